@@ -0,0 +1,408 @@
+/*
+Command rulectl validates, lints and evaluates rule files without a database.
+
+Usage:
+
+	rulectl validate -rules configs/rules.json
+	rulectl lint -rules configs/rules.json [-payload-types configs/payload_types.json]
+	rulectl eval -rules configs/rules.json -event event.json [-policy all-matching]
+	rulectl test [-rules configs/rules.json] rules_test.json...
+
+validate parses the rule file and compiles the condition and action of every
+rule as GRL. lint additionally reports duplicate rule_ids, unknown event types
+and payload fields the event's payload type does not have. eval runs a single
+event against the rules and prints the rules that fired, without persisting
+the event or executing the rule actions. test runs rule test files, see
+package rule_testing for their format, and prints the diffs of failing cases.
+
+rulectl does not know the event types registered by an application, their
+payload types are described in a JSON file mapping each event type to its
+payload fields and their type (string, int, int64, float64, bool or any),
+optionally followed by the JSON key of the field:
+
+	{"disk_space": {"Usage": "int:usage_percentage", "InstanceID": "string:instance_id"}}
+
+Every command registers the event types of the rules and events it reads
+in the EventRegistry of rulectl, the rules and the engine require registered
+event types. The payload of an event type that is not described is decoded
+into a struct with a field per JSON key, lint reports the event types that
+are not described.
+
+rulectl exits with 0 on success, 1 when the rules have problems and 2 on
+invalid usage.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	ruleprocessor "github.com/SMART2016/go-rule-engine/rule-processor"
+	ruletesting "github.com/SMART2016/go-rule-engine/rule-testing"
+	"io"
+	"os"
+)
+
+const (
+	EXIT_OK       = 0
+	EXIT_PROBLEMS = 1
+	EXIT_USAGE    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the rulectl command line and returns its exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return EXIT_USAGE
+	}
+	switch args[0] {
+	case "validate":
+		return runValidate(args[1:], stdout, stderr)
+	case "lint":
+		return runLint(args[1:], stdout, stderr)
+	case "eval":
+		return runEval(args[1:], stdout, stderr)
+	case "test":
+		return runTest(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return EXIT_OK
+	default:
+		fmt.Fprintf(stderr, "rulectl: unknown command %q\n", args[0])
+		usage(stderr)
+		return EXIT_USAGE
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `Usage: rulectl <command> [flags]
+
+Commands:
+  validate  parse the rule file and compile every condition and action as GRL
+  lint      validate and report duplicate rule_ids, unknown event types and unknown payload fields
+  eval      evaluate an event against the rule file and print the rules that fired
+  test      run rule test files and report the failing cases
+
+Run rulectl <command> -h for the flags of a command.`)
+}
+
+// newFlagSet creates the flag set of a command, its errors and help are written to stderr.
+func newFlagSet(name string, stderr io.Writer) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("rulectl "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	rulesPath := flags.String("rules", "configs/rules.json", "path to the rule file")
+	return flags, rulesPath
+}
+
+// parseFlags parses the command flags, returning the exit code to stop with when they are invalid or help was asked.
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK, false
+		}
+		return EXIT_USAGE, false
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "%s: unexpected arguments %v\n", flags.Name(), flags.Args())
+		return EXIT_USAGE, false
+	}
+	return EXIT_OK, true
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags, rulesPath := newFlagSet("validate", stderr)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	tenantRules, err := readRuleFile(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl validate: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	registerRuleEventTypes(tenantRules)
+	if code := printProblems(stdout, ruleprocessor.ValidateTenantRules(tenantRules)); code != EXIT_OK {
+		return code
+	}
+	fmt.Fprintf(stdout, "%s: %d rules are valid\n", *rulesPath, countRules(tenantRules))
+	return EXIT_OK
+}
+
+func runLint(args []string, stdout, stderr io.Writer) int {
+	flags, rulesPath := newFlagSet("lint", stderr)
+	payloadTypesPath := flags.String("payload-types", "", "path to a JSON file describing the payload fields of the event types")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	payloadTypes, err := ruleprocessor.LoadPayloadTypes(*payloadTypesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl lint: %v\n", err)
+		return EXIT_USAGE
+	}
+	tenantRules, err := readRuleFile(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl lint: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	registerRuleEventTypes(tenantRules)
+
+	var problems ruleprocessor.RuleValidationErrors
+	if err := ruleprocessor.ValidateTenantRules(tenantRules); err != nil && !errors.As(err, &problems) {
+		fmt.Fprintf(stderr, "rulectl lint: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	// Duplicate rule_ids and the payload fields of known event types are already reported by the validation.
+	reported := make(map[ruleprocessor.RuleValidationError]bool, len(problems))
+	for _, problem := range problems {
+		reported[problem] = true
+	}
+	for _, problem := range ruleprocessor.LintRules(tenantRules, payloadTypes) {
+		if !reported[problem] {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return printProblems(stdout, problems)
+	}
+	fmt.Fprintf(stdout, "%s: %d rules, no problems found\n", *rulesPath, countRules(tenantRules))
+	return EXIT_OK
+}
+
+func runEval(args []string, stdout, stderr io.Writer) int {
+	flags, rulesPath := newFlagSet("eval", stderr)
+	eventPath := flags.String("event", "", "path to the event JSON, - reads it from stdin")
+	payloadTypesPath := flags.String("payload-types", "", "path to a JSON file describing the payload fields of the event types")
+	policy := flags.String("policy", string(ruleprocessor.MATCH_POLICY_FIRST_MATCH), "match policy, first-match or all-matching")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if *eventPath == "" {
+		fmt.Fprintln(stderr, "rulectl eval: -event is required")
+		return EXIT_USAGE
+	}
+
+	payloadTypes, err := ruleprocessor.LoadPayloadTypes(*payloadTypesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_USAGE
+	}
+	rawEvent, err := readInput(*eventPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_USAGE
+	}
+	registerEventTypes(rawEvent)
+	event, err := ruleprocessor.DecodeEvent(rawEvent, payloadTypes)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_USAGE
+	}
+
+	tenantRules, err := readRuleFile(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	registerRuleEventTypes(tenantRules)
+	repo, err := ruleprocessor.NewJsonRuleRepository(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	if err := ruleprocessor.MatchPolicy(*policy).Validate(); err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_USAGE
+	}
+	cfg := &ruleprocessor.FrameworkConfig{RuleRepoPath: *rulesPath, DefaultMatchPolicy: ruleprocessor.MatchPolicy(*policy)}
+	processor, err := ruleprocessor.NewGRuleProcessor(cfg, ruleprocessor.WithRuleRepository(repo))
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	defer processor.Close()
+
+	// Without duplicate checks the dry run needs no database.
+	result, err := processor.DryRun(context.Background(), event, false)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulectl eval: %v\n", err)
+		return EXIT_PROBLEMS
+	}
+	printResult(stdout, result)
+	return EXIT_OK
+}
+
+func runTest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("rulectl test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	rulesPath := flags.String("rules", "", "path to the rule file to test, overrides the rules of the test files")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "rulectl test: no test file given")
+		return EXIT_USAGE
+	}
+
+	code := EXIT_OK
+	for _, path := range flags.Args() {
+		suite, err := ruletesting.LoadSuite(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "rulectl test: %v\n", err)
+			code = EXIT_PROBLEMS
+			continue
+		}
+		suiteRulesPath := *rulesPath
+		if suiteRulesPath == "" {
+			suiteRulesPath = suite.RulesPath()
+		}
+		if tenantRules, err := readRuleFile(suiteRulesPath); err == nil {
+			registerRuleEventTypes(tenantRules) // Suite.Run reports the rule files it cannot read
+		}
+		for _, testCase := range suite.Cases {
+			registerEventTypes(testCase.Event)
+		}
+		report, err := suite.Run(context.Background(), *rulesPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "rulectl test: %s: %v\n", path, err)
+			code = EXIT_PROBLEMS
+			continue
+		}
+		for _, result := range report.Cases {
+			if result.Passed {
+				fmt.Fprintf(stdout, "PASS %s: %s\n", path, result.Name)
+				continue
+			}
+			fmt.Fprintf(stdout, "FAIL %s: %s\n", path, result.Name)
+			if result.Error != "" {
+				fmt.Fprintf(stdout, "    error: %s\n", result.Error)
+			}
+			for _, diff := range result.Diffs {
+				fmt.Fprintf(stdout, "    %s\n", diff)
+			}
+		}
+		fmt.Fprintf(stdout, "%s: %d passed, %d failed\n", path, report.Passed, report.Failed)
+		if report.Failed > 0 {
+			code = EXIT_PROBLEMS
+		}
+	}
+	return code
+}
+
+// registerEventTypes registers the type of every event the EventRegistry does not know, so the processor accepts them.
+func registerEventTypes(rawEvents ...json.RawMessage) {
+	for _, rawEvent := range rawEvents {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(rawEvent, &event); err == nil {
+			registerEventType(event.Type) // DecodeEvent reports the invalid events
+		}
+	}
+}
+
+// registerRuleEventTypes registers the event types of the rules, and of the sequences of their correlations.
+func registerRuleEventTypes(tenantRules map[string][]models.Rule) {
+	for _, rules := range tenantRules {
+		for _, rule := range rules {
+			registerEventType(rule.EventType)
+			if rule.Correlation != nil {
+				for _, step := range rule.Correlation.Sequence {
+					registerEventType(step.EventType)
+				}
+			}
+		}
+	}
+}
+
+// registerEventType registers an event type without a payload struct unless the EventRegistry knows it.
+func registerEventType(eventType string) {
+	registry := models.GetEventRegistry()
+	if eventType != "" && !registry.IsRegistered(eventType) {
+		registry.RegisterEventType(eventType, func() models.Evaluable { return &models.BaseEvent[any]{} })
+	}
+}
+
+// readRuleFile reads the rules of every tenant from a rule file.
+func readRuleFile(path string) (map[string][]models.Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the rule file: %w", err)
+	}
+	var tenantRules map[string][]models.Rule
+	if err := json.Unmarshal(data, &tenantRules); err != nil {
+		return nil, fmt.Errorf("failed to parse the rule file %s: %w", path, err)
+	}
+	return tenantRules, nil
+}
+
+// readInput reads a file, or stdin when the path is -.
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// printProblems prints every rule problem on its own line and returns the exit code matching them.
+func printProblems(w io.Writer, err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	var problems ruleprocessor.RuleValidationErrors
+	if !errors.As(err, &problems) {
+		fmt.Fprintln(w, err)
+		return EXIT_PROBLEMS
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(w, problem.Error())
+	}
+	fmt.Fprintf(w, "%d problems found\n", len(problems))
+	return EXIT_PROBLEMS
+}
+
+func printResult(w io.Writer, result *models.EvaluationResult) {
+	fmt.Fprintf(w, "tenant: %s, event type: %s, match policy: %s\n", result.TenantID, result.EventType, result.MatchPolicy)
+	if len(result.MatchedRuleIDs) == 0 {
+		fmt.Fprintln(w, "no rule fired")
+	}
+	handled := make(map[string]bool, len(result.HandledRuleIDs))
+	for _, ruleID := range result.HandledRuleIDs {
+		handled[ruleID] = true
+	}
+	for _, ruleID := range result.MatchedRuleIDs {
+		if handled[ruleID] {
+			fmt.Fprintf(w, "fired: %s (handled the event)\n", ruleID)
+		} else {
+			fmt.Fprintf(w, "fired: %s\n", ruleID)
+		}
+	}
+	for _, action := range result.ActionsExecuted {
+		switch {
+		case !action.Skipped || action.Kind == models.ACTION_KIND_PERSIST:
+		case action.Error != "":
+			fmt.Fprintf(w, "action: %s of %s (not executed, %s)\n", action.Kind, action.RuleID, action.Error)
+		default:
+			fmt.Fprintf(w, "action: %s of %s (not executed)\n", action.Kind, action.RuleID)
+		}
+	}
+	fmt.Fprintf(w, "should handle: %t\n", result.ShouldHandle)
+}
+
+func countRules(tenantRules map[string][]models.Rule) int {
+	count := 0
+	for _, rules := range tenantRules {
+		count += len(rules)
+	}
+	return count
+}
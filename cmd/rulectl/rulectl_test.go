@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRules = `{
+  "tenant_default": [
+    {"rule_id": "disk_80", "event_type": "disk_space", "condition": "Payload.Usage >= 80", "action": "Event.ShouldHandle = true", "priority": 1, "actions": [{"kind": "webhook"}]},
+    {"rule_id": "disk_95", "event_type": "disk_space", "condition": "Payload.Usage >= 95", "action": "Event.ShouldHandle = true", "priority": 10}
+  ],
+  "tenant1": [
+    {"rule_id": "cpu_90", "event_type": "cpu", "condition": "Payload.LoadAverage >= 0.9 && Payload.Host == \"db\"", "action": "Event.ShouldHandle = true"}
+  ]
+}`
+
+const testPayloadTypes = `{
+  "disk_space": {"Usage": "int:usage_percentage", "InstanceID": "string:instance_id"},
+  "cpu": {"LoadAverage": "float64", "Host": "string"}
+}`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func runRulectl(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	if code, _, _ := runRulectl(); code != EXIT_USAGE {
+		t.Errorf("no command exit code = %d, want %d", code, EXIT_USAGE)
+	}
+	if code, _, _ := runRulectl("deploy"); code != EXIT_USAGE {
+		t.Errorf("unknown command exit code = %d, want %d", code, EXIT_USAGE)
+	}
+	if code, _, _ := runRulectl("eval", "-rules", writeFile(t, "rules.json", testRules)); code != EXIT_USAGE {
+		t.Errorf("eval without -event exit code = %d, want %d", code, EXIT_USAGE)
+	}
+}
+
+func TestRun_Validate(t *testing.T) {
+	code, stdout, _ := runRulectl("validate", "-rules", writeFile(t, "rules.json", testRules))
+	if code != EXIT_OK || !strings.Contains(stdout, "3 rules are valid") {
+		t.Errorf("validate = %d, %q", code, stdout)
+	}
+
+	broken := strings.Replace(testRules, "Payload.Usage >= 95", "Payload.Usage >=", 1)
+	code, stdout, _ = runRulectl("validate", "-rules", writeFile(t, "rules.json", broken))
+	if code != EXIT_PROBLEMS || !strings.Contains(stdout, "tenant: tenant_default, rule: disk_95, condition 1:") {
+		t.Errorf("validate broken rules = %d, %q", code, stdout)
+	}
+}
+
+func TestRun_Lint(t *testing.T) {
+	rulesPath := writeFile(t, "rules.json", testRules)
+	code, stdout, _ := runRulectl("lint", "-rules", rulesPath)
+	if code != EXIT_PROBLEMS || !strings.Contains(stdout, "unknown event type 'cpu'") {
+		t.Errorf("lint without payload types = %d, %q", code, stdout)
+	}
+
+	payloadTypes := writeFile(t, "payload_types.json", testPayloadTypes)
+	code, stdout, _ = runRulectl("lint", "-rules", rulesPath, "-payload-types", payloadTypes)
+	if code != EXIT_OK {
+		t.Errorf("lint with payload types = %d, %q", code, stdout)
+	}
+
+	payloadTypes = writeFile(t, "payload_types.json", strings.Replace(testPayloadTypes, "LoadAverage", "Load", 1))
+	code, stdout, _ = runRulectl("lint", "-rules", rulesPath, "-payload-types", payloadTypes)
+	if code != EXIT_PROBLEMS || !strings.Contains(stdout, "unknown payload field 'Payload.LoadAverage'") {
+		t.Errorf("lint with an unknown field = %d, %q", code, stdout)
+	}
+
+	duplicated := strings.Replace(testRules, `"rule_id": "disk_95"`, `"rule_id": "disk_80"`, 1)
+	code, stdout, _ = runRulectl("lint", "-rules", writeFile(t, "rules.json", duplicated), "-payload-types", payloadTypes)
+	if code != EXIT_PROBLEMS || strings.Count(stdout, "duplicate rule_id") != 1 {
+		t.Errorf("lint with a duplicate rule_id = %d, %q", code, stdout)
+	}
+}
+
+func TestRun_Eval(t *testing.T) {
+	rulesPath := writeFile(t, "rules.json", testRules)
+
+	event := writeFile(t, "event.json", `{"tenant_id": "tenant1", "type": "disk_space", "payload": {"usage_percentage": 97, "instance_id": "i-1", "disk_size_in_bytes": 10}}`)
+	payloadTypes := writeFile(t, "payload_types.json", testPayloadTypes)
+	code, stdout, stderr := runRulectl("eval", "-rules", rulesPath, "-payload-types", payloadTypes, "-event", event, "-policy", "all-matching")
+	if code != EXIT_OK {
+		t.Fatalf("eval = %d, %s", code, stderr)
+	}
+	for _, want := range []string{"fired: disk_95 (handled the event)", "fired: disk_80 (handled the event)", "action: webhook of disk_80 (not executed", "should handle: true"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("eval output is missing %q:\n%s", want, stdout)
+		}
+	}
+
+	// The payload of an unknown event type is decoded from its JSON keys.
+	event = writeFile(t, "event.json", `{"tenant_id": "tenant1", "type": "cpu", "payload": {"load_average": 0.95, "host": "db"}}`)
+	code, stdout, stderr = runRulectl("eval", "-rules", rulesPath, "-event", event)
+	if code != EXIT_OK || !strings.Contains(stdout, "fired: cpu_90") {
+		t.Errorf("eval of an unknown event type = %d, %q, %s", code, stdout, stderr)
+	}
+
+	event = writeFile(t, "event.json", `{"tenant_id": "tenant1", "type": "cpu", "payload": {"load_average": 0.5, "host": "db"}}`)
+	code, stdout, _ = runRulectl("eval", "-rules", rulesPath, "-event", event)
+	if code != EXIT_OK || !strings.Contains(stdout, "no rule fired") {
+		t.Errorf("eval without a match = %d, %q", code, stdout)
+	}
+}
+
+func TestRun_Test(t *testing.T) {
+	rulesPath := writeFile(t, "rules.json", testRules)
+	payloadTypes := writeFile(t, "payload_types.json", testPayloadTypes)
+	suite := `{"payload_types": "` + payloadTypes + `", "cases": [
+	  {"name": "disk at 97%", "tenant_id": "tenant1", "event": {"type": "disk_space", "payload": {"usage_percentage": 97}}, "expect": {"fired_rule_ids": ["disk_95"]}},
+	  {"name": "disk at 85%", "tenant_id": "tenant1", "event": {"type": "disk_space", "payload": {"usage_percentage": 85}}, "expect": {"fired_rule_ids": ["disk_95"]}}
+	]}`
+	code, stdout, stderr := runRulectl("test", "-rules", rulesPath, writeFile(t, "rules_test.json", suite))
+	if code != EXIT_PROBLEMS {
+		t.Fatalf("test = %d, %s", code, stderr)
+	}
+	for _, want := range []string{"PASS", "disk at 97%", "FAIL", "fired_rule_ids: want [disk_95], got [disk_80]", "1 passed, 1 failed"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("test output is missing %q:\n%s", want, stdout)
+		}
+	}
+	if code, _, _ := runRulectl("test"); code != EXIT_USAGE {
+		t.Errorf("test without files exit code = %d, want %d", code, EXIT_USAGE)
+	}
+}
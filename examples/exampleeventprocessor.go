@@ -14,8 +14,8 @@ import (
 // ExampleRuleProcessor demonstrates how to use the rule processor framework.
 //
 // First, it initializes the framework config using the With* functions.
-// Then, it initializes the rule processor using the NewGRuleProcessor function.
 // Next, it registers an event type with the event registry using the RegisterEventType function.
+// Then, it initializes the rule processor using the NewGRuleProcessor function.
 // After that, it creates a JSON byte slice representing the event payload.
 // Finally, it calls the ProcessEvent function to evaluate the event and trigger an action if needed.
 //
@@ -34,18 +34,22 @@ func ExampleRuleProcessor() {
 		log.Fatalf("Error initializing framework config: %v", err)
 	}
 
-	// Initialize Rule Processor
-	processor, err := ruleprocessor.NewGRuleProcessor(config)
-	if err != nil {
-		log.Fatalf("Error initializing rule processor: %v", err)
-	}
-
 	// Initialize event registry
 	registry := models.GetEventRegistry()
-	// Step 1: Register event types (only once at startup)
+	// Step 1: Register event types (only once at startup, before the rules are loaded so they are validated against the payload types)
 	registry.RegisterEventType("disk_space", func() models.Evaluable {
 		return &events.DiskUsageEvent{} // Correct type
 	})
+	// Reject disk usage events whose payload does not match DiskUsagePayload before any rule sees them
+	if _, err := registry.RegisterGeneratedEventSchema("disk_space"); err != nil {
+		log.Fatalf("Error registering the event schema: %v", err)
+	}
+
+	// Initialize Rule Processor
+	processor, err := ruleprocessor.NewGRuleProcessor(config)
+	if err != nil {
+		log.Fatalf("Error initializing rule processor: %v", err)
+	}
 
 	// Example JSON input for a disk usage event
 	rawJSON := []byte(`{
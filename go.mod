@@ -5,6 +5,7 @@ go 1.23.0
 toolchain go1.23.7
 
 require (
+	github.com/expr-lang/expr v1.17.8
 	github.com/hyperjumptech/grule-rule-engine v1.15.0
 	github.com/jackc/pgx/v5 v5.7.2
 	github.com/sqlc-dev/pqtype v0.3.0
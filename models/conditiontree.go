@@ -0,0 +1,48 @@
+package models
+
+const (
+	// CONDITION_OPERATOR_EQ holds when the field equals the value.
+	CONDITION_OPERATOR_EQ = "eq"
+	// CONDITION_OPERATOR_NE holds when the field differs from the value.
+	CONDITION_OPERATOR_NE = "ne"
+	// CONDITION_OPERATOR_GT holds when the numeric field is greater than the value.
+	CONDITION_OPERATOR_GT = "gt"
+	// CONDITION_OPERATOR_GTE holds when the numeric field is greater than or equal to the value.
+	CONDITION_OPERATOR_GTE = "gte"
+	// CONDITION_OPERATOR_LT holds when the numeric field is less than the value.
+	CONDITION_OPERATOR_LT = "lt"
+	// CONDITION_OPERATOR_LTE holds when the numeric field is less than or equal to the value.
+	CONDITION_OPERATOR_LTE = "lte"
+	// CONDITION_OPERATOR_IN holds when the field equals one of the values of the list.
+	CONDITION_OPERATOR_IN = "in"
+	// CONDITION_OPERATOR_CONTAINS holds when the string field contains the value.
+	CONDITION_OPERATOR_CONTAINS = "contains"
+	// CONDITION_OPERATOR_REGEX holds when the string field matches the regular expression.
+	CONDITION_OPERATOR_REGEX = "regex"
+	// CONDITION_OPERATOR_BETWEEN holds when the numeric field is within the [min, max] list, bounds included.
+	CONDITION_OPERATOR_BETWEEN = "between"
+)
+
+/*
+ConditionNode is a node of a structured rule condition, for rules built by
+a GUI or an API instead of written in a rule language.
+
+A node is either a group or a leaf:
+  - All: holds when every child node holds.
+  - Any: holds when at least one child node holds.
+  - Not: holds when the child node does not hold.
+  - Field, Operator, Value: compares a payload field, named by its JSON key
+    or a dotted path such as "host.name", to the value with one of the
+    CONDITION_OPERATOR_* operators.
+
+e.g. {"all": [{"field": "usage_percentage", "operator": "gte", "value": 80},
+{"not": {"field": "instance_id", "operator": "in", "value": ["db-1", "db-2"]}}]}
+*/
+type ConditionNode struct {
+	All      []ConditionNode `json:"all,omitempty"`
+	Any      []ConditionNode `json:"any,omitempty"`
+	Not      *ConditionNode  `json:"not,omitempty"`
+	Field    string          `json:"field,omitempty"`
+	Operator string          `json:"operator,omitempty"`
+	Value    any             `json:"value,omitempty"`
+}
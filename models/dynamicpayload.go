@@ -0,0 +1,163 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+DynamicPayload is the payload of an event type registered without a Go
+struct, see EventRegistry.RegisterDynamicEventType.
+
+It holds the JSON object of the payload and is exposed to the rules as the
+Payload fact, fields are read with typed accessors taking a key or a dotted
+path into nested objects:
+
+	Payload.GetInt("usage") >= 80 && Payload.Has("instance_id")
+	Payload.GetString("disk.mount") == "/data"
+
+Accessors return the zero value of their type when the field is missing or
+holds another JSON type, rules check Has first when 0 or "" is meaningful.
+*/
+type DynamicPayload struct {
+	raw    json.RawMessage
+	fields map[string]any
+}
+
+/*
+NewDynamicPayload wraps the JSON object of a payload.
+
+Returns:
+  - *DynamicPayload: The payload fact.
+  - error: If the data is not a JSON object.
+*/
+func NewDynamicPayload(data []byte) (*DynamicPayload, error) {
+	payload := &DynamicPayload{}
+	if err := payload.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// UnmarshalJSON keeps the JSON object of the payload, numbers are kept as json.Number so integers do not lose precision.
+func (p *DynamicPayload) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return fmt.Errorf("dynamic payload must be a JSON object: %w", err)
+	}
+	if fields == nil {
+		return errors.New("dynamic payload must be a JSON object, got null")
+	}
+	p.raw = append(json.RawMessage(nil), data...)
+	p.fields = fields
+	return nil
+}
+
+// MarshalJSON returns the JSON object of the payload as received.
+func (p *DynamicPayload) MarshalJSON() ([]byte, error) {
+	if p == nil || p.raw == nil {
+		return []byte("{}"), nil
+	}
+	return p.raw, nil
+}
+
+func (p *DynamicPayload) String() string {
+	data, _ := p.MarshalJSON()
+	return string(data)
+}
+
+// Fields returns the decoded JSON object of the payload.
+func (p *DynamicPayload) Fields() map[string]any {
+	return p.fields
+}
+
+// lookup returns the value at a dotted path.
+func (p *DynamicPayload) lookup(path string) (any, bool) {
+	var current any = p.fields
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Has reports whether the payload has a field at the path, even a null one.
+func (p *DynamicPayload) Has(path string) bool {
+	_, ok := p.lookup(path)
+	return ok
+}
+
+// IsNull reports whether the field at the path is missing or null.
+func (p *DynamicPayload) IsNull(path string) bool {
+	value, _ := p.lookup(path)
+	return value == nil
+}
+
+// GetInt returns the number at the path, truncated to an integer, 0 if it is not a number.
+func (p *DynamicPayload) GetInt(path string) int64 {
+	value, _ := p.lookup(path)
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	f, err := number.Float64()
+	if err != nil || math.IsNaN(f) {
+		return 0
+	}
+	return int64(f)
+}
+
+// GetFloat returns the number at the path, 0 if it is not a number.
+func (p *DynamicPayload) GetFloat(path string) float64 {
+	value, _ := p.lookup(path)
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0
+	}
+	f, _ := number.Float64()
+	return f
+}
+
+// GetString returns the string at the path, "" if it is not a string.
+func (p *DynamicPayload) GetString(path string) string {
+	value, _ := p.lookup(path)
+	s, _ := value.(string)
+	return s
+}
+
+// GetBool returns the boolean at the path, false if it is not a boolean.
+func (p *DynamicPayload) GetBool(path string) bool {
+	value, _ := p.lookup(path)
+	b, _ := value.(bool)
+	return b
+}
+
+// Len returns the length of the array, object or string at the path, 0 for other values.
+func (p *DynamicPayload) Len(path string) int64 {
+	value, _ := p.lookup(path)
+	switch v := value.(type) {
+	case []any:
+		return int64(len(v))
+	case map[string]any:
+		return int64(len(v))
+	case string:
+		return int64(utf8.RuneCountInString(v))
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDynamicPayload_Accessors(t *testing.T) {
+	payload, err := NewDynamicPayload([]byte(`{"usage": 85, "load": 1.5, "big": 9007199254740993, "host": {"name": "db", "up": true}, "mounts": ["/", "/data"], "zone": null}`))
+	if err != nil {
+		t.Fatalf("NewDynamicPayload() error = %v", err)
+	}
+
+	if got := payload.GetInt("usage"); got != 85 {
+		t.Errorf("GetInt(usage) = %d, want 85", got)
+	}
+	if got := payload.GetInt("load"); got != 1 {
+		t.Errorf("GetInt(load) = %d, want 1", got)
+	}
+	if got := payload.GetInt("big"); got != 9007199254740993 {
+		t.Errorf("GetInt(big) = %d, want 9007199254740993", got)
+	}
+	if got := payload.GetFloat("load"); got != 1.5 {
+		t.Errorf("GetFloat(load) = %v, want 1.5", got)
+	}
+	if got := payload.GetString("host.name"); got != "db" {
+		t.Errorf("GetString(host.name) = %q, want db", got)
+	}
+	if !payload.GetBool("host.up") {
+		t.Error("GetBool(host.up) = false, want true")
+	}
+	if got := payload.Len("mounts"); got != 2 {
+		t.Errorf("Len(mounts) = %d, want 2", got)
+	}
+	if !payload.Has("zone") || !payload.IsNull("zone") || payload.Has("host.zone") {
+		t.Error("Has/IsNull do not tell null and missing fields apart")
+	}
+	if payload.GetInt("host.name") != 0 || payload.GetString("usage") != "" || payload.GetInt("usage.value") != 0 {
+		t.Error("accessors of another JSON type do not return the zero value")
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	var received bytes.Buffer
+	if err := json.Compact(&received, []byte(payload.String())); err != nil || string(encoded) != received.String() {
+		t.Errorf("MarshalJSON() = %s, want the payload as received %s", encoded, payload)
+	}
+
+	for _, data := range []string{`[1, 2]`, `null`, `"usage"`, `{`} {
+		if _, err := NewDynamicPayload([]byte(data)); err == nil {
+			t.Errorf("NewDynamicPayload(%s) expected an error", data)
+		}
+	}
+}
+
+func TestRegisterDynamicEventType(t *testing.T) {
+	reg := GetEventRegistry()
+	reg.RegisterDynamicEventType("dynamic_event")
+	if !reg.IsDynamicEventType("dynamic_event") {
+		t.Fatal("IsDynamicEventType(dynamic_event) = false")
+	}
+	reg.RegisterEventType("struct_event", func() Evaluable { return &BaseEvent[TestPayload]{} })
+	if reg.IsDynamicEventType("struct_event") {
+		t.Error("IsDynamicEventType(struct_event) = true for an event type with a payload struct")
+	}
+
+	processor := &MockRuleProcessor2{returnValue: true}
+	if _, err := reg.ProcessEvent(context.Background(), processor, []byte(`{"tenant_id": "tenant1", "type": "dynamic_event", "payload": {"usage": 90}}`)); err != nil {
+		t.Errorf("ProcessEvent() error = %v", err)
+	}
+	if _, err := reg.ProcessEvent(context.Background(), processor, []byte(`{"tenant_id": "tenant1", "type": "dynamic_event", "payload": [90]}`)); err == nil {
+		t.Error("ProcessEvent() expected an error for a payload that is not a JSON object")
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import "time"
+
+const (
+	// ACTION_KIND_GRL is the kind of the action defined in the `then` scope of a rule, the action of a rule in
+	// another language has the kind of its language, e.g. expr.
+	ACTION_KIND_GRL = "grl"
+	// ACTION_KIND_PERSIST is the kind of the action saving the handled event to the event store.
+	ACTION_KIND_PERSIST = "persist"
+	// ACTION_KIND_EMAIL is the kind of the action sending an email notification.
+	ACTION_KIND_EMAIL = "email"
+	// ACTION_KIND_WEBHOOK is the kind of the action calling a webhook.
+	ACTION_KIND_WEBHOOK = "webhook"
+	// ACTION_KIND_LOG is the kind of the action logging the fired rule.
+	ACTION_KIND_LOG = "log"
+)
+
+const (
+	// SCHEDULE_SKIP_INACTIVE is the reason of a rule skipped outside of its active periods or days.
+	SCHEDULE_SKIP_INACTIVE = "inactive"
+	// SCHEDULE_SKIP_BLACKOUT is the reason of a rule skipped during one of its blackout windows.
+	SCHEDULE_SKIP_BLACKOUT = "blackout"
+)
+
+/*
+EvaluationResult describes the outcome of evaluating an event against the
+rules of its tenant.
+
+Fields:
+  - TenantID, EventType, EventSHA: Identify the evaluated event.
+  - MatchedRuleIDs: The rules that fired, in firing order.
+  - HandledByRuleID: The first rule whose action set ShouldHandle, empty if none did.
+  - HandledRuleIDs: Every rule whose action set ShouldHandle, more than one only
+    under the all-matching policy.
+  - MatchPolicy: The match policy the event was evaluated with.
+  - ActiveRevisionID, DefaultRevisionID: The active rule set revisions of the
+    tenant and of the default tenant the rules were read from, 0 when the rule
+    repository is not versioned.
+  - ActionsExecuted: The actions that ran for the fired rules, in a dry run the
+    actions that would have run, marked as skipped.
+  - DedupSkipped: The rules skipped because the event was a duplicate for them.
+  - ScheduleSkipped: The rules skipped because their schedule was not active
+    when the event occurred.
+  - Windows: The sliding windows the aggregation rules allowed to fire were
+    evaluated against, the event included.
+  - Correlations: The partial matches of the correlation rules the event
+    advanced or completed.
+  - ShouldHandle: The final ShouldHandle state of the event.
+  - RuleTimings: Time spent on each rule.
+  - Timings: Time spent on each step of the evaluation.
+  - DryRun: The event was evaluated without persisting it or dispatching actions.
+*/
+type EvaluationResult struct {
+	TenantID          string              `json:"tenant_id"`
+	EventType         string              `json:"event_type"`
+	EventSHA          string              `json:"event_sha,omitempty"`
+	MatchedRuleIDs    []string            `json:"matched_rule_ids"`
+	HandledByRuleID   string              `json:"handled_by_rule_id,omitempty"`
+	HandledRuleIDs    []string            `json:"handled_rule_ids"`
+	MatchPolicy       string              `json:"match_policy,omitempty"`
+	ActiveRevisionID  int64               `json:"active_revision_id,omitempty"`
+	DefaultRevisionID int64               `json:"default_revision_id,omitempty"`
+	ActionsExecuted   []ActionResult      `json:"actions_executed"`
+	DedupSkipped      []DedupSkip         `json:"dedup_skipped"`
+	ScheduleSkipped   []ScheduleSkip      `json:"schedule_skipped,omitempty"`
+	Windows           []AggregationWindow `json:"windows,omitempty"`
+	Correlations      []CorrelationMatch  `json:"correlations,omitempty"`
+	ShouldHandle      bool                `json:"should_handle"`
+	RuleTimings       []RuleTiming        `json:"rule_timings"`
+	Timings           StepTimings         `json:"timings"`
+	DryRun            bool                `json:"dry_run,omitempty"`
+}
+
+// ActionResult records an action executed for a fired rule.
+type ActionResult struct {
+	RuleID  string `json:"rule_id"`
+	Kind    string `json:"kind"`
+	Error   string `json:"error,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"` // The action would have run but was not executed, see EvaluationResult.DryRun
+}
+
+// DedupSkip records a rule skipped because the event was already processed for it.
+type DedupSkip struct {
+	RuleID   string `json:"rule_id"`
+	EventSHA string `json:"event_sha"`
+}
+
+// ScheduleSkip records a rule skipped because it was not active when the event occurred.
+type ScheduleSkip struct {
+	RuleID string `json:"rule_id"`
+	Reason string `json:"reason"`           // SCHEDULE_SKIP_INACTIVE or SCHEDULE_SKIP_BLACKOUT
+	Detail string `json:"detail,omitempty"` // The blackout window or the local time outside of the active periods
+}
+
+// RuleTiming records the time spent on a single rule.
+type RuleTiming struct {
+	RuleID     string        `json:"rule_id"`
+	DedupCheck time.Duration `json:"dedup_check"`
+	Execution  time.Duration `json:"execution"`
+}
+
+// StepTimings records the time spent on each step of an evaluation.
+type StepTimings struct {
+	RuleLookup  time.Duration `json:"rule_lookup"`
+	Compilation time.Duration `json:"compilation"`
+	DedupCheck  time.Duration `json:"dedup_check"`
+	Aggregation time.Duration `json:"aggregation"`
+	Correlation time.Duration `json:"correlation"`
+	Execution   time.Duration `json:"execution"`
+	Persistence time.Duration `json:"persistence"`
+	Total       time.Duration `json:"total"`
+}
+
+// NewEvaluationResult creates an empty EvaluationResult for the given event.
+func NewEvaluationResult(event BaseEvent[any]) *EvaluationResult {
+	return &EvaluationResult{
+		TenantID:     event.TenantID,
+		EventType:    event.Type,
+		EventSHA:     event.EventSHA,
+		ShouldHandle: event.ShouldHandle,
+	}
+}
+
+// Handled reports whether a rule handled the event.
+func (r *EvaluationResult) Handled() bool {
+	return r != nil && r.HandledByRuleID != ""
+}
+
+// RuleTiming returns the timing entry of a rule, creating it if needed.
+func (r *EvaluationResult) RuleTiming(ruleID string) *RuleTiming {
+	for i := range r.RuleTimings {
+		if r.RuleTimings[i].RuleID == ruleID {
+			return &r.RuleTimings[i]
+		}
+	}
+	r.RuleTimings = append(r.RuleTimings, RuleTiming{RuleID: ruleID})
+	return &r.RuleTimings[len(r.RuleTimings)-1]
+}
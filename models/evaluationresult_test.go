@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewEvaluationResult(t *testing.T) {
+	event := BaseEvent[any]{TenantID: "tenant1", Type: "test_event", EventSHA: "abc", ShouldHandle: true}
+
+	result := NewEvaluationResult(event)
+	if result.TenantID != "tenant1" || result.EventType != "test_event" || result.EventSHA != "abc" {
+		t.Errorf("NewEvaluationResult() = %+v, want the event identity", result)
+	}
+	if !result.ShouldHandle {
+		t.Error("NewEvaluationResult() did not copy ShouldHandle")
+	}
+	if result.Handled() {
+		t.Error("Handled() = true for a result no rule handled")
+	}
+
+	result.HandledByRuleID = "rule1"
+	if !result.Handled() {
+		t.Error("Handled() = false for a result handled by rule1")
+	}
+
+	var nilResult *EvaluationResult
+	if nilResult.Handled() {
+		t.Error("Handled() = true for a nil result")
+	}
+}
+
+func TestEvaluationResult_RuleTiming(t *testing.T) {
+	result := &EvaluationResult{}
+
+	result.RuleTiming("rule1").DedupCheck = time.Millisecond
+	result.RuleTiming("rule2").Execution = 2 * time.Millisecond
+	result.RuleTiming("rule1").Execution = 3 * time.Millisecond
+
+	if len(result.RuleTimings) != 2 {
+		t.Fatalf("RuleTimings = %+v, want 2 entries", result.RuleTimings)
+	}
+	if got := result.RuleTimings[0]; got.RuleID != "rule1" || got.DedupCheck != time.Millisecond || got.Execution != 3*time.Millisecond {
+		t.Errorf("RuleTimings[0] = %+v", got)
+	}
+}
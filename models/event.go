@@ -16,6 +16,15 @@ type RuleProcessor interface {
 	Evaluate(ctx context.Context, event BaseEvent[any]) (bool, error)
 }
 
+// ResultEvaluator is a RuleProcessor that also reports the detailed EvaluationResult of an event.
+type ResultEvaluator interface {
+	RuleProcessor
+
+	// EvaluateWithResult evaluates the event like Evaluate and returns the
+	// detailed EvaluationResult.
+	EvaluateWithResult(ctx context.Context, event BaseEvent[any]) (*EvaluationResult, error)
+}
+
 // Evaluable ensures all events implement `Evaluate`
 type Evaluable interface {
 	Evaluate(ctx context.Context, processor RuleProcessor) (bool, error)
@@ -43,14 +52,19 @@ type BaseEvent[T any] struct {
 }
 
 func (e *BaseEvent[T]) Evaluate(ctx context.Context, processor RuleProcessor) (bool, error) {
+	return processor.Evaluate(ctx, e.toAny())
+}
 
-	return processor.Evaluate(ctx, BaseEvent[any]{
+// toAny converts the event to the BaseEvent[any] evaluated by a RuleProcessor, keeping every header field.
+func (e *BaseEvent[T]) toAny() BaseEvent[any] {
+	return BaseEvent[any]{
 		TenantID:     e.TenantID,
 		Type:         e.Type,
 		Payload:      e.Payload, // Convert to `any`
 		ShouldHandle: e.ShouldHandle,
 		EventSHA:     e.EventSHA,
-	})
+		OccuredAt:    e.OccuredAt,
+	}
 }
 
 // Validate checks required fields
@@ -69,9 +83,7 @@ func (e *BaseEvent[T]) Validate() error {
 		}
 	case any: // Ensures it's a struct
 		// ✅ Check if the event type is registered inside this block
-		eventRegistry := GetEventRegistry() // Get the global registry instance
-		_, registered := eventRegistry.GetRegistry()[e.Type]
-		if !registered {
+		if !GetEventRegistry().IsRegistered(e.Type) {
 			return fmt.Errorf("event type '%s' is not registered in EventRegistry", e.Type)
 		}
 	default:
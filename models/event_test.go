@@ -17,6 +17,15 @@ func (m *MockRuleProcessor2) Evaluate(ctx context.Context, event BaseEvent[any])
 	return m.returnValue, m.returnError
 }
 
+func (m *MockRuleProcessor2) EvaluateWithResult(ctx context.Context, event BaseEvent[any]) (*EvaluationResult, error) {
+	m.evaluateCalled = true
+	result := NewEvaluationResult(event)
+	if m.returnValue {
+		result.HandledByRuleID = "mock_rule"
+	}
+	return result, m.returnError
+}
+
 type TestPayload struct {
 	Field1 string `json:"field1"`
 	Field2 int    `json:"field2"`
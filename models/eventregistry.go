@@ -5,30 +5,197 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 )
 
-// EventRegistry stores event constructors dynamically.
+/*
+EventRegistry stores event constructors dynamically.
+
+The payload type of an event type is derived from the Payload field of the
+event its constructor creates, e.g. DiskUsagePayload for an event embedding
+BaseEvent[DiskUsagePayload]. Rules are validated against it.
+*/
 type EventRegistry struct {
+	mu                sync.RWMutex
 	eventConstructors map[string]func() Evaluable
+	payloadTypes      map[string]reflect.Type
+	schemas           map[string]*JSONSchema
 }
 
 // Global registry instance.
 var registry = &EventRegistry{
 	eventConstructors: make(map[string]func() Evaluable),
+	payloadTypes:      make(map[string]reflect.Type),
+	schemas:           make(map[string]*JSONSchema),
 }
 
 func GetEventRegistry() *EventRegistry {
 	return registry
 }
 
-// RegisterEventType registers an event type with a constructor function.
+// GetRegistry returns a copy of the constructors of the registered event types, taken under the registry lock.
 func (er *EventRegistry) GetRegistry() map[string]func() Evaluable {
-	return registry.eventConstructors
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	constructors := make(map[string]func() Evaluable, len(er.eventConstructors))
+	for eventType, constructor := range er.eventConstructors {
+		constructors[eventType] = constructor
+	}
+	return constructors
+}
+
+// IsRegistered reports whether a constructor is registered for the event type.
+func (er *EventRegistry) IsRegistered(eventType string) bool {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	_, ok := er.eventConstructors[eventType]
+	return ok
 }
 
-// RegisterEventType registers an event type with a constructor function.
+// RegisterEventType registers an event type with a constructor function and records the type of its payload.
 func (er *EventRegistry) RegisterEventType(eventType string, constructor func() Evaluable) {
+	payloadType, hasPayloadType := eventPayloadType(constructor())
+
+	er.mu.Lock()
+	defer er.mu.Unlock()
 	er.eventConstructors[eventType] = constructor
+	if hasPayloadType {
+		er.payloadTypes[eventType] = payloadType
+	} else {
+		delete(er.payloadTypes, eventType)
+	}
+}
+
+/*
+RegisterDynamicEventType registers an event type without a Go struct, its
+JSON payload is exposed to the rules as a DynamicPayload read with typed
+accessors such as Payload.GetInt("usage") and Payload.Has("x"). Event types
+can then be added by configuration, without a code release.
+*/
+func (er *EventRegistry) RegisterDynamicEventType(eventType string) {
+	er.RegisterEventType(eventType, func() Evaluable { return &BaseEvent[*DynamicPayload]{} })
+}
+
+// IsDynamicEventType reports whether an event type was registered with RegisterDynamicEventType.
+func (er *EventRegistry) IsDynamicEventType(eventType string) bool {
+	payloadType, ok := er.PayloadType(eventType)
+	return ok && payloadType == reflect.TypeOf(DynamicPayload{})
+}
+
+// PayloadType returns the payload struct of a registered event type, false if it has none.
+func (er *EventRegistry) PayloadType(eventType string) (reflect.Type, bool) {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	payloadType, ok := er.payloadTypes[eventType]
+	return payloadType, ok
+}
+
+// PayloadTypes returns the payload struct of every registered event type that has one.
+func (er *EventRegistry) PayloadTypes() map[string]reflect.Type {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	payloadTypes := make(map[string]reflect.Type, len(er.payloadTypes))
+	for eventType, payloadType := range er.payloadTypes {
+		payloadTypes[eventType] = payloadType
+	}
+	return payloadTypes
+}
+
+/*
+RegisterEventSchema registers the JSON Schema the payload of an event type
+must match. ProcessEvent validates the raw payload against it before the
+event is decoded, so a malformed payload is rejected with field-level
+errors instead of reaching the rules with zero values.
+
+The schema is either written by hand and parsed with ParseJSONSchema, or
+generated from the payload struct with RegisterGeneratedEventSchema.
+Registering a nil schema removes the schema of the event type.
+*/
+func (er *EventRegistry) RegisterEventSchema(eventType string, schema *JSONSchema) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	if schema == nil {
+		delete(er.schemas, eventType)
+		return
+	}
+	er.schemas[eventType] = schema
+}
+
+/*
+RegisterGeneratedEventSchema registers the schema generated by
+GenerateJSONSchema from the payload struct of a registered event type.
+
+Returns:
+  - *JSONSchema: The generated schema.
+  - error: If the event type is not registered or has no payload struct.
+*/
+func (er *EventRegistry) RegisterGeneratedEventSchema(eventType string) (*JSONSchema, error) {
+	payloadType, ok := er.PayloadType(eventType)
+	if !ok {
+		return nil, fmt.Errorf("event type '%s' has no registered payload struct", eventType)
+	}
+	schema := GenerateJSONSchema(payloadType)
+	er.RegisterEventSchema(eventType, schema)
+	return schema, nil
+}
+
+// EventSchema returns the JSON Schema registered for the payload of an event type, false if it has none.
+func (er *EventRegistry) EventSchema(eventType string) (*JSONSchema, bool) {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	schema, ok := er.schemas[eventType]
+	return schema, ok
+}
+
+/*
+ValidatePayload validates the raw payload of an event against the schema of
+its event type, event types without a schema accept any payload.
+
+Returns:
+  - error: SchemaValidationErrors with a FieldError per violation, nil if the payload is valid.
+*/
+func (er *EventRegistry) ValidatePayload(eventType string, payload json.RawMessage) error {
+	schema, ok := er.EventSchema(eventType)
+	if !ok {
+		return nil
+	}
+	if len(payload) == 0 {
+		return SchemaValidationErrors{{Field: "payload", Message: "is required"}}
+	}
+	if errs := schema.Validate(payload, "payload"); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+/*
+eventPayloadType returns the type of the Payload field of an event, which
+may be promoted from an embedded BaseEvent.
+
+Events without a Payload field, or whose payload is not a struct (such as
+BaseEvent[any] or a JSON string), have no payload type.
+*/
+func eventPayloadType(event Evaluable) (reflect.Type, bool) {
+	eventType := reflect.TypeOf(event)
+	for eventType != nil && eventType.Kind() == reflect.Pointer {
+		eventType = eventType.Elem()
+	}
+	if eventType == nil || eventType.Kind() != reflect.Struct {
+		return nil, false
+	}
+	field, ok := eventType.FieldByName("Payload")
+	if !ok {
+		return nil, false
+	}
+	payloadType := field.Type
+	for payloadType.Kind() == reflect.Pointer {
+		payloadType = payloadType.Elem()
+	}
+	if payloadType.Kind() != reflect.Struct {
+		return nil, false
+	}
+	return payloadType, true
 }
 
 /*
@@ -45,37 +212,110 @@ Returns:
   - bool - Indicates whether the event was handled successfully.
   - error - Contains any error encountered during processing or evaluation of the event.
 
+When a JSON Schema is registered for the event type, the payload is validated
+against it first and SchemaValidationErrors is returned for a malformed payload.
+
 NOTE: the consumer needs to handle the error and make sure the event that caused error while processing is
 either logged properly or pushed into a dead letter queue.
 */
 func (er *EventRegistry) ProcessEvent(ctx context.Context, processor RuleProcessor, rawJSON []byte) (bool, error) {
+	eventInstance, err := er.decodeEvent(rawJSON)
+	if err != nil {
+		return false, err
+	}
+	// Step 7: Evaluate the event.
+	return eventInstance.Evaluate(ctx, processor)
+}
+
+/*
+ProcessEventWithResult works like ProcessEvent but returns the detailed
+EvaluationResult of the rule processor instead of a bare bool.
+
+The registered events keep calling RuleProcessor.Evaluate, the result of a
+processor implementing ResultEvaluator is captured by wrapping it so existing
+event types need no changes. If the processor does not report results or the
+event never reaches it, a result only carrying the handled state is returned.
+*/
+func (er *EventRegistry) ProcessEventWithResult(ctx context.Context, processor RuleProcessor, rawJSON []byte) (*EvaluationResult, error) {
+	eventInstance, err := er.decodeEvent(rawJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	resultEvaluator, ok := processor.(ResultEvaluator)
+	if !ok {
+		handled, err := eventInstance.Evaluate(ctx, processor)
+		if err != nil {
+			return nil, err
+		}
+		return &EvaluationResult{ShouldHandle: handled}, nil
+	}
+	capturing := &resultCapturingProcessor{processor: resultEvaluator}
+	handled, err := eventInstance.Evaluate(ctx, capturing)
+	if err != nil {
+		return capturing.result, err
+	}
+	if capturing.result == nil {
+		return &EvaluationResult{ShouldHandle: handled}, nil
+	}
+	return capturing.result, nil
+}
+
+// decodeEvent detects the event type from raw JSON data and constructs the corresponding event.
+func (er *EventRegistry) decodeEvent(rawJSON []byte) (Evaluable, error) {
 	// Step 1: Decode the event to extract the type field.
-	var temp map[string]interface{}
+	var temp map[string]json.RawMessage
 	err := json.Unmarshal(rawJSON, &temp)
 	if err != nil {
-		return false, errors.New("failed to parse event JSON")
+		return nil, errors.New("failed to parse event JSON")
 	}
 
 	// Step 2: Extract the event type.
-	eventType, ok := temp["type"].(string)
-	if !ok {
-		return false, errors.New("missing or invalid event type")
+	var eventType *string
+	if err := json.Unmarshal(temp["type"], &eventType); err != nil || eventType == nil {
+		return nil, errors.New("missing or invalid event type")
 	}
 
 	// Step 3: Look up the registered event constructor.
-	constructor, found := registry.eventConstructors[eventType]
+	er.mu.RLock()
+	constructor, found := er.eventConstructors[*eventType]
+	er.mu.RUnlock()
 	if !found {
-		return false, fmt.Errorf("event type '%s' not registered", eventType)
+		return nil, fmt.Errorf("event type '%s' not registered", *eventType)
 	}
 
-	// Step 4: Create a new event instance using the constructor.
+	// Step 4: Validate the raw payload against the schema of the event type.
+	if err := er.ValidatePayload(*eventType, temp["payload"]); err != nil {
+		return nil, err
+	}
+
+	// Step 5: Create a new event instance using the constructor.
 	eventInstance := constructor()
 
-	// Step 5: Unmarshal JSON into the specific event struct.
+	// Step 6: Unmarshal JSON into the specific event struct.
 	err = json.Unmarshal(rawJSON, eventInstance)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse event payload: %v", err)
+		return nil, fmt.Errorf("failed to parse event payload: %v", err)
 	}
-	// Step 6: Evaluate the event.
-	return eventInstance.Evaluate(ctx, processor)
+	return eventInstance, nil
+}
+
+// resultCapturingProcessor keeps the EvaluationResult of the last event evaluated through it.
+type resultCapturingProcessor struct {
+	processor ResultEvaluator
+	result    *EvaluationResult
+}
+
+func (p *resultCapturingProcessor) Evaluate(ctx context.Context, event BaseEvent[any]) (bool, error) {
+	result, err := p.EvaluateWithResult(ctx, event)
+	if err != nil {
+		return false, err
+	}
+	return result.Handled(), nil
+}
+
+func (p *resultCapturingProcessor) EvaluateWithResult(ctx context.Context, event BaseEvent[any]) (*EvaluationResult, error) {
+	result, err := p.processor.EvaluateWithResult(ctx, event)
+	p.result = result
+	return result, err
 }
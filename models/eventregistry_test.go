@@ -2,6 +2,8 @@ package models
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -61,6 +63,15 @@ func TestGetRegistry(t *testing.T) {
 	if _, exists := registry["test_event"]; !exists {
 		t.Error("Expected registered event type not found in registry")
 	}
+
+	// The returned map is a copy, changing it does not register an event type.
+	registry["test_unregistered"] = constructor
+	if reg.IsRegistered("test_unregistered") {
+		t.Error("GetRegistry() returned the internal map of the registry")
+	}
+	if !reg.IsRegistered("test_event") {
+		t.Error("IsRegistered(test_event) = false")
+	}
 }
 
 func TestProcessEvent(t *testing.T) {
@@ -128,3 +139,131 @@ func TestProcessEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessEventWithResult(t *testing.T) {
+	reg := GetEventRegistry()
+	reg.RegisterEventType("result_event", func() Evaluable {
+		return &BaseEvent[TestPayload]{}
+	})
+
+	processor := &MockRuleProcessor2{returnValue: true}
+	result, err := reg.ProcessEventWithResult(context.Background(), processor,
+		[]byte(`{"type": "result_event", "tenant_id": "tenant1", "payload": {"field1": "a", "field2": 1}}`))
+	if err != nil {
+		t.Fatalf("ProcessEventWithResult() error = %v", err)
+	}
+	if !processor.evaluateCalled {
+		t.Error("ProcessEventWithResult() did not call the rule processor")
+	}
+	if !result.Handled() || result.HandledByRuleID != "mock_rule" {
+		t.Errorf("ProcessEventWithResult() result = %+v, want handled by mock_rule", result)
+	}
+	if result.TenantID != "tenant1" || result.EventType != "result_event" {
+		t.Errorf("ProcessEventWithResult() result = %+v, want tenant1/result_event", result)
+	}
+
+	if _, err := reg.ProcessEventWithResult(context.Background(), processor, []byte(`{"type": "unknown_event"}`)); err == nil {
+		t.Error("ProcessEventWithResult() expected error for unregistered event type")
+	}
+}
+
+func TestProcessEventWithResult_WithoutResultEvaluator(t *testing.T) {
+	reg := GetEventRegistry()
+	reg.RegisterEventType("bool_result_event", func() Evaluable {
+		return &MockEvaluable{
+			EvaluateFunc: func(ctx context.Context, processor RuleProcessor) (bool, error) {
+				return processor.Evaluate(ctx, BaseEvent[any]{})
+			},
+		}
+	})
+
+	processor := &boolRuleProcessor{handled: true}
+	result, err := reg.ProcessEventWithResult(context.Background(), processor, []byte(`{"type": "bool_result_event"}`))
+	if err != nil {
+		t.Fatalf("ProcessEventWithResult() error = %v", err)
+	}
+	if !result.ShouldHandle {
+		t.Errorf("ProcessEventWithResult() result = %+v, want the handled state of Evaluate", result)
+	}
+}
+
+// boolRuleProcessor is a RuleProcessor that does not implement ResultEvaluator.
+type boolRuleProcessor struct {
+	handled bool
+}
+
+func (p *boolRuleProcessor) Evaluate(ctx context.Context, event BaseEvent[any]) (bool, error) {
+	return p.handled, nil
+}
+
+type testDiskPayload struct {
+	Usage int `json:"usage_percentage"`
+}
+
+type testDiskEvent struct {
+	BaseEvent[testDiskPayload]
+}
+
+func TestRegisterEventType_PayloadType(t *testing.T) {
+	reg := GetEventRegistry()
+	reg.RegisterEventType("test_disk", func() Evaluable { return &testDiskEvent{} })
+	reg.RegisterEventType("test_pointer", func() Evaluable { return &BaseEvent[*testDiskPayload]{} })
+	reg.RegisterEventType("test_any", func() Evaluable { return &BaseEvent[any]{} })
+	reg.RegisterEventType("test_mock", func() Evaluable { return &MockEvaluable{} })
+
+	for _, eventType := range []string{"test_disk", "test_pointer"} {
+		if payloadType, ok := reg.PayloadType(eventType); !ok || payloadType != reflect.TypeOf(testDiskPayload{}) {
+			t.Errorf("PayloadType(%s) = %v, %v, want testDiskPayload", eventType, payloadType, ok)
+		}
+	}
+	for _, eventType := range []string{"test_any", "test_mock"} {
+		if payloadType, ok := reg.PayloadType(eventType); ok {
+			t.Errorf("PayloadType(%s) = %v, want none", eventType, payloadType)
+		}
+	}
+	if _, ok := reg.PayloadTypes()["test_disk"]; !ok {
+		t.Error("PayloadTypes() is missing test_disk")
+	}
+
+	// Registering the event type again replaces its payload type.
+	reg.RegisterEventType("test_disk", func() Evaluable { return &BaseEvent[any]{} })
+	if _, ok := reg.PayloadType("test_disk"); ok {
+		t.Error("PayloadType(test_disk) kept the payload type of the replaced constructor")
+	}
+}
+
+func TestProcessEvent_Schema(t *testing.T) {
+	reg := GetEventRegistry()
+	reg.RegisterEventType("schema_disk", func() Evaluable { return &testDiskEvent{} })
+	if _, err := reg.RegisterGeneratedEventSchema("schema_disk"); err != nil {
+		t.Fatalf("RegisterGeneratedEventSchema() error = %v", err)
+	}
+	defer reg.RegisterEventSchema("schema_disk", nil)
+
+	processor := &MockRuleProcessor2{returnValue: true}
+	_, err := reg.ProcessEvent(context.Background(), processor, []byte(`{"type": "schema_disk", "payload": {"usage": 90}}`))
+	var schemaErrs SchemaValidationErrors
+	if !errors.As(err, &schemaErrs) {
+		t.Fatalf("ProcessEvent() error = %v, want SchemaValidationErrors", err)
+	}
+	if want := (SchemaValidationErrors{{Field: "payload.usage_percentage", Message: "is required"}}); !reflect.DeepEqual(schemaErrs, want) {
+		t.Errorf("ProcessEvent() errors = %v, want %v", schemaErrs, want)
+	}
+	if processor.evaluateCalled {
+		t.Error("ProcessEvent() evaluated an event that does not match its schema")
+	}
+
+	if _, err := reg.ProcessEvent(context.Background(), processor, []byte(`{"type": "schema_disk"}`)); !errors.As(err, &schemaErrs) {
+		t.Errorf("ProcessEvent() error = %v, want SchemaValidationErrors for a missing payload", err)
+	}
+
+	handled, err := reg.ProcessEvent(context.Background(), processor, []byte(`{"type": "schema_disk", "payload": {"usage_percentage": 90}}`))
+	if err != nil || !handled {
+		t.Errorf("ProcessEvent() = %v, %v, want a handled valid event", handled, err)
+	}
+
+	reg.RegisterEventType("schema_any", func() Evaluable { return &BaseEvent[any]{} })
+	if _, err := reg.RegisterGeneratedEventSchema("schema_any"); err == nil {
+		t.Error("RegisterGeneratedEventSchema() expected an error for an event type without a payload struct")
+	}
+}
@@ -0,0 +1,338 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	JSON_SCHEMA_TYPE_OBJECT  = "object"
+	JSON_SCHEMA_TYPE_ARRAY   = "array"
+	JSON_SCHEMA_TYPE_STRING  = "string"
+	JSON_SCHEMA_TYPE_INTEGER = "integer"
+	JSON_SCHEMA_TYPE_NUMBER  = "number"
+	JSON_SCHEMA_TYPE_BOOLEAN = "boolean"
+	JSON_SCHEMA_TYPE_NULL    = "null"
+)
+
+/*
+JSONSchema is the subset of JSON Schema used to validate event payloads.
+
+Supported keywords are type, properties, required, additionalProperties
+(as a boolean), items, enum, minimum, maximum, minLength, maxLength and
+pattern. Other keywords are ignored, as JSON Schema validators do with
+unknown keywords.
+*/
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// FieldError is a schema violation of a single field, Field is its path in the event, e.g. payload.usage_percentage.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// SchemaValidationErrors lists every field of an event violating the schema of its event type.
+type SchemaValidationErrors []FieldError
+
+func (e SchemaValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "event does not match its schema: " + strings.Join(messages, "; ")
+}
+
+/*
+ParseJSONSchema parses a hand written JSON Schema.
+
+Returns an error if the document is not a JSON Schema, uses an unknown type
+or an invalid pattern.
+*/
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	var schema JSONSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+	if err := schema.compile(""); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// compile checks the schema and compiles its patterns.
+func (s *JSONSchema) compile(path string) error {
+	switch s.Type {
+	case "", JSON_SCHEMA_TYPE_OBJECT, JSON_SCHEMA_TYPE_ARRAY, JSON_SCHEMA_TYPE_STRING, JSON_SCHEMA_TYPE_INTEGER,
+		JSON_SCHEMA_TYPE_NUMBER, JSON_SCHEMA_TYPE_BOOLEAN, JSON_SCHEMA_TYPE_NULL:
+	default:
+		return fmt.Errorf("invalid JSON schema at %s: unknown type '%s'", schemaPath(path), s.Type)
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid JSON schema at %s: %w", schemaPath(path), err)
+		}
+		s.pattern = pattern
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("invalid JSON schema at %s: empty property", schemaPath(joinPath(path, name)))
+		}
+		if err := property.compile(joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+/*
+Validate checks a JSON document against the schema.
+
+Parameters:
+  - data: []byte - The JSON document.
+  - path: string - The path of the document reported in the errors, e.g. payload.
+
+Returns:
+  - SchemaValidationErrors: Every violation, ordered by field, nil if the document is valid.
+*/
+func (s *JSONSchema) Validate(data []byte, path string) SchemaValidationErrors {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return SchemaValidationErrors{{Field: schemaPath(path), Message: "invalid JSON: " + err.Error()}}
+	}
+	var errs SchemaValidationErrors
+	s.validate(value, path, &errs)
+	return errs
+}
+
+func (s *JSONSchema) validate(value any, path string, errs *SchemaValidationErrors) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: schemaPath(path), Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && jsonType(value, s.Type) != s.Type {
+		fail("expected %s, got %s", s.Type, jsonType(value, s.Type))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		fail("must be one of %s", formatEnum(s.Enum))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Field: schemaPath(joinPath(path, name)), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			switch {
+			case ok:
+				property.validate(v[name], joinPath(path, name), errs)
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				*errs = append(*errs, FieldError{Field: schemaPath(joinPath(path, name)), Message: "is not allowed"})
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match the pattern %s", s.Pattern)
+		}
+	case json.Number:
+		number, _ := v.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			fail("must be greater than or equal to %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			fail("must be less than or equal to %v", *s.Maximum)
+		}
+	}
+}
+
+// jsonType returns the JSON Schema type of a decoded value, numbers are integers when the expected type is integer and they are integral.
+func jsonType(value any, expected string) string {
+	switch v := value.(type) {
+	case nil:
+		return JSON_SCHEMA_TYPE_NULL
+	case bool:
+		return JSON_SCHEMA_TYPE_BOOLEAN
+	case string:
+		return JSON_SCHEMA_TYPE_STRING
+	case []any:
+		return JSON_SCHEMA_TYPE_ARRAY
+	case map[string]any:
+		return JSON_SCHEMA_TYPE_OBJECT
+	case json.Number:
+		number, err := v.Float64()
+		if expected == JSON_SCHEMA_TYPE_NUMBER || err != nil || number != math.Trunc(number) {
+			return JSON_SCHEMA_TYPE_NUMBER
+		}
+		return JSON_SCHEMA_TYPE_INTEGER
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, allowed := range enum {
+		if number, ok := value.(json.Number); ok {
+			if allowedNumber, ok := allowed.(float64); ok {
+				if f, err := number.Float64(); err == nil && f == allowedNumber {
+					return true
+				}
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		encoded, _ := json.Marshal(value)
+		values[i] = string(encoded)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func schemaPath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return path
+}
+
+/*
+GenerateJSONSchema generates the JSON Schema of a Go payload struct.
+
+Fields are named after their json tag. Every field is required unless it is
+a pointer or tagged omitempty, so a payload missing a field is rejected
+instead of reaching the rules with its zero value. Unsigned integers have a
+minimum of 0.
+*/
+func GenerateJSONSchema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_STRING}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		schema := &JSONSchema{Type: JSON_SCHEMA_TYPE_OBJECT, Properties: make(map[string]*JSONSchema)}
+		addStructFields(schema, t)
+		return schema
+	case reflect.Map:
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_OBJECT}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: JSON_SCHEMA_TYPE_STRING}
+		}
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_ARRAY, Items: GenerateJSONSchema(t.Elem())}
+	case reflect.String:
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_STRING}
+	case reflect.Bool:
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_BOOLEAN}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_INTEGER}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := 0.0
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_INTEGER, Minimum: &minimum}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: JSON_SCHEMA_TYPE_NUMBER}
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// addStructFields adds the properties of the exported fields of a struct, flattening embedded structs like encoding/json.
+func addStructFields(schema *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addStructFields(schema, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = GenerateJSONSchema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
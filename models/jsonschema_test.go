@@ -0,0 +1,127 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaHost struct {
+	Name string `json:"name"`
+}
+
+type schemaPayload struct {
+	schemaHost
+	Usage     int               `json:"usage_percentage"`
+	Load      float64           `json:"load"`
+	Cores     uint              `json:"cores"`
+	Tags      []string          `json:"tags,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Region    *string           `json:"region"`
+	Seen      time.Time         `json:"seen"`
+	Internal  string            `json:"-"`
+	unexposed int
+}
+
+func TestGenerateJSONSchema(t *testing.T) {
+	schema := GenerateJSONSchema(reflect.TypeOf(&schemaPayload{}))
+
+	if want := []string{"name", "usage_percentage", "load", "cores", "seen"}; !reflect.DeepEqual(schema.Required, want) {
+		t.Errorf("Required = %v, want %v", schema.Required, want)
+	}
+	wantTypes := map[string]string{
+		"name": "string", "usage_percentage": "integer", "load": "number", "cores": "integer",
+		"tags": "array", "labels": "object", "region": "string", "seen": "string",
+	}
+	if len(schema.Properties) != len(wantTypes) {
+		t.Errorf("Properties = %v, want %d properties", schema.Properties, len(wantTypes))
+	}
+	for name, wantType := range wantTypes {
+		if property, ok := schema.Properties[name]; !ok || property.Type != wantType {
+			t.Errorf("property %s = %+v, want type %s", name, property, wantType)
+		}
+	}
+	if minimum := schema.Properties["cores"].Minimum; minimum == nil || *minimum != 0 {
+		t.Error("unsigned field cores has no minimum of 0")
+	}
+}
+
+func TestJSONSchema_Validate(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+	  "type": "object",
+	  "required": ["usage_percentage", "instance_id"],
+	  "additionalProperties": false,
+	  "properties": {
+	    "usage_percentage": {"type": "integer", "minimum": 0, "maximum": 100},
+	    "instance_id": {"type": "string", "pattern": "^i-[0-9a-f]+$", "maxLength": 12},
+	    "state": {"enum": ["ok", "degraded", 3]},
+	    "mounts": {"type": "array", "items": {"type": "string", "minLength": 1}}
+	  }
+	}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    SchemaValidationErrors
+	}{
+		{
+			name:    "valid payload",
+			payload: `{"usage_percentage": 85, "instance_id": "i-0abc", "state": 3, "mounts": ["/", "/data"]}`,
+		},
+		{
+			name:    "missing fields",
+			payload: `{}`,
+			want: SchemaValidationErrors{
+				{Field: "payload.usage_percentage", Message: "is required"},
+				{Field: "payload.instance_id", Message: "is required"},
+			},
+		},
+		{
+			name:    "invalid values",
+			payload: `{"usage_percentage": 120.5, "instance_id": "host-1", "state": "down", "mounts": [""], "extra": true}`,
+			want: SchemaValidationErrors{
+				{Field: "payload.extra", Message: "is not allowed"},
+				{Field: "payload.instance_id", Message: "must match the pattern ^i-[0-9a-f]+$"},
+				{Field: "payload.mounts[0]", Message: "must be at least 1 characters long"},
+				{Field: "payload.state", Message: `must be one of ["ok", "degraded", 3]`},
+				{Field: "payload.usage_percentage", Message: "expected integer, got number"},
+			},
+		},
+		{
+			name:    "out of range",
+			payload: `{"usage_percentage": 101, "instance_id": "i-0123456789ab"}`,
+			want: SchemaValidationErrors{
+				{Field: "payload.instance_id", Message: "must be at most 12 characters long"},
+				{Field: "payload.usage_percentage", Message: "must be less than or equal to 100"},
+			},
+		},
+		{
+			name:    "wrong type",
+			payload: `[]`,
+			want:    SchemaValidationErrors{{Field: "payload", Message: "expected object, got array"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schema.Validate([]byte(tt.payload), "payload"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONSchema_Errors(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "decimal"}`,
+		`{"properties": {"id": {"pattern": "("}}}`,
+		`{"properties": {"id": null}}`,
+		`[]`,
+	} {
+		if _, err := ParseJSONSchema([]byte(schema)); err == nil {
+			t.Errorf("ParseJSONSchema(%s) expected an error", schema)
+		}
+	}
+}
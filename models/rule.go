@@ -2,20 +2,67 @@ package models
 
 import "time"
 
+const (
+	// RULE_LANGUAGE_GRL is the language of rules written in the Grule Rule Language, the default.
+	RULE_LANGUAGE_GRL = "grl"
+	// RULE_LANGUAGE_EXPR is the language of rules written in expr, see github.com/expr-lang/expr.
+	RULE_LANGUAGE_EXPR = "expr"
+)
+
 type Rule struct {
-	RuleId                  string        `json:"rule_id"`
-	EventType               string        `json:"event_type"`
-	Condition               string        `json:"condition"`     // Expression evaluated by grule
-	Action                  string        `json:"action"`        // Defines what to do when condition is met
-	SendEmail               bool          `json:"send_email"`    // Whether to send an email
-	Deduplication           bool          `json:"deduplication"` // Whether to deduplicate events
-	DedupWindow             time.Duration `json:"dedup_window"`  // Time window for deduplication (x hours)
-	PayloadFields           []string      `json:"payload_fields"`
-	IncludeRuleIdInDedupKey bool          `json:"include_rule_id_in_dedup_key"` // Whether to include rule id in dedup key
+	RuleId                  string           `json:"rule_id"`
+	EventType               string           `json:"event_type"`
+	Language                string           `json:"language,omitempty"`       // Language of the condition and action, grl by default
+	Condition               string           `json:"condition"`                // Expression evaluated by the evaluator of the language
+	ConditionTree           *ConditionNode   `json:"condition_tree,omitempty"` // Structured condition compiled to the language, instead of Condition
+	Action                  string           `json:"action"`                   // Defines what to do when condition is met
+	SendEmail               bool             `json:"send_email"`               // Whether to send an email
+	Deduplication           bool             `json:"deduplication"`            // Whether to deduplicate events
+	DedupWindow             time.Duration    `json:"dedup_window"`             // Time window for deduplication (x hours)
+	PayloadFields           []string         `json:"payload_fields"`
+	IncludeRuleIdInDedupKey bool             `json:"include_rule_id_in_dedup_key"` // Whether to include rule id in dedup key
+	Priority                int              `json:"priority"`                     // Salience of the rule, higher priorities fire first
+	Actions                 []RuleAction     `json:"actions,omitempty"`            // Actions dispatched when the rule fires
+	Disabled                bool             `json:"disabled,omitempty"`           // Disables an inherited default rule for the tenant
+	Schedule                *RuleSchedule    `json:"schedule,omitempty"`           // When the rule may fire, always when nil
+	Aggregation             *RuleAggregation `json:"aggregation,omitempty"`        // Sliding window of events exposed to the rule as Window
+	Correlation             *RuleCorrelation `json:"correlation,omitempty"`        // Sequence of events the event of the rule must follow
+}
+
+// EffectiveLanguage returns the language of the condition and action of the rule, GRL when none is set.
+func (r Rule) EffectiveLanguage() string {
+	if r.Language == "" {
+		return RULE_LANGUAGE_GRL
+	}
+	return r.Language
+}
+
+// AppliesTo reports whether events of the event type are evaluated against the rule, as its event or an event of its sequence.
+func (r Rule) AppliesTo(eventType string) bool {
+	return r.EventType == eventType || r.Correlation.HasEventType(eventType)
+}
+
+// RuleAction declares an action dispatched when a rule fires.
+type RuleAction struct {
+	Kind   string         `json:"kind"`             // Kind of the action handler, e.g. email, webhook, log or a custom kind
+	Params map[string]any `json:"params,omitempty"` // Handler specific parameters
 }
 
-// RuleSet represents a set of rules for a tenant.
-type RuleSet map[string]Rule
+/*
+EffectiveActions returns the actions to dispatch when the rule fires.
 
-// RuleConfig represents all rules for all tenants.
-type RuleConfig map[string]RuleSet
+SendEmail is kept for backwards compatibility, a rule with send_email set
+and no email action declared dispatches an email action without parameters.
+*/
+func (r Rule) EffectiveActions() []RuleAction {
+	actions := append([]RuleAction(nil), r.Actions...)
+	if !r.SendEmail {
+		return actions
+	}
+	for _, action := range actions {
+		if action.Kind == ACTION_KIND_EMAIL {
+			return actions
+		}
+	}
+	return append(actions, RuleAction{Kind: ACTION_KIND_EMAIL})
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRule_EffectiveActions(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want []RuleAction
+	}{
+		{
+			name: "no actions",
+			rule: Rule{},
+			want: nil,
+		},
+		{
+			name: "send_email adds an email action",
+			rule: Rule{SendEmail: true, Actions: []RuleAction{{Kind: ACTION_KIND_LOG}}},
+			want: []RuleAction{{Kind: ACTION_KIND_LOG}, {Kind: ACTION_KIND_EMAIL}},
+		},
+		{
+			name: "declared email action is not duplicated",
+			rule: Rule{SendEmail: true, Actions: []RuleAction{{Kind: ACTION_KIND_EMAIL, Params: map[string]any{"to": "ops"}}}},
+			want: []RuleAction{{Kind: ACTION_KIND_EMAIL, Params: map[string]any{"to": "ops"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.EffectiveActions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rule.EffectiveActions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRule_AppliesTo(t *testing.T) {
+	rule := Rule{EventType: "service_crash", Correlation: &RuleCorrelation{
+		Within:   "10m",
+		Sequence: []CorrelationStep{{EventType: "disk_space"}},
+	}}
+	for eventType, want := range map[string]bool{"service_crash": true, "disk_space": true, "login_failure": false} {
+		if got := rule.AppliesTo(eventType); got != want {
+			t.Errorf("Rule.AppliesTo(%q) = %t, want %t", eventType, got, want)
+		}
+	}
+	if (Rule{EventType: "disk_space"}).AppliesTo("service_crash") {
+		t.Error("Rule.AppliesTo() = true for another event type of a rule without correlation")
+	}
+}
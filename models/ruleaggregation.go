@@ -0,0 +1,136 @@
+package models
+
+import (
+	"math"
+	"reflect"
+)
+
+/*
+RuleAggregation turns a rule into an aggregation rule, evaluated against a
+sliding window of the events of its event type rather than a single event.
+
+Every event of the event type is recorded in the window of its group, the
+window then exposes the events it holds, the current one included, to the
+condition and action of the rule as the Window fact, see AggregationWindow:
+
+	Window.CountAtLeast(80) >= 3    at least 3 of the events had a value >= 80
+	Window.Count > 10               more than 10 events in the window
+
+Fields:
+  - GroupBy: The payload field keying the windows, e.g. instance_id for a
+    window per instance, a single window per tenant and event type when empty.
+  - Field: The numeric payload field aggregated by the window, e.g.
+    usage_percentage, events are only counted when empty.
+  - Size: The window holds the last Size events, e.g. 5.
+  - Duration: The window holds the events that occurred within the duration
+    before the event, e.g. "15m", in the format of time.ParseDuration.
+
+At least one of Size and Duration is required, with both the window holds
+the last Size events within the duration.
+*/
+type RuleAggregation struct {
+	GroupBy  string `json:"group_by,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Size     int    `json:"size,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+/*
+AggregationWindow is the sliding window of an aggregation rule for the event
+being evaluated, exposed to the rule as the Window fact.
+
+Fields:
+  - RuleID: The aggregation rule the window belongs to.
+  - Key: The value of the group_by field of the event, empty without group_by.
+  - Count: The number of events in the window, the current one included.
+  - Sum, Avg, Min, Max: The sum, average, minimum and maximum of the values of
+    the aggregated field of the events in the window, 0 when it is empty.
+  - Values: The values of the aggregated field, most recent first.
+*/
+type AggregationWindow struct {
+	RuleID string    `json:"rule_id"`
+	Key    string    `json:"key,omitempty"`
+	Count  int64     `json:"count"`
+	Sum    float64   `json:"sum"`
+	Avg    float64   `json:"avg"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Values []float64 `json:"values,omitempty"`
+}
+
+// NewAggregationWindow creates the window of a rule holding the given values, most recent first.
+func NewAggregationWindow(ruleID, key string, values []float64) *AggregationWindow {
+	window := &AggregationWindow{RuleID: ruleID, Key: key, Count: int64(len(values)), Values: values}
+	for i, value := range values {
+		window.Sum += value
+		if i == 0 || value < window.Min {
+			window.Min = value
+		}
+		if i == 0 || value > window.Max {
+			window.Max = value
+		}
+	}
+	if window.Count > 0 {
+		window.Avg = window.Sum / float64(window.Count)
+	}
+	return window
+}
+
+// CountAbove returns the number of events in the window whose value is greater than the threshold.
+func (w *AggregationWindow) CountAbove(threshold any) int64 {
+	limit := windowNumber(threshold)
+	return w.countWhere(func(value float64) bool { return value > limit })
+}
+
+// CountAtLeast returns the number of events in the window whose value is greater than or equal to the threshold.
+func (w *AggregationWindow) CountAtLeast(threshold any) int64 {
+	limit := windowNumber(threshold)
+	return w.countWhere(func(value float64) bool { return value >= limit })
+}
+
+// CountBelow returns the number of events in the window whose value is less than the threshold.
+func (w *AggregationWindow) CountBelow(threshold any) int64 {
+	limit := windowNumber(threshold)
+	return w.countWhere(func(value float64) bool { return value < limit })
+}
+
+// CountAtMost returns the number of events in the window whose value is less than or equal to the threshold.
+func (w *AggregationWindow) CountAtMost(threshold any) int64 {
+	limit := windowNumber(threshold)
+	return w.countWhere(func(value float64) bool { return value <= limit })
+}
+
+// CountEqual returns the number of events in the window whose value equals the given one.
+func (w *AggregationWindow) CountEqual(value any) int64 {
+	number := windowNumber(value)
+	return w.countWhere(func(v float64) bool { return v == number })
+}
+
+/*
+windowNumber converts the argument of a Count method to a float64, the rule
+languages pass integer literals as int64 and others as float64. Values that
+are not numbers are NaN, matching no value.
+*/
+func windowNumber(value any) float64 {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		return math.NaN()
+	}
+}
+
+func (w *AggregationWindow) countWhere(match func(value float64) bool) int64 {
+	var count int64
+	for _, value := range w.Values {
+		if match(value) {
+			count++
+		}
+	}
+	return count
+}
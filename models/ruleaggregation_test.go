@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestNewAggregationWindow(t *testing.T) {
+	window := NewAggregationWindow("disk_sustained", "i-1", []float64{95, 50, 85, 80, 40})
+	if window.Count != 5 || window.Sum != 350 || window.Avg != 70 || window.Min != 40 || window.Max != 95 {
+		t.Errorf("NewAggregationWindow() = %+v, want count 5, sum 350, avg 70, min 40 and max 95", window)
+	}
+	for _, tt := range []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"CountAbove(80)", window.CountAbove(80), 2},
+		{"CountAtLeast(80)", window.CountAtLeast(80), 3},
+		{"CountBelow(80)", window.CountBelow(80), 2},
+		{"CountAtMost(80)", window.CountAtMost(80), 3},
+		{"CountEqual(50)", window.CountEqual(50), 1},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	empty := NewAggregationWindow("disk_sustained", "", nil)
+	if empty.Count != 0 || empty.Avg != 0 || empty.Min != 0 || empty.Max != 0 || empty.CountAtLeast(0) != 0 {
+		t.Errorf("NewAggregationWindow() of no values = %+v, want an empty window", empty)
+	}
+}
+
+func TestAggregationWindow_CountArguments(t *testing.T) {
+	window := NewAggregationWindow("disk_sustained", "", []float64{79.5, 80, 80.5})
+	for _, threshold := range []any{int64(80), 80, float64(80), float32(80), uint(80)} {
+		if got := window.CountAtLeast(threshold); got != 2 {
+			t.Errorf("CountAtLeast(%T) = %d, want 2", threshold, got)
+		}
+	}
+	if got := window.CountAtLeast("80"); got != 0 {
+		t.Errorf("CountAtLeast(string) = %d, want 0", got)
+	}
+}
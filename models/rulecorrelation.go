@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+/*
+RuleCorrelation turns a rule into a correlation rule, firing when its event
+completes a sequence of events joined on a key rather than on a single event,
+e.g. a service_crash following a disk_space over 90% on the same instance
+within 10 minutes:
+
+	"event_type": "service_crash",
+	"correlation": {
+	  "join_on": "instance_id",
+	  "within": "10m",
+	  "sequence": [{"event_type": "disk_space", "condition": "Payload.UsagePercentage > 90"}]
+	}
+
+The events of the sequence advance a partial match kept in the state store
+per rule and join key, it expires once Within elapsed since its first event.
+The event of the rule completes the partial match, the rule may then fire
+and the partial match is consumed when it does, so the rule fires once per
+completed sequence.
+
+Fields:
+  - JoinOn: The payload field the events of a sequence share, e.g.
+    instance_id, every event of the tenant joins when empty.
+  - Within: The time from the first event of the sequence within which the
+    event of the rule must arrive, e.g. "10m", in the format of
+    time.ParseDuration.
+  - Sequence: The events that must precede the event of the rule, in order.
+*/
+type RuleCorrelation struct {
+	JoinOn   string            `json:"join_on,omitempty"`
+	Within   string            `json:"within"`
+	Sequence []CorrelationStep `json:"sequence"`
+}
+
+// CorrelationStep is an event of the sequence of a correlation rule.
+type CorrelationStep struct {
+	EventType string `json:"event_type"`          // Event type of the event
+	Condition string `json:"condition,omitempty"` // Condition on the Event and Payload in the language of the rule, any event of the type when empty
+}
+
+// HasEventType reports whether an event of the sequence has the given event type.
+func (c *RuleCorrelation) HasEventType(eventType string) bool {
+	if c == nil {
+		return false
+	}
+	for _, step := range c.Sequence {
+		if step.EventType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+CorrelationMatch records a partial match of the sequence of a correlation
+rule advanced or completed by the event.
+
+Fields:
+  - RuleID: The correlation rule.
+  - Key: The value of the join_on field of the event, empty without join_on.
+  - Step: The number of events of the sequence matched.
+  - StartedAt: The time the first event of the sequence occurred.
+  - Completed: The event is the event of the rule and completed the
+    sequence, the rule was allowed to fire.
+*/
+type CorrelationMatch struct {
+	RuleID    string    `json:"rule_id"`
+	Key       string    `json:"key,omitempty"`
+	Step      int       `json:"step"`
+	StartedAt time.Time `json:"started_at"`
+	Completed bool      `json:"completed,omitempty"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+/*
+RuleSchedule restricts when a rule may fire. A rule without schedule is
+always active.
+
+Times are read in the timezone of the tenant, see
+FrameworkConfig.TenantTimezones, at the time the event occurred, or the time
+of the evaluation when the event has no occured_at.
+
+Fields:
+  - Active: Cron-like expressions of the minutes the rule is active,
+    "minute hour day-of-month month day-of-week", e.g. "* 9-16 * * mon-fri"
+    for business hours. The rule is active when any of them matches, always
+    when there is none.
+  - Days: The days of the week the rule is active, e.g. ["sat", "sun"], every
+    day when empty.
+  - Blackouts: Explicit windows during which the rule is inactive, e.g. a
+    maintenance window, whatever its active periods.
+*/
+type RuleSchedule struct {
+	Active    []string         `json:"active,omitempty"`
+	Days      []string         `json:"days,omitempty"`
+	Blackouts []BlackoutWindow `json:"blackouts,omitempty"`
+}
+
+// BlackoutWindow is a period during which a rule does not fire, from Start included to End excluded.
+type BlackoutWindow struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason,omitempty"` // Why the rule is off, reported with the skipped rule
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+/*
+RuleSetRevision is an immutable revision of the rule set of a tenant.
+
+Revisions are never modified once created, changing the rules of a tenant
+creates a new revision that is then activated. Active tells whether the
+revision is the one currently in use for the tenant.
+*/
+type RuleSetRevision struct {
+	ID        int64     `json:"id"`
+	TenantID  string    `json:"tenant_id"`
+	Rules     []Rule    `json:"rules"`
+	Author    string    `json:"author"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+	Active    bool      `json:"active"`
+}
+
+/*
+ActiveRevisions identifies the rule set revisions the rules of a tenant were
+read from: the tenant's own revision and the tenant_default revision
+its rules are layered on. An ID is 0 when there is no active revision.
+*/
+type ActiveRevisions struct {
+	TenantRevisionID  int64 `json:"tenant_revision_id,omitempty"`
+	DefaultRevisionID int64 `json:"default_revision_id,omitempty"`
+}
@@ -0,0 +1,239 @@
+/*
+Package rule_api provides an HTTP API to manage the rules of the tenants.
+
+The API is backed by any rule_processor.WritableRuleRepository, such as the
+JSON rule file or the Postgres rule repository:
+
+  - GET    /tenants/{tenantID}/rules?event_type=     lists the tenant's own rules
+  - POST   /tenants/{tenantID}/rules                 creates a rule
+  - POST   /tenants/{tenantID}/rules/validate        validates a rule without saving it
+  - GET    /tenants/{tenantID}/rules/{ruleID}        gets a rule
+  - PUT    /tenants/{tenantID}/rules/{ruleID}        updates a rule
+  - DELETE /tenants/{tenantID}/rules/{ruleID}        deletes a rule
+  - GET    /tenants/{tenantID}/effective-rules?event_type=
+    returns the tenant's rules layered on top of the default rules
+
+Creating a rule whose rule_id the tenant already has is rejected with 409
+Conflict and updating a rule it does not have with 404 Not Found, both are
+checked atomically by the repository. Invalid rules are rejected with 422
+Unprocessable Entity and the list of RuleValidationErrors, GRL syntax errors
+are located in the condition or action of the rule.
+*/
+package rule_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	ruleprocessor "github.com/SMART2016/go-rule-engine/rule-processor"
+	"log"
+	"net/http"
+)
+
+const (
+	// MAX_REQUEST_BODY_BYTES limits the size of the rules sent to the API.
+	MAX_REQUEST_BODY_BYTES = 1 << 20
+)
+
+// ErrorResponse is the body of every failed request.
+type ErrorResponse struct {
+	Error            string                              `json:"error"`
+	ValidationErrors []ruleprocessor.RuleValidationError `json:"validation_errors,omitempty"`
+}
+
+// RulesResponse is the body of the rule listing endpoints.
+type RulesResponse struct {
+	TenantID  string        `json:"tenant_id"`
+	EventType string        `json:"event_type,omitempty"`
+	Rules     []models.Rule `json:"rules"`
+}
+
+// ValidationResponse is the body of the validate endpoint.
+type ValidationResponse struct {
+	Valid            bool                                `json:"valid"`
+	ValidationErrors []ruleprocessor.RuleValidationError `json:"validation_errors,omitempty"`
+}
+
+// Server is the http.Handler of the rule management API.
+type Server struct {
+	repo       ruleprocessor.WritableRuleRepository
+	evaluators []ruleprocessor.Evaluator
+	mux        *http.ServeMux
+}
+
+/*
+NewServer creates the rule management API on top of a writable rule
+repository.
+
+Parameters:
+  - repo: ruleprocessor.WritableRuleRepository - The repository the rules are read from and written to.
+  - evaluators: ...ruleprocessor.Evaluator - The evaluators of rule languages other than grl and expr, the
+    validate endpoint checks the rules with them, see ruleprocessor.ValidateRule.
+
+Returns:
+  - *Server: An http.Handler serving the API, see the package documentation for the routes.
+*/
+func NewServer(repo ruleprocessor.WritableRuleRepository, evaluators ...ruleprocessor.Evaluator) *Server {
+	s := &Server{repo: repo, evaluators: evaluators, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /tenants/{tenantID}/rules", s.listRules)
+	s.mux.HandleFunc("POST /tenants/{tenantID}/rules", s.createRule)
+	s.mux.HandleFunc("POST /tenants/{tenantID}/rules/validate", s.validateRule)
+	s.mux.HandleFunc("GET /tenants/{tenantID}/rules/{ruleID}", s.getRule)
+	s.mux.HandleFunc("PUT /tenants/{tenantID}/rules/{ruleID}", s.updateRule)
+	s.mux.HandleFunc("DELETE /tenants/{tenantID}/rules/{ruleID}", s.deleteRule)
+	s.mux.HandleFunc("GET /tenants/{tenantID}/effective-rules", s.effectiveRules)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) listRules(w http.ResponseWriter, r *http.Request) {
+	tenantID, eventType := r.PathValue("tenantID"), r.URL.Query().Get("event_type")
+	rules, err := s.repo.GetTenantRules(tenantID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RulesResponse{TenantID: tenantID, EventType: eventType, Rules: filterByEventType(rules, eventType)})
+}
+
+func (s *Server) effectiveRules(w http.ResponseWriter, r *http.Request) {
+	tenantID, eventType := r.PathValue("tenantID"), r.URL.Query().Get("event_type")
+	rules, err := s.repo.GetEffectiveRules(tenantID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RulesResponse{TenantID: tenantID, EventType: eventType, Rules: filterByEventType(rules, eventType)})
+}
+
+func (s *Server) getRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := s.findRule(r.PathValue("tenantID"), r.PathValue("ruleID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) createRule(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenantID")
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	if err := s.repo.CreateRule(r.Context(), tenantID, rule); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) updateRule(w http.ResponseWriter, r *http.Request) {
+	tenantID, ruleID := r.PathValue("tenantID"), r.PathValue("ruleID")
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	if rule.RuleId == "" {
+		rule.RuleId = ruleID
+	}
+	if rule.RuleId != ruleID {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("rule_id %s does not match the path rule_id %s", rule.RuleId, ruleID)})
+		return
+	}
+	if err := s.repo.UpdateRule(r.Context(), tenantID, rule); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request) {
+	if err := s.repo.DeleteRule(r.Context(), r.PathValue("tenantID"), r.PathValue("ruleID")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) validateRule(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenantID")
+	rule, ok := decodeRule(w, r)
+	if !ok {
+		return
+	}
+	errs := ruleprocessor.ValidateRule(rule, s.evaluators...)
+	for i := range errs {
+		errs[i].TenantID = tenantID
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, ValidationResponse{Valid: false, ValidationErrors: errs})
+		return
+	}
+	writeJSON(w, http.StatusOK, ValidationResponse{Valid: true})
+}
+
+// findRule returns the rule stored for the tenant itself, ErrRuleNotFound if there is none.
+func (s *Server) findRule(tenantID, ruleID string) (models.Rule, error) {
+	rules, err := s.repo.GetTenantRules(tenantID)
+	if err != nil {
+		return models.Rule{}, err
+	}
+	for _, rule := range rules {
+		if rule.RuleId == ruleID {
+			return rule, nil
+		}
+	}
+	return models.Rule{}, fmt.Errorf("tenant: %s, rule: %s: %w", tenantID, ruleID, ruleprocessor.ErrRuleNotFound)
+}
+
+// decodeRule reads the rule from the request body, writing a 400 response if it is not a valid rule document.
+func decodeRule(w http.ResponseWriter, r *http.Request) (models.Rule, bool) {
+	var rule models.Rule
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_BODY_BYTES))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid rule: " + err.Error()})
+		return models.Rule{}, false
+	}
+	return rule, true
+}
+
+// filterByEventType keeps the rules of the event type, all rules when it is empty.
+func filterByEventType(rules []models.Rule, eventType string) []models.Rule {
+	filtered := make([]models.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if eventType == "" || rule.EventType == eventType {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
+
+// writeError maps repository errors to their status code.
+func writeError(w http.ResponseWriter, err error) {
+	var validationErrs ruleprocessor.RuleValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse{Error: "invalid rule", ValidationErrors: validationErrs})
+	case errors.Is(err, ruleprocessor.ErrRuleNotFound):
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, ruleprocessor.ErrRuleExists):
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("[rule_api.Server]: %v", err)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("[rule_api.Server]: failed to write the response: %v", err)
+	}
+}
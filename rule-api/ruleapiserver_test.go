@@ -0,0 +1,237 @@
+package rule_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+	ruleprocessor "github.com/SMART2016/go-rule-engine/rule-processor"
+)
+
+const testRules = `{
+  "tenant_default": [
+    {"rule_id": "disk_80", "event_type": "disk_space", "condition": "Payload.Usage >= 80", "action": "Event.ShouldHandle = true"},
+    {"rule_id": "cpu_90", "event_type": "cpu", "condition": "Payload.Usage >= 90", "action": "Event.ShouldHandle = true"}
+  ],
+  "tenant1": [
+    {"rule_id": "disk_50", "event_type": "disk_space", "condition": "Payload.Usage >= 50", "action": "Event.ShouldHandle = true"}
+  ]
+}`
+
+func init() {
+	for _, eventType := range []string{"disk_space", "cpu"} {
+		models.GetEventRegistry().RegisterEventType(eventType, func() models.Evaluable { return &models.BaseEvent[any]{} })
+	}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(testRules), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	repo, err := ruleprocessor.NewJsonRuleRepository(path)
+	if err != nil {
+		t.Fatalf("NewJsonRuleRepository() error = %v", err)
+	}
+	server := httptest.NewServer(NewServer(repo))
+	t.Cleanup(server.Close)
+	return server, path
+}
+
+// do sends the request and decodes the JSON response into out when it is not nil.
+func do(t *testing.T, method, url string, body any, out any) int {
+	t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode %s %s response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func ruleIDs(rules []models.Rule) []string {
+	ids := make([]string, len(rules))
+	for i, rule := range rules {
+		ids[i] = rule.RuleId
+	}
+	return ids
+}
+
+func TestServer_ListAndEffectiveRules(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var listed RulesResponse
+	if status := do(t, http.MethodGet, server.URL+"/tenants/tenant1/rules", nil, &listed); status != http.StatusOK {
+		t.Fatalf("list status = %d", status)
+	}
+	if ids := ruleIDs(listed.Rules); len(ids) != 1 || ids[0] != "disk_50" {
+		t.Errorf("listed rules = %v", ids)
+	}
+
+	var effective RulesResponse
+	if status := do(t, http.MethodGet, server.URL+"/tenants/tenant1/effective-rules?event_type=disk_space", nil, &effective); status != http.StatusOK {
+		t.Fatalf("effective status = %d", status)
+	}
+	if ids := ruleIDs(effective.Rules); len(ids) != 2 || ids[0] != "disk_80" || ids[1] != "disk_50" {
+		t.Errorf("effective rules = %v", ids)
+	}
+
+	var defaults RulesResponse
+	do(t, http.MethodGet, server.URL+"/tenants/tenant_default/rules?event_type=cpu", nil, &defaults)
+	if ids := ruleIDs(defaults.Rules); len(ids) != 1 || ids[0] != "cpu_90" {
+		t.Errorf("default cpu rules = %v", ids)
+	}
+}
+
+func TestServer_RuleLifecycle(t *testing.T) {
+	server, path := newTestServer(t)
+	rule := models.Rule{RuleId: "disk_95", EventType: "disk_space", Condition: "Payload.Usage >= 95", Action: "Event.ShouldHandle = true", Priority: 5}
+
+	var created models.Rule
+	if status := do(t, http.MethodPost, server.URL+"/tenants/tenant1/rules", rule, &created); status != http.StatusCreated {
+		t.Fatalf("create status = %d", status)
+	}
+	if status := do(t, http.MethodPost, server.URL+"/tenants/tenant1/rules", rule, nil); status != http.StatusConflict {
+		t.Errorf("duplicate create status = %d, want 409", status)
+	}
+
+	var fetched models.Rule
+	if status := do(t, http.MethodGet, server.URL+"/tenants/tenant1/rules/disk_95", nil, &fetched); status != http.StatusOK || fetched.Priority != 5 {
+		t.Errorf("get = %d, %+v", status, fetched)
+	}
+
+	rule.Priority = 7
+	if status := do(t, http.MethodPut, server.URL+"/tenants/tenant1/rules/disk_95", rule, nil); status != http.StatusOK {
+		t.Errorf("update status = %d", status)
+	}
+	if status := do(t, http.MethodPut, server.URL+"/tenants/tenant1/rules/disk_99", rule, nil); status != http.StatusBadRequest {
+		t.Errorf("mismatched update status = %d, want 400", status)
+	}
+	missing := rule
+	missing.RuleId = "disk_99"
+	if status := do(t, http.MethodPut, server.URL+"/tenants/tenant1/rules/disk_99", missing, nil); status != http.StatusNotFound {
+		t.Errorf("update of a missing rule status = %d, want 404", status)
+	}
+
+	// The rule file holds the change, so a new repository sees it.
+	repo, err := ruleprocessor.NewJsonRuleRepository(path)
+	if err != nil {
+		t.Fatalf("NewJsonRuleRepository() error = %v", err)
+	}
+	stored, _ := repo.GetTenantRules("tenant1")
+	if len(stored) != 2 || stored[1].Priority != 7 {
+		t.Errorf("stored rules = %+v", stored)
+	}
+
+	if status := do(t, http.MethodDelete, server.URL+"/tenants/tenant1/rules/disk_95", nil, nil); status != http.StatusNoContent {
+		t.Errorf("delete status = %d", status)
+	}
+	if status := do(t, http.MethodDelete, server.URL+"/tenants/tenant1/rules/disk_95", nil, nil); status != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", status)
+	}
+	if status := do(t, http.MethodGet, server.URL+"/tenants/tenant1/rules/disk_95", nil, nil); status != http.StatusNotFound {
+		t.Errorf("get of a deleted rule status = %d, want 404", status)
+	}
+}
+
+func TestServer_ConcurrentCreate(t *testing.T) {
+	server, _ := newTestServer(t)
+	body := `{"rule_id": "disk_90", "event_type": "disk_space", "condition": "Payload.Usage >= 90", "action": "Event.ShouldHandle = true"}`
+
+	const requests = 8
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(server.URL+"/tenants/tenant1/rules", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Errorf("POST error = %v", err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != requests-1 {
+		t.Errorf("statuses = %v, want one 201 and %d 409", counts, requests-1)
+	}
+}
+
+func TestServer_ValidationErrors(t *testing.T) {
+	server, _ := newTestServer(t)
+	invalid := models.Rule{RuleId: "disk_95", EventType: "disk_space", Condition: "Payload.Usage >=", Action: "Event.ShouldHandle = true"}
+
+	var validation ValidationResponse
+	if status := do(t, http.MethodPost, server.URL+"/tenants/tenant1/rules/validate", invalid, &validation); status != http.StatusUnprocessableEntity {
+		t.Fatalf("validate status = %d, want 422", status)
+	}
+	if validation.Valid || len(validation.ValidationErrors) == 0 {
+		t.Fatalf("validation = %+v", validation)
+	}
+	first := validation.ValidationErrors[0]
+	if first.TenantID != "tenant1" || first.RuleID != "disk_95" || first.Field != ruleprocessor.RULE_FIELD_CONDITION || first.Line != 1 {
+		t.Errorf("validation error = %+v", first)
+	}
+
+	valid := invalid
+	valid.Condition = "Payload.Usage >= 95"
+	if status := do(t, http.MethodPost, server.URL+"/tenants/tenant1/rules/validate", valid, &validation); status != http.StatusOK || !validation.Valid {
+		t.Errorf("validate valid rule = %d, %+v", status, validation)
+	}
+	var listed RulesResponse
+	do(t, http.MethodGet, server.URL+"/tenants/tenant1/rules", nil, &listed)
+	if len(listed.Rules) != 1 {
+		t.Errorf("validate saved the rule: %v", ruleIDs(listed.Rules))
+	}
+
+	var failure ErrorResponse
+	if status := do(t, http.MethodPost, server.URL+"/tenants/tenant1/rules", invalid, &failure); status != http.StatusUnprocessableEntity {
+		t.Errorf("create invalid rule status = %d, want 422", status)
+	}
+	if len(failure.ValidationErrors) == 0 || failure.ValidationErrors[0].Field != ruleprocessor.RULE_FIELD_CONDITION {
+		t.Errorf("create invalid rule response = %+v", failure)
+	}
+
+	if status := do(t, http.MethodPost, server.URL+"/tenants/tenant1/rules", `{"rule_id": "x", "unknown": 1}`, nil); status != http.StatusBadRequest {
+		t.Errorf("unknown field status = %d, want 400", status)
+	}
+}
@@ -0,0 +1,118 @@
+package rule_processor
+
+import (
+	"context"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"log"
+	"sync"
+)
+
+/*
+ActionRequest holds everything an ActionHandler needs to act on a fired rule.
+
+Fields:
+- Event: The evaluated event, including its final ShouldHandle state.
+- Payload: The payload of the event.
+- Rule: The rule that fired.
+- Action: The declared action being dispatched, including its parameters.
+*/
+type ActionRequest struct {
+	Event   models.BaseEvent[any]
+	Payload any
+	Rule    models.Rule
+	Action  models.RuleAction
+}
+
+/*
+ActionDispatcher routes the actions of fired rules to the ActionHandler
+registered for their kind.
+
+It is safe for concurrent use, handlers can be registered while events are
+being evaluated.
+*/
+type ActionDispatcher struct {
+	mu       sync.RWMutex
+	handlers map[string]ActionHandler
+}
+
+// NewActionDispatcher creates an ActionDispatcher with the built-in log handler registered.
+func NewActionDispatcher() *ActionDispatcher {
+	d := &ActionDispatcher{handlers: make(map[string]ActionHandler)}
+	d.Register(models.ACTION_KIND_LOG, LogActionHandler{})
+	return d
+}
+
+// Register registers the handler for an action kind, replacing any previous handler of that kind.
+func (d *ActionDispatcher) Register(kind string, handler ActionHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[kind] = handler
+}
+
+// Handler returns the handler registered for an action kind.
+func (d *ActionDispatcher) Handler(kind string) (ActionHandler, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	handler, ok := d.handlers[kind]
+	return handler, ok
+}
+
+/*
+Dispatch runs every action of the fired rule and returns one ActionResult per
+action.
+
+A failing action, or an action without a registered handler, does not stop
+the remaining actions. Its error is recorded in the ActionResult instead.
+*/
+func (d *ActionDispatcher) Dispatch(ctx context.Context, event models.BaseEvent[any], payload any, rule models.Rule) []models.ActionResult {
+	var results []models.ActionResult
+	for _, action := range rule.EffectiveActions() {
+		actionResult := models.ActionResult{RuleID: rule.RuleId, Kind: action.Kind}
+
+		handler, ok := d.Handler(action.Kind)
+		if !ok {
+			actionResult.Error = fmt.Sprintf("no handler registered for action kind '%s'", action.Kind)
+		} else if err := handler.Handle(ctx, ActionRequest{
+			Event:   event,
+			Payload: payload,
+			Rule:    rule,
+			Action:  action,
+		}); err != nil {
+			actionResult.Error = err.Error()
+		}
+
+		if actionResult.Error != "" {
+			log.Printf("[ActionDispatcher.Dispatch]: action %s of rule %s failed: %s", action.Kind, rule.RuleId, actionResult.Error)
+		}
+		results = append(results, actionResult)
+	}
+	return results
+}
+
+/*
+Plan returns the actions Dispatch would run for the fired rule, marked as
+skipped, without calling their handlers. Actions without a registered
+handler carry the error Dispatch would report.
+*/
+func (d *ActionDispatcher) Plan(rule models.Rule) []models.ActionResult {
+	var results []models.ActionResult
+	for _, action := range rule.EffectiveActions() {
+		actionResult := models.ActionResult{RuleID: rule.RuleId, Kind: action.Kind, Skipped: true}
+		if _, ok := d.Handler(action.Kind); !ok {
+			actionResult.Error = fmt.Sprintf("no handler registered for action kind '%s'", action.Kind)
+		}
+		results = append(results, actionResult)
+	}
+	return results
+}
+
+// LogActionHandler is the built-in handler of the log action, it logs the fired rule.
+type LogActionHandler struct{}
+
+// Handle logs the tenant, event type, rule and payload of the fired rule.
+func (LogActionHandler) Handle(ctx context.Context, req ActionRequest) error {
+	log.Printf("rule %s fired for tenant %s, event type %s, payload %+v",
+		req.Rule.RuleId, req.Event.TenantID, req.Event.Type, req.Payload)
+	return nil
+}
@@ -0,0 +1,71 @@
+package rule_processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type recordingActionHandler struct {
+	requests []ActionRequest
+	err      error
+}
+
+func (h *recordingActionHandler) Handle(ctx context.Context, req ActionRequest) error {
+	h.requests = append(h.requests, req)
+	return h.err
+}
+
+func TestActionDispatcher_Dispatch(t *testing.T) {
+	dispatcher := NewActionDispatcher()
+	webhook := &recordingActionHandler{}
+	failing := &recordingActionHandler{err: errors.New("smtp unavailable")}
+	dispatcher.Register(models.ACTION_KIND_WEBHOOK, webhook)
+	dispatcher.Register(models.ACTION_KIND_EMAIL, failing)
+
+	rule := models.Rule{
+		RuleId:    "disk_80",
+		SendEmail: true,
+		Actions: []models.RuleAction{
+			{Kind: models.ACTION_KIND_WEBHOOK, Params: map[string]any{"url": "http://example.com"}},
+			{Kind: "pager"},
+			{Kind: models.ACTION_KIND_LOG},
+		},
+	}
+	event := models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"}
+	payload := testUsagePayload{Usage: 90}
+
+	results := dispatcher.Dispatch(context.Background(), event, payload, rule)
+
+	wantKinds := []string{models.ACTION_KIND_WEBHOOK, "pager", models.ACTION_KIND_LOG, models.ACTION_KIND_EMAIL}
+	if len(results) != len(wantKinds) {
+		t.Fatalf("Dispatch() returned %d results, want %d: %+v", len(results), len(wantKinds), results)
+	}
+	for i, kind := range wantKinds {
+		if results[i].Kind != kind || results[i].RuleID != "disk_80" {
+			t.Errorf("results[%d] = %+v, want kind %s", i, results[i], kind)
+		}
+	}
+	if results[0].Error != "" || results[2].Error != "" {
+		t.Errorf("successful actions reported errors: %+v", results)
+	}
+	if results[1].Error == "" {
+		t.Error("action without handler did not report an error")
+	}
+	if results[3].Error != "smtp unavailable" {
+		t.Errorf("failing action error = %q, want %q", results[3].Error, "smtp unavailable")
+	}
+
+	if len(webhook.requests) != 1 {
+		t.Fatalf("webhook handler called %d times, want 1", len(webhook.requests))
+	}
+	req := webhook.requests[0]
+	if req.Rule.RuleId != "disk_80" || req.Event.TenantID != "tenant1" || req.Payload != payload {
+		t.Errorf("webhook request = %+v", req)
+	}
+	if req.Action.Params["url"] != "http://example.com" {
+		t.Errorf("webhook params = %+v", req.Action.Params)
+	}
+}
@@ -10,21 +10,33 @@ import (
 /*
 RuleProcessor is the interface that must be implemented by a rule processor.
 
-It provides a single function, Evaluate, which takes a context and a
-BaseEvent and returns a boolean indicating whether the event was handled
-and an error if there was a problem.
+Evaluate takes a context and a BaseEvent and returns a boolean indicating
+whether the event was handled and an error if there was a problem.
+EvaluateWithResult does the same but returns a detailed EvaluationResult.
+DryRun evaluates the event without persisting it or dispatching actions.
 */
 type RuleProcessor interface {
 	// Evaluate takes a context and a BaseEvent and returns a boolean indicating
 	// whether the event was handled and an error if there was a problem.
 	Evaluate(ctx context.Context, event models.BaseEvent[any]) (bool, error)
+
+	// EvaluateWithResult evaluates the event and returns which rules fired, which
+	// were skipped as duplicates, the executed actions and timings.
+	EvaluateWithResult(ctx context.Context, event models.BaseEvent[any]) (*models.EvaluationResult, error)
+
+	// DryRun evaluates the event like EvaluateWithResult and reports the rules that
+	// would fire and the actions that would run, without any side effect.
+	DryRun(ctx context.Context, event models.BaseEvent[any], checkDuplicates bool) (*models.EvaluationResult, error)
 }
 
 /*
 RuleRepository is an interface that provides access to rules.
 
 The GetRules function retrieves all rules for a given tenant and event
-type.
+type. GetEffectiveRules returns every rule that applies to a tenant, the
+tenant's rules layered on top of the default tenant's rules. Generation
+counts the changes of the rules: the processor reuses the compiled rules of
+a tenant and event type until it changes.
 */
 type RuleRepository interface {
 	// GetRules retrieves all rules for a given tenant and event type.
@@ -32,6 +44,49 @@ type RuleRepository interface {
 	// It takes a tenant ID and an event type as input and returns a slice of
 	// Rule objects and an error if there was a problem.
 	GetRules(tenantID, eventType string) ([]models.Rule, error)
+
+	// GetEffectiveRules retrieves the rules of every event type that apply to a tenant.
+	GetEffectiveRules(tenantID string) ([]models.Rule, error)
+
+	// Generation returns a counter incremented every time the rules change, e.g. on a reload or a save.
+	Generation() uint64
+}
+
+/*
+ReloadableRuleRepository is a RuleRepository whose rules can change while it
+is in use and that can watch its source for changes.
+*/
+type ReloadableRuleRepository interface {
+	RuleRepository
+
+	// Watch polls the source of the rules every interval and reloads it when it
+	// changes, until the context is done. onReload, when not nil, is called
+	// after each reload with the error if the new rules were rejected.
+	Watch(ctx context.Context, interval time.Duration, onReload func(err error))
+}
+
+/*
+ActionHandler is the interface that must be implemented by the handlers of
+rule actions.
+
+Handlers are registered per action kind (email, webhook, log or a custom
+kind) and are called once for every matching action of a fired rule.
+*/
+type ActionHandler interface {
+	// Handle executes the action for the fired rule and returns an error if it failed.
+	Handle(ctx context.Context, req ActionRequest) error
+}
+
+/*
+WebhookDeliveryRecorder is the interface that must be implemented to keep
+track of webhook deliveries.
+
+RecordDelivery is called once per endpoint and fired rule with the final
+outcome of the delivery, after all retries.
+*/
+type WebhookDeliveryRecorder interface {
+	// RecordDelivery records the outcome of a webhook delivery.
+	RecordDelivery(ctx context.Context, delivery WebhookDelivery)
 }
 
 /*
@@ -44,6 +99,12 @@ necessary to configure the rule processor.
 The information provided by the configuration provider includes the path
 to the database configuration file, the path to the rule repository JSON
 file, the cleanup interval, and the database configuration.
+
+The other settings are optional: a provider implementing RuleRepoTypeConfig,
+RuleReloadConfig, MatchPolicyConfig, TimezoneConfig, EmailActionConfig,
+WebhookActionConfig or DynamicEventTypesConfig configures them, the processor checks for each of these
+interfaces and uses its defaults otherwise. FrameworkConfig implements all
+of them.
 */
 type Config interface {
 	// GetDBConfigPath returns the path to the database configuration file.
@@ -59,6 +120,51 @@ type Config interface {
 	DbConfig() *EventStateStoreConfig
 }
 
+// RuleRepoTypeConfig is a Config choosing where the rules are read from, the rule file when not implemented.
+type RuleRepoTypeConfig interface {
+	// GetRuleRepoType returns where the rules are read from, the rule file or the database.
+	GetRuleRepoType() RuleRepoType
+}
+
+// RuleReloadConfig is a Config enabling the hot reload of the rules, the rules are not reloaded when not implemented.
+type RuleReloadConfig interface {
+	// GetRuleReloadInterval returns the interval the rules are reloaded at, 0 disables hot reload.
+	GetRuleReloadInterval() time.Duration
+
+	// GetRuleReloadCallback returns the function called after each reload of the rules, or nil.
+	GetRuleReloadCallback() func(err error)
+}
+
+// MatchPolicyConfig is a Config choosing the match policy of the tenants, MATCH_POLICY_FIRST_MATCH when not implemented.
+type MatchPolicyConfig interface {
+	// MatchPolicy returns the match policy used to evaluate the events of a tenant.
+	MatchPolicy(tenantID string) MatchPolicy
+}
+
+// TimezoneConfig is a Config choosing the timezone of the rule schedules of the tenants, UTC when not implemented.
+type TimezoneConfig interface {
+	// Timezone returns the location the rule schedules of a tenant are read in.
+	Timezone(tenantID string) *time.Location
+}
+
+// EmailActionConfig is a Config configuring the email action handler.
+type EmailActionConfig interface {
+	// EmailConfig returns the SMTP configuration, nil if email is not configured.
+	EmailConfig() *EmailConfig
+}
+
+// WebhookActionConfig is a Config configuring the webhook action handler.
+type WebhookActionConfig interface {
+	// WebhookConfig returns the webhook configuration, nil if webhooks are not configured.
+	WebhookConfig() *WebhookConfig
+}
+
+// DynamicEventTypesConfig is a Config declaring event types without a Go struct, NewGRuleProcessor registers them.
+type DynamicEventTypesConfig interface {
+	// GetDynamicEventTypes returns the event types whose payload is a models.DynamicPayload.
+	GetDynamicEventTypes() []string
+}
+
 /*
 EventStore is an interface for managing events.
 
@@ -75,3 +181,142 @@ type EventStore interface {
 	SaveEvent(ctx context.Context, db store.DBTX, arg store.SaveEventParams) error
 	CleanupOldEvents(ctx context.Context, db store.DBTX, dollar_1 interface{}) error
 }
+
+/*
+WindowStore is an interface for managing the samples of the sliding windows
+of aggregation rules.
+
+A window is identified by the tenant, the event type, the rule and the value
+of the group_by field of the rule. The sqlc generated store.Queries
+implements it.
+*/
+type WindowStore interface {
+	// AddWindowSample records an event in a window.
+	AddWindowSample(ctx context.Context, db store.DBTX, arg store.AddWindowSampleParams) error
+
+	// ListWindowSamples returns the most recent samples of a window that occurred at or after arg.OccurredAt, at most arg.Limit.
+	ListWindowSamples(ctx context.Context, db store.DBTX, arg store.ListWindowSamplesParams) ([]*store.WindowSample, error)
+
+	// TrimWindowSamples removes the samples of a window that occurred before arg.OccurredAt or are not among the arg.Limit most recent.
+	TrimWindowSamples(ctx context.Context, db store.DBTX, arg store.TrimWindowSamplesParams) error
+}
+
+/*
+CorrelationStore is an interface for managing the partial matches of the
+sequences of correlation rules.
+
+A partial match is identified by the tenant, the rule, the value of the
+join_on field of the rule and the number of events of the sequence matched.
+The partial matches of a join key are updated in a transaction holding
+LockCorrelation, a completed match is claimed by a single event. The sqlc
+generated store.Queries implements it.
+*/
+type CorrelationStore interface {
+	// UpsertCorrelationMatch records a partial match, keeping the latest start when the step is already matched.
+	UpsertCorrelationMatch(ctx context.Context, db store.DBTX, arg store.UpsertCorrelationMatchParams) error
+
+	// ListCorrelationMatches returns the partial matches of a join key that started at or after arg.StartedAt, by step.
+	ListCorrelationMatches(ctx context.Context, db store.DBTX, arg store.ListCorrelationMatchesParams) ([]*store.CorrelationMatch, error)
+
+	// ExpireCorrelationMatches removes the partial matches of a join key that started before arg.StartedAt.
+	ExpireCorrelationMatches(ctx context.Context, db store.DBTX, arg store.ExpireCorrelationMatchesParams) error
+
+	// DeleteCorrelationMatches removes every partial match of a join key, once its sequence completed.
+	DeleteCorrelationMatches(ctx context.Context, db store.DBTX, arg store.DeleteCorrelationMatchesParams) error
+
+	// ClaimCorrelationMatch removes the partial match of a step started at or after arg.StartedAt and returns the number of matches removed, 0 when another event claimed it.
+	ClaimCorrelationMatch(ctx context.Context, db store.DBTX, arg store.ClaimCorrelationMatchParams) (int64, error)
+
+	// LockCorrelation locks the partial matches of a join key until the end of the transaction.
+	LockCorrelation(ctx context.Context, db store.DBTX, arg store.LockCorrelationParams) error
+}
+
+/*
+RuleStore is an interface for managing the rules stored in the database.
+
+It provides methods to list the rules of every tenant and to create,
+update and delete a single rule. The sqlc generated store.Queries
+implements it.
+*/
+type RuleStore interface {
+	// ListRules returns the stored rules of every tenant, ordered by tenant and rule_id.
+	ListRules(ctx context.Context, db store.DBTX) ([]*store.Rule, error)
+	UpsertRule(ctx context.Context, db store.DBTX, arg store.UpsertRuleParams) error
+	DeleteRule(ctx context.Context, db store.DBTX, arg store.DeleteRuleParams) error
+	// DeleteRuleByID removes a rule_id of a tenant under every event type and returns the number of rows removed.
+	DeleteRuleByID(ctx context.Context, db store.DBTX, arg store.DeleteRuleByIDParams) (int64, error)
+	// LockRule locks a rule_id of a tenant until the end of the transaction.
+	LockRule(ctx context.Context, db store.DBTX, arg store.LockRuleParams) error
+	// ListRuleEventTypes returns the event types a rule_id of a tenant is stored under.
+	ListRuleEventTypes(ctx context.Context, db store.DBTX, arg store.ListRuleEventTypesParams) ([]string, error)
+}
+
+/*
+RevisionedRuleRepository is a RuleRepository keeping the rule set of each
+tenant as immutable revisions, one of which is active.
+
+CreateRevision stores a new revision without activating it,
+ActivateRevision switches the tenant to a revision and Rollback activates
+the revision preceding the active one.
+*/
+type RevisionedRuleRepository interface {
+	RuleRepository
+
+	// GetRulesWithRevisions is GetRules, also returning the active revisions the rules were read from.
+	GetRulesWithRevisions(tenantID, eventType string) ([]models.Rule, models.ActiveRevisions, error)
+
+	// CreateRevision validates and stores a new revision of the rule set of a tenant.
+	CreateRevision(ctx context.Context, tenantID string, rules []models.Rule, author, comment string) (*models.RuleSetRevision, error)
+
+	// ListRevisions returns the revisions of a tenant, newest first.
+	ListRevisions(ctx context.Context, tenantID string) ([]models.RuleSetRevision, error)
+
+	// ActivateRevision makes a revision the active rule set of a tenant.
+	ActivateRevision(ctx context.Context, tenantID string, revisionID int64, author string) (*models.RuleSetRevision, error)
+
+	// Rollback re-activates the revision that was active before the active revision of a tenant.
+	Rollback(ctx context.Context, tenantID, author string) (*models.RuleSetRevision, error)
+}
+
+/*
+RuleSetStore is an interface for managing the rule set revisions stored in
+the database. The sqlc generated store.Queries implements it.
+*/
+type RuleSetStore interface {
+	CreateRuleSetRevision(ctx context.Context, db store.DBTX, arg store.CreateRuleSetRevisionParams) (*store.RuleSetRevision, error)
+	GetRuleSetRevision(ctx context.Context, db store.DBTX, arg store.GetRuleSetRevisionParams) (*store.RuleSetRevision, error)
+	ListRuleSetRevisions(ctx context.Context, db store.DBTX, tenantID string) ([]*store.RuleSetRevision, error)
+	ActivateRuleSetRevision(ctx context.Context, db store.DBTX, arg store.ActivateRuleSetRevisionParams) error
+	ListActiveRuleSets(ctx context.Context, db store.DBTX) ([]*store.ListActiveRuleSetsRow, error)
+	CreateRuleSetActivation(ctx context.Context, db store.DBTX, arg store.CreateRuleSetActivationParams) error
+	ListRuleSetActivations(ctx context.Context, db store.DBTX, tenantID string) ([]*store.RuleSetActivation, error)
+	// LockActiveRuleSet locks the active rule set of a tenant until the end of the transaction, pgx.ErrNoRows without one.
+	LockActiveRuleSet(ctx context.Context, db store.DBTX, tenantID string) (int64, error)
+	RollBackRuleSetActivations(ctx context.Context, db store.DBTX, arg store.RollBackRuleSetActivationsParams) error
+}
+
+/*
+WritableRuleRepository is a RuleRepository whose rules can be changed while
+it is in use, e.g. through the rule management API.
+
+SaveRule and DeleteRule validate the tenant's rules before they are changed,
+a rejected change returns RuleValidationErrors.
+*/
+type WritableRuleRepository interface {
+	RuleRepository
+
+	// GetTenantRules returns the rules stored for the tenant itself, without the inherited default rules.
+	GetTenantRules(tenantID string) ([]models.Rule, error)
+
+	// SaveRule validates and creates or replaces a rule of a tenant.
+	SaveRule(ctx context.Context, tenantID string, rule models.Rule) error
+
+	// CreateRule validates and creates a rule of a tenant, it returns ErrRuleExists if the tenant already has the rule_id.
+	CreateRule(ctx context.Context, tenantID string, rule models.Rule) error
+
+	// UpdateRule validates and replaces a rule of a tenant, it returns ErrRuleNotFound if the tenant has no such rule.
+	UpdateRule(ctx context.Context, tenantID string, rule models.Rule) error
+
+	// DeleteRule removes a rule of a tenant, it returns ErrRuleNotFound if the tenant has no such rule.
+	DeleteRule(ctx context.Context, tenantID, ruleID string) error
+}
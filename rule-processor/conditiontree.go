@@ -0,0 +1,376 @@
+package rule_processor
+
+import (
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CONDITION_TREE_GUARD is prepended to the condition compiled from a condition tree, so a rule
+	// built from a tree does not fire for an event already handled by a rule of higher priority.
+	CONDITION_TREE_GUARD = "Event.ShouldHandle == false"
+	// CONDITION_TREE_DEFAULT_ACTION is the action of a rule built from a condition tree that declares none.
+	CONDITION_TREE_DEFAULT_ACTION = "Event.ShouldHandle = true"
+)
+
+// conditionFieldKind is the kind of value a condition tree leaf compares its field to.
+type conditionFieldKind string
+
+const (
+	conditionKindNumber conditionFieldKind = "number"
+	conditionKindString conditionFieldKind = "string"
+	conditionKindBool   conditionFieldKind = "boolean"
+)
+
+/*
+expandConditionTree replaces the condition tree of a rule with the condition
+compiled from it.
+
+The tree compiles to the expression syntax of the rule's language, grl or
+expr, guarded by CONDITION_TREE_GUARD, and a rule without an action
+gets CONDITION_TREE_DEFAULT_ACTION. Fields are resolved against the payload
+type: by JSON key or Go field name for a payload struct, through the typed
+accessors for a models.DynamicPayload, and taken as the Go field path when
+the payload type is unknown.
+
+Parameters:
+  - rule: models.Rule - The rule, returned unchanged when it has no condition tree.
+  - payloadType: reflect.Type - The payload type of the rule's event type, nil when unknown.
+
+Returns:
+  - models.Rule: The rule with the compiled condition and without condition tree.
+  - RuleValidationErrors: Every problem of the tree, located by the path of its node, nil if there is none.
+*/
+func expandConditionTree(rule models.Rule, payloadType reflect.Type) (models.Rule, RuleValidationErrors) {
+	if rule.ConditionTree == nil {
+		return rule, nil
+	}
+	if strings.TrimSpace(rule.Condition) != "" {
+		return rule, RuleValidationErrors{{RuleID: rule.RuleId, Field: RULE_FIELD_CONDITION_TREE,
+			Message: "condition and condition_tree cannot both be set"}}
+	}
+
+	compiler := &conditionTreeCompiler{payloadType: payloadType, eventType: rule.EventType, language: rule.EffectiveLanguage()}
+	condition := compiler.compile(*rule.ConditionTree, RULE_FIELD_CONDITION_TREE)
+	if len(compiler.problems) > 0 {
+		errs := make(RuleValidationErrors, 0, len(compiler.problems))
+		for _, problem := range compiler.problems {
+			errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_CONDITION_TREE, Message: problem})
+		}
+		return rule, errs
+	}
+
+	rule.Condition = CONDITION_TREE_GUARD + " && " + condition
+	rule.ConditionTree = nil
+	if strings.TrimSpace(rule.Action) == "" {
+		rule.Action = CONDITION_TREE_DEFAULT_ACTION
+	}
+	return rule, nil
+}
+
+// expandRegisteredConditionTree expands the condition tree of a rule against the payload type registered for its event type.
+func expandRegisteredConditionTree(rule models.Rule) (models.Rule, RuleValidationErrors) {
+	payloadType, _ := models.GetEventRegistry().PayloadType(rule.EventType)
+	return expandConditionTree(rule, payloadType)
+}
+
+// conditionTreeCompiler compiles the nodes of a condition tree and collects their problems.
+type conditionTreeCompiler struct {
+	payloadType reflect.Type
+	eventType   string
+	language    string
+	problems    []string
+}
+
+// fail records a problem of the node at path.
+func (c *conditionTreeCompiler) fail(path, format string, args ...any) string {
+	c.problems = append(c.problems, path+": "+fmt.Sprintf(format, args...))
+	return ""
+}
+
+// compile returns the expression of a node, path locates the node in the tree for error messages.
+func (c *conditionTreeCompiler) compile(node models.ConditionNode, path string) string {
+	kinds := 0
+	for _, set := range []bool{node.All != nil, node.Any != nil, node.Not != nil, node.Field != "" || node.Operator != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return c.fail(path, "a node must have exactly one of all, any, not or field and operator")
+	}
+
+	switch {
+	case node.All != nil:
+		return c.compileGroup(node.All, path+".all", " && ")
+	case node.Any != nil:
+		return c.compileGroup(node.Any, path+".any", " || ")
+	case node.Not != nil:
+		return "!(" + c.compile(*node.Not, path+".not") + ")"
+	default:
+		return c.compileLeaf(node, path)
+	}
+}
+
+// compileGroup joins the expressions of the child nodes of an all or any group.
+func (c *conditionTreeCompiler) compileGroup(nodes []models.ConditionNode, path, operator string) string {
+	if len(nodes) == 0 {
+		return c.fail(path, "a group needs at least one node")
+	}
+	expressions := make([]string, len(nodes))
+	for i, node := range nodes {
+		expressions[i] = c.compile(node, fmt.Sprintf("%s[%d]", path, i))
+	}
+	return "(" + strings.Join(expressions, operator) + ")"
+}
+
+// compileLeaf returns the comparison of a leaf node.
+func (c *conditionTreeCompiler) compileLeaf(node models.ConditionNode, path string) string {
+	if node.Field == "" {
+		return c.fail(path, "field cannot be empty")
+	}
+	fieldKind, err := c.fieldKind(node.Field)
+	if err != nil {
+		return c.fail(path, "%v", err)
+	}
+
+	switch node.Operator {
+	case models.CONDITION_OPERATOR_EQ, models.CONDITION_OPERATOR_NE:
+		value, kind, err := conditionLiteral(node.Value)
+		if err != nil {
+			return c.fail(path, "%v", err)
+		}
+		operator := map[string]string{models.CONDITION_OPERATOR_EQ: "==", models.CONDITION_OPERATOR_NE: "!="}[node.Operator]
+		return c.comparison(path, node, fieldKind, kind, operator, value)
+	case models.CONDITION_OPERATOR_GT, models.CONDITION_OPERATOR_GTE, models.CONDITION_OPERATOR_LT, models.CONDITION_OPERATOR_LTE:
+		value, kind, err := conditionLiteral(node.Value)
+		if err != nil {
+			return c.fail(path, "%v", err)
+		}
+		if kind != conditionKindNumber {
+			return c.fail(path, "operator '%s' needs a number value, got %s", node.Operator, kind)
+		}
+		operator := map[string]string{
+			models.CONDITION_OPERATOR_GT: ">", models.CONDITION_OPERATOR_GTE: ">=",
+			models.CONDITION_OPERATOR_LT: "<", models.CONDITION_OPERATOR_LTE: "<=",
+		}[node.Operator]
+		return c.comparison(path, node, fieldKind, kind, operator, value)
+	case models.CONDITION_OPERATOR_IN:
+		values, ok := conditionList(node.Value)
+		if !ok || len(values) == 0 {
+			return c.fail(path, "operator 'in' needs a non-empty list value")
+		}
+		comparisons := make([]string, len(values))
+		for i, element := range values {
+			value, kind, err := conditionLiteral(element)
+			if err != nil {
+				return c.fail(fmt.Sprintf("%s.value[%d]", path, i), "%v", err)
+			}
+			comparisons[i] = c.comparison(fmt.Sprintf("%s.value[%d]", path, i), node, fieldKind, kind, "==", value)
+		}
+		return "(" + strings.Join(comparisons, " || ") + ")"
+	case models.CONDITION_OPERATOR_CONTAINS, models.CONDITION_OPERATOR_REGEX:
+		value, ok := node.Value.(string)
+		if !ok {
+			return c.fail(path, "operator '%s' needs a string value", node.Operator)
+		}
+		if node.Operator == models.CONDITION_OPERATOR_REGEX {
+			if _, err := regexp.Compile(value); err != nil {
+				return c.fail(path, "invalid regular expression: %v", err)
+			}
+		}
+		if fieldKind != "" && fieldKind != conditionKindString {
+			return c.fail(path, "operator '%s' needs a string field, '%s' is a %s", node.Operator, node.Field, fieldKind)
+		}
+		field := c.fieldExpression(node.Field, conditionKindString)
+		if c.language == models.RULE_LANGUAGE_EXPR {
+			operator := map[string]string{models.CONDITION_OPERATOR_CONTAINS: "contains", models.CONDITION_OPERATOR_REGEX: "matches"}[node.Operator]
+			return fmt.Sprintf("%s %s %s", field, operator, strconv.Quote(value))
+		}
+		method := map[string]string{models.CONDITION_OPERATOR_CONTAINS: "Contains", models.CONDITION_OPERATOR_REGEX: "MatchString"}[node.Operator]
+		return fmt.Sprintf("%s.%s(%s)", field, method, strconv.Quote(value))
+	case models.CONDITION_OPERATOR_BETWEEN:
+		bounds, ok := conditionList(node.Value)
+		if !ok || len(bounds) != 2 {
+			return c.fail(path, "operator 'between' needs a [min, max] list value")
+		}
+		low, lowKind, lowErr := conditionLiteral(bounds[0])
+		high, highKind, highErr := conditionLiteral(bounds[1])
+		if lowErr != nil || highErr != nil || lowKind != conditionKindNumber || highKind != conditionKindNumber {
+			return c.fail(path, "operator 'between' needs number bounds")
+		}
+		if mustParseFloat(low) > mustParseFloat(high) {
+			return c.fail(path, "the min bound %s is greater than the max bound %s", low, high)
+		}
+		if fieldKind != "" && fieldKind != conditionKindNumber {
+			return c.fail(path, "operator 'between' needs a number field, '%s' is a %s", node.Field, fieldKind)
+		}
+		field := c.fieldExpression(node.Field, conditionKindNumber)
+		return fmt.Sprintf("(%s >= %s && %s <= %s)", field, low, field, high)
+	case "":
+		return c.fail(path, "operator cannot be empty")
+	default:
+		return c.fail(path, "unknown operator '%s'", node.Operator)
+	}
+}
+
+// comparison compares the field of a leaf to a literal of the given kind.
+func (c *conditionTreeCompiler) comparison(path string, node models.ConditionNode, fieldKind, kind conditionFieldKind, operator, value string) string {
+	if fieldKind != "" && fieldKind != kind {
+		return c.fail(path, "'%s' is a %s, it cannot be compared to a %s", node.Field, fieldKind, kind)
+	}
+	return fmt.Sprintf("%s %s %s", c.fieldExpression(node.Field, kind), operator, value)
+}
+
+/*
+fieldKind returns the kind of the payload field at the dotted path, empty
+when it is not known: for a dynamic payload or an unknown payload type.
+*/
+func (c *conditionTreeCompiler) fieldKind(path string) (conditionFieldKind, error) {
+	names := strings.Split(path, ".")
+	for _, name := range names {
+		if name == "" {
+			return "", fmt.Errorf("invalid field '%s'", path)
+		}
+	}
+	if c.payloadType == nil {
+		for _, name := range names {
+			if !isGRLIdentifier(name) {
+				return "", fmt.Errorf("invalid field '%s', the payload type of event type '%s' is unknown so fields are Go field paths", path, c.eventType)
+			}
+		}
+		return "", nil
+	}
+	if c.isDynamic() {
+		return "", nil
+	}
+
+	field, ok := resolvePayloadField(c.payloadType, names)
+	if !ok {
+		return "", fmt.Errorf("unknown payload field '%s' for event type '%s'", path, c.eventType)
+	}
+	for field.Type.Kind() == reflect.Pointer {
+		field.Type = field.Type.Elem()
+	}
+	switch field.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return conditionKindNumber, nil
+	case reflect.String:
+		return conditionKindString, nil
+	case reflect.Bool:
+		return conditionKindBool, nil
+	default:
+		return "", fmt.Errorf("payload field '%s' of type %s cannot be compared", path, field.Type)
+	}
+}
+
+// fieldExpression returns the expression reading a payload field, kind selects the accessor of a dynamic payload.
+func (c *conditionTreeCompiler) fieldExpression(path string, kind conditionFieldKind) string {
+	if c.isDynamic() {
+		accessor := map[conditionFieldKind]string{
+			conditionKindNumber: "GetFloat", conditionKindString: "GetString", conditionKindBool: "GetBool",
+		}[kind]
+		return fmt.Sprintf("Payload.%s(%s)", accessor, strconv.Quote(path))
+	}
+	names := strings.Split(path, ".")
+	if c.payloadType != nil {
+		names = payloadFieldNames(c.payloadType, names)
+	}
+	return "Payload." + strings.Join(names, ".")
+}
+
+// isDynamic reports whether the payload is a models.DynamicPayload read through its accessors.
+func (c *conditionTreeCompiler) isDynamic() bool {
+	return c.payloadType == reflect.TypeOf(models.DynamicPayload{})
+}
+
+// resolvePayloadField returns the nested field of the payload struct named by JSON keys or Go field names.
+func resolvePayloadField(payloadType reflect.Type, names []string) (reflect.StructField, bool) {
+	var field reflect.StructField
+	current := payloadType
+	for _, name := range names {
+		for current.Kind() == reflect.Pointer {
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return reflect.StructField{}, false
+		}
+		var ok bool
+		if field, ok = payloadFieldByName(current, name); !ok {
+			return reflect.StructField{}, false
+		}
+		current = field.Type
+	}
+	return field, true
+}
+
+// payloadFieldByName returns the exported field of a struct whose JSON key or Go name is name, the JSON key first.
+func payloadFieldByName(structType reflect.Type, name string) (reflect.StructField, bool) {
+	for _, field := range reflect.VisibleFields(structType) {
+		if field.IsExported() && !field.Anonymous && strings.Split(field.Tag.Get("json"), ",")[0] == name {
+			return field, true
+		}
+	}
+	field, ok := structType.FieldByName(name)
+	return field, ok && field.IsExported()
+}
+
+// payloadFieldNames maps the JSON keys of a resolved field path to the Go field names read by the rules.
+func payloadFieldNames(payloadType reflect.Type, names []string) []string {
+	goNames := make([]string, len(names))
+	current := payloadType
+	for i, name := range names {
+		for current.Kind() == reflect.Pointer {
+			current = current.Elem()
+		}
+		field, _ := payloadFieldByName(current, name)
+		goNames[i] = field.Name
+		current = field.Type
+	}
+	return goNames
+}
+
+// conditionLiteral formats a scalar value of a condition tree as a literal of the rule languages.
+func conditionLiteral(value any) (string, conditionFieldKind, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v), conditionKindString, nil
+	case bool:
+		return strconv.FormatBool(v), conditionKindBool, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), conditionKindNumber, nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), conditionKindNumber, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), conditionKindNumber, nil
+	case nil:
+		return "", "", fmt.Errorf("value is required")
+	default:
+		return "", "", fmt.Errorf("value must be a string, a number or a boolean, got %T", value)
+	}
+}
+
+// conditionList returns the elements of a list value, false if the value is not a list.
+func conditionList(value any) ([]any, bool) {
+	list := reflect.ValueOf(value)
+	if !list.IsValid() || (list.Kind() != reflect.Slice && list.Kind() != reflect.Array) {
+		return nil, false
+	}
+	elements := make([]any, list.Len())
+	for i := range elements {
+		elements[i] = list.Index(i).Interface()
+	}
+	return elements, true
+}
+
+// mustParseFloat parses a number literal returned by conditionLiteral.
+func mustParseFloat(literal string) float64 {
+	value, _ := strconv.ParseFloat(literal, 64)
+	return value
+}
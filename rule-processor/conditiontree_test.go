@@ -0,0 +1,282 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type treeHost struct {
+	Name string `json:"name"`
+	Zone string `json:"zone"`
+}
+
+type treePayload struct {
+	Usage   int      `json:"usage_percentage"`
+	Load    float64  `json:"load"`
+	Healthy bool     `json:"healthy"`
+	Host    treeHost `json:"host"`
+	Tags    []string `json:"tags"`
+}
+
+func init() {
+	models.GetEventRegistry().RegisterEventType("host_status", func() models.Evaluable {
+		return &models.BaseEvent[treePayload]{}
+	})
+}
+
+// parseConditionTree decodes a condition tree as it is read from a rule file.
+func parseConditionTree(t *testing.T, tree string) *models.ConditionNode {
+	t.Helper()
+	var node models.ConditionNode
+	if err := json.Unmarshal([]byte(tree), &node); err != nil {
+		t.Fatalf("invalid condition tree %s: %v", tree, err)
+	}
+	return &node
+}
+
+func TestExpandConditionTree(t *testing.T) {
+	structType := reflect.TypeOf(treePayload{})
+	dynamicType := reflect.TypeOf(models.DynamicPayload{})
+
+	tests := []struct {
+		name        string
+		tree        string
+		payloadType reflect.Type
+		want        string
+	}{
+		{
+			name:        "json keys",
+			tree:        `{"all": [{"field": "usage_percentage", "operator": "gte", "value": 80}, {"field": "host.name", "operator": "eq", "value": "db"}]}`,
+			payloadType: structType,
+			want:        `(Payload.Usage >= 80 && Payload.Host.Name == "db")`,
+		},
+		{
+			name:        "go field names",
+			tree:        `{"any": [{"field": "Load", "operator": "lt", "value": -0.5}, {"field": "Healthy", "operator": "ne", "value": true}]}`,
+			payloadType: structType,
+			want:        `(Payload.Load < -0.5 || Payload.Healthy != true)`,
+		},
+		{
+			name:        "not in",
+			tree:        `{"not": {"field": "host.zone", "operator": "in", "value": ["eu", "us"]}}`,
+			payloadType: structType,
+			want:        `!((Payload.Host.Zone == "eu" || Payload.Host.Zone == "us"))`,
+		},
+		{
+			name:        "contains regex between",
+			tree:        `{"all": [{"field": "host.name", "operator": "contains", "value": "db"}, {"field": "host.zone", "operator": "regex", "value": "^eu-\\d+$"}, {"field": "load", "operator": "between", "value": [0.5, 2]}]}`,
+			payloadType: structType,
+			want:        `(Payload.Host.Name.Contains("db") && Payload.Host.Zone.MatchString("^eu-\\d+$") && (Payload.Load >= 0.5 && Payload.Load <= 2))`,
+		},
+		{
+			name:        "dynamic payload",
+			tree:        `{"all": [{"field": "depth", "operator": "gt", "value": 100}, {"field": "queue.name", "operator": "regex", "value": "^orders"}, {"field": "paused", "operator": "eq", "value": false}]}`,
+			payloadType: dynamicType,
+			want:        `(Payload.GetFloat("depth") > 100 && Payload.GetString("queue.name").MatchString("^orders") && Payload.GetBool("paused") == false)`,
+		},
+		{
+			name: "unknown payload type",
+			tree: `{"field": "Usage", "operator": "in", "value": [90, 95]}`,
+			want: `(Payload.Usage == 90 || Payload.Usage == 95)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := models.Rule{RuleId: "tree", EventType: "host_status", ConditionTree: parseConditionTree(t, tt.tree)}
+			expanded, errs := expandConditionTree(rule, tt.payloadType)
+			if len(errs) > 0 {
+				t.Fatalf("expandConditionTree() errors = %v", errs)
+			}
+			if want := CONDITION_TREE_GUARD + " && " + tt.want; expanded.Condition != want {
+				t.Errorf("Condition = %s, want %s", expanded.Condition, want)
+			}
+			if expanded.ConditionTree != nil || expanded.Action != CONDITION_TREE_DEFAULT_ACTION {
+				t.Errorf("expanded rule = %+v", expanded)
+			}
+		})
+	}
+
+	// Values built in Go need not be JSON decoded.
+	rule := models.Rule{RuleId: "tree", EventType: "host_status", Action: "Event.ShouldHandle = true; Retract(\"tree\")",
+		ConditionTree: &models.ConditionNode{Field: "usage_percentage", Operator: models.CONDITION_OPERATOR_IN, Value: []int{90, 95}}}
+	expanded, errs := expandConditionTree(rule, structType)
+	if len(errs) > 0 || !strings.HasSuffix(expanded.Condition, "(Payload.Usage == 90 || Payload.Usage == 95)") || expanded.Action != rule.Action {
+		t.Errorf("expandConditionTree() = %+v, %v", expanded, errs)
+	}
+}
+
+func TestExpandConditionTree_Errors(t *testing.T) {
+	structType := reflect.TypeOf(treePayload{})
+
+	tests := []struct {
+		name        string
+		rule        models.Rule
+		payloadType reflect.Type
+		want        []string
+	}{
+		{
+			name: "condition and tree",
+			rule: models.Rule{Condition: "Payload.Usage > 1", ConditionTree: &models.ConditionNode{Field: "usage_percentage", Operator: "gt", Value: 1}},
+			want: []string{"condition and condition_tree cannot both be set"},
+		},
+		{
+			name: "nested problems",
+			rule: models.Rule{ConditionTree: parseConditionTree(t, `{"all": [
+				{"field": "usage", "operator": "gt", "value": 1},
+				{"any": [{"field": "host.name", "operator": "gt", "value": 1}, {"field": "load", "operator": "eq", "value": "high"}]},
+				{"not": {"field": "host.zone", "operator": "regex", "value": "("}},
+				{"field": "tags", "operator": "contains", "value": "db"}
+			]}`)},
+			payloadType: structType,
+			want: []string{
+				"condition_tree.all[0]: unknown payload field 'usage' for event type 'host_status'",
+				"condition_tree.all[1].any[0]: 'host.name' is a string, it cannot be compared to a number",
+				"condition_tree.all[1].any[1]: 'load' is a number, it cannot be compared to a string",
+				"condition_tree.all[2].not: invalid regular expression: error parsing regexp: missing closing ): `(`",
+				"condition_tree.all[3]: payload field 'tags' of type []string cannot be compared",
+			},
+		},
+		{
+			name: "malformed nodes",
+			rule: models.Rule{ConditionTree: parseConditionTree(t, `{"any": [
+				{},
+				{"all": []},
+				{"field": "load", "operator": "gt", "value": 1, "not": {"field": "load", "operator": "gt", "value": 1}},
+				{"field": "load"},
+				{"field": "load", "operator": "like", "value": 1},
+				{"operator": "eq", "value": 1},
+				{"field": "load", "operator": "eq"},
+				{"field": "load", "operator": "gt", "value": "1"},
+				{"field": "load", "operator": "in", "value": 1},
+				{"field": "load", "operator": "in", "value": [1, {"a": 1}]},
+				{"field": "load", "operator": "between", "value": [2, 1]},
+				{"field": "load", "operator": "between", "value": [1]},
+				{"field": "host.name", "operator": "contains", "value": 1},
+				{"field": "host..name", "operator": "eq", "value": "db"}
+			]}`)},
+			payloadType: structType,
+			want: []string{
+				"condition_tree.any[0]: a node must have exactly one of all, any, not or field and operator",
+				"condition_tree.any[1].all: a group needs at least one node",
+				"condition_tree.any[2]: a node must have exactly one of all, any, not or field and operator",
+				"condition_tree.any[3]: operator cannot be empty",
+				"condition_tree.any[4]: unknown operator 'like'",
+				"condition_tree.any[5]: field cannot be empty",
+				"condition_tree.any[6]: value is required",
+				"condition_tree.any[7]: operator 'gt' needs a number value, got string",
+				"condition_tree.any[8]: operator 'in' needs a non-empty list value",
+				"condition_tree.any[9].value[1]: value must be a string, a number or a boolean, got map[string]interface {}",
+				"condition_tree.any[10]: the min bound 2 is greater than the max bound 1",
+				"condition_tree.any[11]: operator 'between' needs a [min, max] list value",
+				"condition_tree.any[12]: operator 'contains' needs a string value",
+				"condition_tree.any[13]: invalid field 'host..name'",
+			},
+		},
+		{
+			name: "unknown payload type",
+			rule: models.Rule{EventType: "cpu", ConditionTree: &models.ConditionNode{Field: "load-avg", Operator: "gt", Value: 1}},
+			want: []string{"condition_tree: invalid field 'load-avg', the payload type of event type 'cpu' is unknown so fields are Go field paths"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rule.EventType == "" {
+				tt.rule.EventType = "host_status"
+			}
+			tt.rule.RuleId = "tree"
+			_, errs := expandConditionTree(tt.rule, tt.payloadType)
+			var got []string
+			for _, err := range errs {
+				if err.Field != RULE_FIELD_CONDITION_TREE || err.RuleID != "tree" {
+					t.Errorf("error %+v is not located on the condition tree of the rule", err)
+				}
+				got = append(got, err.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandConditionTree() errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestGRuleProcessor_EvaluateConditionTree(t *testing.T) {
+	tree := `{"all": [
+		{"field": "usage_percentage", "operator": "between", "value": [80, 100]},
+		{"any": [{"field": "host.name", "operator": "regex", "value": "^db-\\d+$"}, {"field": "host.zone", "operator": "contains", "value": "prod"}]},
+		{"not": {"field": "healthy", "operator": "eq", "value": true}}
+	]}`
+	for _, language := range []string{models.RULE_LANGUAGE_GRL, models.RULE_LANGUAGE_EXPR} {
+		t.Run(language, func(t *testing.T) {
+			rule := models.Rule{RuleId: "host_alert", EventType: "host_status", Language: language, ConditionTree: parseConditionTree(t, tree)}
+			if errs := ValidateRule(rule); len(errs) > 0 {
+				t.Fatalf("ValidateRule() = %v", errs)
+			}
+			repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+			processor, eventStore := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+
+			for _, tt := range []struct {
+				payload treePayload
+				want    bool
+			}{
+				{treePayload{Usage: 85, Host: treeHost{Name: "db-1", Zone: "eu"}}, true},
+				{treePayload{Usage: 100, Host: treeHost{Name: "web", Zone: "eu-prod"}}, true},
+				{treePayload{Usage: 79, Host: treeHost{Name: "db-1", Zone: "eu"}}, false},
+				{treePayload{Usage: 85, Host: treeHost{Name: "db-x", Zone: "eu"}}, false},
+				{treePayload{Usage: 85, Healthy: true, Host: treeHost{Name: "db-1", Zone: "eu"}}, false},
+			} {
+				payload := tt.payload
+				handled, err := processor.Evaluate(context.Background(), models.BaseEvent[any]{
+					TenantID: "tenant1", Type: "host_status", Payload: &payload, EventSHA: payload.Host.Name,
+				})
+				if err != nil || handled != tt.want {
+					t.Errorf("Evaluate(%+v) = %v, %v, want %v", payload, handled, err, tt.want)
+				}
+			}
+			if eventStore.Count() != 2 {
+				t.Errorf("event store holds %d events, want 2", eventStore.Count())
+			}
+		})
+	}
+}
+
+func TestLintRules_ConditionTree(t *testing.T) {
+	payloadTypes := map[string]reflect.Type{"host_status": reflect.TypeOf(treePayload{})}
+	errs := LintRules(map[string][]models.Rule{
+		DEFAULT_TENANT_RULE_ID: {
+			{RuleId: "valid", EventType: "host_status", ConditionTree: &models.ConditionNode{Field: "host.name", Operator: "contains", Value: "db"}},
+			{RuleId: "unknown_field", EventType: "host_status", ConditionTree: &models.ConditionNode{Field: "hostname", Operator: "eq", Value: "db"}},
+		},
+	}, payloadTypes)
+	if len(errs) != 1 || errs[0].RuleID != "unknown_field" || errs[0].Field != RULE_FIELD_CONDITION_TREE {
+		t.Errorf("LintRules() = %v, want the unknown field of unknown_field", errs)
+	}
+}
+
+func TestGRuleProcessor_EvaluateDynamicConditionTree(t *testing.T) {
+	models.GetEventRegistry().RegisterDynamicEventType("queue_depth")
+	tree := `{"all": [{"field": "depth", "operator": "gt", "value": 100}, {"field": "queue.name", "operator": "regex", "value": "^orders-\\d+$"}]}`
+	for _, language := range []string{models.RULE_LANGUAGE_GRL, models.RULE_LANGUAGE_EXPR} {
+		t.Run(language, func(t *testing.T) {
+			rule := models.Rule{RuleId: "queue_alert", EventType: "queue_depth", Language: language, ConditionTree: parseConditionTree(t, tree)}
+			repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+			processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+
+			for payload, want := range map[string]bool{
+				`{"depth": 150, "queue": {"name": "orders-1"}}`: true,
+				`{"depth": 150, "queue": {"name": "billing"}}`:  false,
+				`{"depth": 50, "queue": {"name": "orders-1"}}`:  false,
+			} {
+				result, err := models.GetEventRegistry().ProcessEventWithResult(context.Background(), processor,
+					[]byte(`{"tenant_id": "tenant1", "type": "queue_depth", "event_sha": "q", "payload": `+payload+`}`))
+				if err != nil || result.Handled() != want {
+					t.Errorf("ProcessEventWithResult(%s) = %+v, %v, want handled %v", payload, result, err, want)
+				}
+			}
+		})
+	}
+}
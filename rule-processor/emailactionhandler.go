@@ -0,0 +1,220 @@
+package rule_processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DEFAULT_EMAIL_SUBJECT_TEMPLATE = "[{{.Event.TenantID}}] Rule {{.Rule.RuleId}} fired for {{.Event.Type}}"
+	DEFAULT_EMAIL_BODY_TEMPLATE    = "Rule {{.Rule.RuleId}} fired for tenant {{.Event.TenantID}} on a {{.Event.Type}} event.\n\nPayload: {{printf \"%+v\" .Payload}}\n"
+	DEFAULT_EMAIL_TIMEOUT          = 10 * time.Second
+)
+
+// emailTemplateData is the data the subject and body templates are executed against.
+type emailTemplateData struct {
+	Event   models.BaseEvent[any]
+	Payload any
+	Rule    models.Rule
+}
+
+/*
+EmailActionHandler is the ActionHandler of the email action, it sends the
+alert of a fired rule through an SMTP server.
+
+The action accepts the optional params:
+  - to: a list of recipients replacing the tenant's configured recipients.
+  - subject_template, body_template: templates replacing the configured ones.
+*/
+type EmailActionHandler struct {
+	cfg     *EmailConfig
+	subject *template.Template
+	body    *template.Template
+}
+
+/*
+NewEmailActionHandler creates an EmailActionHandler from the SMTP configuration.
+
+The configured templates are parsed up front so a broken template is reported
+at startup instead of on the first alert. Empty templates fall back to the
+defaults.
+*/
+func NewEmailActionHandler(cfg *EmailConfig) (*EmailActionHandler, error) {
+	if cfg == nil {
+		return nil, errors.New("email config is required")
+	}
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, errors.New("email config requires a host and a from address")
+	}
+
+	subject, err := parseEmailTemplate("subject", cfg.SubjectTemplate, DEFAULT_EMAIL_SUBJECT_TEMPLATE)
+	if err != nil {
+		return nil, err
+	}
+	body, err := parseEmailTemplate("body", cfg.BodyTemplate, DEFAULT_EMAIL_BODY_TEMPLATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmailActionHandler{cfg: cfg, subject: subject, body: body}, nil
+}
+
+// Handle renders the templates for the fired rule and sends the email to the tenant's recipients.
+func (h *EmailActionHandler) Handle(ctx context.Context, req ActionRequest) error {
+	recipients := stringListParam(req.Action.Params, "to")
+	if len(recipients) == 0 {
+		recipients = h.cfg.RecipientsFor(req.Event.TenantID)
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("no email recipients configured for tenant %s", req.Event.TenantID)
+	}
+
+	subject, body, err := h.render(req)
+	if err != nil {
+		return err
+	}
+	return h.send(ctx, recipients, buildEmailMessage(h.cfg.From, recipients, subject, body))
+}
+
+// render executes the subject and body templates, using the action's template params when present.
+func (h *EmailActionHandler) render(req ActionRequest) (string, string, error) {
+	var err error
+	subjectTmpl, bodyTmpl := h.subject, h.body
+	if text, ok := req.Action.Params["subject_template"].(string); ok {
+		if subjectTmpl, err = parseEmailTemplate("subject", text, DEFAULT_EMAIL_SUBJECT_TEMPLATE); err != nil {
+			return "", "", err
+		}
+	}
+	if text, ok := req.Action.Params["body_template"].(string); ok {
+		if bodyTmpl, err = parseEmailTemplate("body", text, DEFAULT_EMAIL_BODY_TEMPLATE); err != nil {
+			return "", "", err
+		}
+	}
+
+	data := emailTemplateData{Event: req.Event, Payload: req.Payload, Rule: req.Rule}
+	var subject, body bytes.Buffer
+	if err = subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email subject: %w", err)
+	}
+	if err = bodyTmpl.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email body: %w", err)
+	}
+	// Header injection guard, the subject must stay on a single line.
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
+
+/*
+send delivers the message through the configured SMTP server.
+
+It follows smtp.SendMail but honours the context and the configured timeout,
+upgrades to TLS when the server offers STARTTLS and only authenticates when a
+username is configured.
+*/
+func (h *EmailActionHandler) send(ctx context.Context, recipients []string, message []byte) error {
+	timeout := DEFAULT_EMAIL_TIMEOUT
+	if h.cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.cfg.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", h.cfg.Address())
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, h.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: h.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+	if h.cfg.Username != "" {
+		auth := smtp.PlainAuth("", h.cfg.Username, h.cfg.Password, h.cfg.Host)
+		if err = client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+	if err = client.Mail(h.cfg.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err = client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err = writer.Write(message); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildEmailMessage assembles a plain text RFC 5322 message.
+func buildEmailMessage(from string, to []string, subject, body string) []byte {
+	var msg bytes.Buffer
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return msg.Bytes()
+}
+
+// parseEmailTemplate parses an email template, using the fallback when the text is empty.
+func parseEmailTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// stringListParam reads a list of strings from action params decoded from JSON.
+func stringListParam(params map[string]any, key string) []string {
+	switch value := params[key].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []any:
+		var list []string
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package rule_processor
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+// smtpMessage is a message received by the smtpStub.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpStub is a minimal in-process SMTP server recording the messages it receives.
+type smtpStub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start smtp stub: %v", err)
+	}
+	stub := &smtpStub{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost stub")
+	var msg smtpMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+		upper := strings.ToUpper(command)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			msg = smtpMessage{from: strings.Trim(command[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(command[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStub) config() *EmailConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &EmailConfig{
+		Host: "127.0.0.1",
+		Port: addr.Port,
+		From: "engine@example.com",
+		Recipients: map[string][]string{
+			"tenant1":              {"ops@tenant1.example.com", "oncall@tenant1.example.com"},
+			DEFAULT_TENANT_RULE_ID: {"alerts@example.com"},
+		},
+		SubjectTemplate: "[{{.Event.TenantID}}] {{.Rule.RuleId}} at {{.Payload.Usage}}%",
+		BodyTemplate:    "Usage of {{.Event.Type}} reached {{.Payload.Usage}}%.",
+	}
+}
+
+func (s *smtpStub) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func TestEmailActionHandler_Handle(t *testing.T) {
+	stub := newSMTPStub(t)
+	handler, err := NewEmailActionHandler(stub.config())
+	if err != nil {
+		t.Fatalf("NewEmailActionHandler() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		tenantID    string
+		params      map[string]any
+		wantTo      []string
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			name:        "tenant recipients",
+			tenantID:    "tenant1",
+			wantTo:      []string{"ops@tenant1.example.com", "oncall@tenant1.example.com"},
+			wantSubject: "Subject: [tenant1] disk_80 at 91%",
+			wantBody:    "Usage of disk_space reached 91%.",
+		},
+		{
+			name:        "default tenant recipients",
+			tenantID:    "tenant2",
+			wantTo:      []string{"alerts@example.com"},
+			wantSubject: "Subject: [tenant2] disk_80 at 91%",
+			wantBody:    "Usage of disk_space reached 91%.",
+		},
+		{
+			name:     "action params override",
+			tenantID: "tenant1",
+			params: map[string]any{
+				"to":               []any{"custom@example.com"},
+				"subject_template": "custom {{.Rule.RuleId}}",
+				"body_template":    "custom body {{.Payload.Usage}}",
+			},
+			wantTo:      []string{"custom@example.com"},
+			wantSubject: "Subject: custom disk_80",
+			wantBody:    "custom body 91",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handler.Handle(context.Background(), ActionRequest{
+				Event:   models.BaseEvent[any]{TenantID: tt.tenantID, Type: "disk_space"},
+				Payload: testUsagePayload{Usage: 91},
+				Rule:    models.Rule{RuleId: "disk_80"},
+				Action:  models.RuleAction{Kind: models.ACTION_KIND_EMAIL, Params: tt.params},
+			})
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+
+			messages := stub.received()
+			if len(messages) != i+1 {
+				t.Fatalf("stub received %d messages, want %d", len(messages), i+1)
+			}
+			msg := messages[i]
+			if msg.from != "engine@example.com" {
+				t.Errorf("from = %q", msg.from)
+			}
+			if strings.Join(msg.to, ",") != strings.Join(tt.wantTo, ",") {
+				t.Errorf("to = %v, want %v", msg.to, tt.wantTo)
+			}
+			if !strings.Contains(msg.data, tt.wantSubject+"\r\n") {
+				t.Errorf("message %q does not contain %q", msg.data, tt.wantSubject)
+			}
+			if !strings.Contains(msg.data, tt.wantBody) {
+				t.Errorf("message %q does not contain %q", msg.data, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestEmailActionHandler_Errors(t *testing.T) {
+	if _, err := NewEmailActionHandler(nil); err == nil {
+		t.Error("NewEmailActionHandler(nil) expected an error")
+	}
+	if _, err := NewEmailActionHandler(&EmailConfig{Host: "localhost", From: "a@b.c", BodyTemplate: "{{.Broken"}); err == nil {
+		t.Error("NewEmailActionHandler() expected an error for an invalid template")
+	}
+
+	stub := newSMTPStub(t)
+	cfg := stub.config()
+	cfg.Recipients = nil
+	handler, err := NewEmailActionHandler(cfg)
+	if err != nil {
+		t.Fatalf("NewEmailActionHandler() error = %v", err)
+	}
+	err = handler.Handle(context.Background(), ActionRequest{
+		Event:   models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"},
+		Payload: testUsagePayload{Usage: 91},
+		Rule:    models.Rule{RuleId: "disk_80"},
+	})
+	if err == nil {
+		t.Error("Handle() expected an error without recipients")
+	}
+
+	cfg = stub.config()
+	cfg.Port = 1
+	handler, err = NewEmailActionHandler(cfg)
+	if err != nil {
+		t.Fatalf("NewEmailActionHandler() error = %v", err)
+	}
+	err = handler.Handle(context.Background(), ActionRequest{
+		Event:   models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"},
+		Payload: testUsagePayload{Usage: 91},
+		Rule:    models.Rule{RuleId: "disk_80"},
+	})
+	if err == nil {
+		t.Error("Handle() expected an error for an unreachable smtp server")
+	}
+}
@@ -0,0 +1,118 @@
+package rule_processor
+
+import (
+	"context"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"sort"
+)
+
+/*
+Evaluator compiles and executes the rules written in one rule language.
+
+A rule picks its evaluator with its `language` field, GRL by default. The
+GRuleProcessor keeps deduplication, persistence of handled events and action
+dispatching to itself, an Evaluator only decides which rules fire and runs
+their actions against the facts of the event.
+
+Two evaluators are built in: grl, backed by grule, and expr, backed by
+expr-lang. Others, e.g. for CEL, are added to a processor
+with WithEvaluator and passed to the repositories validating the rules.
+*/
+type Evaluator interface {
+	// Language returns the value of the `language` field of the rules the evaluator handles.
+	Language() string
+
+	/*
+		Compile compiles rules of the evaluator's language, in order of decreasing
+		priority. The compiled rules are cached per tenant, event type and rule set
+		revision, and executed concurrently.
+	*/
+	Compile(rules []models.Rule) (CompiledRules, error)
+
+	// Validate checks a single rule on its own and locates the syntax errors of its condition and action.
+	Validate(rule models.Rule) RuleValidationErrors
+}
+
+/*
+CompiledRules are the rules compiled by an Evaluator.
+
+An aggregation rule is compiled on its own, facts.Window then holds its
+window and must be exposed to its condition and action as the Window fact.
+
+Execute runs the rules against the facts of an event: every rule for which
+facts.IsActive holds and whose condition holds fires, in order of decreasing
+priority. A firing rule is reported with facts.RuleFired before its action
+runs and facts.RuleDone once it completed, so the processor can tell the
+rules that set Event.ShouldHandle and apply the match policy.
+*/
+type CompiledRules interface {
+	Execute(ctx context.Context, facts *RuleFacts) error
+}
+
+/*
+RuleFacts are the facts of the event being evaluated, shared by every
+evaluator taking part in the evaluation.
+*/
+type RuleFacts struct {
+	Event   *models.BaseEvent[any]    // The event, rules set Event.ShouldHandle to handle it
+	Payload any                       // The payload of the event, as exposed to the rules
+	Window  *models.AggregationWindow // The window of the aggregation rule being executed, nil for other rules
+
+	gate     *ruleGate
+	listener *firedRulesListener
+	windows  map[string]*models.AggregationWindow
+}
+
+// newRuleFacts creates the facts of an event, with the rules allowed to fire, the listener recording them and the windows of the aggregation rules.
+func newRuleFacts(event *models.BaseEvent[any], payload any, gate *ruleGate, listener *firedRulesListener, windows map[string]*models.AggregationWindow) *RuleFacts {
+	return &RuleFacts{Event: event, Payload: payload, gate: gate, listener: listener, windows: windows}
+}
+
+// IsActive reports whether the rule may fire for the event, rules skipped as duplicates may not.
+func (f *RuleFacts) IsActive(ruleID string) bool {
+	return f.gate.IsActive(ruleID)
+}
+
+// RuleFired records that the rule fired, it must be called before its action runs.
+func (f *RuleFacts) RuleFired(rule models.Rule) {
+	f.listener.start(rule.RuleId, rule.EffectiveLanguage())
+}
+
+// RuleDone records the effect of the action of the last fired rule.
+func (f *RuleFacts) RuleDone() {
+	f.listener.observe()
+}
+
+// evaluatorSet holds the Evaluator of every rule language known to a processor or a repository.
+type evaluatorSet map[string]Evaluator
+
+// newEvaluatorSet returns the built-in evaluators and the given ones, which replace a built-in evaluator of the same language.
+func newEvaluatorSet(evaluators ...Evaluator) evaluatorSet {
+	set := evaluatorSet{
+		models.RULE_LANGUAGE_GRL:  grlEvaluator{},
+		models.RULE_LANGUAGE_EXPR: exprEvaluator{},
+	}
+	for _, evaluator := range evaluators {
+		set[evaluator.Language()] = evaluator
+	}
+	return set
+}
+
+// forRule returns the evaluator of the language of a rule.
+func (s evaluatorSet) forRule(rule models.Rule) (Evaluator, error) {
+	evaluator, ok := s[rule.EffectiveLanguage()]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule language '%s'", rule.Language)
+	}
+	return evaluator, nil
+}
+
+// sortRulesByPriority returns the rules in order of decreasing priority, rules of equal priority keep their order.
+func sortRulesByPriority(rules []models.Rule) []models.Rule {
+	sorted := append([]models.Rule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return sorted
+}
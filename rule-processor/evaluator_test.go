@@ -0,0 +1,175 @@
+package rule_processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+// alwaysEvaluator fires every active rule, ignoring its condition and action.
+type alwaysEvaluator struct{}
+
+type alwaysCompiledRules struct {
+	rules []models.Rule
+}
+
+func (alwaysEvaluator) Language() string {
+	return "test_always"
+}
+
+func (alwaysEvaluator) Compile(rules []models.Rule) (CompiledRules, error) {
+	return &alwaysCompiledRules{rules: sortRulesByPriority(rules)}, nil
+}
+
+func (alwaysEvaluator) Validate(rule models.Rule) RuleValidationErrors {
+	return nil
+}
+
+func (c *alwaysCompiledRules) Execute(ctx context.Context, facts *RuleFacts) error {
+	for _, rule := range c.rules {
+		if !facts.IsActive(rule.RuleId) {
+			continue
+		}
+		facts.RuleFired(rule)
+		facts.Event.ShouldHandle = true
+		facts.RuleDone()
+	}
+	return nil
+}
+
+func TestGRuleProcessor_EvaluateMixedLanguages(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{
+		DEFAULT_TENANT_RULE_ID: {
+			{
+				RuleId:    "disk_warning",
+				EventType: "disk_space",
+				Condition: "Payload.Usage >= 80 && Event.ShouldHandle == false",
+				Action:    "Event.ShouldHandle = true",
+				Priority:  1,
+			},
+			{
+				RuleId:        "disk_critical",
+				EventType:     "disk_space",
+				Language:      models.RULE_LANGUAGE_EXPR,
+				Condition:     "Payload.Usage >= 95 && Event.ShouldHandle == false",
+				Action:        "Event.ShouldHandle = true",
+				Deduplication: true,
+				Priority:      5,
+				Actions:       []models.RuleAction{{Kind: "recording"}},
+			},
+			{
+				RuleId:    "disk_full",
+				EventType: "disk_space",
+				Condition: "Payload.Usage == 100 && Event.ShouldHandle == false",
+				Action:    "Event.ShouldHandle = true",
+				Priority:  10,
+			},
+		},
+	}}
+	cfg := &FrameworkConfig{TenantMatchPolicies: map[string]MatchPolicy{"tenant_all": MATCH_POLICY_ALL_MATCHING}}
+	handler := &recordingActionHandler{}
+	processor, eventStore := newTestProcessor(t, cfg, WithRuleRepository(repo), WithActionHandler("recording", handler))
+
+	// Rules of both languages fire in order of decreasing priority.
+	result, err := processor.EvaluateWithResult(context.Background(), diskEvent("tenant_all", 100))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if want := []string{"disk_full", "disk_critical", "disk_warning"}; !reflect.DeepEqual(result.HandledRuleIDs, want) {
+		t.Errorf("HandledRuleIDs = %v, want %v", result.HandledRuleIDs, want)
+	}
+	kinds := map[string]string{}
+	for _, action := range result.ActionsExecuted {
+		if action.Kind == models.ACTION_KIND_GRL || action.Kind == models.RULE_LANGUAGE_EXPR {
+			kinds[action.RuleID] = action.Kind
+		}
+	}
+	if want := map[string]string{"disk_full": "grl", "disk_critical": "expr", "disk_warning": "grl"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("inline action kinds = %v, want %v", kinds, want)
+	}
+	if eventStore.Count() != 3 || len(handler.requests) != 1 || handler.requests[0].Rule.RuleId != "disk_critical" {
+		t.Errorf("event store holds %d events, dispatched actions = %+v", eventStore.Count(), handler.requests)
+	}
+
+	// The expr rule is deduplicated like any other rule.
+	result, err = processor.EvaluateWithResult(context.Background(), diskEvent("tenant_all", 97))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if len(result.DedupSkipped) != 1 || result.DedupSkipped[0].RuleID != "disk_critical" {
+		t.Errorf("DedupSkipped = %+v", result.DedupSkipped)
+	}
+	if !reflect.DeepEqual(result.HandledRuleIDs, []string{"disk_warning"}) {
+		t.Errorf("HandledRuleIDs = %v, want [disk_warning]", result.HandledRuleIDs)
+	}
+
+	// Under the first-match policy the expr rule stops the lower priority GRL rule.
+	result, err = processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 97))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.HandledRuleIDs, []string{"disk_critical"}) {
+		t.Errorf("first-match HandledRuleIDs = %v, want [disk_critical]", result.HandledRuleIDs)
+	}
+}
+
+func TestGRuleProcessor_EvaluateExprRuntimeError(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{
+		DEFAULT_TENANT_RULE_ID: {{
+			RuleId:    "disk_80",
+			EventType: "disk_space",
+			Language:  models.RULE_LANGUAGE_EXPR,
+			Condition: "Payload.Usage % 0 > 1",
+			Action:    "Event.ShouldHandle = true",
+		}},
+	}}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+
+	if _, err := processor.Evaluate(context.Background(), diskEvent("tenant1", 80)); err == nil {
+		t.Error("Evaluate() expected an error for a modulo by zero")
+	}
+}
+
+func TestWithEvaluator(t *testing.T) {
+	rule := models.Rule{RuleId: "always", EventType: "disk_space", Language: "test_always", Condition: "always", Action: "handle"}
+	if errs := ValidateRule(rule); len(errs) != 1 || errs[0].Field != RULE_FIELD_LANGUAGE {
+		t.Fatalf("ValidateRule() = %v, want an unknown language error", errs)
+	}
+	if errs := ValidateRule(rule, alwaysEvaluator{}); len(errs) > 0 {
+		t.Errorf("ValidateRule() with the evaluator = %v", errs)
+	}
+
+	// Evaluators are per processor, a processor without the evaluator cannot compile the rule.
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	without, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+	if _, err := without.Evaluate(context.Background(), diskEvent("tenant1", 10)); err == nil {
+		t.Error("Evaluate() expected an unknown rule language error without the evaluator")
+	}
+
+	processor, eventStore := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithEvaluator(alwaysEvaluator{}))
+	result, err := processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 10))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if result.HandledByRuleID != "always" || eventStore.Count() != 1 {
+		t.Errorf("result = %+v, event store holds %d events", result, eventStore.Count())
+	}
+}
+
+func TestNewJsonRuleRepository_Evaluators(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `{"tenant_default": [{"rule_id": "always", "event_type": "disk_space", "language": "test_always", "condition": "always", "action": "handle"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJsonRuleRepository(path); err == nil {
+		t.Error("NewJsonRuleRepository() expected an unknown rule language error")
+	}
+	if _, err := NewJsonRuleRepository(path, alwaysEvaluator{}); err != nil {
+		t.Errorf("NewJsonRuleRepository() with the evaluator error = %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package rule_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser/lexer"
+	"github.com/expr-lang/expr/types"
+	"github.com/expr-lang/expr/vm"
+	"reflect"
+)
+
+/*
+exprEvaluator is the Evaluator of the rules written in expr, executed by
+github.com/expr-lang/expr.
+
+A condition is an expr expression over the Event, Payload and, for
+aggregation rules, Window facts, type checked at load against the payload
+type registered for the event type of the rule:
+
+	condition: Payload.Usage >= 80 && Payload.Host.Name matches "^db-" && !Event.ShouldHandle
+	action:    Event.ShouldHandle = true
+
+expr has no assignments, an action is a list of assignments separated by
+";" whose values are expr expressions and whose targets are fields of the
+facts, or entries of maps with string keys.
+
+Rules are evaluated in a single pass in order of decreasing priority, each
+condition is evaluated when its rule is reached and sees the effects of the
+actions of the rules that fired before it. A rule fires at most once per
+event, as with GRL.
+*/
+type exprEvaluator struct{}
+
+// exprRule is a rule of the expr language with its compiled condition and action.
+type exprRule struct {
+	rule        models.Rule
+	condition   *vm.Program
+	action      []exprAssignment
+	payloadType reflect.Type // The pointer to the payload struct the rule was compiled against, nil when unknown
+}
+
+// exprAssignment assigns the value of an expression to the field at path, path starts with the name of a fact.
+type exprAssignment struct {
+	path  []string
+	value *vm.Program
+}
+
+// exprCompiledRules are rules of the expr language in order of decreasing priority, they are only read once compiled.
+type exprCompiledRules struct {
+	rules []exprRule
+}
+
+func (exprEvaluator) Language() string {
+	return models.RULE_LANGUAGE_EXPR
+}
+
+// Compile compiles the condition and action of every rule.
+func (exprEvaluator) Compile(rules []models.Rule) (CompiledRules, error) {
+	compiled := &exprCompiledRules{}
+	for _, rule := range sortRulesByPriority(rules) {
+		env, payloadType := exprEnvironment(rule)
+		condition, err := compileExprCondition(rule.Condition, env)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: condition: %w", rule.RuleId, err)
+		}
+		action, err := compileExprAction(rule.Action, env)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: action: %w", rule.RuleId, err)
+		}
+		compiled.rules = append(compiled.rules, exprRule{rule: rule, condition: condition, action: action, payloadType: payloadType})
+	}
+	return compiled, nil
+}
+
+// Validate compiles the condition and action of the rule and locates their errors.
+func (exprEvaluator) Validate(rule models.Rule) RuleValidationErrors {
+	var errs RuleValidationErrors
+	locate := func(field string, err error) {
+		validationErr := RuleValidationError{RuleID: rule.RuleId, Field: field, Message: err.Error()}
+		var exprErr *file.Error
+		if errors.As(err, &exprErr) {
+			// expr columns start at 0
+			validationErr.Line, validationErr.Column, validationErr.Message = exprErr.Line, exprErr.Column+1, exprErr.Message
+		}
+		errs = append(errs, validationErr)
+	}
+	env, _ := exprEnvironment(rule)
+	if _, err := compileExprCondition(rule.Condition, env); err != nil {
+		locate(RULE_FIELD_CONDITION, err)
+	}
+	if _, err := compileExprAction(rule.Action, env); err != nil {
+		locate(RULE_FIELD_ACTION, err)
+	}
+	return errs
+}
+
+/*
+exprEnvironment returns the facts a rule can reference with their types: the
+event, the payload typed as a pointer to the payload struct registered for
+the event type of the rule, any when there is none, and the window of an
+aggregation rule.
+*/
+func exprEnvironment(rule models.Rule) (types.Map, reflect.Type) {
+	env := types.Map{
+		"Event":   types.TypeOf(&models.BaseEvent[any]{}),
+		"Payload": types.Any,
+	}
+	var payloadType reflect.Type
+	if registered, ok := models.GetEventRegistry().PayloadType(rule.EventType); ok {
+		payloadType = reflect.PointerTo(registered)
+		env["Payload"] = types.TypeOf(reflect.New(registered).Interface())
+	}
+	if rule.Aggregation != nil {
+		env[WINDOW_FACT_NAME] = types.TypeOf(&models.AggregationWindow{})
+	}
+	return env, payloadType
+}
+
+// compileExprCondition compiles a condition, it must be a boolean expression.
+func compileExprCondition(condition string, env types.Map) (*vm.Program, error) {
+	return expr.Compile(condition, expr.Env(env), expr.AsBool())
+}
+
+/*
+compileExprAction compiles the assignments of an action. The action is split
+into statements at the ";" outside of brackets, each statement into its
+target and value at its first "=". Errors are located in the whole action.
+*/
+func compileExprAction(action string, env types.Map) ([]exprAssignment, error) {
+	source := file.NewSource(action)
+	tokens, err := lexer.Lex(source)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(action)
+	fail := func(from int, err error) error {
+		var exprErr *file.Error
+		if !errors.As(err, &exprErr) {
+			exprErr = &file.Error{Message: err.Error()}
+		} else {
+			from += exprErr.From
+		}
+		located := &file.Error{Location: file.Location{From: from}, Message: exprErr.Message}
+		return located.Bind(source)
+	}
+
+	var assignments []exprAssignment
+	var statement []lexer.Token
+	depth := 0
+	for _, token := range tokens {
+		switch {
+		case token.Is(lexer.Bracket, "(", "[", "{"):
+			depth++
+		case token.Is(lexer.Bracket, ")", "]", "}"):
+			depth--
+		}
+		if depth > 0 || !(token.Kind == lexer.EOF || token.Is(lexer.Operator, ";")) {
+			statement = append(statement, token)
+			continue
+		}
+		if len(statement) > 0 {
+			assignment, err := compileExprAssignment(runes, statement, env, fail)
+			if err != nil {
+				return nil, err
+			}
+			assignments = append(assignments, assignment)
+		}
+		statement = nil
+	}
+	if len(assignments) == 0 {
+		return nil, fail(0, errors.New("an action needs at least one assignment"))
+	}
+	return assignments, nil
+}
+
+// compileExprAssignment compiles a statement of an action, `Fact.Field = value`.
+func compileExprAssignment(runes []rune, statement []lexer.Token, env types.Map, fail func(from int, err error) error) (exprAssignment, error) {
+	equals, from := -1, statement[0].From
+	for i, token := range statement {
+		if token.Is(lexer.Operator, "=") {
+			equals = i
+			break
+		}
+		if token.Is(lexer.Operator, "==") && from == statement[0].From {
+			from = token.From
+		}
+	}
+	if equals < 0 {
+		return exprAssignment{}, fail(from, errors.New("expected an assignment, e.g. Event.ShouldHandle = true"))
+	}
+
+	var path []string
+	for i, token := range statement[:equals] {
+		if i%2 == 1 {
+			if !token.Is(lexer.Operator, ".") {
+				return exprAssignment{}, fail(token.From, fmt.Errorf("unexpected %s in the target of the assignment", token.Value))
+			}
+			continue
+		}
+		if token.Kind != lexer.Identifier {
+			return exprAssignment{}, fail(token.From, fmt.Errorf("unexpected %s in the target of the assignment", token.Value))
+		}
+		path = append(path, token.Value)
+	}
+	if len(path) < 2 || equals%2 == 0 {
+		return exprAssignment{}, fail(statement[0].From, errors.New("the target of an assignment must be a field of Event, Payload or Window"))
+	}
+	target := string(runes[statement[0].From:statement[equals-1].To])
+	if _, err := expr.Compile(target, expr.Env(env)); err != nil {
+		return exprAssignment{}, fail(statement[0].From, err)
+	}
+
+	last := statement[len(statement)-1]
+	if equals == len(statement)-1 {
+		return exprAssignment{}, fail(last.From, errors.New("the assignment has no value"))
+	}
+	valueFrom := statement[equals+1].From
+	value, err := expr.Compile(string(runes[valueFrom:last.To]), expr.Env(env))
+	if err != nil {
+		return exprAssignment{}, fail(valueFrom, err)
+	}
+	return exprAssignment{path: path, value: value}, nil
+}
+
+// Execute fires the active rules whose condition holds, in order of decreasing priority.
+func (c *exprCompiledRules) Execute(ctx context.Context, facts *RuleFacts) error {
+	env := map[string]any{"Event": facts.Event, "Payload": facts.Payload}
+	if facts.Window != nil {
+		env[WINDOW_FACT_NAME] = facts.Window
+	}
+	for _, compiled := range c.rules {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !facts.IsActive(compiled.rule.RuleId) {
+			continue
+		}
+		env["Payload"] = exprPayload(facts.Payload, compiled.payloadType)
+		result, err := expr.Run(compiled.condition, env)
+		if err != nil {
+			return fmt.Errorf("rule %s: condition: %w", compiled.rule.RuleId, err)
+		}
+		if matched, _ := result.(bool); !matched {
+			continue
+		}
+
+		facts.RuleFired(compiled.rule)
+		for _, assignment := range compiled.action {
+			if err := assignment.exec(env); err != nil {
+				facts.RuleDone()
+				return fmt.Errorf("rule %s: action: %w", compiled.rule.RuleId, err)
+			}
+		}
+		facts.RuleDone()
+	}
+	return nil
+}
+
+// exprPayload returns a payload struct passed by value as a pointer to a copy, the type the rule was compiled against.
+func exprPayload(payload any, payloadType reflect.Type) any {
+	value := reflect.ValueOf(payload)
+	if payloadType == nil || !value.IsValid() || value.Type() != payloadType.Elem() {
+		return payload
+	}
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+	return pointer.Interface()
+}
+
+// exec evaluates the value of the assignment and stores it in the field of its path.
+func (a exprAssignment) exec(env map[string]any) error {
+	value, err := expr.Run(a.value, env)
+	if err != nil {
+		return err
+	}
+	target := reflect.ValueOf(env[a.path[0]])
+	for i, name := range a.path[1:] {
+		for target.Kind() == reflect.Pointer || target.Kind() == reflect.Interface {
+			if target.IsNil() {
+				return fmt.Errorf("cannot assign %s, %s is nil", name, a.path[i])
+			}
+			target = target.Elem()
+		}
+		last := i == len(a.path)-2
+		switch target.Kind() {
+		case reflect.Struct:
+			field := target.FieldByName(name)
+			if !field.IsValid() || !field.CanSet() {
+				return fmt.Errorf("%s has no settable field %s", target.Type(), name)
+			}
+			if !last {
+				target = field
+				continue
+			}
+			converted, err := convertExprValue(value, field.Type())
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			field.Set(converted)
+		case reflect.Map:
+			if target.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("%s does not have string keys", target.Type())
+			}
+			key := reflect.ValueOf(name).Convert(target.Type().Key())
+			if !last {
+				target = target.MapIndex(key)
+				continue
+			}
+			if target.IsNil() {
+				return fmt.Errorf("cannot assign %s of a nil map", name)
+			}
+			converted, err := convertExprValue(value, target.Type().Elem())
+			if err != nil {
+				return fmt.Errorf("entry %s: %w", name, err)
+			}
+			target.SetMapIndex(key, converted)
+		default:
+			return fmt.Errorf("cannot assign %s of a %s", name, target.Type())
+		}
+	}
+	return nil
+}
+
+// convertExprValue converts the value of an expression to the type of the field it is assigned to, numbers convert between Go types.
+func convertExprValue(value any, to reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(to), nil
+	}
+	converted := reflect.ValueOf(value)
+	if converted.Type().AssignableTo(to) {
+		return converted, nil
+	}
+	if isExprNumber(converted.Kind()) && isExprNumber(to.Kind()) {
+		return converted.Convert(to), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot assign a %s to a %s", converted.Type(), to)
+}
+
+// isExprNumber reports whether values of the kind are numbers.
+func isExprNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
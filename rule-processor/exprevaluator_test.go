@@ -0,0 +1,161 @@
+package rule_processor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type exprHost struct {
+	Name  string
+	Cores uint
+}
+
+type exprPayloadFixture struct {
+	Usage  int
+	Load   float64
+	Host   *exprHost
+	Labels map[string]string
+}
+
+func (p *exprPayloadFixture) IsCritical(threshold int) bool {
+	return p.Usage >= threshold
+}
+
+func init() {
+	models.GetEventRegistry().RegisterEventType("host_usage", func() models.Evaluable {
+		return &models.BaseEvent[exprPayloadFixture]{}
+	})
+}
+
+// executeExprRule compiles a host_usage rule and executes it against the event and payload.
+func executeExprRule(t *testing.T, rule models.Rule, event *models.BaseEvent[any], payload any) error {
+	t.Helper()
+	rule.EventType, rule.Language = "host_usage", models.RULE_LANGUAGE_EXPR
+	if rule.RuleId == "" {
+		rule.RuleId = "host_rule"
+	}
+	compiled, err := exprEvaluator{}.Compile([]models.Rule{rule})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	gate := newRuleGate()
+	gate.activate(rule.RuleId)
+	listener := newFiredRulesListener(event, MATCH_POLICY_ALL_MATCHING, gate)
+	err = compiled.Execute(context.Background(), newRuleFacts(event, payload, gate, listener, nil))
+	listener.finish()
+	return err
+}
+
+func TestExprEvaluator_Condition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{`Payload.Usage >= 80 && Event.ShouldHandle == false`, true},
+		{`Payload.Usage > 90 || !(Payload.Host.Name == "db")`, false},
+		{`Payload.Load * 2 == 3`, true},
+		{`Payload.Host.Cores == 8 && Payload.Host.Cores > 7.5`, true},
+		{`Payload.Labels.zone == "eu" && !("region" in Payload.Labels)`, true},
+		{`Payload.IsCritical(80) && !Payload.IsCritical(90)`, true},
+		{`Payload.Host.Name contains "d" && Payload.Host.Name matches "^d[a-z]+$"`, true},
+		{`Event.TenantID startsWith "tenant" && Payload.Usage in [85, 95]`, true},
+		{"Payload.Usage >= 80 &&\n\tPayload.Host != nil", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			// Payloads are passed by value and by pointer.
+			for _, byValue := range []bool{false, true} {
+				payload := &exprPayloadFixture{Usage: 85, Load: 1.5, Host: &exprHost{Name: "db", Cores: 8}, Labels: map[string]string{"zone": "eu"}}
+				event := &models.BaseEvent[any]{TenantID: "tenant1", Type: "host_usage"}
+				var facts any = payload
+				if byValue {
+					facts = *payload
+				}
+				rule := models.Rule{Condition: tt.condition, Action: "Event.ShouldHandle = true"}
+				if err := executeExprRule(t, rule, event, facts); err != nil {
+					t.Fatalf("Execute() error = %v", err)
+				}
+				if event.ShouldHandle != tt.want {
+					t.Errorf("Execute() by value %v: ShouldHandle = %v, want %v", byValue, event.ShouldHandle, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExprEvaluator_Action(t *testing.T) {
+	payload := &exprPayloadFixture{Usage: 85, Host: &exprHost{Name: "db"}, Labels: map[string]string{}}
+	event := &models.BaseEvent[any]{TenantID: "tenant1", Type: "host_usage"}
+	rule := models.Rule{
+		Condition: "Payload.Usage >= 80",
+		Action:    "Payload.Usage = Payload.Usage / 5;\n Payload.Host.Name = upper(Payload.Host.Name); Payload.Labels.zone = \"eu\"; Payload.Load = Payload.Usage; Event.ShouldHandle = true",
+	}
+	if err := executeExprRule(t, rule, event, payload); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := &exprPayloadFixture{Usage: 17, Load: 17, Host: &exprHost{Name: "DB"}, Labels: map[string]string{"zone": "eu"}}
+	if !reflect.DeepEqual(payload, want) || !event.ShouldHandle {
+		t.Errorf("Execute() payload = %+v, ShouldHandle = %v, want %+v and true", payload, event.ShouldHandle, want)
+	}
+}
+
+func TestExprEvaluator_ActionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+	}{
+		{"nil struct", "Payload.Host.Name = \"db\""},
+		{"nil map", "Payload.Labels.zone = \"eu\""},
+		{"wrong type", "Payload.Usage = \"high\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.BaseEvent[any]{TenantID: "tenant1", Type: "host_usage"}
+			rule := models.Rule{Condition: "true", Action: tt.action}
+			if err := executeExprRule(t, rule, event, &exprPayloadFixture{}); err == nil {
+				t.Error("Execute() expected an error")
+			}
+		})
+	}
+}
+
+func TestExprEvaluator_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		condition  string
+		action     string
+		wantField  string
+		wantLine   int
+		wantColumn int
+	}{
+		{"valid", "Payload.Usage >= 80", "Payload.Labels.zone = \"eu\"; Event.ShouldHandle = true", "", 0, 0},
+		{"condition is not a boolean", "Payload.Usage + 1", "Event.ShouldHandle = true", RULE_FIELD_CONDITION, 0, 0},
+		{"unknown method", "Payload.IsHigh()", "Event.ShouldHandle = true", RULE_FIELD_CONDITION, 1, 9},
+		{"empty action", "true", " ", RULE_FIELD_ACTION, 1, 1},
+		{"fact as target", "true", "Event = true", RULE_FIELD_ACTION, 1, 1},
+		{"unknown target field", "true", "Event.ShouldHandle = true; Payload.Used = 1", RULE_FIELD_ACTION, 1, 36},
+		{"missing value", "true", "Event.ShouldHandle =", RULE_FIELD_ACTION, 1, 20},
+		{"value error on a later line", "true", "Event.ShouldHandle = true;\nPayload.Usage = Payload.Used", RULE_FIELD_ACTION, 2, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := models.Rule{RuleId: "host_rule", EventType: "host_usage", Language: models.RULE_LANGUAGE_EXPR, Condition: tt.condition, Action: tt.action}
+			errs := exprEvaluator{}.Validate(rule)
+			if tt.wantField == "" {
+				if len(errs) != 0 {
+					t.Fatalf("Validate() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatal("Validate() expected errors")
+			}
+			if got := errs[0]; got.Field != tt.wantField || got.Line != tt.wantLine || got.Column != tt.wantColumn {
+				t.Errorf("Validate() = %+v, want field %s at %d:%d", got, tt.wantField, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
@@ -43,12 +43,102 @@ func (cfg *EventStateStoreConfig) GenerateDSN() string {
 	)
 }
 
+/*
+EmailConfig holds the SMTP server details and templates used by the email
+action.
+
+Recipients are configured per tenant, the DEFAULT_TENANT_RULE_ID entry is
+used for tenants without their own list. The subject and body are Go
+text/templates that can reference .Event, .Payload and .Rule, e.g.
+{{.Payload.Usage}}.
+*/
+type EmailConfig struct {
+	Host            string              `json:"host"`
+	Port            int                 `json:"port"`
+	Username        string              `json:"username"`
+	Password        string              `json:"password"`
+	From            string              `json:"from"`
+	Recipients      map[string][]string `json:"recipients"`
+	SubjectTemplate string              `json:"subject_template"`
+	BodyTemplate    string              `json:"body_template"`
+	TimeoutSeconds  int                 `json:"timeout_seconds"`
+}
+
+// Address returns the host:port address of the SMTP server.
+func (cfg *EmailConfig) Address() string {
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+// RecipientsFor returns the recipients of a tenant, falling back to the default tenant's recipients.
+func (cfg *EmailConfig) RecipientsFor(tenantID string) []string {
+	if recipients, ok := cfg.Recipients[tenantID]; ok {
+		return recipients
+	}
+	return cfg.Recipients[DEFAULT_TENANT_RULE_ID]
+}
+
+/*
+WebhookConfig holds the webhook endpoints of each tenant and the delivery
+settings used by the webhook action.
+
+Endpoints are configured per tenant, the DEFAULT_TENANT_RULE_ID entry is used
+for tenants without their own endpoints. Failed deliveries are retried up to
+MaxRetries times with an exponential backoff starting at InitialBackoffMillis
+and capped at MaxBackoffMillis.
+*/
+type WebhookConfig struct {
+	Endpoints            map[string][]WebhookEndpoint `json:"endpoints"`
+	TimeoutSeconds       int                          `json:"timeout_seconds"`
+	MaxRetries           int                          `json:"max_retries"`
+	InitialBackoffMillis int                          `json:"initial_backoff_millis"`
+	MaxBackoffMillis     int                          `json:"max_backoff_millis"`
+}
+
+// WebhookEndpoint is a URL fired rules are posted to and the secret used to sign the requests.
+type WebhookEndpoint struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// EndpointsFor returns the endpoints of a tenant, falling back to the default tenant's endpoints.
+func (cfg *WebhookConfig) EndpointsFor(tenantID string) []WebhookEndpoint {
+	if endpoints, ok := cfg.Endpoints[tenantID]; ok {
+		return endpoints
+	}
+	return cfg.Endpoints[DEFAULT_TENANT_RULE_ID]
+}
+
+// RuleRepoType selects where the rules of the processor are read from.
+type RuleRepoType string
+
+const (
+	// RULE_REPO_TYPE_JSON reads the rules from the JSON rule file at RuleRepoPath.
+	RULE_REPO_TYPE_JSON RuleRepoType = "json"
+	// RULE_REPO_TYPE_POSTGRES reads the rules from the rules table of the event state store database.
+	RULE_REPO_TYPE_POSTGRES RuleRepoType = "postgres"
+	// RULE_REPO_TYPE_VERSIONED reads the active rule set revisions from the event state store database.
+	RULE_REPO_TYPE_VERSIONED RuleRepoType = "versioned"
+)
+
 // FrameworkConfig holds all configuration for the rule engine.
 type FrameworkConfig struct {
 	EventStoreConfigPath string
 	RuleRepoPath         string
+	RuleRepoType         RuleRepoType
+	EmailConfigPath      string
+	WebhookConfigPath    string
 	CleanupInterval      time.Duration
+	RuleReloadInterval   time.Duration
+	RuleReloadCallback   func(err error)
+	DefaultMatchPolicy   MatchPolicy
+	TenantMatchPolicies  map[string]MatchPolicy
+	DefaultTimezone      string            // IANA timezone the rule schedules are read in, UTC when empty
+	TenantTimezones      map[string]string // IANA timezone of each tenant with its own
+	DynamicEventTypes    []string
 	eventStoreConfig     *EventStateStoreConfig
+	emailConfig          *EmailConfig
+	webhookConfig        *WebhookConfig
+	locations            map[string]*time.Location
 	rules                map[string]map[string][]models.Rule
 }
 
@@ -63,6 +153,42 @@ The following options are available:
 
 - WithCleanupInterval(time.Duration): sets the event cleanup interval.
 
+- WithEmailConfigPath(string): sets the path to the SMTP configuration file,
+the email action is only available when it is set.
+
+- WithWebhookConfigPath(string): sets the path to the webhook configuration
+file, the webhook action is only available when it is set.
+
+- WithPostgresRuleRepository(): reads the rules from the rules table of the
+event state store database instead of the rule file.
+
+- WithVersionedRuleRepository(): reads the active rule set revisions of the
+tenants from the event state store database.
+
+- WithRuleReloadInterval(time.Duration): polls the rule file for changes at
+the given interval and reloads it, disabled by default. With the postgres
+and versioned rule repositories it is the cache refresh interval,
+DEFAULT_RULE_REFRESH_INTERVAL by default.
+
+- WithRuleReloadCallback(func(error)): called after every reload of the rule
+file, with the error if the new file was rejected.
+
+- WithMatchPolicy(MatchPolicy): sets the match policy of the processor,
+first-match by default.
+
+- WithTenantMatchPolicy(string, MatchPolicy): overrides the match policy for
+a tenant.
+
+- WithTimezone(string): sets the IANA timezone the schedules of the rules are
+read in, e.g. "Europe/Berlin", UTC by default.
+
+- WithTenantTimezone(string, string): overrides the timezone for a tenant.
+
+- WithDynamicEventTypes(...string): declares event types without a Go
+struct, their JSON payload is read in the rules with Payload.GetInt("key")
+and the other models.DynamicPayload accessors. NewGRuleProcessor registers
+them in the EventRegistry.
+
 The provided options are applied to the configuration in order. If an option
 is not provided, the default value is used.
 
@@ -71,7 +197,10 @@ applied. If the loading process fails, an error is returned.
 */
 func NewFrameworkConfig(opts ...FrameworkConfigOption) (*FrameworkConfig, error) {
 	cfg := &FrameworkConfig{
-		CleanupInterval: 24 * time.Hour, // Default cleanup interval
+		CleanupInterval:     24 * time.Hour,           // Default cleanup interval
+		RuleRepoType:        RULE_REPO_TYPE_JSON,      // Default rule repository
+		DefaultMatchPolicy:  MATCH_POLICY_FIRST_MATCH, // Default match policy
+		TenantMatchPolicies: make(map[string]MatchPolicy),
 	}
 
 	for _, opt := range opts {
@@ -79,9 +208,11 @@ func NewFrameworkConfig(opts ...FrameworkConfigOption) (*FrameworkConfig, error)
 	}
 
 	// Load configurations from provided paths
-	if err := cfg.Load(); err != nil {
+	dynamicEventTypes, err := cfg.Load()
+	if err != nil {
 		return nil, err
 	}
+	cfg.DynamicEventTypes = dynamicEventTypes
 
 	return cfg, nil
 }
@@ -98,18 +229,190 @@ func (cfg *FrameworkConfig) GetCleanupInterval() time.Duration {
 	return cfg.CleanupInterval
 }
 
+// GetRuleRepoType returns where the rules are read from, the JSON rule file by default.
+func (cfg *FrameworkConfig) GetRuleRepoType() RuleRepoType {
+	if cfg.RuleRepoType == "" {
+		return RULE_REPO_TYPE_JSON
+	}
+	return cfg.RuleRepoType
+}
+
+// GetRuleReloadInterval returns the rule reload interval, the database rule repositories always refresh their cache.
+func (cfg *FrameworkConfig) GetRuleReloadInterval() time.Duration {
+	if cfg.RuleReloadInterval <= 0 && cfg.GetRuleRepoType() != RULE_REPO_TYPE_JSON {
+		return DEFAULT_RULE_REFRESH_INTERVAL
+	}
+	return cfg.RuleReloadInterval
+}
+
+func (cfg *FrameworkConfig) GetRuleReloadCallback() func(err error) {
+	return cfg.RuleReloadCallback
+}
+
 func (cfg *FrameworkConfig) DbConfig() *EventStateStoreConfig {
 	return cfg.eventStoreConfig
 }
 
-func (cfg *FrameworkConfig) Load() error {
+// MatchPolicy returns the match policy of a tenant, falling back to the default match policy.
+func (cfg *FrameworkConfig) MatchPolicy(tenantID string) MatchPolicy {
+	if policy, ok := cfg.TenantMatchPolicies[tenantID]; ok {
+		return policy
+	}
+	if cfg.DefaultMatchPolicy == "" {
+		return MATCH_POLICY_FIRST_MATCH
+	}
+	return cfg.DefaultMatchPolicy
+}
+
+/*
+Timezone returns the location the rule schedules of a tenant are read in:
+the timezone of the tenant, falling back to the default timezone, then UTC.
+Timezones that cannot be loaded fall back to UTC, Load rejects them.
+*/
+func (cfg *FrameworkConfig) Timezone(tenantID string) *time.Location {
+	name, ok := cfg.TenantTimezones[tenantID]
+	if !ok {
+		name = cfg.DefaultTimezone
+	}
+	if location, ok := cfg.locations[name]; ok {
+		return location
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func (cfg *FrameworkConfig) EmailConfig() *EmailConfig {
+	return cfg.emailConfig
+}
+
+func (cfg *FrameworkConfig) WebhookConfig() *WebhookConfig {
+	return cfg.webhookConfig
+}
+
+func (cfg *FrameworkConfig) GetDynamicEventTypes() []string {
+	return cfg.DynamicEventTypes
+}
+
+/*
+Load validates the configuration and loads the configurations from the
+provided paths.
+
+Returns the dynamic event types of the configuration without duplicates,
+they are not registered: NewGRuleProcessor registers them, or
+RegisterDynamicEventTypes when the processor is given its rule repository.
+*/
+func (cfg *FrameworkConfig) Load() ([]string, error) {
+	if err := cfg.ValidateMatchPolicies(); err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateTimezones(); err != nil {
+		return nil, err
+	}
+	switch cfg.GetRuleRepoType() {
+	case RULE_REPO_TYPE_JSON, RULE_REPO_TYPE_POSTGRES, RULE_REPO_TYPE_VERSIONED:
+	default:
+		return nil, fmt.Errorf("unknown rule repository type '%s'", cfg.RuleRepoType)
+	}
 	//Load DB config from the provided path by the consumer.
 	if err := cfg.LoadDBConfig(); err != nil {
-		return errors.New("load db config failed, Error : " + err.Error())
+		return nil, errors.New("load db config failed, Error : " + err.Error())
+	}
+	//Email config is optional, it is only loaded when a path is provided.
+	if cfg.EmailConfigPath != "" {
+		if err := cfg.LoadEmailConfig(); err != nil {
+			return nil, errors.New("load email config failed, Error : " + err.Error())
+		}
+	}
+	//Webhook config is optional, it is only loaded when a path is provided.
+	if cfg.WebhookConfigPath != "" {
+		if err := cfg.LoadWebhookConfig(); err != nil {
+			return nil, errors.New("load webhook config failed, Error : " + err.Error())
+		}
+	}
+	return cfg.ValidateDynamicEventTypes()
+}
+
+// ValidateDynamicEventTypes checks the dynamic event types and returns them without duplicates.
+func (cfg *FrameworkConfig) ValidateDynamicEventTypes() ([]string, error) {
+	seen := make(map[string]bool, len(cfg.DynamicEventTypes))
+	var eventTypes []string
+	for _, eventType := range cfg.DynamicEventTypes {
+		if eventType == "" {
+			return nil, errors.New("dynamic event type cannot be empty")
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	return eventTypes, nil
+}
+
+/*
+RegisterDynamicEventTypes registers event types without a Go struct in the
+EventRegistry. NewGRuleProcessor registers the dynamic event types of a
+DynamicEventTypesConfig before it loads the rules, a rule repository created
+before the processor must be created after they are registered so its rules
+are validated against the DynamicPayload accessors.
+
+Returns an error if an event type is already registered with a payload
+struct, a dynamic registration would silently replace it.
+*/
+func RegisterDynamicEventTypes(eventTypes ...string) error {
+	registry := models.GetEventRegistry()
+	for _, eventType := range eventTypes {
+		if eventType == "" {
+			return errors.New("dynamic event type cannot be empty")
+		}
+		if _, registered := registry.PayloadType(eventType); registered && !registry.IsDynamicEventType(eventType) {
+			return fmt.Errorf("dynamic event type '%s' is already registered with a payload struct", eventType)
+		}
+		registry.RegisterDynamicEventType(eventType)
 	}
 	return nil
 }
 
+// ValidateMatchPolicies checks the default and the tenant match policies.
+func (cfg *FrameworkConfig) ValidateMatchPolicies() error {
+	if cfg.DefaultMatchPolicy != "" {
+		if err := cfg.DefaultMatchPolicy.Validate(); err != nil {
+			return err
+		}
+	}
+	for tenantID, policy := range cfg.TenantMatchPolicies {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+	}
+	return nil
+}
+
+// ValidateTimezones loads the default and the tenant timezones, keeping them for Timezone.
+func (cfg *FrameworkConfig) ValidateTimezones() error {
+	locations := make(map[string]*time.Location)
+	load := func(name string) error {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("unknown timezone '%s': %w", name, err)
+		}
+		locations[name] = location
+		return nil
+	}
+	if err := load(cfg.DefaultTimezone); err != nil {
+		return err
+	}
+	for tenantID, name := range cfg.TenantTimezones {
+		if err := load(name); err != nil {
+			return fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+	}
+	cfg.locations = locations
+	return nil
+}
+
 // LoadDBConfig loads the database configuration from a JSON file.
 func (cfg *FrameworkConfig) LoadDBConfig() error {
 	file, err := os.ReadFile(cfg.EventStoreConfigPath)
@@ -124,3 +427,33 @@ func (cfg *FrameworkConfig) LoadDBConfig() error {
 	cfg.eventStoreConfig = &dbConfig
 	return nil
 }
+
+// LoadEmailConfig loads the SMTP configuration from a JSON file.
+func (cfg *FrameworkConfig) LoadEmailConfig() error {
+	file, err := os.ReadFile(cfg.EmailConfigPath)
+	if err != nil {
+		return err
+	}
+	var emailConfig EmailConfig
+	err = json.Unmarshal(file, &emailConfig)
+	if err != nil {
+		return err
+	}
+	cfg.emailConfig = &emailConfig
+	return nil
+}
+
+// LoadWebhookConfig loads the webhook configuration from a JSON file.
+func (cfg *FrameworkConfig) LoadWebhookConfig() error {
+	file, err := os.ReadFile(cfg.WebhookConfigPath)
+	if err != nil {
+		return err
+	}
+	var webhookConfig WebhookConfig
+	err = json.Unmarshal(file, &webhookConfig)
+	if err != nil {
+		return err
+	}
+	cfg.webhookConfig = &webhookConfig
+	return nil
+}
@@ -0,0 +1,114 @@
+package rule_processor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+func writeTestDBConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db_config.json")
+	if err := os.WriteFile(path, []byte(`{"host": "localhost", "port": 5432}`), 0o600); err != nil {
+		t.Fatalf("failed to write db config: %v", err)
+	}
+	return path
+}
+
+func TestFrameworkConfig_MatchPolicy(t *testing.T) {
+	cfg, err := NewFrameworkConfig(
+		WithDBConfigPath(writeTestDBConfig(t)),
+		WithTenantMatchPolicy("tenant_all", MATCH_POLICY_ALL_MATCHING),
+	)
+	if err != nil {
+		t.Fatalf("NewFrameworkConfig() error = %v", err)
+	}
+	if got := cfg.MatchPolicy("tenant1"); got != MATCH_POLICY_FIRST_MATCH {
+		t.Errorf("MatchPolicy(tenant1) = %s, want %s", got, MATCH_POLICY_FIRST_MATCH)
+	}
+	if got := cfg.MatchPolicy("tenant_all"); got != MATCH_POLICY_ALL_MATCHING {
+		t.Errorf("MatchPolicy(tenant_all) = %s, want %s", got, MATCH_POLICY_ALL_MATCHING)
+	}
+
+	cfg, err = NewFrameworkConfig(
+		WithDBConfigPath(writeTestDBConfig(t)),
+		WithMatchPolicy(MATCH_POLICY_ALL_MATCHING),
+		WithTenantMatchPolicy("tenant_first", MATCH_POLICY_FIRST_MATCH),
+	)
+	if err != nil {
+		t.Fatalf("NewFrameworkConfig() error = %v", err)
+	}
+	if got := cfg.MatchPolicy("tenant1"); got != MATCH_POLICY_ALL_MATCHING {
+		t.Errorf("MatchPolicy(tenant1) = %s, want %s", got, MATCH_POLICY_ALL_MATCHING)
+	}
+	if got := cfg.MatchPolicy("tenant_first"); got != MATCH_POLICY_FIRST_MATCH {
+		t.Errorf("MatchPolicy(tenant_first) = %s, want %s", got, MATCH_POLICY_FIRST_MATCH)
+	}
+
+	if _, err = NewFrameworkConfig(
+		WithDBConfigPath(writeTestDBConfig(t)),
+		WithTenantMatchPolicy("tenant1", "most-matching"),
+	); err == nil {
+		t.Error("NewFrameworkConfig() expected an error for an unknown match policy")
+	}
+}
+
+func TestFrameworkConfig_DynamicEventTypes(t *testing.T) {
+	cfg, err := NewFrameworkConfig(WithDBConfigPath(writeTestDBConfig(t)), WithDynamicEventTypes("config_dynamic", "config_dynamic"))
+	if err != nil {
+		t.Fatalf("NewFrameworkConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg.GetDynamicEventTypes(), []string{"config_dynamic"}) {
+		t.Errorf("GetDynamicEventTypes() = %v, want [config_dynamic]", cfg.GetDynamicEventTypes())
+	}
+	// Loading the configuration has no side effect on the registry, the processor registers them.
+	if _, registered := models.GetEventRegistry().PayloadType("config_dynamic"); registered {
+		t.Fatal("NewFrameworkConfig() registered config_dynamic")
+	}
+	newTestProcessor(t, cfg, WithRuleRepository(&JsonRuleRepository{}))
+	if !models.GetEventRegistry().IsDynamicEventType("config_dynamic") {
+		t.Error("config_dynamic was not registered as a dynamic event type")
+	}
+
+	if _, err := NewFrameworkConfig(WithDBConfigPath(writeTestDBConfig(t)), WithDynamicEventTypes("")); err == nil {
+		t.Error("NewFrameworkConfig() expected an error for an empty event type")
+	}
+	cfg, err = NewFrameworkConfig(WithDBConfigPath(writeTestDBConfig(t)), WithDynamicEventTypes("disk_space"))
+	if err != nil {
+		t.Fatalf("NewFrameworkConfig() error = %v", err)
+	}
+	if _, err := NewGRuleProcessor(cfg, WithRuleRepository(&JsonRuleRepository{})); err == nil {
+		t.Error("NewGRuleProcessor() expected an error for an event type registered with a payload struct")
+	}
+}
+
+func TestFrameworkConfig_Timezone(t *testing.T) {
+	cfg, err := NewFrameworkConfig(
+		WithDBConfigPath(writeTestDBConfig(t)),
+		WithTimezone("Europe/Paris"),
+		WithTenantTimezone("tenant_ny", "America/New_York"),
+	)
+	if err != nil {
+		t.Fatalf("NewFrameworkConfig() error = %v", err)
+	}
+	if got := cfg.Timezone("tenant1").String(); got != "Europe/Paris" {
+		t.Errorf("Timezone(tenant1) = %s, want Europe/Paris", got)
+	}
+	if got := cfg.Timezone("tenant_ny").String(); got != "America/New_York" {
+		t.Errorf("Timezone(tenant_ny) = %s, want America/New_York", got)
+	}
+	if got := (&FrameworkConfig{}).Timezone("tenant1"); got != time.UTC {
+		t.Errorf("Timezone() without timezone = %s, want UTC", got)
+	}
+
+	if _, err = NewFrameworkConfig(
+		WithDBConfigPath(writeTestDBConfig(t)),
+		WithTenantTimezone("tenant1", "Mars/Olympus_Mons"),
+	); err == nil {
+		t.Error("NewFrameworkConfig() expected an error for an unknown timezone")
+	}
+}
@@ -21,9 +21,92 @@ func WithRuleRepoPath(path string) FrameworkConfigOption {
 	}
 }
 
+// WithPostgresRuleRepository reads the rules from the rules table of the event state store database.
+func WithPostgresRuleRepository() FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.RuleRepoType = RULE_REPO_TYPE_POSTGRES
+	}
+}
+
+// WithVersionedRuleRepository reads the active rule set revisions of the tenants from the event state store database.
+func WithVersionedRuleRepository() FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.RuleRepoType = RULE_REPO_TYPE_VERSIONED
+	}
+}
+
 // WithCleanupInterval sets the event cleanup interval.
 func WithCleanupInterval(interval time.Duration) FrameworkConfigOption {
 	return func(cfg *FrameworkConfig) {
 		cfg.CleanupInterval = interval
 	}
 }
+
+// WithEmailConfigPath sets the path to the SMTP configuration file used by the email action.
+func WithEmailConfigPath(path string) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.EmailConfigPath = path
+	}
+}
+
+// WithWebhookConfigPath sets the path to the webhook configuration file used by the webhook action.
+func WithWebhookConfigPath(path string) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.WebhookConfigPath = path
+	}
+}
+
+// WithMatchPolicy sets the match policy used for tenants without their own policy.
+func WithMatchPolicy(policy MatchPolicy) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.DefaultMatchPolicy = policy
+	}
+}
+
+// WithTenantMatchPolicy overrides the match policy for a tenant.
+func WithTenantMatchPolicy(tenantID string, policy MatchPolicy) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		if cfg.TenantMatchPolicies == nil {
+			cfg.TenantMatchPolicies = make(map[string]MatchPolicy)
+		}
+		cfg.TenantMatchPolicies[tenantID] = policy
+	}
+}
+
+// WithTimezone sets the IANA timezone the rule schedules of tenants without their own timezone are read in.
+func WithTimezone(name string) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.DefaultTimezone = name
+	}
+}
+
+// WithTenantTimezone overrides the IANA timezone the rule schedules of a tenant are read in.
+func WithTenantTimezone(tenantID, name string) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		if cfg.TenantTimezones == nil {
+			cfg.TenantTimezones = make(map[string]string)
+		}
+		cfg.TenantTimezones[tenantID] = name
+	}
+}
+
+// WithRuleReloadInterval enables hot reload of the rule file, polling it for changes at the given interval.
+func WithRuleReloadInterval(interval time.Duration) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.RuleReloadInterval = interval
+	}
+}
+
+// WithRuleReloadCallback sets the function called after every reload of the rule file.
+func WithRuleReloadCallback(callback func(err error)) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.RuleReloadCallback = callback
+	}
+}
+
+// WithDynamicEventTypes declares event types without a Go struct, read in the rules through the DynamicPayload accessors.
+func WithDynamicEventTypes(eventTypes ...string) FrameworkConfigOption {
+	return func(cfg *FrameworkConfig) {
+		cfg.DynamicEventTypes = append(cfg.DynamicEventTypes, eventTypes...)
+	}
+}
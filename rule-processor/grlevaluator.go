@@ -0,0 +1,173 @@
+package rule_processor
+
+import (
+	"context"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/hyperjumptech/grule-rule-engine/ast"
+	"github.com/hyperjumptech/grule-rule-engine/builder"
+	"github.com/hyperjumptech/grule-rule-engine/engine"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+	"strings"
+	"sync"
+)
+
+const (
+	KNOWLEDGE_BASE_NAME    = "EventRules"
+	KNOWLEDGE_BASE_VERSION = "0.0.1"
+)
+
+// grlEvaluator is the Evaluator of the rules written in GRL, executed by grule.
+type grlEvaluator struct{}
+
+/*
+grlCompiledRules holds the compiled GRL of rules.
+
+All rules are built into a single KnowledgeBase so that grule's conflict
+resolution decides the firing order by salience. The KnowledgeLibrary is only
+read after it is built, so it can be shared by concurrent evaluations. Every
+evaluation still needs its own KnowledgeBase instance because grule keeps
+working memory and retraction state on it, so ready instances are recycled
+through a pool.
+*/
+type grlCompiledRules struct {
+	library *ast.KnowledgeLibrary
+	pool    *sync.Pool
+	rules   map[string]models.Rule
+}
+
+func (grlEvaluator) Language() string {
+	return models.RULE_LANGUAGE_GRL
+}
+
+// Compile builds the GRL of every rule into a single KnowledgeBase.
+func (grlEvaluator) Compile(rules []models.Rule) (CompiledRules, error) {
+	return compileGRL(rules)
+}
+
+// Validate compiles the rule and locates the GRL syntax errors in its condition or action.
+func (grlEvaluator) Validate(rule models.Rule) RuleValidationErrors {
+	if _, err := compileGRL([]models.Rule{rule}); err != nil {
+		return grlValidationErrors(rule, err)
+	}
+	return nil
+}
+
+// compileGRL builds the GRL of every rule into a single KnowledgeBase.
+func compileGRL(rules []models.Rule) (*grlCompiledRules, error) {
+	library := ast.NewKnowledgeLibrary()
+	ruleBuilder := builder.NewRuleBuilder(library)
+
+	compiled := &grlCompiledRules{library: library, pool: &sync.Pool{}, rules: make(map[string]models.Rule, len(rules))}
+	for _, rule := range rules {
+		resource := pkg.NewBytesResource([]byte(ruleToGRL(rule)))
+		if err := ruleBuilder.BuildRuleFromResource(KNOWLEDGE_BASE_NAME, KNOWLEDGE_BASE_VERSION, resource); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.RuleId, err)
+		}
+		compiled.rules[rule.RuleId] = rule
+	}
+	return compiled, nil
+}
+
+// acquire returns a ready KnowledgeBase instance holding every rule of the set.
+func (c *grlCompiledRules) acquire() (*ast.KnowledgeBase, error) {
+	if kb, ok := c.pool.Get().(*ast.KnowledgeBase); ok {
+		return kb, nil
+	}
+	return c.library.NewKnowledgeBaseInstance(KNOWLEDGE_BASE_NAME, KNOWLEDGE_BASE_VERSION)
+}
+
+// release hands a KnowledgeBase instance obtained from acquire back to the pool.
+func (c *grlCompiledRules) release(kb *ast.KnowledgeBase) {
+	if kb != nil {
+		c.pool.Put(kb)
+	}
+}
+
+/*
+Execute runs the KnowledgeBase against a DataContext holding the Event, the
+Payload, the Rules fact guarding every condition and, for an aggregation
+rule, its Window.
+*/
+func (c *grlCompiledRules) Execute(ctx context.Context, facts *RuleFacts) error {
+	knowledgeBase, err := c.acquire()
+	if err != nil {
+		return fmt.Errorf("failed to get KnowledgeBase: %w", err)
+	}
+	defer c.release(knowledgeBase)
+
+	dataContext := ast.NewDataContext()
+	if err := dataContext.Add("Event", facts.Event); err != nil {
+		return fmt.Errorf("failed to add Event to DataContext: %w", err)
+	}
+	if err := dataContext.Add("Payload", facts.Payload); err != nil {
+		return fmt.Errorf("failed to add Payload to DataContext: %w", err)
+	}
+	if err := dataContext.Add(RULES_FACT_NAME, facts.gate); err != nil {
+		return fmt.Errorf("failed to add Rules to DataContext: %w", err)
+	}
+	if facts.Window != nil {
+		if err := dataContext.Add(WINDOW_FACT_NAME, facts.Window); err != nil {
+			return fmt.Errorf("failed to add Window to DataContext: %w", err)
+		}
+	}
+
+	gruleEngine := engine.NewGruleEngine()
+	gruleEngine.Listeners = append(gruleEngine.Listeners, &grlListener{facts: facts, rules: c.rules, memory: knowledgeBase.WorkingMemory})
+	err = gruleEngine.ExecuteWithContext(ctx, dataContext, knowledgeBase)
+	facts.RuleDone()
+	return err
+}
+
+/*
+grlListener reports the rules executed by the grule engine to the RuleFacts.
+
+It implements engine.GruleEngineListener. The effect of a rule is only
+visible once the engine moves to the next cycle, so the previous rule is
+done at the beginning of each cycle.
+
+grule remembers the value of the Rules.IsActive guards, once the ruleGate
+stopped the working memory is reset so no condition holds anymore.
+*/
+type grlListener struct {
+	facts  *RuleFacts
+	rules  map[string]models.Rule
+	memory *ast.WorkingMemory
+}
+
+// EvaluateRuleEntry is a no-op, only executed rules are recorded.
+func (l *grlListener) EvaluateRuleEntry(cycle uint64, entry *ast.RuleEntry, candidate bool) {}
+
+// ExecuteRuleEntry records the rule that is about to be executed.
+func (l *grlListener) ExecuteRuleEntry(cycle uint64, entry *ast.RuleEntry) {
+	l.facts.RuleFired(l.rules[entry.RuleName])
+}
+
+// BeginCycle records the effect of the previously executed rule.
+func (l *grlListener) BeginCycle(cycle uint64) {
+	l.facts.RuleDone()
+	if l.facts.gate.stopped {
+		l.memory.ResetAll()
+	}
+}
+
+/*
+ruleToGRL wraps a rule's condition and action into a GRL rule definition.
+
+The rule's priority becomes its salience. The condition is guarded by the
+Rules fact so rules skipped for the current event (e.g. duplicates) never
+fire, and the rule retracts itself once executed so it fires at most once
+per evaluation even if its action does not change the facts it matches on.
+*/
+func ruleToGRL(rule models.Rule) string {
+	return fmt.Sprintf(`
+			rule %s salience %d {
+				when
+					%s.IsActive("%s") && (%s)
+				then
+					%s;
+					Retract("%s");
+			}
+		`, rule.RuleId, rule.Priority, RULES_FACT_NAME, rule.RuleId, rule.Condition,
+		strings.TrimSuffix(strings.TrimSpace(rule.Action), ";"), rule.RuleId)
+}
@@ -1,85 +1,336 @@
 package rule_processor
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"github.com/SMART2016/go-rule-engine/models"
+	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
 const (
 	DEFAULT_TENANT_RULE_ID = "tenant_default"
 )
 
-// RuleRepository provides access to rules.
-type singletonJsonRuleRepository struct {
-	cfg   Config
-	rules map[string][]models.Rule
-	mu    sync.RWMutex
+/*
+JsonRuleRepository is a RuleRepository reading the rules of every tenant from
+a JSON file.
+
+Each instance owns the rules of its own file, so processors configured with
+different files can coexist. The file can be reloaded while the repository
+is in use, see Reload and Watch, and rules can be changed with SaveRule and
+DeleteRule, which rewrite the file.
+*/
+type JsonRuleRepository struct {
+	rules      map[string][]models.Rule
+	mu         sync.RWMutex
+	writeMu    sync.Mutex
+	path       string
+	hash       [sha256.Size]byte
+	generation uint64
+	evaluators []Evaluator
 }
 
-var (
-	instance *singletonJsonRuleRepository
-	once     sync.Once
-)
+// NewJsonRuleRepository loads and validates the rules of the JSON rule file at the given path, see ValidateTenantRules for the evaluators.
+func NewJsonRuleRepository(path string, evaluators ...Evaluator) (*JsonRuleRepository, error) {
+	repo := &JsonRuleRepository{path: path, evaluators: evaluators}
+	if _, err := repo.Reload(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
 
-// GetInstance returns the singleton instance of Singleton
-func initializeSingleRuleRepoInstance(frameWrkCfg Config) (*singletonJsonRuleRepository, error) {
-	var instantiationErr error = nil
-	once.Do(func() {
-		file, err := os.ReadFile(frameWrkCfg.GetRuleRepoPath())
-		if err != nil {
-			instantiationErr = err
-			return
+// parseRulesFile parses the content of a rule file and validates its rules, see ValidateTenantRules.
+func parseRulesFile(data []byte, evaluators []Evaluator) (map[string][]models.Rule, error) {
+	var r map[string][]models.Rule
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if err := ValidateTenantRules(r, evaluators...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+/*
+ValidateTenantRules checks that every rule of every tenant can be used, see
+ValidateRule for the rules and the evaluators, and that rule_ids are unique
+per tenant.
+
+The returned error is a RuleValidationErrors listing every problem found.
+*/
+func ValidateTenantRules(r map[string][]models.Rule, evaluators ...Evaluator) error {
+	set := newEvaluatorSet(evaluators...)
+	tenantIDs := make([]string, 0, len(r))
+	for tenantID := range r {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	var errs RuleValidationErrors
+	for _, tenantID := range tenantIDs {
+		rules := r[tenantID]
+		seen := make(map[string]bool, len(rules))
+		for _, rule := range rules {
+			if rule.RuleId != "" && seen[rule.RuleId] {
+				errs = append(errs, RuleValidationError{TenantID: tenantID, RuleID: rule.RuleId, Field: RULE_FIELD_RULE_ID, Message: "duplicate rule_id"})
+				continue
+			}
+			seen[rule.RuleId] = true
+			errs = append(errs, validateRule(rule, set).withTenant(tenantID)...)
 		}
-		//TODO: Handle rules validation against the event schema seperately
-		//if err = validateRules("rules.json"); err != nil {
-		//	instantiationErr = errors.New(fmt.Sprintf("Rules Validation failed: %+v", err))
-		//}
-		var r map[string][]models.Rule
-		err = json.Unmarshal(file, &r)
-		if err != nil {
-			instantiationErr = err
-			return
+	}
+	return errs.orNil()
+}
+
+/*
+Reload re-reads the rule file if its content changed since it was last
+loaded, the content is compared by its sha256 so a change keeping the
+modification time and size is not missed.
+
+Reload takes the write lock of the rule file, it never runs concurrently
+with another reload or a change. The new rules are parsed and validated
+into a map of their own, the repository lock is only taken to swap them for
+the current rules. If the file cannot be read or is invalid the previous
+rules stay in place and the error is returned, the same broken content is
+not reported again on the next call.
+
+Returns whether the rules were replaced.
+*/
+func (r *JsonRuleRepository) Reload() (bool, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.reload()
+}
+
+// reload is Reload, the caller holds the write lock of the rule file.
+func (r *JsonRuleRepository) reload() (bool, error) {
+	file, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(file)
+
+	r.mu.RLock()
+	seen := hash == r.hash
+	loaded := r.rules != nil
+	r.mu.RUnlock()
+	if seen {
+		return false, nil // Touched but not modified
+	}
+
+	// The file is parsed and validated outside the lock, evaluations keep reading the current rules meanwhile.
+	rules, err := parseRulesFile(file, r.evaluators)
+	if err != nil {
+		if !loaded {
+			err = fmt.Errorf("invalid rule file %s: %w", r.path, err)
+		} else {
+			err = fmt.Errorf("invalid rule file %s, keeping the previous rules: %w", r.path, err)
 		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hash = hash
+	if err != nil {
+		return false, err
+	}
+	r.rules = rules
+	r.generation++
+	return true, nil
+}
+
+// Generation returns a counter incremented every time the rules are replaced, by a reload or a change.
+func (r *JsonRuleRepository) Generation() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generation
+}
+
+/*
+Watch polls the rule file every interval and reloads it when it changes,
+until the context is done.
 
-		instance = &singletonJsonRuleRepository{
-			rules: r,
-			cfg:   frameWrkCfg,
+onReload, when not nil, is called after every reload attempt that replaced
+the rules (with a nil error) or failed.
+*/
+func (r *JsonRuleRepository) Watch(ctx context.Context, interval time.Duration, onReload func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Printf("[JsonRuleRepository.Watch]: %v", err)
+			}
+			if onReload != nil && (reloaded || err != nil) {
+				onReload(err)
+			}
 		}
-	})
-	return instance, instantiationErr
+	}
 }
 
 /*
-GetRules retrieves rules for a specific tenant and event type.
-GetRules retrieves all rules for a specified tenant and event type.
+GetRules retrieves all effective rules for a specified tenant and event type.
 
 It acquires a read lock to ensure thread-safe access to the rules map.
-If the tenant's rules exist, it filters rules matching the given event type.
+The tenant's rules are layered on top of the DEFAULT_TENANT_RULE_ID rules,
+see ResolveTenantRules, and filtered by the given event type.
 It returns a slice of matching rules or an empty slice if none are found.
 An error is returned if any issues occur during retrieval.
 */
-func (r *singletonJsonRuleRepository) GetRules(tenantID, eventType string) ([]models.Rule, error) {
+func (r *JsonRuleRepository) GetRules(tenantID, eventType string) ([]models.Rule, error) {
+	effective, err := r.GetEffectiveRules(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return filterRulesByEventType(effective, eventType), nil
+}
+
+/*
+GetEffectiveRules returns the rules that apply to a tenant for every event
+type, after layering the tenant's rules on top of the default rules.
+*/
+func (r *JsonRuleRepository) GetEffectiveRules(tenantID string) ([]models.Rule, error) {
 	r.mu.RLock()         // Acquire read lock for thread-safe access
 	defer r.mu.RUnlock() // Ensure lock is released
 
-	var rules []models.Rule
-	if tenantRules, ok := r.rules[tenantID]; ok {
-		for _, rule := range tenantRules {
-			if eventType == rule.EventType {
-				rules = append(rules, rule)
+	if tenantID == DEFAULT_TENANT_RULE_ID {
+		return ResolveTenantRules(r.rules[DEFAULT_TENANT_RULE_ID], nil), nil
+	}
+	return ResolveTenantRules(r.rules[DEFAULT_TENANT_RULE_ID], r.rules[tenantID]), nil
+}
+
+// GetTenantRules returns the rules stored for the tenant itself, without the default rules.
+func (r *JsonRuleRepository) GetTenantRules(tenantID string) ([]models.Rule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]models.Rule(nil), r.rules[tenantID]...), nil
+}
+
+// SaveRule validates and creates or replaces a rule of a tenant, then rewrites the rule file.
+func (r *JsonRuleRepository) SaveRule(ctx context.Context, tenantID string, rule models.Rule) error {
+	return r.writeRule(tenantID, rule, ruleWriteUpsert)
+}
+
+// CreateRule validates and creates a rule of a tenant, then rewrites the rule file, ErrRuleExists if the tenant already has the rule_id.
+func (r *JsonRuleRepository) CreateRule(ctx context.Context, tenantID string, rule models.Rule) error {
+	return r.writeRule(tenantID, rule, ruleWriteCreate)
+}
+
+// UpdateRule validates and replaces a rule of a tenant, then rewrites the rule file, ErrRuleNotFound if the tenant has no such rule.
+func (r *JsonRuleRepository) UpdateRule(ctx context.Context, tenantID string, rule models.Rule) error {
+	return r.writeRule(tenantID, rule, ruleWriteUpdate)
+}
+
+// writeRule writes a rule of a tenant, the existence of the rule is checked under the write lock of the rule file.
+func (r *JsonRuleRepository) writeRule(tenantID string, rule models.Rule, write ruleWrite) error {
+	return r.update(func(rules map[string][]models.Rule) error {
+		for i, existing := range rules[tenantID] {
+			if existing.RuleId == rule.RuleId {
+				if err := write.check(tenantID, rule.RuleId, true); err != nil {
+					return err
+				}
+				rules[tenantID][i] = rule
+				return nil
 			}
 		}
-	} else {
-		if tenantRules, ok = r.rules[DEFAULT_TENANT_RULE_ID]; ok {
-			for _, rule := range tenantRules {
-				if eventType == rule.EventType {
-					rules = append(rules, rule)
+		if err := write.check(tenantID, rule.RuleId, false); err != nil {
+			return err
+		}
+		rules[tenantID] = append(rules[tenantID], rule)
+		return nil
+	})
+}
+
+// DeleteRule removes a rule of a tenant and rewrites the rule file, ErrRuleNotFound if the tenant has no such rule.
+func (r *JsonRuleRepository) DeleteRule(ctx context.Context, tenantID, ruleID string) error {
+	return r.update(func(rules map[string][]models.Rule) error {
+		for i, existing := range rules[tenantID] {
+			if existing.RuleId == ruleID {
+				rules[tenantID] = append(rules[tenantID][:i], rules[tenantID][i+1:]...)
+				if len(rules[tenantID]) == 0 {
+					delete(rules, tenantID)
 				}
+				return nil
 			}
 		}
+		return fmt.Errorf("tenant: %s, rule: %s: %w", tenantID, ruleID, ErrRuleNotFound)
+	})
+}
+
+/*
+update applies a change to a copy of the rules, validates the result and
+atomically replaces the rule file and the current rules with it.
+
+Changes made to the file by hand are loaded first so they are not lost.
+*/
+func (r *JsonRuleRepository) update(change func(rules map[string][]models.Rule) error) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	if _, err := r.reload(); err != nil {
+		return err
+	}
+	r.mu.RLock()
+	rules := make(map[string][]models.Rule, len(r.rules)+1)
+	for tenantID, tenantRules := range r.rules {
+		rules[tenantID] = append([]models.Rule(nil), tenantRules...)
 	}
+	r.mu.RUnlock()
 
-	return rules, nil
+	if err := change(rules); err != nil {
+		return err
+	}
+	if err := ValidateTenantRules(rules, r.evaluators...); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the rules: %w", err)
+	}
+	if err := writeFileAtomic(r.path, data); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules, r.hash = rules, sha256.Sum256(data)
+	r.generation++
+	return nil
+}
+
+// writeFileAtomic replaces the file with the data through a temporary file, keeping its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
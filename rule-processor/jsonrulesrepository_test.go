@@ -0,0 +1,305 @@
+package rule_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+const testRulesV1 = `{
+  "tenant_default": [
+    {"rule_id": "disk_80", "event_type": "disk_space", "condition": "Payload.Usage >= 80", "action": "Event.ShouldHandle = true"}
+  ]
+}`
+
+const testRulesV2 = `{
+  "tenant_default": [
+    {"rule_id": "disk_90", "event_type": "disk_space", "condition": "Payload.Usage >= 90", "action": "Event.ShouldHandle = true"}
+  ]
+}`
+
+const testRulesInvalidGRL = `{
+  "tenant_default": [
+    {"rule_id": "disk_90", "event_type": "disk_space", "condition": "Payload.Usage >=", "action": "Event.ShouldHandle = true"}
+  ]
+}`
+
+// writeRulesFile writes the rule file and moves its modification time forward so every write is detected.
+func writeRulesFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set rules mtime: %v", err)
+	}
+}
+
+func assertRuleIDs(t *testing.T, repo *JsonRuleRepository, want string) {
+	t.Helper()
+	rules, err := repo.GetRules("tenant1", "disk_space")
+	if err != nil {
+		t.Fatalf("GetRules() error = %v", err)
+	}
+	if len(rules) != 1 || rules[0].RuleId != want {
+		t.Fatalf("GetRules() = %v, want [%s]", ruleIDs(rules), want)
+	}
+}
+
+func TestJsonRuleRepository_GetRules(t *testing.T) {
+	repo := &JsonRuleRepository{
+		rules: map[string][]models.Rule{
+			DEFAULT_TENANT_RULE_ID: {
+				{RuleId: "disk_80", EventType: "disk_space"},
+				{RuleId: "disk_100", EventType: "disk_space"},
+				{RuleId: "cpu_90", EventType: "cpu"},
+			},
+			"tenant1": {
+				{RuleId: "disk_80", EventType: "disk_space", Condition: "custom"},
+				{RuleId: "disk_100", Disabled: true},
+				{RuleId: "disk_50", EventType: "disk_space"},
+			},
+		},
+	}
+
+	rules, err := repo.GetRules("tenant1", "disk_space")
+	if err != nil {
+		t.Fatalf("GetRules() error = %v", err)
+	}
+	if ids := ruleIDs(rules); !reflect.DeepEqual(ids, []string{"disk_80", "disk_50"}) {
+		t.Errorf("GetRules(tenant1) = %v", ids)
+	}
+	if rules[0].Condition != "custom" {
+		t.Errorf("GetRules(tenant1) did not apply the override: %+v", rules[0])
+	}
+
+	rules, err = repo.GetRules("tenant2", "disk_space")
+	if err != nil {
+		t.Fatalf("GetRules() error = %v", err)
+	}
+	if ids := ruleIDs(rules); !reflect.DeepEqual(ids, []string{"disk_80", "disk_100"}) {
+		t.Errorf("GetRules(tenant2) = %v", ids)
+	}
+
+	effective, err := repo.GetEffectiveRules("tenant1")
+	if err != nil {
+		t.Fatalf("GetEffectiveRules() error = %v", err)
+	}
+	if ids := ruleIDs(effective); !reflect.DeepEqual(ids, []string{"disk_80", "cpu_90", "disk_50"}) {
+		t.Errorf("GetEffectiveRules(tenant1) = %v", ids)
+	}
+}
+
+func TestJsonRuleRepository_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeRulesFile(t, path, testRulesV1, modTime)
+
+	repo := &JsonRuleRepository{path: path}
+	if reloaded, err := repo.Reload(); err != nil || !reloaded {
+		t.Fatalf("initial Reload() = %v, %v", reloaded, err)
+	}
+	assertRuleIDs(t, repo, "disk_80")
+	generation := repo.Generation()
+
+	// Unchanged file.
+	if reloaded, err := repo.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of an unchanged file = %v, %v", reloaded, err)
+	}
+
+	// Touched but same content.
+	modTime = modTime.Add(time.Minute)
+	writeRulesFile(t, path, testRulesV1, modTime)
+	if reloaded, err := repo.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of a touched file = %v, %v", reloaded, err)
+	}
+
+	// Broken file keeps the previous rules and is reported once.
+	modTime = modTime.Add(time.Minute)
+	writeRulesFile(t, path, testRulesInvalidGRL, modTime)
+	if reloaded, err := repo.Reload(); err == nil || reloaded {
+		t.Errorf("Reload() of an invalid file = %v, %v, want an error", reloaded, err)
+	}
+	assertRuleIDs(t, repo, "disk_80")
+	if reloaded, err := repo.Reload(); err != nil || reloaded {
+		t.Errorf("second Reload() of the same invalid file = %v, %v", reloaded, err)
+	}
+
+	modTime = modTime.Add(time.Minute)
+	writeRulesFile(t, path, `{not json`, modTime)
+	if _, err := repo.Reload(); err == nil {
+		t.Error("Reload() of a malformed file expected an error")
+	}
+	assertRuleIDs(t, repo, "disk_80")
+	if repo.Generation() != generation {
+		t.Errorf("Generation() = %d after reloads that kept the rules, want %d", repo.Generation(), generation)
+	}
+
+	// Valid change is swapped in.
+	modTime = modTime.Add(time.Minute)
+	writeRulesFile(t, path, testRulesV2, modTime)
+	if reloaded, err := repo.Reload(); err != nil || !reloaded {
+		t.Errorf("Reload() of a changed file = %v, %v", reloaded, err)
+	}
+	assertRuleIDs(t, repo, "disk_90")
+	if repo.Generation() == generation {
+		t.Error("Generation() did not change with the rules")
+	}
+
+	// A change keeping the modification time and size is detected by the content.
+	writeRulesFile(t, path, strings.ReplaceAll(testRulesV2, "disk_90", "disk_95"), modTime)
+	if reloaded, err := repo.Reload(); err != nil || !reloaded {
+		t.Errorf("Reload() of a file changed in place = %v, %v", reloaded, err)
+	}
+	assertRuleIDs(t, repo, "disk_95")
+}
+
+func TestJsonRuleRepository_ReloadDuringChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, testRulesV1, time.Now().Add(-time.Minute))
+	repo, err := NewJsonRuleRepository(path)
+	if err != nil {
+		t.Fatalf("NewJsonRuleRepository() error = %v", err)
+	}
+
+	// Reloads running alongside the changes never swap in an older version of the file.
+	const saves = 10
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < saves; i++ {
+			if err := repo.SaveRule(context.Background(), "tenant1", diskRule(fmt.Sprintf("disk_%d", i), "50")); err != nil {
+				t.Errorf("SaveRule() error = %v", err)
+			}
+		}
+	}()
+	for reloading := true; reloading; {
+		select {
+		case <-done:
+			reloading = false
+		default:
+			if _, err := repo.Reload(); err != nil {
+				t.Errorf("Reload() error = %v", err)
+			}
+		}
+	}
+	if rules, _ := repo.GetTenantRules("tenant1"); len(rules) != saves {
+		t.Errorf("GetTenantRules() = %v, want the %d saved rules", ruleIDs(rules), saves)
+	}
+}
+
+func TestJsonRuleRepository_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeRulesFile(t, path, testRulesV1, modTime)
+
+	repo := &JsonRuleRepository{path: path}
+	if _, err := repo.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	reloads := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go repo.Watch(ctx, 5*time.Millisecond, func(err error) { reloads <- err })
+
+	writeRulesFile(t, path, testRulesInvalidGRL, modTime.Add(time.Minute))
+	select {
+	case err := <-reloads:
+		if err == nil {
+			t.Error("Watch() reported a successful reload of an invalid file")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() did not report the invalid file")
+	}
+
+	writeRulesFile(t, path, testRulesV2, modTime.Add(2*time.Minute))
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Errorf("Watch() reload error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() did not reload the changed file")
+	}
+	assertRuleIDs(t, repo, "disk_90")
+}
+
+func TestParseRulesFile_ShippedRules(t *testing.T) {
+	data, err := os.ReadFile("../configs/rules.json")
+	if err != nil {
+		t.Fatalf("failed to read shipped rules: %v", err)
+	}
+	if _, err := parseRulesFile(data, nil); err != nil {
+		t.Errorf("parseRulesFile() error = %v", err)
+	}
+}
+
+func TestJsonRuleRepository_SaveAndDeleteRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, testRulesV1, time.Now().Add(-time.Minute))
+	repo, err := NewJsonRuleRepository(path)
+	if err != nil {
+		t.Fatalf("NewJsonRuleRepository() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := repo.SaveRule(ctx, "tenant1", diskRule("disk_50", "50")); err != nil {
+		t.Fatalf("SaveRule() error = %v", err)
+	}
+	if err := repo.SaveRule(ctx, DEFAULT_TENANT_RULE_ID, diskRule("disk_80", "85")); err != nil {
+		t.Fatalf("SaveRule() error = %v", err)
+	}
+	var validationErrs RuleValidationErrors
+	if err := repo.SaveRule(ctx, "tenant1", diskRule("disk_broken", "")); !errors.As(err, &validationErrs) {
+		t.Errorf("SaveRule() of an invalid rule error = %v", err)
+	}
+
+	reloaded, err := NewJsonRuleRepository(path)
+	if err != nil {
+		t.Fatalf("NewJsonRuleRepository() of the rewritten file error = %v", err)
+	}
+	rules, _ := reloaded.GetRules("tenant1", "disk_space")
+	if ids := ruleIDs(rules); !reflect.DeepEqual(ids, []string{"disk_80", "disk_50"}) || rules[0].Condition != "Payload.Usage >= 85" {
+		t.Errorf("rewritten rules = %+v", rules)
+	}
+
+	if err := repo.DeleteRule(ctx, "tenant1", "disk_50"); err != nil {
+		t.Fatalf("DeleteRule() error = %v", err)
+	}
+	if err := repo.DeleteRule(ctx, "tenant1", "disk_50"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("DeleteRule() of a missing rule error = %v", err)
+	}
+	if rules, _ := repo.GetTenantRules("tenant1"); len(rules) != 0 {
+		t.Errorf("GetTenantRules() after delete = %v", ruleIDs(rules))
+	}
+	if reloaded, _ := repo.Reload(); reloaded {
+		t.Error("Reload() picked up the repository's own write as a change")
+	}
+}
+
+func TestNewJsonRuleRepository_ValidatesPayloadFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{
+  "tenant1": [
+    {"rule_id": "disk_80", "event_type": "disk_space", "condition": "Payload.UsedPercent >= 80", "action": "Event.ShouldHandle = true", "payload_fields": ["Usage"]}
+  ]
+}`, time.Now())
+
+	_, err := NewJsonRuleRepository(path)
+	var errs RuleValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("NewJsonRuleRepository() error = %v, want one validation error", err)
+	}
+	if errs[0].TenantID != "tenant1" || errs[0].RuleID != "disk_80" || errs[0].Field != RULE_FIELD_CONDITION {
+		t.Errorf("validation error = %+v", errs[0])
+	}
+}
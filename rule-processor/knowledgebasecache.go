@@ -0,0 +1,231 @@
+package rule_processor
+
+import (
+	"context"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"sync"
+	"time"
+)
+
+// knowledgeBaseCacheKey identifies the compiled rules of a tenant for a single event type.
+type knowledgeBaseCacheKey struct {
+	tenantID  string
+	eventType string
+}
+
+/*
+compiledRuleSet holds the compiled rules of one generation of the rules.
+
+The rules are split into stages, runs of consecutive rules of the same
+language in order of decreasing priority, each compiled by the Evaluator of
+its language. Stages execute in order against the same facts, so priority
+decides the firing order across languages and a rule set written in a
+single language is a single stage, e.g. one grule KnowledgeBase. An
+aggregation rule is a stage of its own, executed with the Window fact of the
+rule. The schedules, aggregations and correlations of the rules are compiled
+along with them.
+
+Correlation rules of another event type take no part in the stages, only the
+conditions of the events of their sequences having the event type do. They
+are compiled into steps, matched against the event before the stages run.
+*/
+type compiledRuleSet struct {
+	generation       uint64
+	stages           []compiledStage
+	schedules        map[string]*ruleSchedule
+	aggregations     map[string]*ruleAggregation
+	aggregationOrder []string // The aggregation rules in order of decreasing priority
+	correlations     map[string]*ruleCorrelation
+	correlationOrder []string                   // The correlation rules in order of decreasing priority
+	steps            []compiledStage            // The conditions of the events of the sequences having the event type
+	sequenceSteps    map[string]correlationStep // The event of a sequence matched by each rule of the steps
+}
+
+// scheduleSkip returns why the rule is not active at the given time, nil when it is or has no schedule.
+func (s *compiledRuleSet) scheduleSkip(ruleID string, at time.Time) *models.ScheduleSkip {
+	return s.schedules[ruleID].skipReason(ruleID, at)
+}
+
+// compiledStage is a run of rules compiled by the Evaluator of their language.
+type compiledStage struct {
+	language     string
+	rules        CompiledRules
+	windowRuleID string // The aggregation rule of the stage, empty for other rules
+}
+
+/*
+knowledgeBaseCache caches compiled rule sets per (tenant, event type).
+
+Each entry is tagged with the generation of the RuleRepository it was
+compiled from, which changes whenever the rules change. A lookup with
+another generation compiles the rules again and replaces the entry, so the
+cache holds a single rule set per tenant and event type. It is safe for
+concurrent use.
+*/
+type knowledgeBaseCache struct {
+	mu         sync.RWMutex
+	entries    map[knowledgeBaseCacheKey]*compiledRuleSet
+	evaluators evaluatorSet
+}
+
+// newKnowledgeBaseCache creates an empty knowledgeBaseCache compiling the rules with the built-in and the given evaluators.
+func newKnowledgeBaseCache(evaluators ...Evaluator) *knowledgeBaseCache {
+	return &knowledgeBaseCache{
+		entries:    make(map[knowledgeBaseCacheKey]*compiledRuleSet),
+		evaluators: newEvaluatorSet(evaluators...),
+	}
+}
+
+/*
+get returns the compiled rule set for the given tenant, event type and rules
+of a generation of the RuleRepository.
+
+If the cached entry was compiled from a different generation of the rules,
+or no entry exists yet, the rules are compiled and the cache entry is
+replaced. Compilation happens outside the lock so evaluations of other
+tenants are not blocked by it.
+*/
+func (c *knowledgeBaseCache) get(tenantID, eventType string, generation uint64, rules []models.Rule) (*compiledRuleSet, error) {
+	key := knowledgeBaseCacheKey{tenantID: tenantID, eventType: eventType}
+
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && entry.generation == generation {
+		return entry, nil
+	}
+
+	compiled, err := compileRuleSet(c.evaluators, generation, eventType, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another evaluation may have compiled the same generation in the meantime.
+	if entry, ok = c.entries[key]; ok && entry.generation == generation {
+		return entry, nil
+	}
+	c.entries[key] = compiled
+	return compiled, nil
+}
+
+// execute runs the stages of the rule set in order against the facts of an event, with the window of each aggregation rule.
+func (s *compiledRuleSet) execute(ctx context.Context, facts *RuleFacts) error {
+	defer func() { facts.Window = nil }()
+	for _, stage := range s.stages {
+		facts.Window = nil
+		if stage.windowRuleID != "" {
+			facts.Window = facts.windows[stage.windowRuleID]
+			if facts.Window == nil {
+				facts.Window = models.NewAggregationWindow(stage.windowRuleID, "", nil) // The rule may not fire
+			}
+		}
+		if err := stage.rules.Execute(ctx, facts); err != nil {
+			return fmt.Errorf("%s rules: %w", stage.language, err)
+		}
+	}
+	return nil
+}
+
+/*
+compileRuleSet splits the rules of the event type into stages by language
+and compiles each of them with its Evaluator of the set, rules built from a condition
+tree are compiled from the condition expanded from it. Aggregation rules
+are stages of their own. The schedules, aggregations and correlations of
+the rules are parsed, the conditions of the events of the sequences of
+correlation rules having the event type are compiled into stages of their
+own.
+*/
+func compileRuleSet(evaluators evaluatorSet, generation uint64, eventType string, rules []models.Rule) (*compiledRuleSet, error) {
+	compiled := &compiledRuleSet{
+		generation:    generation,
+		schedules:     make(map[string]*ruleSchedule),
+		aggregations:  make(map[string]*ruleAggregation),
+		correlations:  make(map[string]*ruleCorrelation),
+		sequenceSteps: make(map[string]correlationStep),
+	}
+	var eventRules, stepRules []models.Rule
+	for _, rule := range sortRulesByPriority(rules) {
+		expanded, errs := expandRegisteredConditionTree(rule)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		if rule.EventType == eventType {
+			eventRules = append(eventRules, expanded)
+		}
+		if rule.Schedule != nil {
+			schedule, err := compileRuleSchedule(rule.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: schedule: %w", rule.RuleId, err)
+			}
+			compiled.schedules[rule.RuleId] = schedule
+		}
+		if rule.Aggregation != nil && rule.Correlation != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.RuleId, errAggregatedCorrelation)
+		}
+		if rule.Aggregation != nil {
+			aggregation, err := compileRuleAggregation(rule.Aggregation)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: aggregation: %w", rule.RuleId, err)
+			}
+			compiled.aggregations[rule.RuleId] = aggregation
+			compiled.aggregationOrder = append(compiled.aggregationOrder, rule.RuleId)
+		}
+		if rule.Correlation != nil {
+			correlation, err := compileRuleCorrelation(rule.Correlation)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: correlation: %w", rule.RuleId, err)
+			}
+			correlation.completes = rule.EventType == eventType
+			compiled.correlations[rule.RuleId] = correlation
+			compiled.correlationOrder = append(compiled.correlationOrder, rule.RuleId)
+			for i, step := range rule.Correlation.Sequence {
+				if step.EventType != eventType {
+					continue
+				}
+				stepRule := correlationStepRule(rule, i)
+				stepRules = append(stepRules, stepRule)
+				compiled.sequenceSteps[stepRule.RuleId] = correlationStep{ruleID: rule.RuleId, index: i}
+			}
+		}
+	}
+
+	var err error
+	if compiled.stages, err = compileStages(evaluators, eventRules); err != nil {
+		return nil, err
+	}
+	if compiled.steps, err = compileStages(evaluators, stepRules); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// compileStages splits rules in order of decreasing priority into stages by language, an aggregation rule is a stage of its own.
+func compileStages(evaluators evaluatorSet, sorted []models.Rule) ([]compiledStage, error) {
+	var stages []compiledStage
+	for start := 0; start < len(sorted); {
+		language := sorted[start].EffectiveLanguage()
+		end := start + 1
+		for end < len(sorted) && sorted[end].EffectiveLanguage() == language &&
+			sorted[start].Aggregation == nil && sorted[end].Aggregation == nil {
+			end++
+		}
+		evaluator, err := evaluators.forRule(sorted[start])
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", sorted[start].RuleId, err)
+		}
+		stageRules, err := evaluator.Compile(sorted[start:end])
+		if err != nil {
+			return nil, err
+		}
+		stage := compiledStage{language: language, rules: stageRules}
+		if sorted[start].Aggregation != nil {
+			stage.windowRuleID = sorted[start].RuleId
+		}
+		stages = append(stages, stage)
+		start = end
+	}
+	return stages, nil
+}
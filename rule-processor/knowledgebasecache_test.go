@@ -0,0 +1,119 @@
+package rule_processor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type testUsagePayload struct {
+	Usage int
+}
+
+// executeCompiled runs a compiled rule set against an event with the given rules activated.
+func executeCompiled(compiled *compiledRuleSet, event *models.BaseEvent[any], payload any, policy MatchPolicy, active ...string) (*firedRulesListener, error) {
+	gate := newRuleGate()
+	for _, ruleID := range active {
+		gate.activate(ruleID)
+	}
+	listener := newFiredRulesListener(event, policy, gate)
+	err := compiled.execute(context.Background(), newRuleFacts(event, payload, gate, listener, nil))
+	listener.finish()
+	return listener, err
+}
+
+func testDiskRules() []models.Rule {
+	return []models.Rule{
+		{
+			RuleId:    "disk_80",
+			EventType: "disk_space",
+			Condition: "Payload.Usage >= 80 && Event.ShouldHandle == false",
+			Action:    "Event.ShouldHandle = true",
+		},
+	}
+}
+
+func TestKnowledgeBaseCache_ReusesCompiledRuleSet(t *testing.T) {
+	cache := newKnowledgeBaseCache()
+	rules := testDiskRules()
+
+	first, err := cache.get("tenant1", "disk_space", 0, rules)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	second, err := cache.get("tenant1", "disk_space", 0, testDiskRules())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if first != second {
+		t.Error("get() recompiled an unchanged rule set")
+	}
+
+	other, err := cache.get("tenant2", "disk_space", 0, rules)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if other == first {
+		t.Error("get() shared a compiled rule set between tenants")
+	}
+}
+
+func TestKnowledgeBaseCache_ComparesGenerations(t *testing.T) {
+	cache := newKnowledgeBaseCache()
+	rules := testDiskRules()
+
+	first, err := cache.get("tenant1", "disk_space", 1, rules)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	// The content of the rules is not compared, the generation changes with them.
+	rules[0].Condition = "Payload.Usage >= 90 && Event.ShouldHandle == false"
+	if second, err := cache.get("tenant1", "disk_space", 1, rules); err != nil || second != first {
+		t.Errorf("get() = %v, %v, want the rule set compiled for the generation", second, err)
+	}
+	third, err := cache.get("tenant1", "disk_space", 2, rules)
+	if err != nil || third == first || third.generation != 2 {
+		t.Fatalf("get() = %v, %v, want the rule set recompiled for a new generation", third, err)
+	}
+	if len(cache.entries) != 1 || cache.entries[knowledgeBaseCacheKey{tenantID: "tenant1", eventType: "disk_space"}] != third {
+		t.Errorf("get() kept %d entries, want the stale entry replaced", len(cache.entries))
+	}
+}
+
+func TestKnowledgeBaseCache_BuildError(t *testing.T) {
+	cache := newKnowledgeBaseCache()
+	rules := testDiskRules()
+	rules[0].Condition = "Payload.Usage >="
+
+	if _, err := cache.get("tenant1", "disk_space", 0, rules); err == nil {
+		t.Error("get() expected an error for an invalid condition")
+	}
+}
+
+func TestKnowledgeBaseCache_ConcurrentEvaluation(t *testing.T) {
+	cache := newKnowledgeBaseCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(usage int) {
+			defer wg.Done()
+			compiled, err := cache.get("tenant1", "disk_space", 0, testDiskRules())
+			if err != nil {
+				t.Errorf("get() error = %v", err)
+				return
+			}
+			event := models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"}
+			if _, err := executeCompiled(compiled, &event, &testUsagePayload{Usage: usage}, MATCH_POLICY_FIRST_MATCH, "disk_80"); err != nil {
+				t.Errorf("execute error = %v", err)
+				return
+			}
+			if want := usage >= 80; event.ShouldHandle != want {
+				t.Errorf("usage %d: ShouldHandle = %v, want %v", usage, event.ShouldHandle, want)
+			}
+		}(60 + i)
+	}
+	wg.Wait()
+}
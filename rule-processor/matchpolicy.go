@@ -0,0 +1,31 @@
+package rule_processor
+
+import "fmt"
+
+/*
+MatchPolicy decides how many of the rules matching an event handle it.
+
+  - MATCH_POLICY_FIRST_MATCH: the first rule, by priority, that sets
+    Event.ShouldHandle handles the event. No rule fires after it and only
+    its actions are dispatched.
+  - MATCH_POLICY_ALL_MATCHING: every rule whose condition holds handles the
+    event. Event.ShouldHandle is reset after each of them so the following
+    rules see the event as it arrived, and every handling rule is persisted
+    and dispatched.
+*/
+type MatchPolicy string
+
+const (
+	MATCH_POLICY_FIRST_MATCH  MatchPolicy = "first-match"
+	MATCH_POLICY_ALL_MATCHING MatchPolicy = "all-matching"
+)
+
+// Validate returns an error if the match policy is unknown.
+func (p MatchPolicy) Validate() error {
+	switch p {
+	case MATCH_POLICY_FIRST_MATCH, MATCH_POLICY_ALL_MATCHING:
+		return nil
+	default:
+		return fmt.Errorf("unknown match policy '%s'", p)
+	}
+}
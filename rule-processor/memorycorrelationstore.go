@@ -0,0 +1,107 @@
+package rule_processor
+
+import (
+	"context"
+	"github.com/SMART2016/go-rule-engine/store"
+	"sort"
+	"sync"
+)
+
+/*
+MemoryCorrelationStore is an in-memory CorrelationStore, the counterpart of
+MemoryEventStore for the partial matches of correlation rules.
+
+It needs no database connection, pair it with a DBConnector returning a nil
+connection such as NoDBConnector. Without transactions LockCorrelation does
+nothing, every method is atomic and a completed match is claimed by a single
+event.
+*/
+type MemoryCorrelationStore struct {
+	mu      sync.Mutex
+	matches map[memoryCorrelationKey]map[int32]store.CorrelationMatch
+}
+
+type memoryCorrelationKey struct {
+	tenantID, ruleID, joinKey string
+}
+
+// NewMemoryCorrelationStore creates an empty MemoryCorrelationStore.
+func NewMemoryCorrelationStore() *MemoryCorrelationStore {
+	return &MemoryCorrelationStore{matches: make(map[memoryCorrelationKey]map[int32]store.CorrelationMatch)}
+}
+
+func (s *MemoryCorrelationStore) UpsertCorrelationMatch(ctx context.Context, db store.DBTX, arg store.UpsertCorrelationMatchParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryCorrelationKey{arg.TenantID, arg.RuleID, arg.JoinKey}
+	if s.matches[key] == nil {
+		s.matches[key] = make(map[int32]store.CorrelationMatch)
+	}
+	if existing, ok := s.matches[key][arg.Step]; ok && existing.StartedAt.Time.After(arg.StartedAt.Time) {
+		return nil
+	}
+	s.matches[key][arg.Step] = store.CorrelationMatch{
+		TenantID: arg.TenantID, RuleID: arg.RuleID, JoinKey: arg.JoinKey, Step: arg.Step, StartedAt: arg.StartedAt,
+	}
+	return nil
+}
+
+func (s *MemoryCorrelationStore) ListCorrelationMatches(ctx context.Context, db store.DBTX, arg store.ListCorrelationMatchesParams) ([]*store.CorrelationMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matches []*store.CorrelationMatch
+	for _, match := range s.matches[memoryCorrelationKey{arg.TenantID, arg.RuleID, arg.JoinKey}] {
+		if !match.StartedAt.Time.Before(arg.StartedAt.Time) {
+			match := match
+			matches = append(matches, &match)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Step < matches[j].Step })
+	return matches, nil
+}
+
+func (s *MemoryCorrelationStore) ExpireCorrelationMatches(ctx context.Context, db store.DBTX, arg store.ExpireCorrelationMatchesParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := s.matches[memoryCorrelationKey{arg.TenantID, arg.RuleID, arg.JoinKey}]
+	for step, match := range matches {
+		if match.StartedAt.Time.Before(arg.StartedAt.Time) {
+			delete(matches, step)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryCorrelationStore) DeleteCorrelationMatches(ctx context.Context, db store.DBTX, arg store.DeleteCorrelationMatchesParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.matches, memoryCorrelationKey{arg.TenantID, arg.RuleID, arg.JoinKey})
+	return nil
+}
+
+func (s *MemoryCorrelationStore) ClaimCorrelationMatch(ctx context.Context, db store.DBTX, arg store.ClaimCorrelationMatchParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := s.matches[memoryCorrelationKey{arg.TenantID, arg.RuleID, arg.JoinKey}]
+	match, ok := matches[arg.Step]
+	if !ok || match.StartedAt.Time.Before(arg.StartedAt.Time) {
+		return 0, nil
+	}
+	delete(matches, arg.Step)
+	return 1, nil
+}
+
+func (s *MemoryCorrelationStore) LockCorrelation(ctx context.Context, db store.DBTX, arg store.LockCorrelationParams) error {
+	return nil
+}
+
+// Count returns the number of partial matches of every rule and join key.
+func (s *MemoryCorrelationStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, matches := range s.matches {
+		count += len(matches)
+	}
+	return count
+}
@@ -0,0 +1,70 @@
+package rule_processor
+
+import (
+	"context"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"sync"
+)
+
+/*
+MemoryEventStore is an in-memory EventStore keyed like the unique index of
+the processed_events table.
+
+It needs no database connection, pair it with a DBConnector returning a nil
+connection such as NoDBConnector. Dedup windows are not enforced, a
+processed event stays a duplicate for good.
+*/
+type MemoryEventStore struct {
+	mu        sync.Mutex
+	processed map[memoryEventKey]store.SaveEventParams
+}
+
+type memoryEventKey struct {
+	tenantID, eventType, ruleID, eventSHA string
+}
+
+// NewMemoryEventStore creates an empty MemoryEventStore.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{processed: make(map[memoryEventKey]store.SaveEventParams)}
+}
+
+// NoDBConnector is a DBConnector for event stores that do not need a database connection.
+func NoDBConnector(ctx context.Context) (store.DBTX, func(), error) {
+	return nil, func() {}, nil
+}
+
+func (s *MemoryEventStore) IsDuplicate(ctx context.Context, db store.DBTX, arg store.IsDuplicateParams) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.processed[memoryEventKey{arg.TenantID, arg.EventType, arg.RuleID, arg.EventSha}]
+	return ok, nil
+}
+
+func (s *MemoryEventStore) SaveEvent(ctx context.Context, db store.DBTX, arg store.SaveEventParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed[memoryEventKey{arg.TenantID, arg.EventType, arg.RuleID, arg.EventSha}] = arg
+	return nil
+}
+
+func (s *MemoryEventStore) CleanupOldEvents(ctx context.Context, db store.DBTX, dollar_1 interface{}) error {
+	return nil
+}
+
+// MarkProcessed records the event as already handled by the rule, using the dedup key the rule would save it under.
+func (s *MemoryEventStore) MarkProcessed(tenantID, eventType string, rule models.Rule, eventSHA string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dedupSHA := ruleDedupSHA(rule, eventSHA)
+	s.processed[memoryEventKey{tenantID, eventType, rule.RuleId, dedupSHA}] = store.SaveEventParams{
+		TenantID: tenantID, EventType: eventType, RuleID: rule.RuleId, EventSha: dedupSHA,
+	}
+}
+
+// Count returns the number of processed events.
+func (s *MemoryEventStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.processed)
+}
@@ -0,0 +1,94 @@
+package rule_processor
+
+import (
+	"context"
+	"github.com/SMART2016/go-rule-engine/store"
+	"sort"
+	"sync"
+)
+
+/*
+MemoryWindowStore is an in-memory WindowStore, the counterpart of
+MemoryEventStore for the windows of aggregation rules.
+
+It needs no database connection, pair it with a DBConnector returning a nil
+connection such as NoDBConnector.
+*/
+type MemoryWindowStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	samples map[memoryWindowKey][]store.WindowSample
+}
+
+type memoryWindowKey struct {
+	tenantID, eventType, ruleID, groupKey string
+}
+
+// NewMemoryWindowStore creates an empty MemoryWindowStore.
+func NewMemoryWindowStore() *MemoryWindowStore {
+	return &MemoryWindowStore{samples: make(map[memoryWindowKey][]store.WindowSample)}
+}
+
+func (s *MemoryWindowStore) AddWindowSample(ctx context.Context, db store.DBTX, arg store.AddWindowSampleParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	key := memoryWindowKey{arg.TenantID, arg.EventType, arg.RuleID, arg.GroupKey}
+	s.samples[key] = append(s.samples[key], store.WindowSample{
+		ID: s.nextID, TenantID: arg.TenantID, EventType: arg.EventType, RuleID: arg.RuleID,
+		GroupKey: arg.GroupKey, Value: arg.Value, OccurredAt: arg.OccurredAt,
+	})
+	return nil
+}
+
+func (s *MemoryWindowStore) ListWindowSamples(ctx context.Context, db store.DBTX, arg store.ListWindowSamplesParams) ([]*store.WindowSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var samples []*store.WindowSample
+	for _, sample := range s.recent(memoryWindowKey{arg.TenantID, arg.EventType, arg.RuleID, arg.GroupKey}) {
+		if len(samples) == int(arg.Limit) {
+			break
+		}
+		if !sample.OccurredAt.Time.Before(arg.OccurredAt.Time) {
+			samples = append(samples, &sample)
+		}
+	}
+	return samples, nil
+}
+
+func (s *MemoryWindowStore) TrimWindowSamples(ctx context.Context, db store.DBTX, arg store.TrimWindowSamplesParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryWindowKey{arg.TenantID, arg.EventType, arg.RuleID, arg.GroupKey}
+	var kept []store.WindowSample
+	for i, sample := range s.recent(key) {
+		if i < int(arg.Limit) && !sample.OccurredAt.Time.Before(arg.OccurredAt.Time) {
+			kept = append(kept, sample)
+		}
+	}
+	s.samples[key] = kept
+	return nil
+}
+
+// recent returns the samples of a window, most recent first, like the ORDER BY of the window queries.
+func (s *MemoryWindowStore) recent(key memoryWindowKey) []store.WindowSample {
+	samples := append([]store.WindowSample(nil), s.samples[key]...)
+	sort.Slice(samples, func(i, j int) bool {
+		if !samples[i].OccurredAt.Time.Equal(samples[j].OccurredAt.Time) {
+			return samples[i].OccurredAt.Time.After(samples[j].OccurredAt.Time)
+		}
+		return samples[i].ID > samples[j].ID
+	})
+	return samples
+}
+
+// Count returns the number of samples of every window.
+func (s *MemoryWindowStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, samples := range s.samples {
+		count += len(samples)
+	}
+	return count
+}
@@ -0,0 +1,260 @@
+package rule_processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// DYNAMIC_PAYLOAD_TYPE marks an event type of a payload type file whose payload is a models.DynamicPayload.
+	DYNAMIC_PAYLOAD_TYPE = "dynamic"
+)
+
+// ErrUnknownEventType is returned by DecodeEvent for an event whose type is not registered in the EventRegistry.
+var ErrUnknownEventType = errors.New("event type not registered in EventRegistry")
+
+// fieldTypes are the payload field types a payload type file can use.
+var fieldTypes = map[string]reflect.Type{
+	"string":  reflect.TypeOf(""),
+	"int":     reflect.TypeOf(0),
+	"int64":   reflect.TypeOf(int64(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"bool":    reflect.TypeOf(false),
+	"any":     reflect.TypeOf((*any)(nil)).Elem(),
+}
+
+// KnownPayloadTypes returns the payload struct of every event type registered in the EventRegistry.
+func KnownPayloadTypes() map[string]reflect.Type {
+	return models.GetEventRegistry().PayloadTypes()
+}
+
+/*
+LoadPayloadTypes returns the payload types registered in the EventRegistry,
+extended with the event types described in a payload type file.
+
+The file maps each event type to its payload fields and their type, one of
+string, int, int64, float64, bool or any, optionally followed by the JSON key
+of the field in the event:
+
+	{"cpu": {"Usage": "int:usage_percentage", "Host": "string"}}
+
+An event type registered without a Go struct is described as "dynamic", its
+rules read the payload with the models.DynamicPayload accessors:
+
+	{"queue_depth": "dynamic"}
+
+Parameters:
+  - path: string - The payload type file, ignored when empty.
+
+Returns:
+  - map[string]reflect.Type: The payload struct of every event type.
+  - error: If the file cannot be read or uses an unknown field type.
+*/
+func LoadPayloadTypes(path string) (map[string]reflect.Type, error) {
+	payloadTypes := KnownPayloadTypes()
+	if path == "" {
+		return payloadTypes, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the payload types: %w", err)
+	}
+	var catalog map[string]json.RawMessage
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse the payload types %s: %w", path, err)
+	}
+	for eventType, description := range catalog {
+		var kind string
+		if json.Unmarshal(description, &kind) == nil {
+			if kind != DYNAMIC_PAYLOAD_TYPE {
+				return nil, fmt.Errorf("event type %s: unknown payload type '%s'", eventType, kind)
+			}
+			payloadTypes[eventType] = reflect.TypeOf(models.DynamicPayload{})
+			continue
+		}
+		var fields map[string]string
+		if err := json.Unmarshal(description, &fields); err != nil {
+			return nil, fmt.Errorf("failed to parse the payload types %s: event type %s: %w", path, eventType, err)
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		structFields := make([]reflect.StructField, 0, len(fields))
+		for _, name := range names {
+			typeName, jsonKey, _ := strings.Cut(fields[name], ":")
+			fieldType, ok := fieldTypes[typeName]
+			if !ok {
+				return nil, fmt.Errorf("event type %s: unknown type '%s' of payload field %s", eventType, typeName, name)
+			}
+			if !isExportedIdentifier(name) {
+				return nil, fmt.Errorf("event type %s: payload field %s must be an exported Go identifier", eventType, name)
+			}
+			field := reflect.StructField{Name: name, Type: fieldType}
+			if jsonKey != "" {
+				field.Tag = reflect.StructTag(fmt.Sprintf(`json:"%s"`, jsonKey))
+			}
+			structFields = append(structFields, field)
+		}
+		payloadTypes[eventType] = reflect.StructOf(structFields)
+	}
+	return payloadTypes, nil
+}
+
+/*
+DecodeEvent decodes an event in the JSON format consumed by
+EventRegistry.ProcessEvent.
+
+The event type must be registered in the EventRegistry, like the processor
+requires, ErrUnknownEventType is returned otherwise. DecodeEvent does not
+register event types, tools decoding events of arbitrary types register
+them themselves.
+
+The payload is first validated against the JSON Schema registered for the
+event type, if any, like ProcessEvent does. It is then decoded into the
+payload type of the event type. The payload of an event type without a
+payload type, e.g. one registered with BaseEvent[any], gets a struct with a
+field per JSON key, named in CamelCase (usage_percentage becomes
+UsagePercentage), integral numbers are int64 and other numbers float64.
+*/
+func DecodeEvent(data []byte, payloadTypes map[string]reflect.Type) (models.BaseEvent[any], error) {
+	var raw struct {
+		TenantID     string          `json:"tenant_id"`
+		Type         string          `json:"type"`
+		Payload      json.RawMessage `json:"payload"`
+		ShouldHandle bool            `json:"should_handle"`
+		EventSHA     string          `json:"event_sha"`
+		OccuredAt    time.Time       `json:"occured_at"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return models.BaseEvent[any]{}, fmt.Errorf("failed to parse the event: %w", err)
+	}
+
+	registry := models.GetEventRegistry()
+	if raw.Type != "" && !registry.IsRegistered(raw.Type) {
+		return models.BaseEvent[any]{}, fmt.Errorf("'%s': %w", raw.Type, ErrUnknownEventType)
+	}
+	if err := registry.ValidatePayload(raw.Type, raw.Payload); err != nil {
+		return models.BaseEvent[any]{}, err
+	}
+
+	payloadType, known := payloadTypes[raw.Type]
+	if !known {
+		inferred, err := inferPayloadType(raw.Payload)
+		if err != nil {
+			return models.BaseEvent[any]{}, err
+		}
+		payloadType = inferred
+	}
+	// Rule actions may assign to the payload, grule needs a pointer for that.
+	payload := reflect.New(payloadType)
+	if len(raw.Payload) > 0 {
+		if err := json.Unmarshal(raw.Payload, payload.Interface()); err != nil {
+			return models.BaseEvent[any]{}, fmt.Errorf("failed to parse the payload of event type %s: %w", raw.Type, err)
+		}
+	}
+
+	return models.BaseEvent[any]{
+		TenantID:     raw.TenantID,
+		Type:         raw.Type,
+		Payload:      payload.Interface(),
+		ShouldHandle: raw.ShouldHandle,
+		EventSHA:     raw.EventSHA,
+		OccuredAt:    raw.OccuredAt,
+	}, nil
+}
+
+// inferPayloadType builds a payload struct from the keys and values of a JSON object.
+func inferPayloadType(payload json.RawMessage) (reflect.Type, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, fmt.Errorf("the payload of an unknown event type must be a JSON object: %w", err)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]reflect.StructField, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		name := camelCase(key)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		fields = append(fields, reflect.StructField{
+			Name: name,
+			Type: jsonValueType(values[key]),
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s"`, key)),
+		})
+	}
+	return reflect.StructOf(fields), nil
+}
+
+// jsonValueType returns the Go type a JSON value is decoded into.
+func jsonValueType(value json.RawMessage) reflect.Type {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return fieldTypes["any"]
+	}
+	switch value[0] {
+	case '"':
+		return fieldTypes["string"]
+	case 't', 'f':
+		return fieldTypes["bool"]
+	case '{', '[', 'n':
+		return fieldTypes["any"]
+	default:
+		var integer int64
+		if json.Unmarshal(value, &integer) == nil {
+			return fieldTypes["int64"]
+		}
+		return fieldTypes["float64"]
+	}
+}
+
+// camelCase turns a JSON key such as usage_percentage into the exported field name UsagePercentage.
+func camelCase(key string) string {
+	var name strings.Builder
+	upper := true
+	for _, r := range key {
+		switch {
+		case unicode.IsLetter(r) || (unicode.IsDigit(r) && name.Len() > 0):
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			name.WriteRune(r)
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	return name.String()
+}
+
+// isExportedIdentifier reports whether the name can be used as an exported struct field.
+func isExportedIdentifier(name string) bool {
+	for i, r := range name {
+		switch {
+		case i == 0 && !unicode.IsUpper(r):
+			return false
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_':
+			return false
+		}
+	}
+	return name != ""
+}
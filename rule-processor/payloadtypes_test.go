@@ -0,0 +1,100 @@
+package rule_processor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+func TestLoadPayloadTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload_types.json")
+	if err := os.WriteFile(path, []byte(`{"cpu": {"Load": "float64", "Host": "string"}, "queue": "dynamic"}`), 0o600); err != nil {
+		t.Fatalf("failed to write payload types: %v", err)
+	}
+	payloadTypes, err := LoadPayloadTypes(path)
+	if err != nil {
+		t.Fatalf("LoadPayloadTypes() error = %v", err)
+	}
+	if _, ok := payloadTypes["disk_space"]; !ok {
+		t.Error("LoadPayloadTypes() dropped the known payload types")
+	}
+	if field, ok := payloadTypes["cpu"].FieldByName("Load"); !ok || field.Type.Kind() != reflect.Float64 {
+		t.Errorf("cpu payload type = %v", payloadTypes["cpu"])
+	}
+	if payloadTypes["queue"] != reflect.TypeOf(models.DynamicPayload{}) {
+		t.Errorf("queue payload type = %v, want models.DynamicPayload", payloadTypes["queue"])
+	}
+	models.GetEventRegistry().RegisterDynamicEventType("queue")
+	event, err := DecodeEvent([]byte(`{"tenant_id": "tenant1", "type": "queue", "payload": {"depth": 12}}`), payloadTypes)
+	if err != nil {
+		t.Fatalf("DecodeEvent() error = %v", err)
+	}
+	if payload, ok := event.Payload.(*models.DynamicPayload); !ok || payload.GetInt("depth") != 12 {
+		t.Errorf("payload = %#v, want a DynamicPayload with depth 12", event.Payload)
+	}
+
+	for _, catalog := range []string{`{"cpu": {"Load": "decimal"}}`, `{"cpu": "schemaless"}`} {
+		if err := os.WriteFile(path, []byte(catalog), 0o600); err != nil {
+			t.Fatalf("failed to write payload types: %v", err)
+		}
+		if _, err := LoadPayloadTypes(path); err == nil {
+			t.Errorf("LoadPayloadTypes(%s) expected an error for an unknown type", catalog)
+		}
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	payloadTypes := map[string]reflect.Type{"disk_space": reflect.TypeOf(testUsagePayload{})}
+
+	event, err := DecodeEvent([]byte(`{"tenant_id": "tenant1", "type": "disk_space", "payload": {"Usage": 90}}`), payloadTypes)
+	if err != nil {
+		t.Fatalf("DecodeEvent() error = %v", err)
+	}
+	if payload, ok := event.Payload.(*testUsagePayload); !ok || payload.Usage != 90 {
+		t.Errorf("payload = %#v, want *testUsagePayload{Usage: 90}", event.Payload)
+	}
+
+	// DecodeEvent does not register event types.
+	cpuLoad := []byte(`{"tenant_id": "tenant1", "type": "cpu_load", "payload": {"load_average": 0.5, "core_count": 8, "host": "db"}}`)
+	if _, err := DecodeEvent(cpuLoad, payloadTypes); !errors.Is(err, ErrUnknownEventType) {
+		t.Fatalf("DecodeEvent() error = %v, want ErrUnknownEventType", err)
+	}
+	if models.GetEventRegistry().IsRegistered("cpu_load") {
+		t.Fatal("DecodeEvent() registered the unknown event type")
+	}
+
+	// The payload of an event type without a payload type is decoded from its JSON keys.
+	models.GetEventRegistry().RegisterEventType("cpu_load", func() models.Evaluable { return &models.BaseEvent[any]{} })
+	event, err = DecodeEvent(cpuLoad, payloadTypes)
+	if err != nil {
+		t.Fatalf("DecodeEvent() error = %v", err)
+	}
+	payload := reflect.ValueOf(event.Payload).Elem()
+	if payload.FieldByName("LoadAverage").Float() != 0.5 || payload.FieldByName("CoreCount").Int() != 8 || payload.FieldByName("Host").String() != "db" {
+		t.Errorf("inferred payload = %+v", event.Payload)
+	}
+	if err := event.Validate(); err != nil {
+		t.Errorf("decoded event is not valid: %v", err)
+	}
+}
+
+func TestDecodeEvent_ValidatesSchema(t *testing.T) {
+	registry := models.GetEventRegistry()
+	schema, err := models.ParseJSONSchema([]byte(`{"type": "object", "required": ["Usage"], "properties": {"Usage": {"type": "integer"}}}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema() error = %v", err)
+	}
+	registry.RegisterEventType("schema_usage", func() models.Evaluable { return &models.BaseEvent[any]{} })
+	registry.RegisterEventSchema("schema_usage", schema)
+	defer registry.RegisterEventSchema("schema_usage", nil)
+
+	_, err = DecodeEvent([]byte(`{"tenant_id": "tenant1", "type": "schema_usage", "payload": {"Usage": "high"}}`), nil)
+	var schemaErrs models.SchemaValidationErrors
+	if !errors.As(err, &schemaErrs) || schemaErrs[0].Field != "payload.Usage" {
+		t.Errorf("DecodeEvent() error = %v, want a payload.Usage schema error", err)
+	}
+}
@@ -0,0 +1,351 @@
+package rule_processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DEFAULT_RULE_REFRESH_INTERVAL is how often the PostgresRuleRepository refreshes its cache when no reload interval is configured.
+	DEFAULT_RULE_REFRESH_INTERVAL = 30 * time.Second
+)
+
+/*
+PostgresRuleRepository is a RuleRepository reading the rules of every tenant
+from the rules table, so every engine instance sees the same rules.
+
+The rules are served from an in-memory cache. Refresh reloads the cache from
+the database and Watch refreshes it periodically, a refresh that fails keeps
+the cached rules and a tenant with invalid rules keeps its cached rules.
+*/
+type PostgresRuleRepository struct {
+	rules      map[string][]models.Rule
+	mu         sync.RWMutex
+	ruleStore  RuleStore
+	connectDB  DBConnector
+	hash       [sha256.Size]byte
+	generation uint64
+	evaluators []Evaluator
+}
+
+/*
+NewPostgresRuleRepository creates a PostgresRuleRepository and loads its
+cache.
+
+Parameters:
+  - ctx: context.Context - The context of the initial load.
+  - connectDB: DBConnector - Opens the connections used to read and write the rules.
+  - ruleStore: RuleStore - The queries on the rules table, store.New() when nil.
+  - evaluators: ...Evaluator - The evaluators of rule languages other than grl and expr, see ValidateRule.
+
+Returns:
+  - *PostgresRuleRepository: The repository holding the stored rules.
+  - error: If the rules cannot be read or are invalid.
+*/
+func NewPostgresRuleRepository(ctx context.Context, connectDB DBConnector, ruleStore RuleStore, evaluators ...Evaluator) (*PostgresRuleRepository, error) {
+	if ruleStore == nil {
+		ruleStore = store.New()
+	}
+	repo := &PostgresRuleRepository{ruleStore: ruleStore, connectDB: connectDB, evaluators: evaluators}
+	if _, err := repo.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+/*
+Refresh reloads the cached rules from the database.
+
+The stored rules are decoded and validated like the rules of a rule file,
+outside the repository lock, before they replace the cached rules in a
+single swap. The rule_id and event_type columns take precedence over the
+ones in the stored definition.
+
+Failures are scoped per tenant: a tenant with an invalid rule keeps its
+cached rules while the other tenants are refreshed, and the returned
+RuleValidationErrors name the tenants and rules that were rejected. Rules
+rejected by a previous refresh are not reported again. The initial load
+fails if any rule is invalid.
+
+Returns whether the cached rules changed.
+*/
+func (r *PostgresRuleRepository) Refresh(ctx context.Context) (bool, error) {
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return false, fmt.Errorf("[PostgresRuleRepository.Refresh]: failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	rows, err := r.ruleStore.ListRules(ctx, db)
+	if err != nil {
+		return false, fmt.Errorf("[PostgresRuleRepository.Refresh]: failed to list the rules: %w", err)
+	}
+
+	digest := sha256.New()
+	for _, row := range rows {
+		fmt.Fprintf(digest, "%s\x00%s\x00%s\x00%s\x00", row.TenantID, row.RuleID, row.EventType, row.Definition)
+	}
+	var hash [sha256.Size]byte
+	copy(hash[:], digest.Sum(nil))
+
+	r.mu.RLock()
+	loaded := r.rules != nil
+	unchanged := loaded && hash == r.hash
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	rules, rejected := r.decodeRules(rows)
+	if len(rejected) > 0 && !loaded {
+		return false, fmt.Errorf("[PostgresRuleRepository.Refresh]: invalid rules: %w", rejected)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tenantID := range rejected.tenantIDs() {
+		if cached, ok := r.rules[tenantID]; ok {
+			rules[tenantID] = cached
+		}
+	}
+	changed := !reflect.DeepEqual(rules, r.rules)
+	r.rules, r.hash = rules, hash
+	if changed {
+		r.generation++
+	}
+	if len(rejected) > 0 {
+		return changed, fmt.Errorf("[PostgresRuleRepository.Refresh]: invalid rules, keeping the cached rules of their tenants: %w", rejected)
+	}
+	return changed, nil
+}
+
+// decodeRules decodes the stored rules and validates them per tenant, the tenants with an invalid rule are left out.
+func (r *PostgresRuleRepository) decodeRules(rows []*store.Rule) (map[string][]models.Rule, RuleValidationErrors) {
+	var rejected RuleValidationErrors
+	stored := make(map[string][]models.Rule)
+	for _, row := range rows {
+		var rule models.Rule
+		if err := json.Unmarshal(row.Definition, &rule); err != nil {
+			rejected = append(rejected, RuleValidationError{TenantID: row.TenantID, RuleID: row.RuleID, Message: "invalid definition: " + err.Error()})
+			continue
+		}
+		rule.RuleId, rule.EventType = row.RuleID, row.EventType
+		stored[row.TenantID] = append(stored[row.TenantID], rule)
+	}
+
+	undecodable := make(map[string]bool)
+	for _, tenantID := range rejected.tenantIDs() {
+		undecodable[tenantID] = true
+	}
+	rules := make(map[string][]models.Rule, len(stored))
+	for tenantID, tenantRules := range stored {
+		err := ValidateTenantRules(map[string][]models.Rule{tenantID: tenantRules}, r.evaluators...)
+		var errs RuleValidationErrors
+		if errors.As(err, &errs) {
+			rejected = append(rejected, errs...)
+		} else if err != nil {
+			rejected = append(rejected, RuleValidationError{TenantID: tenantID, Message: err.Error()})
+		}
+		if err == nil && !undecodable[tenantID] {
+			rules[tenantID] = tenantRules
+		}
+	}
+	sort.SliceStable(rejected, func(i, j int) bool {
+		return rejected[i].TenantID < rejected[j].TenantID
+	})
+	return rules, rejected
+}
+
+/*
+Watch refreshes the cached rules every interval until the context is done.
+
+onReload, when not nil, is called after every refresh that changed the
+rules (with a nil error) or failed.
+*/
+func (r *PostgresRuleRepository) Watch(ctx context.Context, interval time.Duration, onReload func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshed, err := r.Refresh(ctx)
+			if err != nil {
+				log.Printf("[PostgresRuleRepository.Watch]: %v", err)
+			}
+			if onReload != nil && (refreshed || err != nil) {
+				onReload(err)
+			}
+		}
+	}
+}
+
+/*
+SaveRule creates or replaces a rule of a tenant and refreshes the cache.
+
+The rule is validated together with the tenant's other rules before it is
+stored. A rule moved to another event type is deleted and stored in one
+transaction, so it is never lost or stored twice. Other engine instances
+pick it up on their next refresh.
+*/
+func (r *PostgresRuleRepository) SaveRule(ctx context.Context, tenantID string, rule models.Rule) error {
+	return r.writeRule(ctx, tenantID, rule, ruleWriteUpsert)
+}
+
+// CreateRule creates a rule of a tenant like SaveRule, ErrRuleExists if the tenant already has the rule_id.
+func (r *PostgresRuleRepository) CreateRule(ctx context.Context, tenantID string, rule models.Rule) error {
+	return r.writeRule(ctx, tenantID, rule, ruleWriteCreate)
+}
+
+// UpdateRule replaces a rule of a tenant like SaveRule, ErrRuleNotFound if the tenant has no such rule.
+func (r *PostgresRuleRepository) UpdateRule(ctx context.Context, tenantID string, rule models.Rule) error {
+	return r.writeRule(ctx, tenantID, rule, ruleWriteUpdate)
+}
+
+/*
+writeRule validates and writes a rule of a tenant. The rule_id is locked
+for the transaction, so whether it exists is checked against the rules
+table and not the cache, and concurrent writes of every engine instance
+are serialized.
+*/
+func (r *PostgresRuleRepository) writeRule(ctx context.Context, tenantID string, rule models.Rule, write ruleWrite) error {
+	r.mu.RLock()
+	candidate := make([]models.Rule, 0, len(r.rules[tenantID])+1)
+	for _, existing := range r.rules[tenantID] {
+		if existing.RuleId != rule.RuleId {
+			candidate = append(candidate, existing)
+		}
+	}
+	r.mu.RUnlock()
+	if err := ValidateTenantRules(map[string][]models.Rule{tenantID: append(candidate, rule)}, r.evaluators...); err != nil {
+		return fmt.Errorf("[PostgresRuleRepository.SaveRule]: %w", err)
+	}
+
+	definition, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("[PostgresRuleRepository.SaveRule]: failed to encode rule %s: %w", rule.RuleId, err)
+	}
+
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return fmt.Errorf("[PostgresRuleRepository.SaveRule]: failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	err = inTransaction(ctx, db, func(tx store.DBTX) error {
+		if err := r.ruleStore.LockRule(ctx, tx, store.LockRuleParams{TenantID: tenantID, RuleID: rule.RuleId}); err != nil {
+			return fmt.Errorf("failed to lock rule %s: %w", rule.RuleId, err)
+		}
+		eventTypes, err := r.ruleStore.ListRuleEventTypes(ctx, tx, store.ListRuleEventTypesParams{TenantID: tenantID, RuleID: rule.RuleId})
+		if err != nil {
+			return fmt.Errorf("failed to read rule %s: %w", rule.RuleId, err)
+		}
+		if err := write.check(tenantID, rule.RuleId, len(eventTypes) > 0); err != nil {
+			return err
+		}
+		// A rule_id is unique per tenant, the rule stored under another event type is moved.
+		for _, eventType := range eventTypes {
+			if eventType != rule.EventType {
+				if err := r.ruleStore.DeleteRule(ctx, tx, store.DeleteRuleParams{TenantID: tenantID, RuleID: rule.RuleId, EventType: eventType}); err != nil {
+					return fmt.Errorf("failed to move rule %s: %w", rule.RuleId, err)
+				}
+			}
+		}
+		if err := r.ruleStore.UpsertRule(ctx, tx, store.UpsertRuleParams{
+			TenantID:   tenantID,
+			RuleID:     rule.RuleId,
+			EventType:  rule.EventType,
+			Definition: definition,
+		}); err != nil {
+			return fmt.Errorf("failed to save rule %s: %w", rule.RuleId, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("[PostgresRuleRepository.SaveRule]: %w", err)
+	}
+	_, err = r.Refresh(ctx)
+	return err
+}
+
+/*
+DeleteRule removes a rule of a tenant and refreshes the cache,
+ErrRuleNotFound if the tenant has no such rule. Like writeRule it locks the
+rule_id for the transaction, whether it exists is decided by the rows
+deleted and not by the cache.
+*/
+func (r *PostgresRuleRepository) DeleteRule(ctx context.Context, tenantID, ruleID string) error {
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return fmt.Errorf("[PostgresRuleRepository.DeleteRule]: failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	err = inTransaction(ctx, db, func(tx store.DBTX) error {
+		if err := r.ruleStore.LockRule(ctx, tx, store.LockRuleParams{TenantID: tenantID, RuleID: ruleID}); err != nil {
+			return fmt.Errorf("failed to lock rule %s: %w", ruleID, err)
+		}
+		deleted, err := r.ruleStore.DeleteRuleByID(ctx, tx, store.DeleteRuleByIDParams{TenantID: tenantID, RuleID: ruleID})
+		if err != nil {
+			return fmt.Errorf("failed to delete rule %s: %w", ruleID, err)
+		}
+		if deleted == 0 {
+			return fmt.Errorf("tenant: %s, rule: %s: %w", tenantID, ruleID, ErrRuleNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("[PostgresRuleRepository.DeleteRule]: %w", err)
+	}
+	_, err = r.Refresh(ctx)
+	return err
+}
+
+// Generation returns a counter incremented every time a refresh changes the cached rules, e.g. after a save.
+func (r *PostgresRuleRepository) Generation() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generation
+}
+
+// GetTenantRules returns a copy of the cached rules stored for the tenant itself, without the default rules.
+func (r *PostgresRuleRepository) GetTenantRules(tenantID string) ([]models.Rule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]models.Rule(nil), r.rules[tenantID]...), nil
+}
+
+/*
+GetRules retrieves the effective rules of a tenant for an event type from
+the cache, the tenant's rules layered on top of the DEFAULT_TENANT_RULE_ID
+rules, see ResolveTenantRules.
+*/
+func (r *PostgresRuleRepository) GetRules(tenantID, eventType string) ([]models.Rule, error) {
+	effective, err := r.GetEffectiveRules(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return filterRulesByEventType(effective, eventType), nil
+}
+
+// GetEffectiveRules returns the cached rules that apply to a tenant for every event type.
+func (r *PostgresRuleRepository) GetEffectiveRules(tenantID string) ([]models.Rule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if tenantID == DEFAULT_TENANT_RULE_ID {
+		return ResolveTenantRules(r.rules[DEFAULT_TENANT_RULE_ID], nil), nil
+	}
+	return ResolveTenantRules(r.rules[DEFAULT_TENANT_RULE_ID], r.rules[tenantID]), nil
+}
@@ -0,0 +1,389 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5"
+)
+
+// memoryRuleStore is an in-memory RuleStore behaving like the rules table.
+type memoryRuleStore struct {
+	mu        sync.Mutex
+	rows      map[store.DeleteRuleParams][]byte
+	listErr   error
+	upsertErr error
+}
+
+func newMemoryRuleStore() *memoryRuleStore {
+	return &memoryRuleStore{rows: make(map[store.DeleteRuleParams][]byte)}
+}
+
+func (s *memoryRuleStore) put(t *testing.T, tenantID string, rule models.Rule) {
+	t.Helper()
+	definition, err := json.Marshal(rule)
+	if err != nil {
+		t.Fatalf("failed to encode rule: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows[store.DeleteRuleParams{TenantID: tenantID, RuleID: rule.RuleId, EventType: rule.EventType}] = definition
+}
+
+func (s *memoryRuleStore) ListRules(ctx context.Context, db store.DBTX) ([]*store.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	var rows []*store.Rule
+	for key, definition := range s.rows {
+		rows = append(rows, &store.Rule{TenantID: key.TenantID, RuleID: key.RuleID, EventType: key.EventType, Definition: definition})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].TenantID != rows[j].TenantID {
+			return rows[i].TenantID < rows[j].TenantID
+		}
+		if rows[i].RuleID != rows[j].RuleID {
+			return rows[i].RuleID < rows[j].RuleID
+		}
+		return rows[i].EventType < rows[j].EventType
+	})
+	return rows, nil
+}
+
+func (s *memoryRuleStore) UpsertRule(ctx context.Context, db store.DBTX, arg store.UpsertRuleParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.upsertErr != nil {
+		return s.upsertErr
+	}
+	s.rows[store.DeleteRuleParams{TenantID: arg.TenantID, RuleID: arg.RuleID, EventType: arg.EventType}] = arg.Definition
+	return nil
+}
+
+func (s *memoryRuleStore) LockRule(ctx context.Context, db store.DBTX, arg store.LockRuleParams) error {
+	return nil
+}
+
+func (s *memoryRuleStore) ListRuleEventTypes(ctx context.Context, db store.DBTX, arg store.ListRuleEventTypesParams) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var eventTypes []string
+	for key := range s.rows {
+		if key.TenantID == arg.TenantID && key.RuleID == arg.RuleID {
+			eventTypes = append(eventTypes, key.EventType)
+		}
+	}
+	sort.Strings(eventTypes)
+	return eventTypes, nil
+}
+
+func (s *memoryRuleStore) DeleteRule(ctx context.Context, db store.DBTX, arg store.DeleteRuleParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rows, arg)
+	return nil
+}
+
+func (s *memoryRuleStore) DeleteRuleByID(ctx context.Context, db store.DBTX, arg store.DeleteRuleByIDParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for key := range s.rows {
+		if key.TenantID == arg.TenantID && key.RuleID == arg.RuleID {
+			delete(s.rows, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// recordingTx is a pgx.Tx recording whether it was committed or rolled back.
+type recordingTx struct {
+	pgx.Tx
+	committed, rolledBack bool
+}
+
+func (tx *recordingTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *recordingTx) Rollback(ctx context.Context) error {
+	if tx.committed {
+		return pgx.ErrTxClosed
+	}
+	tx.rolledBack = true
+	return nil
+}
+
+// transactionalDB is a connection beginning recordingTxs.
+type transactionalDB struct {
+	store.DBTX
+	txs []*recordingTx
+}
+
+func (db *transactionalDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx := &recordingTx{}
+	db.txs = append(db.txs, tx)
+	return tx, nil
+}
+
+func (db *transactionalDB) connect(ctx context.Context) (store.DBTX, func(), error) {
+	return db, func() {}, nil
+}
+
+func diskRule(ruleID string, threshold string) models.Rule {
+	return models.Rule{
+		RuleId:    ruleID,
+		EventType: "disk_space",
+		Condition: "Payload.Usage >= " + threshold,
+		Action:    "Event.ShouldHandle = true",
+	}
+}
+
+func TestPostgresRuleRepository_Refresh(t *testing.T) {
+	ruleStore := newMemoryRuleStore()
+	ruleStore.put(t, DEFAULT_TENANT_RULE_ID, diskRule("disk_80", "80"))
+	ruleStore.put(t, DEFAULT_TENANT_RULE_ID, diskRule("disk_95", "95"))
+	ruleStore.put(t, "tenant1", models.Rule{RuleId: "disk_95", Disabled: true})
+
+	ctx := context.Background()
+	repo, err := NewPostgresRuleRepository(ctx, NoDBConnector, ruleStore)
+	if err != nil {
+		t.Fatalf("NewPostgresRuleRepository() error = %v", err)
+	}
+
+	rules, err := repo.GetRules("tenant1", "disk_space")
+	if err != nil {
+		t.Fatalf("GetRules() error = %v", err)
+	}
+	if ids := ruleIDs(rules); !reflect.DeepEqual(ids, []string{"disk_80"}) {
+		t.Errorf("GetRules(tenant1) = %v", ids)
+	}
+	if rules, _ := repo.GetRules("tenant2", "disk_space"); len(rules) != 2 {
+		t.Errorf("GetRules(tenant2) = %v", ruleIDs(rules))
+	}
+
+	generation := repo.Generation()
+	if refreshed, err := repo.Refresh(ctx); err != nil || refreshed || repo.Generation() != generation {
+		t.Errorf("Refresh() without changes = %v, %v, generation %d, want %d", refreshed, err, repo.Generation(), generation)
+	}
+
+	ruleStore.put(t, "tenant1", diskRule("disk_50", "50"))
+	if refreshed, err := repo.Refresh(ctx); err != nil || !refreshed {
+		t.Fatalf("Refresh() = %v, %v, want true, nil", refreshed, err)
+	}
+	if repo.Generation() == generation {
+		t.Error("Generation() did not change with the rules")
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80", "disk_50"}) {
+		t.Errorf("GetRules(tenant1) after refresh = %v", ruleIDs(rules))
+	}
+
+	// Invalid rules are reported once and keep the cached rules.
+	ruleStore.put(t, "tenant1", diskRule("disk_broken", ""))
+	if _, err := repo.Refresh(ctx); err == nil {
+		t.Error("Refresh() expected an error for an invalid rule")
+	}
+	if _, err := repo.Refresh(ctx); err != nil {
+		t.Errorf("Refresh() reported the rejected rules again: %v", err)
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); len(rules) != 2 {
+		t.Errorf("GetRules(tenant1) after invalid refresh = %v", ruleIDs(rules))
+	}
+
+	ruleStore.listErr = errors.New("connection reset")
+	if _, err := repo.Refresh(ctx); err == nil {
+		t.Error("Refresh() expected an error when the rules cannot be listed")
+	}
+	if _, err := NewPostgresRuleRepository(ctx, NoDBConnector, ruleStore); err == nil {
+		t.Error("NewPostgresRuleRepository() expected an error when the rules cannot be listed")
+	}
+}
+
+func TestPostgresRuleRepository_RefreshScopesFailuresPerTenant(t *testing.T) {
+	ruleStore := newMemoryRuleStore()
+	ruleStore.put(t, "tenant1", diskRule("disk_80", "80"))
+	ruleStore.put(t, "tenant2", diskRule("disk_90", "90"))
+
+	ctx := context.Background()
+	repo, err := NewPostgresRuleRepository(ctx, NoDBConnector, ruleStore)
+	if err != nil {
+		t.Fatalf("NewPostgresRuleRepository() error = %v", err)
+	}
+
+	// tenant2 gets an invalid rule and tenant3 an undecodable one, tenant1 is still refreshed.
+	ruleStore.put(t, "tenant1", diskRule("disk_50", "50"))
+	ruleStore.put(t, "tenant2", diskRule("disk_broken", ""))
+	ruleStore.rows[store.DeleteRuleParams{TenantID: "tenant3", RuleID: "disk_70", EventType: "disk_space"}] = []byte("{")
+	refreshed, err := repo.Refresh(ctx)
+	var errs RuleValidationErrors
+	if !refreshed || !errors.As(err, &errs) {
+		t.Fatalf("Refresh() = %v, %v, want true and RuleValidationErrors", refreshed, err)
+	}
+	if len(errs) != 2 || errs[0].TenantID != "tenant2" || errs[0].RuleID != "disk_broken" || errs[1].TenantID != "tenant3" || errs[1].RuleID != "disk_70" {
+		t.Errorf("Refresh() errors = %+v, want disk_broken of tenant2 and disk_70 of tenant3", errs)
+	}
+	if rules, _ := repo.GetTenantRules("tenant1"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_50", "disk_80"}) {
+		t.Errorf("GetTenantRules(tenant1) = %v, want [disk_50 disk_80]", ruleIDs(rules))
+	}
+	if rules, _ := repo.GetTenantRules("tenant2"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_90"}) {
+		t.Errorf("GetTenantRules(tenant2) = %v, want the cached [disk_90]", ruleIDs(rules))
+	}
+	if rules, _ := repo.GetTenantRules("tenant3"); len(rules) != 0 {
+		t.Errorf("GetTenantRules(tenant3) = %v, want none", ruleIDs(rules))
+	}
+	if _, err := repo.Refresh(ctx); err != nil {
+		t.Errorf("Refresh() reported the rejected rules again: %v", err)
+	}
+}
+
+func TestPostgresRuleRepository_SaveAndDeleteRule(t *testing.T) {
+	ctx := context.Background()
+	ruleStore := newMemoryRuleStore()
+	repo, err := NewPostgresRuleRepository(ctx, NoDBConnector, ruleStore)
+	if err != nil {
+		t.Fatalf("NewPostgresRuleRepository() error = %v", err)
+	}
+
+	if err := repo.SaveRule(ctx, "tenant1", diskRule("disk_80", "80")); err != nil {
+		t.Fatalf("SaveRule() error = %v", err)
+	}
+	moved := diskRule("disk_80", "80")
+	moved.EventType = "disk_io"
+	if err := repo.SaveRule(ctx, "tenant1", moved); err != nil {
+		t.Fatalf("SaveRule() error = %v", err)
+	}
+	if len(ruleStore.rows) != 1 {
+		t.Errorf("rules table holds %d rows, want 1", len(ruleStore.rows))
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_io"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80"}) {
+		t.Errorf("GetRules(disk_io) = %v", ruleIDs(rules))
+	}
+
+	if err := repo.CreateRule(ctx, "tenant1", diskRule("disk_80", "90")); !errors.Is(err, ErrRuleExists) {
+		t.Errorf("CreateRule() of an existing rule error = %v, want ErrRuleExists", err)
+	}
+	if err := repo.UpdateRule(ctx, "tenant1", diskRule("disk_70", "70")); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("UpdateRule() of a missing rule error = %v, want ErrRuleNotFound", err)
+	}
+	if err := repo.UpdateRule(ctx, "tenant1", diskRule("disk_80", "85")); err != nil {
+		t.Errorf("UpdateRule() error = %v", err)
+	}
+	if err := repo.SaveRule(ctx, "tenant1", diskRule("disk_broken", "")); err == nil {
+		t.Error("SaveRule() expected an error for an invalid rule")
+	}
+	if len(ruleStore.rows) != 1 {
+		t.Errorf("an invalid rule was stored")
+	}
+
+	if err := repo.DeleteRule(ctx, "tenant1", "disk_80"); err != nil {
+		t.Fatalf("DeleteRule() error = %v", err)
+	}
+	if rules, _ := repo.GetEffectiveRules("tenant1"); len(rules) != 0 {
+		t.Errorf("GetEffectiveRules() after delete = %v", ruleIDs(rules))
+	}
+	if err := repo.DeleteRule(ctx, "tenant1", "disk_80"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("DeleteRule() of a missing rule error = %v, want ErrRuleNotFound", err)
+	}
+}
+
+func TestPostgresRuleRepository_DeleteRuleChecksTheTable(t *testing.T) {
+	ctx := context.Background()
+	ruleStore := newMemoryRuleStore()
+	ruleStore.put(t, "tenant1", diskRule("disk_80", "80"))
+	db := &transactionalDB{}
+	repo, err := NewPostgresRuleRepository(ctx, db.connect, ruleStore)
+	if err != nil {
+		t.Fatalf("NewPostgresRuleRepository() error = %v", err)
+	}
+
+	// Another instance deleted the cached rule and stored one the cache does not know yet
+	ruleStore.mu.Lock()
+	delete(ruleStore.rows, store.DeleteRuleParams{TenantID: "tenant1", RuleID: "disk_80", EventType: "disk_space"})
+	ruleStore.mu.Unlock()
+	ruleStore.put(t, "tenant1", diskRule("disk_90", "90"))
+
+	if err := repo.DeleteRule(ctx, "tenant1", "disk_80"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("DeleteRule() of a rule only in the cache error = %v, want ErrRuleNotFound", err)
+	}
+	if err := repo.DeleteRule(ctx, "tenant1", "disk_90"); err != nil {
+		t.Errorf("DeleteRule() of a rule not cached yet error = %v", err)
+	}
+	if len(db.txs) != 2 || !db.txs[0].rolledBack || !db.txs[1].committed {
+		t.Errorf("transactions = %+v, want the missing rule rolled back and the delete committed", db.txs)
+	}
+	if rules, _ := repo.GetEffectiveRules("tenant1"); len(rules) != 0 {
+		t.Errorf("GetEffectiveRules() after delete = %v", ruleIDs(rules))
+	}
+}
+
+func TestPostgresRuleRepository_SaveRuleInTransaction(t *testing.T) {
+	ctx := context.Background()
+	ruleStore := newMemoryRuleStore()
+	ruleStore.put(t, "tenant1", diskRule("disk_80", "80"))
+	db := &transactionalDB{}
+	repo, err := NewPostgresRuleRepository(ctx, db.connect, ruleStore)
+	if err != nil {
+		t.Fatalf("NewPostgresRuleRepository() error = %v", err)
+	}
+
+	// Moving the rule deletes and stores it in one transaction, rolled back when the rule cannot be stored.
+	moved := diskRule("disk_80", "80")
+	moved.EventType = "disk_io"
+	ruleStore.upsertErr = errors.New("connection reset")
+	if err := repo.SaveRule(ctx, "tenant1", moved); err == nil {
+		t.Fatal("SaveRule() expected an error when the rule cannot be stored")
+	}
+	if len(db.txs) != 1 || !db.txs[0].rolledBack || db.txs[0].committed {
+		t.Fatalf("transactions = %+v, want one rolled back", db.txs)
+	}
+
+	ruleStore.upsertErr = nil
+	if err := repo.SaveRule(ctx, "tenant1", moved); err != nil {
+		t.Fatalf("SaveRule() error = %v", err)
+	}
+	if len(db.txs) != 2 || !db.txs[1].committed || db.txs[1].rolledBack {
+		t.Errorf("transactions = %+v, want the second committed", db.txs)
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_io"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80"}) {
+		t.Errorf("GetRules(disk_io) = %v", ruleIDs(rules))
+	}
+}
+
+func TestPostgresRuleRepository_Watch(t *testing.T) {
+	ruleStore := newMemoryRuleStore()
+	ruleStore.put(t, DEFAULT_TENANT_RULE_ID, diskRule("disk_80", "80"))
+	repo, err := NewPostgresRuleRepository(context.Background(), NoDBConnector, ruleStore)
+	if err != nil {
+		t.Fatalf("NewPostgresRuleRepository() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan error, 1)
+	go repo.Watch(ctx, 5*time.Millisecond, func(err error) { reloads <- err })
+
+	ruleStore.put(t, DEFAULT_TENANT_RULE_ID, diskRule("disk_90", "90"))
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Fatalf("reload error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() did not refresh the rules")
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); len(rules) != 2 {
+		t.Errorf("GetRules() after watch = %v", ruleIDs(rules))
+	}
+}
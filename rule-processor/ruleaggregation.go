@@ -0,0 +1,293 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5/pgtype"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// WINDOW_FACT_NAME is the name of the fact exposing the window of an aggregation rule to its condition and action.
+	WINDOW_FACT_NAME = "Window"
+)
+
+// windowReference matches a reference to the Window fact in a condition or action.
+var windowReference = regexp.MustCompile(`\b` + WINDOW_FACT_NAME + `\s*\.`)
+
+// ruleAggregation is the compiled models.RuleAggregation of a rule.
+type ruleAggregation struct {
+	groupBy  string
+	field    string
+	size     int
+	duration time.Duration
+}
+
+/*
+compileRuleAggregation checks the window of an aggregation rule and parses
+its duration. It returns nil for a rule without aggregation.
+*/
+func compileRuleAggregation(aggregation *models.RuleAggregation) (*ruleAggregation, error) {
+	if aggregation == nil {
+		return nil, nil
+	}
+	compiled := &ruleAggregation{groupBy: aggregation.GroupBy, field: aggregation.Field, size: aggregation.Size}
+	if aggregation.Size < 0 {
+		return nil, fmt.Errorf("size must be positive, got %d", aggregation.Size)
+	}
+	if aggregation.Duration != "" {
+		duration, err := time.ParseDuration(aggregation.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration '%s', expected e.g. 15m", aggregation.Duration)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("duration must be positive, got %s", aggregation.Duration)
+		}
+		compiled.duration = duration
+	}
+	if compiled.size == 0 && compiled.duration == 0 {
+		return nil, fmt.Errorf("size or duration is required")
+	}
+	return compiled, nil
+}
+
+// limit returns the number of samples the window holds, unbounded windows are limited by their duration only.
+func (a *ruleAggregation) limit() int32 {
+	if a.size == 0 {
+		return math.MaxInt32
+	}
+	return int32(a.size)
+}
+
+// since returns the time from which the samples of the window occurred, for an event at the given time.
+func (a *ruleAggregation) since(at time.Time) time.Time {
+	if a.duration == 0 {
+		return time.Time{}
+	}
+	return at.Add(-a.duration)
+}
+
+/*
+sample returns the group key and the value the event adds to the window,
+read from the payload by JSON key or Go field name like the fields of a
+condition tree. A missing group_by field is an empty key, a missing field a
+0 value.
+*/
+func (a *ruleAggregation) sample(payload any) (string, float64) {
+	var key string
+	if a.groupBy != "" {
+		if value, ok := payloadFieldValue(payload, a.groupBy); ok {
+			key = fmt.Sprint(value)
+		}
+	}
+	var value float64
+	if a.field != "" {
+		field, _ := payloadFieldValue(payload, a.field)
+		value, _ = windowValue(field)
+	}
+	return key, value
+}
+
+/*
+payloadFieldValue returns the value of the payload field at a dotted path of
+JSON keys or Go field names, the value of the JSON object for a
+models.DynamicPayload.
+*/
+func payloadFieldValue(payload any, path string) (any, bool) {
+	if dynamic, ok := payload.(*models.DynamicPayload); ok {
+		var current any = dynamic.Fields()
+		for _, key := range strings.Split(path, ".") {
+			object, ok := current.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if current, ok = object[key]; !ok {
+				return nil, false
+			}
+		}
+		return current, true
+	}
+
+	current := reflect.ValueOf(payload)
+	for _, name := range strings.Split(path, ".") {
+		for current.Kind() == reflect.Pointer || current.Kind() == reflect.Interface {
+			if current.IsNil() {
+				return nil, false
+			}
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return nil, false
+		}
+		field, ok := payloadFieldByName(current.Type(), name)
+		if !ok {
+			return nil, false
+		}
+		current = current.FieldByIndex(field.Index)
+	}
+	for current.Kind() == reflect.Pointer {
+		if current.IsNil() {
+			return nil, false
+		}
+		current = current.Elem()
+	}
+	return current.Interface(), true
+}
+
+// windowValue converts the value of a numeric payload field to the value of a window sample.
+func windowValue(value any) (float64, bool) {
+	if number, ok := value.(json.Number); ok {
+		f, err := number.Float64()
+		return f, err == nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+/*
+aggregationFieldErrors reports the group_by and field of an aggregation rule
+that the payload type does not have, or that cannot be aggregated. Any field
+of a models.DynamicPayload is accepted.
+*/
+func aggregationFieldErrors(rule models.Rule, payloadType reflect.Type) RuleValidationErrors {
+	if rule.Aggregation == nil || payloadType == reflect.TypeOf(models.DynamicPayload{}) {
+		return nil
+	}
+	var errs RuleValidationErrors
+	fail := func(format string, args ...any) {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_AGGREGATION, Message: fmt.Sprintf(format, args...)})
+	}
+	if groupBy := rule.Aggregation.GroupBy; groupBy != "" {
+		if _, ok := resolvePayloadField(payloadType, strings.Split(groupBy, ".")); !ok {
+			fail("unknown group_by field '%s' for event type '%s'", groupBy, rule.EventType)
+		}
+	}
+	if field := rule.Aggregation.Field; field != "" {
+		resolved, ok := resolvePayloadField(payloadType, strings.Split(field, "."))
+		if !ok {
+			fail("unknown field '%s' for event type '%s'", field, rule.EventType)
+		} else if _, numeric := windowValue(reflect.Zero(derefType(resolved.Type)).Interface()); !numeric {
+			fail("field '%s' of type %s is not a number", field, resolved.Type)
+		}
+	}
+	return errs
+}
+
+// derefType returns the type pointed to by a pointer type, the type itself otherwise.
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+/*
+updateWindows records the event in the window of its group for every
+aggregation rule of the rule set, and returns the windows of the rules
+allowed to fire by the gate, keyed by rule ID.
+
+An event skipped as a duplicate by a rule is not recorded again in the
+window of the rule. The sample is added, the window trimmed and read in one
+transaction, so concurrent events of a group do not see a partial window.
+
+Windows are read from the WindowStore, except in a dry run that does not
+check duplicates where a window only holds the event. A dry run does not
+record the event, it is added to the windows read instead.
+
+Parameters:
+  - ctx: context.Context - A context to manage cancellation and deadlines.
+  - database: store.DBTX - The connection to the state store, opened when mode.usesStore().
+  - event: models.BaseEvent[any] - The event being evaluated.
+  - payload: any - The payload of the event, as exposed to the rules.
+  - compiled: *compiledRuleSet - The compiled rules, with their aggregations.
+  - occurredAt: time.Time - The time the event occurred.
+  - gate: *ruleGate - The rules allowed to fire.
+  - duplicates: map[string]bool - The rules that skipped the event as a duplicate.
+  - mode: evaluationMode - Whether the evaluation is a dry run.
+
+Returns:
+  - map[string]*models.AggregationWindow: The windows of the active aggregation rules.
+  - error: If the WindowStore failed.
+*/
+func (re *GRuleProcessor) updateWindows(ctx context.Context, database store.DBTX, event models.BaseEvent[any], payload any,
+	compiled *compiledRuleSet, occurredAt time.Time, gate *ruleGate, duplicates map[string]bool, mode evaluationMode) (map[string]*models.AggregationWindow, error) {
+	if len(compiled.aggregations) == 0 {
+		return nil, nil
+	}
+	occurredAt = occurredAt.UTC()
+	windows := make(map[string]*models.AggregationWindow)
+	for _, ruleID := range compiled.aggregationOrder {
+		record := !mode.dryRun && !duplicates[ruleID]
+		if !record && !gate.IsActive(ruleID) {
+			continue
+		}
+		aggregation := compiled.aggregations[ruleID]
+		key, value := aggregation.sample(payload)
+		values := []float64{value} // The window of a dry run without database
+		if mode.usesStore() {
+			var samples []*store.WindowSample
+			err := inTransaction(ctx, database, func(tx store.DBTX) (err error) {
+				samples, err = re.updateWindow(ctx, tx, event, ruleID, aggregation, key, value, occurredAt, record, gate.IsActive(ruleID), mode)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", ruleID, err)
+			}
+			if !mode.dryRun {
+				values = values[:0]
+			}
+			for _, sample := range samples {
+				values = append(values, sample.Value)
+			}
+		}
+		if gate.IsActive(ruleID) {
+			windows[ruleID] = models.NewAggregationWindow(ruleID, key, values)
+		}
+	}
+	return windows, nil
+}
+
+// updateWindow records the sample in the window of a group when record is set, trims the window and returns its samples when list is set.
+func (re *GRuleProcessor) updateWindow(ctx context.Context, tx store.DBTX, event models.BaseEvent[any], ruleID string, aggregation *ruleAggregation,
+	key string, value float64, occurredAt time.Time, record bool, list bool, mode evaluationMode) ([]*store.WindowSample, error) {
+	since := pgtype.Timestamp{Time: aggregation.since(occurredAt), Valid: true}
+	if record {
+		if err := re.windowStore.AddWindowSample(ctx, tx, store.AddWindowSampleParams{
+			TenantID: event.TenantID, EventType: event.Type, RuleID: ruleID, GroupKey: key, Value: value,
+			OccurredAt: pgtype.Timestamp{Time: occurredAt, Valid: true},
+		}); err != nil {
+			return nil, err
+		}
+		if err := re.windowStore.TrimWindowSamples(ctx, tx, store.TrimWindowSamplesParams{
+			TenantID: event.TenantID, EventType: event.Type, RuleID: ruleID, GroupKey: key, OccurredAt: since, Limit: aggregation.limit(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if !list {
+		return nil, nil
+	}
+	limit := aggregation.limit()
+	if mode.dryRun && limit < math.MaxInt32 {
+		limit-- // The event is not recorded, it takes the place of the oldest sample
+	}
+	return re.windowStore.ListWindowSamples(ctx, tx, store.ListWindowSamplesParams{
+		TenantID: event.TenantID, EventType: event.Type, RuleID: ruleID, GroupKey: key, OccurredAt: since, Limit: limit,
+	})
+}
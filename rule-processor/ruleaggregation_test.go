@@ -0,0 +1,335 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type windowHost struct {
+	Zone string `json:"zone"`
+}
+
+type windowPayload struct {
+	InstanceID string      `json:"instance_id"`
+	Usage      int         `json:"usage_percentage"`
+	Host       *windowHost `json:"host"`
+}
+
+func init() {
+	models.GetEventRegistry().RegisterEventType("instance_usage", func() models.Evaluable {
+		return &models.BaseEvent[windowPayload]{}
+	})
+}
+
+func usageEvent(instanceID string, usage int, occurredAt time.Time) models.BaseEvent[any] {
+	return models.BaseEvent[any]{
+		TenantID:  "tenant1",
+		Type:      "instance_usage",
+		Payload:   &windowPayload{InstanceID: instanceID, Usage: usage},
+		EventSHA:  instanceID,
+		OccuredAt: occurredAt,
+	}
+}
+
+func TestCompileRuleAggregation(t *testing.T) {
+	tests := []struct {
+		name        string
+		aggregation models.RuleAggregation
+		wantErr     string
+	}{
+		{"size", models.RuleAggregation{Size: 5}, ""},
+		{"duration", models.RuleAggregation{Duration: "15m"}, ""},
+		{"size and duration", models.RuleAggregation{Size: 5, Duration: "1h"}, ""},
+		{"no window", models.RuleAggregation{GroupBy: "instance_id"}, "size or duration is required"},
+		{"negative size", models.RuleAggregation{Size: -1}, "size must be positive"},
+		{"invalid duration", models.RuleAggregation{Duration: "15 minutes"}, "invalid duration '15 minutes'"},
+		{"negative duration", models.RuleAggregation{Duration: "-5m"}, "duration must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileRuleAggregation(&tt.aggregation)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("compileRuleAggregation() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileRuleAggregation() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPayloadFieldValue(t *testing.T) {
+	payload := &windowPayload{InstanceID: "i-1", Usage: 85, Host: &windowHost{Zone: "eu"}}
+	dynamic, err := models.NewDynamicPayload([]byte(`{"instance_id": "i-2", "usage": 42.5, "host": {"zone": "us"}}`))
+	if err != nil {
+		t.Fatalf("NewDynamicPayload() error = %v", err)
+	}
+	tests := []struct {
+		payload any
+		path    string
+		want    any
+		wantOK  bool
+	}{
+		{payload, "instance_id", "i-1", true},
+		{payload, "InstanceID", "i-1", true},
+		{payload, "usage_percentage", 85, true},
+		{payload, "host.zone", "eu", true},
+		{&windowPayload{}, "host.zone", nil, false},
+		{payload, "region", nil, false},
+		{dynamic, "instance_id", "i-2", true},
+		{dynamic, "usage", json.Number("42.5"), true},
+		{dynamic, "host.zone", "us", true},
+		{dynamic, "host.region", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := payloadFieldValue(tt.payload, tt.path)
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("payloadFieldValue(%T, %s) = %v, %v, want %v, %v", tt.payload, tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGRuleProcessor_EvaluateCountWindow(t *testing.T) {
+	for _, language := range []string{models.RULE_LANGUAGE_GRL, models.RULE_LANGUAGE_EXPR} {
+		t.Run(language, func(t *testing.T) {
+			rule := models.Rule{
+				RuleId: "usage_sustained", EventType: "instance_usage", Language: language,
+				Condition:   "Window.CountAtLeast(80) >= 3",
+				Action:      "Event.ShouldHandle = true",
+				Aggregation: &models.RuleAggregation{GroupBy: "instance_id", Field: "usage_percentage", Size: 5},
+			}
+			if errs := ValidateRule(rule); len(errs) > 0 {
+				t.Fatalf("ValidateRule() = %v", errs)
+			}
+			repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+			windowStore := NewMemoryWindowStore()
+			processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithWindowStore(windowStore))
+
+			start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+			for i, tt := range []struct {
+				instanceID string
+				usage      int
+				want       bool
+			}{
+				{"i-1", 85, false},
+				{"i-1", 50, false},
+				{"i-2", 90, false}, // Another window
+				{"i-1", 90, false},
+				{"i-2", 95, false},
+				{"i-1", 95, true}, // 85, 90 and 95 in the last 5 events of i-1
+				{"i-1", 10, true},
+				{"i-1", 10, false}, // 85 left the window
+				{"i-1", 10, false},
+			} {
+				result, err := processor.EvaluateWithResult(context.Background(), usageEvent(tt.instanceID, tt.usage, start.Add(time.Duration(i)*time.Minute)))
+				if err != nil {
+					t.Fatalf("EvaluateWithResult() error = %v", err)
+				}
+				if result.Handled() != tt.want {
+					t.Errorf("event %d: Handled() = %v with window %+v, want %v", i, result.Handled(), result.Windows, tt.want)
+				}
+				if len(result.Windows) != 1 || result.Windows[0].Key != tt.instanceID || result.Windows[0].Values[0] != float64(tt.usage) {
+					t.Errorf("event %d: Windows = %+v, want the window of %s starting with %d", i, result.Windows, tt.instanceID, tt.usage)
+				}
+			}
+			if windowStore.Count() != 7 {
+				t.Errorf("window store holds %d samples, want 7, 5 of i-1 and 2 of i-2", windowStore.Count())
+			}
+		})
+	}
+}
+
+func TestGRuleProcessor_EvaluateDurationWindow(t *testing.T) {
+	models.GetEventRegistry().RegisterDynamicEventType("login_failure")
+	rule := models.Rule{
+		RuleId: "login_failures", EventType: "login_failure", Language: models.RULE_LANGUAGE_EXPR,
+		Condition:   "Window.Count > 3",
+		Action:      "Event.ShouldHandle = true",
+		Aggregation: &models.RuleAggregation{GroupBy: "user", Duration: "15m"},
+	}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	windowStore := NewMemoryWindowStore()
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithWindowStore(windowStore))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i, tt := range []struct {
+		minute int
+		want   bool
+	}{
+		{0, false},
+		{2, false},
+		{4, false},
+		{6, true},   // 4 failures in 15 minutes
+		{20, false}, // Only the failure at 6 is within 15 minutes
+		{21, false},
+		{21, true},
+	} {
+		event := models.BaseEvent[any]{
+			TenantID: "tenant1", Type: "login_failure", EventSHA: "alice",
+			Payload: json.RawMessage(`{"user": "alice"}`), OccuredAt: start.Add(time.Duration(tt.minute) * time.Minute),
+		}
+		handled, err := processor.Evaluate(context.Background(), event)
+		if err != nil || handled != tt.want {
+			t.Errorf("event %d at minute %d: Evaluate() = %v, %v, want %v", i, tt.minute, handled, err, tt.want)
+		}
+	}
+	if windowStore.Count() != 4 {
+		t.Errorf("window store holds %d samples, want the 4 of the last 15 minutes", windowStore.Count())
+	}
+}
+
+func TestGRuleProcessor_DryRunWindow(t *testing.T) {
+	rule := models.Rule{
+		RuleId: "usage_sustained", EventType: "instance_usage",
+		Condition:   "Window.Avg >= 80 && Window.Count == 3",
+		Action:      "Event.ShouldHandle = true",
+		Aggregation: &models.RuleAggregation{GroupBy: "instance_id", Field: "usage_percentage", Size: 3},
+	}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	windowStore := NewMemoryWindowStore()
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithWindowStore(windowStore))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i, usage := range []int{60, 90, 90} {
+		if _, err := processor.Evaluate(context.Background(), usageEvent("i-1", usage, start.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+	}
+
+	result, err := processor.DryRun(context.Background(), usageEvent("i-1", 80, start.Add(3*time.Minute)), true)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if !result.Handled() || len(result.Windows) != 1 || !reflect.DeepEqual(result.Windows[0].Values, []float64{80, 90, 90}) {
+		t.Errorf("DryRun() handled %v with windows %+v, want the window 80, 90, 90", result.Handled(), result.Windows)
+	}
+	if windowStore.Count() != 3 {
+		t.Errorf("window store holds %d samples after a dry run, want 3", windowStore.Count())
+	}
+
+	result, err = processor.DryRun(context.Background(), usageEvent("i-1", 80, start.Add(3*time.Minute)), false)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if result.Handled() || len(result.Windows) != 1 || result.Windows[0].Count != 1 {
+		t.Errorf("DryRun() without store handled %v with windows %+v, want a window of the event alone", result.Handled(), result.Windows)
+	}
+}
+
+func TestGRuleProcessor_WindowSkipsDuplicates(t *testing.T) {
+	rule := models.Rule{
+		RuleId: "usage_sustained", EventType: "instance_usage", Deduplication: true,
+		Condition:   "Window.CountAtLeast(80) >= 2",
+		Action:      "Event.ShouldHandle = true",
+		Aggregation: &models.RuleAggregation{GroupBy: "instance_id", Field: "usage_percentage", Size: 5},
+	}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	windowStore := NewMemoryWindowStore()
+	db := &transactionalDB{}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithWindowStore(windowStore), WithDBConnector(db.connect))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i, want := range []bool{false, true, false} {
+		result, err := processor.EvaluateWithResult(context.Background(), usageEvent("i-1", 90, start.Add(time.Duration(i)*time.Minute)))
+		if err != nil {
+			t.Fatalf("EvaluateWithResult() error = %v", err)
+		}
+		if result.Handled() != want {
+			t.Errorf("event %d: Handled() = %v, want %v", i, result.Handled(), want)
+		}
+	}
+	if windowStore.Count() != 2 {
+		t.Errorf("window store holds %d samples, want 2, the duplicate is not recorded", windowStore.Count())
+	}
+	// The window of each new event is updated in a transaction, the duplicate leaves it alone
+	if len(db.txs) != 2 {
+		t.Fatalf("updated the window in %d transactions, want 2", len(db.txs))
+	}
+	for i, tx := range db.txs {
+		if !tx.committed {
+			t.Errorf("transaction %d was not committed", i)
+		}
+	}
+}
+
+func TestGRuleProcessor_EvaluateAggregationStages(t *testing.T) {
+	// The window of each aggregation rule is its own, rules without aggregation run around them by priority
+	rules := []models.Rule{
+		{RuleId: "single", EventType: "instance_usage", Priority: 1, Condition: "Payload.Usage >= 0", Action: "Event.ShouldHandle = true"},
+		{RuleId: "last_two", EventType: "instance_usage", Priority: 3, Condition: "Window.Count == 2", Action: "Event.ShouldHandle = true",
+			Aggregation: &models.RuleAggregation{Size: 2}},
+		{RuleId: "last_three", EventType: "instance_usage", Priority: 2, Language: models.RULE_LANGUAGE_EXPR, Condition: "Window.Count == 3",
+			Action: "Event.ShouldHandle = true", Aggregation: &models.RuleAggregation{Size: 3}},
+	}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: rules}}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{DefaultMatchPolicy: MATCH_POLICY_ALL_MATCHING}, WithRuleRepository(repo), WithWindowStore(NewMemoryWindowStore()))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i, want := range [][]string{
+		{"single"},
+		{"last_two", "single"},
+		{"last_two", "last_three", "single"},
+	} {
+		result, err := processor.EvaluateWithResult(context.Background(), usageEvent("i-1", 50, start.Add(time.Duration(i)*time.Minute)))
+		if err != nil {
+			t.Fatalf("EvaluateWithResult() error = %v", err)
+		}
+		if !reflect.DeepEqual(result.HandledRuleIDs, want) {
+			t.Errorf("event %d: HandledRuleIDs = %v, want %v", i, result.HandledRuleIDs, want)
+		}
+	}
+}
+
+func TestValidateRule_Aggregation(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      models.Rule
+		wantField string
+		wantErr   string
+	}{
+		{
+			name:      "window without aggregation",
+			rule:      models.Rule{RuleId: "usage", EventType: "instance_usage", Condition: "Window.Count > 3", Action: "Event.ShouldHandle = true"},
+			wantField: RULE_FIELD_CONDITION,
+			wantErr:   "Window is only available to aggregation rules",
+		},
+		{
+			name: "invalid window",
+			rule: models.Rule{RuleId: "usage", EventType: "instance_usage", Condition: "Window.Count > 3", Action: "Event.ShouldHandle = true",
+				Aggregation: &models.RuleAggregation{GroupBy: "instance_id"}},
+			wantField: RULE_FIELD_AGGREGATION,
+			wantErr:   "size or duration is required",
+		},
+		{
+			name: "unknown group_by field",
+			rule: models.Rule{RuleId: "usage", EventType: "instance_usage", Condition: "Window.Count > 3", Action: "Event.ShouldHandle = true",
+				Aggregation: &models.RuleAggregation{GroupBy: "instance", Size: 5}},
+			wantField: RULE_FIELD_AGGREGATION,
+			wantErr:   "unknown group_by field 'instance'",
+		},
+		{
+			name: "field is not a number",
+			rule: models.Rule{RuleId: "usage", EventType: "instance_usage", Condition: "Window.Avg > 80", Action: "Event.ShouldHandle = true",
+				Aggregation: &models.RuleAggregation{Field: "instance_id", Size: 5}},
+			wantField: RULE_FIELD_AGGREGATION,
+			wantErr:   "field 'instance_id' of type string is not a number",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateRule(tt.rule)
+			if len(errs) != 1 || errs[0].Field != tt.wantField || !strings.Contains(errs[0].Message, tt.wantErr) {
+				t.Errorf("ValidateRule() = %v, want a %s error %q", errs, tt.wantField, tt.wantErr)
+			}
+		})
+	}
+}
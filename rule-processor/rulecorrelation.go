@@ -0,0 +1,393 @@
+package rule_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5/pgtype"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// errAggregatedCorrelation is returned for a rule with both an aggregation and a correlation.
+var errAggregatedCorrelation = errors.New("a rule cannot both aggregate and correlate events, remove the aggregation or the correlation")
+
+// ruleCorrelation is the compiled models.RuleCorrelation of a rule.
+type ruleCorrelation struct {
+	joinOn    string
+	within    time.Duration
+	length    int  // The number of events of the sequence
+	completes bool // The rule set is compiled for the event type of the rule, its events complete the sequence
+}
+
+// correlationStep identifies an event of the sequence of a correlation rule.
+type correlationStep struct {
+	ruleID string
+	index  int
+}
+
+/*
+compileRuleCorrelation checks the sequence of a correlation rule and parses
+its window. It returns nil for a rule without correlation.
+*/
+func compileRuleCorrelation(correlation *models.RuleCorrelation) (*ruleCorrelation, error) {
+	if correlation == nil {
+		return nil, nil
+	}
+	if correlation.Within == "" {
+		return nil, fmt.Errorf("within is required, e.g. 10m")
+	}
+	within, err := time.ParseDuration(correlation.Within)
+	if err != nil {
+		return nil, fmt.Errorf("invalid within '%s', expected e.g. 10m", correlation.Within)
+	}
+	if within <= 0 {
+		return nil, fmt.Errorf("within must be positive, got %s", correlation.Within)
+	}
+	if len(correlation.Sequence) == 0 {
+		return nil, fmt.Errorf("sequence requires at least one event")
+	}
+	for i, step := range correlation.Sequence {
+		if step.EventType == "" {
+			return nil, fmt.Errorf("sequence[%d]: event_type cannot be empty", i)
+		}
+	}
+	return &ruleCorrelation{joinOn: correlation.JoinOn, within: within, length: len(correlation.Sequence)}, nil
+}
+
+/*
+key returns the join key of the event, the value of its join_on field read
+like the fields of an aggregation. It is false when the payload does not
+have the field, the event then joins no sequence.
+*/
+func (c *ruleCorrelation) key(payload any) (string, bool) {
+	if c.joinOn == "" {
+		return "", true
+	}
+	value, ok := payloadFieldValue(payload, c.joinOn)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+/*
+correlationStepRule returns the rule matching an event of the sequence of a
+correlation rule, in the language and with the priority of the rule. Its
+action only marks the event as matched, it runs against a copy of the event.
+*/
+func correlationStepRule(rule models.Rule, index int) models.Rule {
+	step := rule.Correlation.Sequence[index]
+	condition := step.Condition
+	if strings.TrimSpace(condition) == "" {
+		condition = "true"
+	}
+	return models.Rule{
+		RuleId:    fmt.Sprintf("%s__sequence_%d", rule.RuleId, index),
+		EventType: step.EventType,
+		Language:  rule.Language,
+		Condition: condition,
+		Action:    "Event.ShouldHandle = true",
+		Priority:  rule.Priority,
+	}
+}
+
+// correlationStepField returns the name of a field of an event of the sequence in validation errors.
+func correlationStepField(index int, field string) string {
+	return fmt.Sprintf("%s.sequence[%d].%s", RULE_FIELD_CORRELATION, index, field)
+}
+
+/*
+correlationStepErrors checks the conditions of the sequence of a correlation
+rule with the Evaluator of its language, syntax errors are located in the
+condition of the event of the sequence.
+*/
+func correlationStepErrors(evaluator Evaluator, rule models.Rule) RuleValidationErrors {
+	if rule.Correlation == nil {
+		return nil
+	}
+	var errs RuleValidationErrors
+	for i := range rule.Correlation.Sequence {
+		for _, err := range evaluator.Validate(correlationStepRule(rule, i)) {
+			err.RuleID, err.Field = rule.RuleId, correlationStepField(i, RULE_FIELD_CONDITION)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+/*
+correlationFieldErrors reports the join_on field of a correlation rule that
+the payload types of its events do not have, and the Payload references of
+the conditions of its sequence that the payload types of their events do
+not have. Event types without a known payload type are not checked.
+*/
+func correlationFieldErrors(rule models.Rule, payloadTypeOf func(eventType string) (reflect.Type, bool)) RuleValidationErrors {
+	if rule.Correlation == nil {
+		return nil
+	}
+	var errs RuleValidationErrors
+	if joinOn := rule.Correlation.JoinOn; joinOn != "" {
+		checked := make(map[string]bool)
+		eventTypes := []string{rule.EventType}
+		for _, step := range rule.Correlation.Sequence {
+			eventTypes = append(eventTypes, step.EventType)
+		}
+		for _, eventType := range eventTypes {
+			payloadType, known := payloadTypeOf(eventType)
+			if checked[eventType] || !known || payloadType == reflect.TypeOf(models.DynamicPayload{}) {
+				continue
+			}
+			checked[eventType] = true
+			if _, ok := resolvePayloadField(payloadType, strings.Split(joinOn, ".")); !ok {
+				errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_CORRELATION,
+					Message: fmt.Sprintf("unknown join_on field '%s' for event type '%s'", joinOn, eventType)})
+			}
+		}
+	}
+	for i := range rule.Correlation.Sequence {
+		stepRule := correlationStepRule(rule, i)
+		payloadType, known := payloadTypeOf(stepRule.EventType)
+		if !known {
+			continue
+		}
+		for _, err := range payloadFieldErrors(stepRule, payloadType) {
+			err.RuleID, err.Field = rule.RuleId, correlationStepField(i, RULE_FIELD_CONDITION)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+/*
+matchSequence evaluates the conditions of the events of the sequences of the
+correlation rules against the event, and returns the events of the
+sequences it matches by rule ID. The conditions run against a copy of the
+event, they never handle it.
+*/
+func (s *compiledRuleSet) matchSequence(ctx context.Context, event models.BaseEvent[any], payload any) (map[string][]int, error) {
+	if len(s.steps) == 0 {
+		return nil, nil
+	}
+	event.ShouldHandle = false
+	gate := newRuleGate()
+	for stepRuleID := range s.sequenceSteps {
+		gate.activate(stepRuleID)
+	}
+	listener := newFiredRulesListener(&event, MATCH_POLICY_ALL_MATCHING, gate)
+	facts := newRuleFacts(&event, payload, gate, listener, nil)
+	for _, stage := range s.steps {
+		if err := stage.rules.Execute(ctx, facts); err != nil {
+			return nil, fmt.Errorf("%s sequence conditions: %w", stage.language, err)
+		}
+	}
+	listener.finish()
+
+	matched := make(map[string][]int)
+	for _, stepRuleID := range listener.fired {
+		step := s.sequenceSteps[stepRuleID]
+		matched[step.ruleID] = append(matched[step.ruleID], step.index)
+	}
+	return matched, nil
+}
+
+// completedSequence is the partial match of a join key claimed by an event completing the sequence of a correlation rule.
+type completedSequence struct {
+	key       string
+	step      int // The number of events of the sequence
+	startedAt time.Time
+}
+
+/*
+correlate advances the partial matches of the correlation rules of the rule
+set with the event, and keeps the correlation rules of the event type out of
+the evaluation unless the event completes their sequence.
+
+A partial match advances when the event matches the next event of its
+sequence, the first event of a sequence starts a partial match. Partial
+matches are kept in the CorrelationStore and expire once the within of
+their rule elapsed since they started. A dry run reads the partial matches
+when it checks duplicates but does not record the event, without a database
+no sequence completes.
+
+The partial matches of a join key are read and updated in one transaction
+holding its lock. An event completing a sequence claims the completed match
+in it, of concurrent events completing the same sequence only one may fire
+the rule.
+
+Parameters:
+  - ctx: context.Context - A context to manage cancellation and deadlines.
+  - database: store.DBTX - The connection to the state store, opened when mode.usesStore().
+  - event: models.BaseEvent[any] - The event being evaluated.
+  - payload: any - The payload of the event, as exposed to the rules.
+  - compiled: *compiledRuleSet - The compiled rules, with their correlations.
+  - occurredAt: time.Time - The time the event occurred.
+  - gate: *ruleGate - The rules allowed to fire, correlation rules are removed from it.
+  - mode: evaluationMode - Whether the evaluation is a dry run.
+  - result: *models.EvaluationResult - Receives the partial matches advanced or completed.
+
+Returns:
+  - map[string]completedSequence: The sequences claimed by the event, by rule ID.
+  - error: If a condition of a sequence or the CorrelationStore failed.
+*/
+func (re *GRuleProcessor) correlate(ctx context.Context, database store.DBTX, event models.BaseEvent[any], payload any,
+	compiled *compiledRuleSet, occurredAt time.Time, gate *ruleGate, mode evaluationMode, result *models.EvaluationResult) (map[string]completedSequence, error) {
+	if len(compiled.correlations) == 0 {
+		return nil, nil
+	}
+	matched, err := compiled.matchSequence(ctx, event, payload)
+	if err != nil {
+		return nil, err
+	}
+	occurredAt = occurredAt.UTC()
+	completed := make(map[string]completedSequence)
+	for _, ruleID := range compiled.correlationOrder {
+		correlation := compiled.correlations[ruleID]
+		steps := matched[ruleID]
+		completes := correlation.completes && gate.IsActive(ruleID)
+		if len(steps) == 0 && !completes {
+			gate.deactivate(ruleID)
+			continue
+		}
+		key, ok := correlation.key(payload)
+		if !ok {
+			gate.deactivate(ruleID)
+			continue
+		}
+
+		var sequence *completedSequence
+		var matches []models.CorrelationMatch
+		err := inTransaction(ctx, database, func(tx store.DBTX) (err error) {
+			sequence, matches, err = re.updateCorrelation(ctx, tx, event.TenantID, ruleID, correlation, key, steps, completes, occurredAt, mode)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", ruleID, err)
+		}
+		if sequence != nil {
+			completed[ruleID] = *sequence
+		} else {
+			gate.deactivate(ruleID)
+		}
+		result.Correlations = append(result.Correlations, matches...)
+	}
+	return completed, nil
+}
+
+/*
+updateCorrelation reads the partial matches of a join key, claims the
+completed match when the event completes the sequence and advances the
+partial matches waiting for the events of the sequence the event matched.
+It returns the claimed sequence, nil when the event does not complete it,
+and the partial matches advanced or completed.
+*/
+func (re *GRuleProcessor) updateCorrelation(ctx context.Context, tx store.DBTX, tenantID, ruleID string, correlation *ruleCorrelation,
+	key string, steps []int, completes bool, occurredAt time.Time, mode evaluationMode) (*completedSequence, []models.CorrelationMatch, error) {
+	since := pgtype.Timestamp{Time: occurredAt.Add(-correlation.within), Valid: true}
+	started := make(map[int]time.Time) // The start of the partial matches, by number of events matched
+	if mode.usesStore() {
+		if !mode.dryRun {
+			if err := re.correlationStore.LockCorrelation(ctx, tx, store.LockCorrelationParams{
+				TenantID: tenantID, RuleID: ruleID, JoinKey: key,
+			}); err != nil {
+				return nil, nil, err
+			}
+			if err := re.correlationStore.ExpireCorrelationMatches(ctx, tx, store.ExpireCorrelationMatchesParams{
+				TenantID: tenantID, RuleID: ruleID, JoinKey: key, StartedAt: since,
+			}); err != nil {
+				return nil, nil, err
+			}
+		}
+		matches, err := re.correlationStore.ListCorrelationMatches(ctx, tx, store.ListCorrelationMatchesParams{
+			TenantID: tenantID, RuleID: ruleID, JoinKey: key, StartedAt: since,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, match := range matches {
+			started[int(match.Step)] = match.StartedAt.Time
+		}
+	}
+
+	var sequence *completedSequence
+	var matches []models.CorrelationMatch
+	if startedAt, ok := started[correlation.length]; completes && ok {
+		claimed := int64(1)
+		if !mode.dryRun {
+			var err error
+			claimed, err = re.correlationStore.ClaimCorrelationMatch(ctx, tx, store.ClaimCorrelationMatchParams{
+				TenantID: tenantID, RuleID: ruleID, JoinKey: key, Step: int32(correlation.length), StartedAt: since,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if claimed > 0 {
+			sequence = &completedSequence{key: key, step: correlation.length, startedAt: startedAt}
+			matches = append(matches, models.CorrelationMatch{
+				RuleID: ruleID, Key: key, Step: correlation.length, StartedAt: startedAt, Completed: true,
+			})
+		}
+	}
+
+	// Partial matches advance from their state before the event, an event advances each of them once
+	for _, index := range steps {
+		startedAt, ok := occurredAt, index == 0
+		if !ok {
+			startedAt, ok = started[index]
+		}
+		if !ok {
+			continue // No partial match waits for this event of the sequence
+		}
+		matches = append(matches, models.CorrelationMatch{
+			RuleID: ruleID, Key: key, Step: index + 1, StartedAt: startedAt,
+		})
+		if mode.dryRun {
+			continue
+		}
+		if err := re.correlationStore.UpsertCorrelationMatch(ctx, tx, store.UpsertCorrelationMatchParams{
+			TenantID: tenantID, RuleID: ruleID, JoinKey: key, Step: int32(index + 1),
+			StartedAt: pgtype.Timestamp{Time: startedAt, Valid: true},
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return sequence, matches, nil
+}
+
+/*
+consumeCorrelations removes the partial matches of the completed sequences
+whose rule fired, so each sequence fires its rule once. The completed match
+claimed for a rule that did not fire is restored.
+*/
+func (re *GRuleProcessor) consumeCorrelations(ctx context.Context, database store.DBTX, event models.BaseEvent[any], completed map[string]completedSequence, result *models.EvaluationResult) error {
+	fired := make(map[string]bool, len(result.MatchedRuleIDs))
+	for _, ruleID := range result.MatchedRuleIDs {
+		fired[ruleID] = true
+	}
+	for ruleID, sequence := range completed {
+		err := inTransaction(ctx, database, func(tx store.DBTX) error {
+			if err := re.correlationStore.LockCorrelation(ctx, tx, store.LockCorrelationParams{
+				TenantID: event.TenantID, RuleID: ruleID, JoinKey: sequence.key,
+			}); err != nil {
+				return err
+			}
+			if fired[ruleID] {
+				return re.correlationStore.DeleteCorrelationMatches(ctx, tx, store.DeleteCorrelationMatchesParams{
+					TenantID: event.TenantID, RuleID: ruleID, JoinKey: sequence.key,
+				})
+			}
+			return re.correlationStore.UpsertCorrelationMatch(ctx, tx, store.UpsertCorrelationMatchParams{
+				TenantID: event.TenantID, RuleID: ruleID, JoinKey: sequence.key, Step: int32(sequence.step),
+				StartedAt: pgtype.Timestamp{Time: sequence.startedAt, Valid: true},
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", ruleID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+)
+
+type crashPayload struct {
+	InstanceID string `json:"instance_id"`
+	Service    string `json:"service"`
+}
+
+func init() {
+	models.GetEventRegistry().RegisterEventType("service_crash", func() models.Evaluable {
+		return &models.BaseEvent[crashPayload]{}
+	})
+}
+
+func crashEvent(instanceID string, occurredAt time.Time) models.BaseEvent[any] {
+	return models.BaseEvent[any]{
+		TenantID:  "tenant1",
+		Type:      "service_crash",
+		Payload:   &crashPayload{InstanceID: instanceID, Service: "api"},
+		EventSHA:  instanceID + occurredAt.String(),
+		OccuredAt: occurredAt,
+	}
+}
+
+// diskThenCrash fires on a service_crash following a usage over 90% on the same instance within 10 minutes.
+func diskThenCrash(language string) models.Rule {
+	return models.Rule{
+		RuleId: "disk_then_crash", EventType: "service_crash", Language: language,
+		Condition: "Payload.Service == \"api\"",
+		Action:    "Event.ShouldHandle = true",
+		Correlation: &models.RuleCorrelation{JoinOn: "instance_id", Within: "10m", Sequence: []models.CorrelationStep{
+			{EventType: "instance_usage", Condition: "Payload.Usage > 90"},
+		}},
+	}
+}
+
+func TestCompileRuleCorrelation(t *testing.T) {
+	step := []models.CorrelationStep{{EventType: "instance_usage"}}
+	tests := []struct {
+		name        string
+		correlation models.RuleCorrelation
+		wantErr     string
+	}{
+		{"sequence", models.RuleCorrelation{JoinOn: "instance_id", Within: "10m", Sequence: step}, ""},
+		{"no within", models.RuleCorrelation{Sequence: step}, "within is required"},
+		{"invalid within", models.RuleCorrelation{Within: "10 minutes", Sequence: step}, "invalid within '10 minutes'"},
+		{"negative within", models.RuleCorrelation{Within: "-10m", Sequence: step}, "within must be positive"},
+		{"no sequence", models.RuleCorrelation{Within: "10m"}, "sequence requires at least one event"},
+		{"no event type", models.RuleCorrelation{Within: "10m", Sequence: []models.CorrelationStep{{Condition: "true"}}}, "sequence[0]: event_type cannot be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileRuleCorrelation(&tt.correlation)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("compileRuleCorrelation() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileRuleCorrelation() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGRuleProcessor_EvaluateSequence(t *testing.T) {
+	for _, language := range []string{models.RULE_LANGUAGE_GRL, models.RULE_LANGUAGE_EXPR} {
+		t.Run(language, func(t *testing.T) {
+			rule := diskThenCrash(language)
+			if errs := ValidateRule(rule); len(errs) > 0 {
+				t.Fatalf("ValidateRule() = %v", errs)
+			}
+			repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+			correlationStore := NewMemoryCorrelationStore()
+			processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithCorrelationStore(correlationStore))
+
+			start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+			at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+			for i, tt := range []struct {
+				event models.BaseEvent[any]
+				want  bool
+			}{
+				{crashEvent("i-1", at(0)), false}, // No usage before
+				{usageEvent("i-1", 50, at(1)), false},
+				{crashEvent("i-1", at(2)), false}, // The usage was not over 90%
+				{usageEvent("i-1", 95, at(3)), false},
+				{crashEvent("i-2", at(4)), false}, // Another instance
+				{crashEvent("i-1", at(5)), true},
+				{crashEvent("i-1", at(6)), false}, // The sequence fired once
+				{usageEvent("i-1", 95, at(10)), false},
+				{crashEvent("i-1", at(21)), false}, // The partial match expired
+			} {
+				result, err := processor.EvaluateWithResult(context.Background(), tt.event)
+				if err != nil {
+					t.Fatalf("EvaluateWithResult() error = %v", err)
+				}
+				if result.Handled() != tt.want {
+					t.Errorf("event %d: Handled() = %v with correlations %+v, want %v", i, result.Handled(), result.Correlations, tt.want)
+				}
+			}
+			if correlationStore.Count() != 0 {
+				t.Errorf("correlation store holds %d partial matches, want the expired one removed", correlationStore.Count())
+			}
+		})
+	}
+}
+
+// barrierCorrelationStore holds the events that read the partial matches of a completed sequence until all of them did.
+type barrierCorrelationStore struct {
+	*MemoryCorrelationStore
+	waiting sync.WaitGroup
+}
+
+func (s *barrierCorrelationStore) ListCorrelationMatches(ctx context.Context, db store.DBTX, arg store.ListCorrelationMatchesParams) ([]*store.CorrelationMatch, error) {
+	matches, err := s.MemoryCorrelationStore.ListCorrelationMatches(ctx, db, arg)
+	if len(matches) > 0 {
+		s.waiting.Done()
+		s.waiting.Wait()
+	}
+	return matches, err
+}
+
+func TestGRuleProcessor_SequenceFiresOnceConcurrently(t *testing.T) {
+	const crashes = 20
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {diskThenCrash(models.RULE_LANGUAGE_GRL)}}}
+	correlationStore := &barrierCorrelationStore{MemoryCorrelationStore: NewMemoryCorrelationStore()}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithCorrelationStore(correlationStore))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	if _, err := processor.EvaluateWithResult(context.Background(), usageEvent("i-1", 95, start)); err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+
+	// Every crash reads the completed sequence before any of them consumes it, a single one claims it
+	correlationStore.waiting.Add(crashes)
+	var wg sync.WaitGroup
+	var handled atomic.Int32
+	for i := 1; i <= crashes; i++ {
+		wg.Add(1)
+		go func(event models.BaseEvent[any]) {
+			defer wg.Done()
+			result, err := processor.EvaluateWithResult(context.Background(), event)
+			if err != nil {
+				t.Errorf("EvaluateWithResult() error = %v", err)
+				return
+			}
+			if result.Handled() {
+				handled.Add(1)
+			}
+		}(crashEvent("i-1", start.Add(time.Duration(i)*time.Second)))
+	}
+	wg.Wait()
+	if got := handled.Load(); got != 1 {
+		t.Errorf("the sequence fired %d times, want 1", got)
+	}
+	if correlationStore.Count() != 0 {
+		t.Errorf("correlation store holds %d partial matches, want the fired sequence consumed", correlationStore.Count())
+	}
+}
+
+func TestGRuleProcessor_SequenceRestoredWhenRuleDoesNotFire(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {diskThenCrash(models.RULE_LANGUAGE_GRL)}}}
+	db := &transactionalDB{}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithDBConnector(db.connect))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	workerCrash := crashEvent("i-1", start.Add(time.Minute))
+	workerCrash.Payload = &crashPayload{InstanceID: "i-1", Service: "worker"}
+	for i, tt := range []struct {
+		event models.BaseEvent[any]
+		want  bool
+	}{
+		{usageEvent("i-1", 95, start), false},
+		{workerCrash, false}, // Completes the sequence but the condition does not hold, the match is kept
+		{crashEvent("i-1", start.Add(2*time.Minute)), true},
+	} {
+		result, err := processor.EvaluateWithResult(context.Background(), tt.event)
+		if err != nil {
+			t.Fatalf("EvaluateWithResult() error = %v", err)
+		}
+		if result.Handled() != tt.want {
+			t.Errorf("event %d: Handled() = %v with correlations %+v, want %v", i, result.Handled(), result.Correlations, tt.want)
+		}
+	}
+	// The partial matches are updated, and the completed ones released, in committed transactions
+	if len(db.txs) != 5 {
+		t.Fatalf("updated the partial matches in %d transactions, want 5", len(db.txs))
+	}
+	for i, tx := range db.txs {
+		if !tx.committed {
+			t.Errorf("transaction %d was not committed", i)
+		}
+	}
+}
+
+func TestGRuleProcessor_EvaluateSequenceOrder(t *testing.T) {
+	for _, eventType := range []string{"host_step_a", "host_step_b", "host_step_c"} {
+		models.GetEventRegistry().RegisterDynamicEventType(eventType)
+	}
+	rule := models.Rule{
+		RuleId: "a_b_c", EventType: "host_step_c", Language: models.RULE_LANGUAGE_EXPR,
+		Condition: "true", Action: "Event.ShouldHandle = true",
+		Correlation: &models.RuleCorrelation{JoinOn: "host", Within: "1h", Sequence: []models.CorrelationStep{
+			{EventType: "host_step_a"},
+			{EventType: "host_step_b"},
+		}},
+	}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i, tt := range []struct {
+		eventType string
+		payload   string
+		want      bool
+		wantSteps []int
+	}{
+		{"host_step_b", `{"host": "h1"}`, false, nil}, // b before a does not match
+		{"host_step_c", `{"host": "h1"}`, false, nil},
+		{"host_step_a", `{"host": "h1"}`, false, []int{1}},
+		{"host_step_a", `{}`, false, nil}, // No join key
+		{"host_step_c", `{"host": "h1"}`, false, nil},
+		{"host_step_b", `{"host": "h1"}`, false, []int{2}},
+		{"host_step_c", `{"host": "h1"}`, true, []int{2}},
+	} {
+		event := models.BaseEvent[any]{
+			TenantID: "tenant1", Type: tt.eventType, EventSHA: "h1",
+			Payload: json.RawMessage(tt.payload), OccuredAt: start.Add(time.Duration(i) * time.Minute),
+		}
+		result, err := processor.EvaluateWithResult(context.Background(), event)
+		if err != nil {
+			t.Fatalf("EvaluateWithResult() error = %v", err)
+		}
+		var steps []int
+		for _, match := range result.Correlations {
+			steps = append(steps, match.Step)
+			if match.Completed != tt.want || !match.StartedAt.Equal(start.Add(2*time.Minute)) {
+				t.Errorf("event %d: correlation %+v, want started at the first host_step_a", i, match)
+			}
+		}
+		if result.Handled() != tt.want || !reflect.DeepEqual(steps, tt.wantSteps) {
+			t.Errorf("event %d (%s): Handled() = %v with steps %v, want %v with steps %v", i, tt.eventType, result.Handled(), steps, tt.want, tt.wantSteps)
+		}
+	}
+}
+
+func TestGRuleProcessor_DryRunSequence(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {diskThenCrash(models.RULE_LANGUAGE_GRL)}}}
+	correlationStore := NewMemoryCorrelationStore()
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithCorrelationStore(correlationStore))
+
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	result, err := processor.DryRun(context.Background(), usageEvent("i-1", 95, start), true)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if len(result.Correlations) != 1 || correlationStore.Count() != 0 {
+		t.Errorf("DryRun() correlations %+v with %d stored partial matches, want one partial match not stored", result.Correlations, correlationStore.Count())
+	}
+
+	if _, err := processor.Evaluate(context.Background(), usageEvent("i-1", 95, start)); err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	for _, checkDuplicates := range []bool{true, true, false} {
+		result, err = processor.DryRun(context.Background(), crashEvent("i-1", start.Add(time.Minute)), checkDuplicates)
+		if err != nil {
+			t.Fatalf("DryRun() error = %v", err)
+		}
+		if result.Handled() != checkDuplicates {
+			t.Errorf("DryRun(%v) handled = %v, want %v", checkDuplicates, result.Handled(), checkDuplicates)
+		}
+	}
+	if correlationStore.Count() != 1 {
+		t.Errorf("correlation store holds %d partial matches after dry runs, want 1", correlationStore.Count())
+	}
+}
+
+func TestValidateRule_Correlation(t *testing.T) {
+	invalid := func(change func(rule *models.Rule)) models.Rule {
+		rule := diskThenCrash(models.RULE_LANGUAGE_GRL)
+		rule.Correlation = &models.RuleCorrelation{JoinOn: "instance_id", Within: "10m", Sequence: []models.CorrelationStep{
+			{EventType: "instance_usage", Condition: "Payload.Usage > 90"},
+		}}
+		change(&rule)
+		return rule
+	}
+	tests := []struct {
+		name      string
+		rule      models.Rule
+		wantField string
+		wantErr   string
+	}{
+		{
+			name:      "invalid within",
+			rule:      invalid(func(rule *models.Rule) { rule.Correlation.Within = "soon" }),
+			wantField: RULE_FIELD_CORRELATION,
+			wantErr:   "invalid within 'soon'",
+		},
+		{
+			name:      "aggregation",
+			rule:      invalid(func(rule *models.Rule) { rule.Aggregation = &models.RuleAggregation{Size: 5} }),
+			wantField: RULE_FIELD_CORRELATION,
+			wantErr:   "cannot both aggregate and correlate",
+		},
+		{
+			name:      "window in the sequence",
+			rule:      invalid(func(rule *models.Rule) { rule.Correlation.Sequence[0].Condition = "Window.Count > 3" }),
+			wantField: "correlation.sequence[0].condition",
+			wantErr:   "Window is only available to aggregation rules",
+		},
+		{
+			name:      "syntax error in the sequence",
+			rule:      invalid(func(rule *models.Rule) { rule.Correlation.Sequence[0].Condition = "Payload.Usage >" }),
+			wantField: "correlation.sequence[0].condition",
+		},
+		{
+			name:      "unknown payload field in the sequence",
+			rule:      invalid(func(rule *models.Rule) { rule.Correlation.Sequence[0].Condition = "Payload.Service == \"api\"" }),
+			wantField: "correlation.sequence[0].condition",
+			wantErr:   "unknown payload field 'Payload.Service' for event type 'instance_usage'",
+		},
+		{
+			name:      "unknown join_on field",
+			rule:      invalid(func(rule *models.Rule) { rule.Correlation.JoinOn = "service" }),
+			wantField: RULE_FIELD_CORRELATION,
+			wantErr:   "unknown join_on field 'service' for event type 'instance_usage'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateRule(tt.rule)
+			if len(errs) != 1 || errs[0].Field != tt.wantField || !strings.Contains(errs[0].Message, tt.wantErr) {
+				t.Errorf("ValidateRule() = %v, want a %s error %q", errs, tt.wantField, tt.wantErr)
+			}
+		})
+	}
+}
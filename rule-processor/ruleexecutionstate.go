@@ -0,0 +1,162 @@
+package rule_processor
+
+import (
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"time"
+)
+
+const (
+	// RULES_FACT_NAME is the name under which the ruleGate is added to the grule DataContext.
+	RULES_FACT_NAME = "Rules"
+)
+
+/*
+ruleGate decides which rules of a compiled rule set may fire for the event
+being evaluated.
+
+Every rule's GRL condition is guarded by Rules.IsActive("<rule_id>"), so a
+rule that was skipped before execution, e.g. because the event is a
+duplicate for it, is never a candidate in the shared KnowledgeBase.
+*/
+type ruleGate struct {
+	active  map[string]bool
+	stopped bool
+}
+
+// newRuleGate creates a ruleGate with no active rules.
+func newRuleGate() *ruleGate {
+	return &ruleGate{active: make(map[string]bool)}
+}
+
+// activate marks a rule as allowed to fire.
+func (g *ruleGate) activate(ruleID string) {
+	g.active[ruleID] = true
+}
+
+// deactivate keeps a rule from firing, e.g. a correlation rule whose sequence the event does not complete.
+func (g *ruleGate) deactivate(ruleID string) {
+	delete(g.active, ruleID)
+}
+
+// stop keeps every rule from firing, the rules that fired so far are the last of the evaluation.
+func (g *ruleGate) stop() {
+	g.stopped = true
+}
+
+// hasActive reports whether at least one rule is allowed to fire.
+func (g *ruleGate) hasActive() bool {
+	return len(g.active) > 0
+}
+
+// IsActive is called from the GRL conditions and reports whether the rule may fire.
+func (g *ruleGate) IsActive(ruleID string) bool {
+	return !g.stopped && g.active[ruleID]
+}
+
+/*
+firedRulesListener records the rules fired by the evaluators in firing
+order, how long each of them took and the rules whose action set
+Event.ShouldHandle.
+
+Evaluators report the rules through RuleFacts: a rule is started before its
+action runs and its effect is observed once the action completed, or at the
+latest when the next rule starts or execution finishes.
+
+With the first-match policy the listener stops the ruleGate once a rule set
+Event.ShouldHandle, no rule fires after the handling rule. With the
+all-matching policy it resets Event.ShouldHandle after every rule that set
+it instead, so the following rules are evaluated against the event as it
+arrived and every rule whose condition holds handles it.
+*/
+type firedRulesListener struct {
+	event            *models.BaseEvent[any]
+	gate             *ruleGate
+	initial          bool
+	resetAfterHandle bool
+	fired            []string
+	kinds            map[string]string
+	handled          []string
+	durations        map[string]time.Duration
+	running          string
+	runningFrom      time.Time
+	runningHandled   bool
+}
+
+// newFiredRulesListener creates a listener observing the given event under the match policy, gate holds the rules allowed to fire.
+func newFiredRulesListener(event *models.BaseEvent[any], policy MatchPolicy, gate *ruleGate) *firedRulesListener {
+	return &firedRulesListener{
+		event:            event,
+		gate:             gate,
+		initial:          event.ShouldHandle,
+		resetAfterHandle: policy == MATCH_POLICY_ALL_MATCHING,
+		kinds:            make(map[string]string),
+		durations:        make(map[string]time.Duration),
+	}
+}
+
+// start records the rule whose action is about to run, kind is the kind of the action, the language of the rule.
+func (l *firedRulesListener) start(ruleID, kind string) {
+	l.observe()
+	l.fired = append(l.fired, ruleID)
+	l.kinds[ruleID] = kind
+	l.running = ruleID
+	l.runningFrom = time.Now()
+	l.runningHandled = l.event.ShouldHandle
+}
+
+// finish must be called once the engine returns to complete the bookkeeping of the last rule.
+func (l *firedRulesListener) finish() {
+	l.observe()
+	if l.resetAfterHandle && len(l.handled) > 0 {
+		l.event.ShouldHandle = true
+	}
+}
+
+// observe stops the timer of the last executed rule and records whether it set Event.ShouldHandle.
+func (l *firedRulesListener) observe() {
+	if l.running == "" {
+		return
+	}
+	l.durations[l.running] += time.Since(l.runningFrom)
+	if !l.runningHandled && l.event.ShouldHandle {
+		l.handled = append(l.handled, l.running)
+		if l.resetAfterHandle {
+			l.event.ShouldHandle = l.initial
+		} else {
+			l.gate.stop() // First match, the handling rule is the last to fire
+		}
+	}
+	l.running = ""
+}
+
+// handledBy returns the ID of the first rule that set Event.ShouldHandle, or an empty string.
+func (l *firedRulesListener) handledBy() string {
+	l.observe()
+	if len(l.handled) == 0 {
+		return ""
+	}
+	return l.handled[0]
+}
+
+// applyTo copies the fired and handling rules, their inline actions and timings into the result.
+func (l *firedRulesListener) applyTo(result *models.EvaluationResult) {
+	result.MatchedRuleIDs = append(result.MatchedRuleIDs, l.fired...)
+	result.HandledByRuleID = l.handledBy()
+	result.HandledRuleIDs = append(result.HandledRuleIDs, l.handled...)
+	for _, ruleID := range l.fired {
+		result.ActionsExecuted = append(result.ActionsExecuted, models.ActionResult{
+			RuleID: ruleID,
+			Kind:   l.kinds[ruleID],
+		})
+		result.RuleTiming(ruleID).Execution = l.durations[ruleID]
+	}
+}
+
+// ruleDedupSHA returns the SHA used to deduplicate the event for the given rule.
+func ruleDedupSHA(rule models.Rule, eventSHA string) string {
+	if rule.IncludeRuleIdInDedupKey {
+		return fmt.Sprintf("%s:%s", rule.RuleId, eventSHA)
+	}
+	return eventSHA
+}
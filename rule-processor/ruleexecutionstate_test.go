@@ -0,0 +1,189 @@
+package rule_processor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+func layeredDiskRules() []models.Rule {
+	return []models.Rule{
+		{
+			RuleId:    "disk_warning",
+			EventType: "disk_space",
+			Condition: "Payload.Usage >= 80 && Event.ShouldHandle == false",
+			Action:    "Event.ShouldHandle = true",
+			Priority:  1,
+		},
+		{
+			RuleId:    "disk_critical",
+			EventType: "disk_space",
+			Condition: "Payload.Usage >= 95 && Event.ShouldHandle == false",
+			Action:    "Event.ShouldHandle = true",
+			Priority:  10,
+		},
+		{
+			RuleId:    "disk_audit",
+			EventType: "disk_space",
+			Condition: "Payload.Usage >= 50",
+			Action:    "Payload.Usage = Payload.Usage",
+		},
+	}
+}
+
+func TestRuleExecution_PriorityDecidesHandlingRule(t *testing.T) {
+	tests := []struct {
+		name          string
+		usage         int
+		active        []string
+		wantHandledBy string
+		wantFired     []string
+	}{
+		{
+			name:          "critical beats warning",
+			usage:         97,
+			active:        []string{"disk_warning", "disk_critical", "disk_audit"},
+			wantHandledBy: "disk_critical",
+			wantFired:     []string{"disk_critical"}, // No rule fires after the handling rule
+		},
+		{
+			name:          "warning only",
+			usage:         85,
+			active:        []string{"disk_warning", "disk_critical", "disk_audit"},
+			wantHandledBy: "disk_warning",
+			wantFired:     []string{"disk_warning"},
+		},
+		{
+			name:          "inactive critical falls back to warning",
+			usage:         97,
+			active:        []string{"disk_warning", "disk_audit"},
+			wantHandledBy: "disk_warning",
+			wantFired:     []string{"disk_warning"},
+		},
+		{
+			name:          "nothing handles",
+			usage:         60,
+			active:        []string{"disk_warning", "disk_critical", "disk_audit"},
+			wantHandledBy: "",
+			wantFired:     []string{"disk_audit"},
+		},
+	}
+
+	cache := newKnowledgeBaseCache()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := cache.get("tenant1", "disk_space", 0, layeredDiskRules())
+			if err != nil {
+				t.Fatalf("get() error = %v", err)
+			}
+			event := models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"}
+			listener, err := executeCompiled(compiled, &event, &testUsagePayload{Usage: tt.usage}, MATCH_POLICY_FIRST_MATCH, tt.active...)
+			if err != nil {
+				t.Fatalf("execute error = %v", err)
+			}
+			if got := listener.handledBy(); got != tt.wantHandledBy {
+				t.Errorf("handledBy() = %q, want %q", got, tt.wantHandledBy)
+			}
+			if !reflect.DeepEqual(listener.fired, tt.wantFired) {
+				t.Errorf("fired = %v, want %v", listener.fired, tt.wantFired)
+			}
+		})
+	}
+}
+
+func TestRuleDedupSHA(t *testing.T) {
+	rule := models.Rule{RuleId: "disk_80"}
+	if got := ruleDedupSHA(rule, "abc"); got != "abc" {
+		t.Errorf("ruleDedupSHA() = %q, want %q", got, "abc")
+	}
+	rule.IncludeRuleIdInDedupKey = true
+	if got := ruleDedupSHA(rule, "abc"); got != "disk_80:abc" {
+		t.Errorf("ruleDedupSHA() = %q, want %q", got, "disk_80:abc")
+	}
+}
+
+func TestFiredRulesListener_ApplyTo(t *testing.T) {
+	cache := newKnowledgeBaseCache()
+	compiled, err := cache.get("tenant1", "disk_space", 0, layeredDiskRules())
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	event := models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"}
+	listener, err := executeCompiled(compiled, &event, &testUsagePayload{Usage: 97}, MATCH_POLICY_ALL_MATCHING, "disk_critical", "disk_audit")
+	if err != nil {
+		t.Fatalf("execute error = %v", err)
+	}
+
+	result := models.NewEvaluationResult(event)
+	listener.applyTo(result)
+
+	if !reflect.DeepEqual(result.MatchedRuleIDs, []string{"disk_critical", "disk_audit"}) {
+		t.Errorf("MatchedRuleIDs = %v", result.MatchedRuleIDs)
+	}
+	if result.HandledByRuleID != "disk_critical" {
+		t.Errorf("HandledByRuleID = %q, want disk_critical", result.HandledByRuleID)
+	}
+	if len(result.ActionsExecuted) != 2 || result.ActionsExecuted[0].Kind != models.ACTION_KIND_GRL {
+		t.Errorf("ActionsExecuted = %+v", result.ActionsExecuted)
+	}
+	if len(result.RuleTimings) != 2 || result.RuleTimings[0].RuleID != "disk_critical" {
+		t.Errorf("RuleTimings = %+v", result.RuleTimings)
+	}
+}
+
+func TestRuleExecution_MatchPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      MatchPolicy
+		usage       int
+		wantHandled []string
+	}{
+		{
+			name:        "first-match handles once",
+			policy:      MATCH_POLICY_FIRST_MATCH,
+			usage:       97,
+			wantHandled: []string{"disk_critical"},
+		},
+		{
+			name:        "all-matching handles with every matching rule",
+			policy:      MATCH_POLICY_ALL_MATCHING,
+			usage:       97,
+			wantHandled: []string{"disk_critical", "disk_warning"},
+		},
+		{
+			name:        "all-matching with a single matching rule",
+			policy:      MATCH_POLICY_ALL_MATCHING,
+			usage:       85,
+			wantHandled: []string{"disk_warning"},
+		},
+		{
+			name:        "all-matching without matching rules",
+			policy:      MATCH_POLICY_ALL_MATCHING,
+			usage:       10,
+			wantHandled: nil,
+		},
+	}
+
+	cache := newKnowledgeBaseCache()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := cache.get("tenant1", "disk_space", 0, layeredDiskRules())
+			if err != nil {
+				t.Fatalf("get() error = %v", err)
+			}
+			event := models.BaseEvent[any]{TenantID: "tenant1", Type: "disk_space"}
+			listener, err := executeCompiled(compiled, &event, &testUsagePayload{Usage: tt.usage}, tt.policy,
+				"disk_warning", "disk_critical", "disk_audit")
+			if err != nil {
+				t.Fatalf("execute error = %v", err)
+			}
+			if !reflect.DeepEqual(listener.handled, tt.wantHandled) {
+				t.Errorf("handled = %v, want %v", listener.handled, tt.wantHandled)
+			}
+			if event.ShouldHandle != (len(tt.wantHandled) > 0) {
+				t.Errorf("ShouldHandle = %v, want %v", event.ShouldHandle, len(tt.wantHandled) > 0)
+			}
+		})
+	}
+}
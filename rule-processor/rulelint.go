@@ -0,0 +1,157 @@
+package rule_processor
+
+import (
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// grlStringFunctions are the functions GRL can call on a string.
+var grlStringFunctions = map[string]bool{
+	"Compare": true, "Contains": true, "Count": true, "HasPrefix": true, "HasSuffix": true, "Index": true,
+	"LastIndex": true, "Len": true, "MatchString": true, "Repeat": true, "Replace": true, "Split": true,
+	"ToLower": true, "ToUpper": true, "Trim": true,
+}
+
+// payloadReference matches the Payload fields and methods referenced in a condition or action.
+var payloadReference = regexp.MustCompile(`\bPayload((?:\s*\.\s*[A-Za-z_][A-Za-z0-9_]*)+)(\s*\()?`)
+
+/*
+LintRules reports the problems of rules that compile but cannot work as
+intended:
+
+  - a rule_id used more than once by a tenant,
+  - an event_type without a known payload type,
+  - a payload_fields entry, a Payload field referenced in the condition or
+    action, or a group_by or field of an aggregation that the payload type of
+    the event does not have,
+  - an event of the sequence of a correlation without a known payload type,
+    or a join_on field or a Payload field referenced in the condition of an
+    event of the sequence that the payload type of the event does not have.
+
+Disabled rules are only checked for duplicates.
+
+Parameters:
+  - tenantRules: map[string][]models.Rule - The rules of every tenant, as read from a rule file.
+  - payloadTypes: map[string]reflect.Type - The payload struct of every known event type.
+
+Returns:
+  - RuleValidationErrors: Every problem found, ordered by tenant, nil if there is none.
+*/
+func LintRules(tenantRules map[string][]models.Rule, payloadTypes map[string]reflect.Type) RuleValidationErrors {
+	tenantIDs := make([]string, 0, len(tenantRules))
+	for tenantID := range tenantRules {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+
+	var errs RuleValidationErrors
+	for _, tenantID := range tenantIDs {
+		seen := make(map[string]bool)
+		for _, rule := range tenantRules[tenantID] {
+			if seen[rule.RuleId] {
+				errs = append(errs, RuleValidationError{TenantID: tenantID, RuleID: rule.RuleId, Field: RULE_FIELD_RULE_ID, Message: "duplicate rule_id"})
+			}
+			seen[rule.RuleId] = true
+			if rule.Disabled {
+				continue
+			}
+			errs = append(errs, lintPayloadFields(rule, payloadTypes).withTenant(tenantID)...)
+		}
+	}
+	return errs
+}
+
+// lintPayloadFields checks the event types of a rule and the payload fields it uses.
+func lintPayloadFields(rule models.Rule, payloadTypes map[string]reflect.Type) RuleValidationErrors {
+	var errs RuleValidationErrors
+	if payloadType, known := payloadTypes[rule.EventType]; known {
+		errs = payloadFieldErrors(rule, payloadType)
+	} else {
+		errs = RuleValidationErrors{{RuleID: rule.RuleId, Field: RULE_FIELD_EVENT_TYPE, Message: fmt.Sprintf("unknown event type '%s'", rule.EventType)}}
+	}
+	if rule.Correlation == nil {
+		return errs
+	}
+	for i, step := range rule.Correlation.Sequence {
+		if _, known := payloadTypes[step.EventType]; !known {
+			errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: correlationStepField(i, RULE_FIELD_EVENT_TYPE),
+				Message: fmt.Sprintf("unknown event type '%s'", step.EventType)})
+		}
+	}
+	return append(errs, correlationFieldErrors(rule, func(eventType string) (reflect.Type, bool) {
+		payloadType, known := payloadTypes[eventType]
+		return payloadType, known
+	})...)
+}
+
+/*
+payloadFieldErrors reports the payload_fields and Payload references of a rule
+that the payload type does not have.
+
+A models.DynamicPayload has any payload_fields, its Payload references must
+be calls to its accessors such as Payload.GetInt("usage"). The condition tree
+of a rule is checked by compiling it against the payload type, the fields of
+its aggregation by aggregationFieldErrors.
+*/
+func payloadFieldErrors(rule models.Rule, payloadType reflect.Type) RuleValidationErrors {
+	rule, errs := expandConditionTree(rule, payloadType)
+	if len(errs) > 0 {
+		return errs
+	}
+	errs = aggregationFieldErrors(rule, payloadType)
+	dynamic := payloadType == reflect.TypeOf(models.DynamicPayload{})
+	for _, field := range rule.PayloadFields {
+		if !dynamic && !hasPayloadPath(payloadType, []string{field}, false) {
+			errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_PAYLOAD_FIELDS,
+				Message: fmt.Sprintf("unknown payload field '%s' for event type '%s'", field, rule.EventType)})
+		}
+	}
+	for _, field := range []struct{ name, expression string }{
+		{RULE_FIELD_CONDITION, rule.Condition},
+		{RULE_FIELD_ACTION, rule.Action},
+	} {
+		for _, match := range payloadReference.FindAllStringSubmatch(field.expression, -1) {
+			path := strings.FieldsFunc(match[1], func(r rune) bool { return r == '.' || r == ' ' || r == '\t' || r == '\n' })
+			if hasPayloadPath(payloadType, path, match[2] != "") {
+				continue
+			}
+			message := fmt.Sprintf("unknown payload field 'Payload.%s' for event type '%s'", strings.Join(path, "."), rule.EventType)
+			if dynamic {
+				message = fmt.Sprintf("'Payload.%s' is not an accessor of the dynamic payload of event type '%s', read fields with e.g. Payload.GetInt(\"key\")",
+					strings.Join(path, "."), rule.EventType)
+			}
+			errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: field.name, Message: message})
+		}
+	}
+	return errs
+}
+
+// hasPayloadPath reports whether the payload type has the nested field path, whose last element is a method or string function when isCall is set.
+func hasPayloadPath(payloadType reflect.Type, path []string, isCall bool) bool {
+	current := payloadType
+	for i, name := range path {
+		if isCall && i == len(path)-1 {
+			if grlStringFunctions[name] && current.Kind() == reflect.String {
+				return true
+			}
+			_, ok := reflect.PointerTo(current).MethodByName(name)
+			return ok
+		}
+		for current.Kind() == reflect.Pointer {
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return false
+		}
+		field, ok := current.FieldByName(name)
+		if !ok {
+			return false
+		}
+		current = field.Type
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package rule_processor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type lintHost struct {
+	Name string
+}
+
+type lintPayload struct {
+	Usage int
+	Host  *lintHost
+}
+
+func (p *lintPayload) IsCritical() bool {
+	return p.Usage > 90
+}
+
+func TestLintRules(t *testing.T) {
+	payloadTypes := map[string]reflect.Type{
+		"disk_space": reflect.TypeOf(lintPayload{}),
+		"dynamic":    reflect.TypeOf(models.DynamicPayload{}),
+	}
+	valid := diskRule("disk_80", "80")
+	valid.Condition = "Payload.Usage >= 80 && Payload.Host.Name == \"db\" && Payload.IsCritical()"
+	valid.PayloadFields = []string{"Usage", "Host"}
+
+	tests := []struct {
+		name       string
+		rules      []models.Rule
+		wantFields []string
+	}{
+		{name: "valid", rules: []models.Rule{valid}},
+		{name: "disabled override", rules: []models.Rule{{RuleId: "cpu_90", Disabled: true}}},
+		{name: "duplicate rule_id", rules: []models.Rule{valid, valid}, wantFields: []string{RULE_FIELD_RULE_ID}},
+		{
+			name:       "unknown event type",
+			rules:      []models.Rule{{RuleId: "cpu_90", EventType: "cpu", Condition: "Payload.Load > 1", Action: "Event.ShouldHandle = true"}},
+			wantFields: []string{RULE_FIELD_EVENT_TYPE},
+		},
+		{
+			name: "unknown payload fields",
+			rules: []models.Rule{{
+				RuleId: "disk_90", EventType: "disk_space", PayloadFields: []string{"Size"},
+				Condition: "Payload.Host.Zone == \"eu\" && Payload.IsFull()", Action: "Payload.Usage = 0",
+			}},
+			wantFields: []string{RULE_FIELD_PAYLOAD_FIELDS, RULE_FIELD_CONDITION, RULE_FIELD_CONDITION},
+		},
+		{
+			name:       "unknown payload field in the action",
+			rules:      []models.Rule{{RuleId: "disk_90", EventType: "disk_space", Condition: "true", Action: "Payload.Used = 0"}},
+			wantFields: []string{RULE_FIELD_ACTION},
+		},
+		{
+			name: "dynamic payload accessors",
+			rules: []models.Rule{{
+				RuleId: "dynamic_80", EventType: "dynamic", PayloadFields: []string{"usage"},
+				Condition: "Payload.GetInt(\"usage\") >= 80 && Payload.Has(\"host\")", Action: "Event.ShouldHandle = true",
+			}},
+		},
+		{
+			name:       "dynamic payload field",
+			rules:      []models.Rule{{RuleId: "dynamic_80", EventType: "dynamic", Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle = true"}},
+			wantFields: []string{RULE_FIELD_CONDITION},
+		},
+		{
+			name: "correlation",
+			rules: []models.Rule{{
+				RuleId: "disk_then_dynamic", EventType: "dynamic", Condition: "true", Action: "Event.ShouldHandle = true",
+				Correlation: &models.RuleCorrelation{JoinOn: "Host", Within: "10m", Sequence: []models.CorrelationStep{
+					{EventType: "disk_space", Condition: "Payload.Usage > 90"},
+				}},
+			}},
+		},
+		{
+			name: "correlation of unknown events and fields",
+			rules: []models.Rule{{
+				RuleId: "disk_then_cpu", EventType: "disk_space", Condition: "true", Action: "Event.ShouldHandle = true",
+				Correlation: &models.RuleCorrelation{JoinOn: "Zone", Within: "10m", Sequence: []models.CorrelationStep{
+					{EventType: "cpu"},
+					{EventType: "disk_space", Condition: "Payload.Size > 90"},
+				}},
+			}},
+			wantFields: []string{"correlation.sequence[0].event_type", RULE_FIELD_CORRELATION, "correlation.sequence[1].condition"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := LintRules(map[string][]models.Rule{"tenant1": tt.rules}, payloadTypes)
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+				if err.TenantID != "tenant1" || err.RuleID == "" {
+					t.Errorf("lint error without its rule: %+v", err)
+				}
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("LintRules() fields = %v, want %v (%v)", fields, tt.wantFields, errs)
+			}
+		})
+	}
+}
@@ -7,245 +7,549 @@ import (
 	"fmt"
 	"github.com/SMART2016/go-rule-engine/models"
 	"github.com/SMART2016/go-rule-engine/store"
-	"github.com/hyperjumptech/grule-rule-engine/ast"
-	"github.com/hyperjumptech/grule-rule-engine/builder"
-	"github.com/hyperjumptech/grule-rule-engine/engine"
-	"github.com/hyperjumptech/grule-rule-engine/pkg"
-	"log"
-	"reflect"
+	"time"
 )
 
 type GRuleProcessor struct {
-	conf       Config
-	ruleRepo   RuleRepository
-	eventStore EventStore
+	conf             Config
+	ruleRepo         RuleRepository
+	eventStore       EventStore
+	windowStore      WindowStore
+	correlationStore CorrelationStore
+	connectDB        DBConnector
+	evaluators       []Evaluator
+	kbCache          *knowledgeBaseCache
+	dispatcher       *ActionDispatcher
+	stopWatch        context.CancelFunc
 }
 
 /*
 NewGRuleProcessor initializes a new instance of GRuleProcessor.
 
+Every processor owns its rule repository. Unless one is injected with
+WithRuleRepository, a JsonRuleRepository is loaded from the configured rule
+repository path, or a PostgresRuleRepository or VersionedRuleRepository
+when the config selects RULE_REPO_TYPE_POSTGRES or RULE_REPO_TYPE_VERSIONED,
+so processors configured with different rules can coexist.
+
+Rules are evaluated in the languages of the built-in evaluators and of those
+added with WithEvaluator. A repository created by the processor validates
+its rules with the same evaluators, one injected with WithRuleRepository
+must be given them when it is created.
+
+The rules are validated against the event types of the EventRegistry when
+they are loaded, so the event types must be registered with
+models.GetEventRegistry().RegisterEventType before the processor is
+created, and before a repository injected with WithRuleRepository is. The
+dynamic event types of a DynamicEventTypesConfig are registered by the
+processor. A rule of an event type registered later is rejected.
+
 Parameters:
-  - cfg: *Config - The configuration settings for the rule processor.
-  - ruleRepo: RuleRepository - Interface to access the rule repository.
-  - eventStore: store.Querier - Interface to interact with the event store.
+  - cfg: Config - The configuration settings for the rule processor.
+  - opts: ...GRuleProcessorOption - Optional dependencies, see
+    WithRuleRepository, WithEventStore, WithWindowStore,
+    WithCorrelationStore, WithDBConnector and WithEvaluator.
 
 Returns:
   - *GRuleProcessor: A pointer to the initialized GRuleProcessor instance.
 */
-func NewGRuleProcessor(cfg Config) (*GRuleProcessor, error) {
+func NewGRuleProcessor(cfg Config, opts ...GRuleProcessorOption) (*GRuleProcessor, error) {
+	processor := &GRuleProcessor{
+		conf:             cfg,
+		eventStore:       store.New(),
+		windowStore:      store.New(),
+		correlationStore: store.New(),
+		dispatcher:       NewActionDispatcher(),
+		stopWatch:        func() {},
+	}
+	processor.connectDB = processor.connectConfiguredDB
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+	processor.kbCache = newKnowledgeBaseCache(processor.evaluators...)
+
+	// Dynamic event types are registered before the rules of the repository are validated against them
+	if dynamic, ok := cfg.(DynamicEventTypesConfig); ok {
+		if err := RegisterDynamicEventTypes(dynamic.GetDynamicEventTypes()...); err != nil {
+			return nil, errors.New("Failed to Register Dynamic Event Types: " + err.Error())
+		}
+	}
+
 	// Initialize Rule Repository
-	ruleRepo, err := initializeSingleRuleRepoInstance(cfg)
+	if processor.ruleRepo == nil {
+		var ruleRepo RuleRepository
+		var err error
+		var repoType RuleRepoType
+		if typed, ok := cfg.(RuleRepoTypeConfig); ok {
+			repoType = typed.GetRuleRepoType()
+		}
+		switch repoType {
+		case RULE_REPO_TYPE_POSTGRES:
+			ruleRepo, err = NewPostgresRuleRepository(context.Background(), processor.connectDB, nil, processor.evaluators...)
+		case RULE_REPO_TYPE_VERSIONED:
+			ruleRepo, err = NewVersionedRuleRepository(context.Background(), processor.connectDB, nil, processor.evaluators...)
+		default:
+			ruleRepo, err = NewJsonRuleRepository(cfg.GetRuleRepoPath(), processor.evaluators...)
+		}
+		if err != nil {
+			return nil, errors.New("Failed to Initialize Rule Repository: " + err.Error())
+		}
+		processor.ruleRepo = ruleRepo
+	}
+
+	if emailCfg, ok := cfg.(EmailActionConfig); ok && emailCfg.EmailConfig() != nil {
+		emailHandler, err := NewEmailActionHandler(emailCfg.EmailConfig())
+		if err != nil {
+			return nil, errors.New("Failed to Initialize Email Action: " + err.Error())
+		}
+		processor.registerDefaultActionHandler(models.ACTION_KIND_EMAIL, emailHandler)
+	}
+	if webhookCfg, ok := cfg.(WebhookActionConfig); ok && webhookCfg.WebhookConfig() != nil {
+		webhookHandler, err := NewWebhookActionHandler(webhookCfg.WebhookConfig(), nil)
+		if err != nil {
+			return nil, errors.New("Failed to Initialize Webhook Action: " + err.Error())
+		}
+		processor.registerDefaultActionHandler(models.ACTION_KIND_WEBHOOK, webhookHandler)
+	}
+
+	// Hot reload the rules, the compiled rule cache picks up the new rules by their revision.
+	reloadable, ok := processor.ruleRepo.(ReloadableRuleRepository)
+	reloadCfg, configured := cfg.(RuleReloadConfig)
+	if ok && configured && reloadCfg.GetRuleReloadInterval() > 0 {
+		watchCtx, cancel := context.WithCancel(context.Background())
+		processor.stopWatch = cancel
+		go reloadable.Watch(watchCtx, reloadCfg.GetRuleReloadInterval(), reloadCfg.GetRuleReloadCallback())
+	}
+
+	return processor, nil
+}
+
+// registerDefaultActionHandler registers a handler built from the config unless one was injected for the kind.
+func (re *GRuleProcessor) registerDefaultActionHandler(kind string, handler ActionHandler) {
+	if _, exists := re.dispatcher.Handler(kind); !exists {
+		re.dispatcher.Register(kind, handler)
+	}
+}
+
+// matchPolicy returns the match policy of a tenant from a MatchPolicyConfig, MATCH_POLICY_FIRST_MATCH otherwise.
+func (re *GRuleProcessor) matchPolicy(tenantID string) MatchPolicy {
+	if cfg, ok := re.conf.(MatchPolicyConfig); ok {
+		return cfg.MatchPolicy(tenantID)
+	}
+	return MATCH_POLICY_FIRST_MATCH
+}
+
+// timezone returns the location of the rule schedules of a tenant from a TimezoneConfig, UTC otherwise.
+func (re *GRuleProcessor) timezone(tenantID string) *time.Location {
+	if cfg, ok := re.conf.(TimezoneConfig); ok {
+		return cfg.Timezone(tenantID)
+	}
+	return time.UTC
+}
+
+// connectConfiguredDB is the default DBConnector, it opens a connection to the configured event state store.
+func (re *GRuleProcessor) connectConfiguredDB(ctx context.Context) (store.DBTX, func(), error) {
+	// Generate DSN
+	dsn := re.conf.DbConfig().GenerateDSN()
+
+	// Initialize database
+	database, err := store.NewDatabase(dsn)
 	if err != nil {
-		return nil, errors.New("Failed to Initialize Rule Repository: " + err.Error())
+		return nil, nil, err
 	}
+	return database.Conn, database.Close, nil
+}
+
+// Close stops the background work of the processor, such as the rule file hot reload.
+func (re *GRuleProcessor) Close() {
+	re.stopWatch()
+}
 
-	return &GRuleProcessor{
-		conf:       cfg,
-		ruleRepo:   ruleRepo,
-		eventStore: store.New(),
-	}, nil
+// GetEffectiveRules returns the rules that apply to a tenant after layering its rules on top of the defaults.
+func (re *GRuleProcessor) GetEffectiveRules(tenantID string) ([]models.Rule, error) {
+	return re.ruleRepo.GetEffectiveRules(tenantID)
+}
+
+// RegisterActionHandler registers the handler called for the actions of the given kind of fired rules.
+func (re *GRuleProcessor) RegisterActionHandler(kind string, handler ActionHandler) {
+	re.dispatcher.Register(kind, handler)
+}
+
+/*
+getRules returns the rules of the event, recording the active rule set
+revisions when the repository is versioned.
+
+The returned generation of the repository identifies the rules for the
+knowledgeBaseCache. It is read before the rules, rules changed in between
+are compiled again on the next evaluation.
+*/
+func (re *GRuleProcessor) getRules(event models.BaseEvent[any], result *models.EvaluationResult) ([]models.Rule, uint64, error) {
+	generation := re.ruleRepo.Generation()
+	revisioned, ok := re.ruleRepo.(RevisionedRuleRepository)
+	if !ok {
+		rules, err := re.ruleRepo.GetRules(event.TenantID, event.Type)
+		return rules, generation, err
+	}
+	rules, revisions, err := revisioned.GetRulesWithRevisions(event.TenantID, event.Type)
+	result.ActiveRevisionID = revisions.TenantRevisionID
+	result.DefaultRevisionID = revisions.DefaultRevisionID
+	return rules, generation, err
 }
 
 /*
 Evaluate takes a context and a BaseEvent and returns a boolean indicating
 whether the event was handled and an error if there was a problem.
 
-The method first validates the event. If the event is invalid, an error is
-returned. If the event is valid, it retrieves the rules associated with the
-event's tenant and type from the rule repository. If no rules are found, the
-method returns false, nil. If rules are found, the method iterates over the
-rules and for each rule:
+It is a thin wrapper around EvaluateWithResult.
 
-1. If the rule has deduplication enabled, the method checks if the event is a
-duplicate by checking the event's SHA in the event store. If the event is a
-duplicate, the method skips processing the rule.
+Parameters:
+  - ctx: context.Context - A context to manage cancellation and deadlines.
+  - event: models.BaseEvent[any] - The event to be evaluated.
 
-2. The method builds the rule using the RuleBuilder and adds it to the
-KnowledgeBase.
+Returns:
+  - bool - Indicates whether the event was handled successfully.
+  - error - Contains any error encountered during processing or evaluation of
 
-3. The method creates a new DataContext and adds the event to it.
+the event.
+*/
+func (re *GRuleProcessor) Evaluate(ctx context.Context, event models.BaseEvent[any]) (bool, error) {
+	result, err := re.EvaluateWithResult(ctx, event)
+	if err != nil {
+		return false, err
+	}
+	return result.Handled(), nil
+}
 
-4. The method initializes the Grule engine and executes the rules in the
-KnowledgeBase.
+/*
+EvaluateWithResult takes a context and a BaseEvent, evaluates the event
+against the rules of its tenant and returns an EvaluationResult describing
+what happened.
 
-5. If the rule's action indicates an email should be sent, the method saves the
-event to the event store and triggers the email sending logic.
+The method first validates the event. If the event is invalid, an error is
+returned. If the event is valid, it retrieves the rules associated with the
+event's tenant and type from the rule repository, with the correlation
+rules having an event of the type in their sequence. If no rules are found,
+an empty result is returned. If rules are found:
+
+1. The method takes the compiled rules from the compiled rule cache. The
+rules of a tenant are only compiled again, by the Evaluator of their
+language, when the rules returned by the repository change.
+
+2. Rules whose schedule is not active when the event occurred, read in the
+timezone of the tenant, are kept out of the evaluation and reported in
+EvaluationResult.ScheduleSkipped. For every other rule with deduplication
+enabled, the method checks if the event is a duplicate by checking the
+event's SHA in the event store. Duplicate rules are kept out of the
+evaluation and reported in EvaluationResult.DedupSkipped.
+
+3. The event is recorded in the sliding window of its group for every
+aggregation rule, the windows of the rules allowed to fire are read back
+from the WindowStore and reported in EvaluationResult.Windows.
+
+4. The event advances the partial matches of the correlation rules whose
+sequence it continues, kept in the CorrelationStore. A correlation rule of
+the event type is kept out of the evaluation unless the event completes its
+sequence. The partial matches are reported in EvaluationResult.Correlations.
+
+5. The method gathers the facts of the evaluation: the event, its payload,
+the set of rules allowed to fire and the windows of the aggregation rules.
+
+6. The method executes the rules with the Evaluator of their language, grule
+for GRL rules. Rules fire in order of their priority (salience) and can see
+the effects of the rules that fired before them. An aggregation rule sees its
+window as the Window fact. The partial matches of the correlation rules that
+fired are removed, their sequence completed.
+
+7. The method saves the event to the event store under the rules that set
+Event.ShouldHandle. With the first-match policy of the tenant that is the
+first such rule, no rule fires after it. With the all-matching policy every
+rule whose condition held.
+
+8. The actions declared by the handling rule, with the all-matching policy by
+every fired rule, are dispatched to the registered ActionHandlers. A failed action is recorded in the result, it does not fail
+the evaluation.
 
 Parameters:
   - ctx: context.Context - A context to manage cancellation and deadlines.
   - event: models.BaseEvent[any] - The event to be evaluated.
 
 Returns:
-  - bool - Indicates whether the event was handled successfully.
+  - *models.EvaluationResult - The fired rules, executed actions, dedup skipped
+    rules, the final ShouldHandle state and timings. It is never nil, on error
+    it holds what was done before the failure.
   - error - Contains any error encountered during processing or evaluation of
+    the event.
+*/
+func (re *GRuleProcessor) EvaluateWithResult(ctx context.Context, event models.BaseEvent[any]) (*models.EvaluationResult, error) {
+	return re.evaluate(ctx, event, evaluationMode{checkDuplicates: true})
+}
 
-the event.
+/*
+DryRun evaluates the event like EvaluateWithResult without side effects, to
+find out what would happen if the event arrived.
+
+Conditions and actions of the rules are executed against the event, but the
+handled event is not saved to the event store and the actions of the fired
+rules are not dispatched. They are reported in EvaluationResult.ActionsExecuted
+marked as skipped instead, with an error for actions without a registered
+handler.
+
+Parameters:
+  - ctx: context.Context - A context to manage cancellation and deadlines.
+  - event: models.BaseEvent[any] - The event to be evaluated.
+  - checkDuplicates: bool - Whether rules with deduplication look the event up
+    in the event store, aggregation rules read their windows and correlation
+    rules their partial matches, read-only queries. When false no database
+    connection is opened, every rule is evaluated as if the event was new, a
+    window only holds the event and no sequence of a correlation rule
+    completes.
+
+Returns:
+  - *models.EvaluationResult - The rules that would fire, the actions that
+    would run and the rules skipped as duplicates, with DryRun set.
+  - error - Contains any error encountered during the evaluation of the event.
 */
+func (re *GRuleProcessor) DryRun(ctx context.Context, event models.BaseEvent[any], checkDuplicates bool) (*models.EvaluationResult, error) {
+	return re.evaluate(ctx, event, evaluationMode{dryRun: true, checkDuplicates: checkDuplicates})
+}
+
+// evaluationMode selects the side effects of an evaluation.
+type evaluationMode struct {
+	dryRun          bool // Do not persist the handled event nor dispatch actions
+	checkDuplicates bool // Look up rules with deduplication in the event store
+}
+
+// usesStore reports whether the evaluation reads or writes the state store, it needs a connection then.
+func (m evaluationMode) usesStore() bool {
+	return m.checkDuplicates || !m.dryRun
+}
+
+// evaluate implements EvaluateWithResult and DryRun.
+func (re *GRuleProcessor) evaluate(ctx context.Context, event models.BaseEvent[any], mode evaluationMode) (*models.EvaluationResult, error) {
+	start := time.Now()
+	result := models.NewEvaluationResult(event)
+	result.DryRun = mode.dryRun
+	defer func() {
+		result.ShouldHandle = event.ShouldHandle
+		result.Timings.Total = time.Since(start)
+	}()
 
-func (re *GRuleProcessor) Evaluate(ctx context.Context, event models.BaseEvent[any]) (bool, error) {
 	err := event.Validate()
 	if err != nil {
-		return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Event Validation failed %v", err)
+		return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Event Validation failed %v", err)
 	}
 
-	rules, err := re.ruleRepo.GetRules(event.TenantID, event.Type)
-	if err != nil {
-		return false, nil // No rules found for this tenant and event type
+	stepStart := time.Now()
+	rules, generation, err := re.getRules(event, result)
+	result.Timings.RuleLookup = time.Since(stepStart)
+	if err != nil || len(rules) == 0 {
+		return result, nil // No rules found for this tenant and event type
 	}
-	// Generate DSN
-	dsn := re.conf.DbConfig().GenerateDSN()
 
-	// Initialize database
-	database, err := store.NewDatabase(dsn)
+	stepStart = time.Now()
+	compiled, err := re.kbCache.get(event.TenantID, event.Type, generation, rules)
+	result.Timings.Compilation = time.Since(stepStart)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
-		return false, err
+		return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Rule Build Failed : %v", err)
+	}
+	var database store.DBTX
+	if mode.usesStore() {
+		var closeDB func()
+		database, closeDB, err = re.connectDB(ctx)
+		if err != nil {
+			return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Failed to initialize database: %v", err)
+		}
+		defer closeDB() // Ensure closure of DB connection
 	}
-	defer database.Close() // Ensure closure of DB connection
 
+	// Schedules are read in the timezone of the tenant at the time the event occurred
+	occurredAt := event.OccuredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	occurredAt = occurredAt.In(re.timezone(event.TenantID))
+
+	stepStart = time.Now()
+	rulesByID := make(map[string]models.Rule, len(rules))
+	gate := newRuleGate()
+	duplicates := make(map[string]bool)
 	for _, rule := range rules {
-		if rule.Deduplication {
-			//Update the event SHA to include the rule ID if it's enabled in the rule
-			if rule.IncludeRuleIdInDedupKey {
-				event.EventSHA = fmt.Sprintf("%s:%s", rule.RuleId, event.EventSHA)
-			}
+		rulesByID[rule.RuleId] = rule
+		if rule.EventType != event.Type {
+			continue // Correlation rules of another event type only match the events of their sequence
+		}
+		if skip := compiled.scheduleSkip(rule.RuleId, occurredAt); skip != nil {
+			result.ScheduleSkipped = append(result.ScheduleSkipped, *skip)
+			continue // Skip rules outside of their schedule
+		}
+		if rule.Deduplication && mode.checkDuplicates {
 			// Check if event is a duplicate
-			isDuplicate, err := re.eventStore.IsDuplicate(ctx, database.Conn, store.IsDuplicateParams{
+			dedupSHA := ruleDedupSHA(rule, event.EventSHA)
+			checkStart := time.Now()
+			isDuplicate, err := re.eventStore.IsDuplicate(ctx, database, store.IsDuplicateParams{
 				TenantID:  event.TenantID,
 				EventType: event.Type,
-				EventSha:  event.EventSHA,
+				EventSha:  dedupSHA,
 				Column5:   rule.DedupWindow,
 				RuleID:    rule.RuleId,
 			})
+			result.RuleTiming(rule.RuleId).DedupCheck = time.Since(checkStart)
 			if err != nil {
-				return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Duplicate Event Check Failed: %v", err)
+				return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Duplicate Event Check Failed: %v", err)
 			}
 			if isDuplicate.(bool) {
+				result.DedupSkipped = append(result.DedupSkipped, models.DedupSkip{RuleID: rule.RuleId, EventSHA: dedupSHA})
+				duplicates[rule.RuleId] = true
 				continue // Skip processing for duplicate events
 			}
 		}
+		gate.activate(rule.RuleId)
+	}
+	result.Timings.DedupCheck = time.Since(stepStart)
 
-		// Build the rule dynamically
-		grl := fmt.Sprintf(`
-			rule %s {
-				when
-					%s
-				then
-					%s;
-			}
-		`, rule.RuleId, rule.Condition, rule.Action)
+	// Payload of the rules, JSON payloads are wrapped in a DynamicPayload
+	payload := extractPayload(event.GetPayload())
 
-		knowledgeLibrary := ast.NewKnowledgeLibrary()
-		ruleBuilder := builder.NewRuleBuilder(knowledgeLibrary)
-		resource := pkg.NewBytesResource([]byte(grl))
-		err = ruleBuilder.BuildRuleFromResource("EventRules", "0.0.1", resource)
-		if err != nil {
-			return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Rule Build Failed : %v", err)
+	// Every new event enters the windows of the aggregation rules, even when no rule may fire
+	stepStart = time.Now()
+	windows, err := re.updateWindows(ctx, database, event, payload, compiled, occurredAt, gate, duplicates, mode)
+	result.Timings.Aggregation = time.Since(stepStart)
+	if err != nil {
+		return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Aggregation Window Update Failed: %v", err)
+	}
+	for _, ruleID := range compiled.aggregationOrder {
+		if window, ok := windows[ruleID]; ok {
+			result.Windows = append(result.Windows, *window)
 		}
+	}
 
-		// Retrieve the KnowledgeBase instance
-		knowledgeBase, err := knowledgeLibrary.NewKnowledgeBaseInstance("EventRules", "0.0.1")
-		if err != nil {
-			return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Failed to get KnowledgeBase: %v", err)
-		}
+	// Every event advances the sequences of the correlation rules, even when no rule may fire
+	stepStart = time.Now()
+	completed, err := re.correlate(ctx, database, event, payload, compiled, occurredAt, gate, mode, result)
+	result.Timings.Correlation = time.Since(stepStart)
+	if err != nil {
+		return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Correlation Update Failed: %v", err)
+	}
+	if !gate.hasActive() {
+		return result, nil
+	}
 
-		// Create a new DataContext
-		dataContext := ast.NewDataContext()
+	// Execute rules
+	stepStart = time.Now()
+	policy := re.matchPolicy(event.TenantID)
+	result.MatchPolicy = string(policy)
+	listener := newFiredRulesListener(&event, policy, gate)
+	err = compiled.execute(ctx, newRuleFacts(&event, payload, gate, listener, windows))
+	listener.finish()
+	result.Timings.Execution = time.Since(stepStart)
+	listener.applyTo(result)
+	if err != nil {
+		return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Rule Execution Failed : %v", err)
+	}
 
-		err = dataContext.Add("Event", &event) // Add main event
-		if err != nil {
-			return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Failed to add Event to DataContext: %v", err)
+	if mode.dryRun {
+		for _, ruleID := range result.HandledRuleIDs {
+			result.ActionsExecuted = append(result.ActionsExecuted, models.ActionResult{
+				RuleID: ruleID, Kind: models.ACTION_KIND_PERSIST, Skipped: true,
+			})
 		}
-
-		// Extract and add Payload dynamically
-		//payload := extractPayload(event.Payload)
-		//if payload == nil {
-		//	return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Failed to extract Payload")
-		//}
-
-		// Add Payload using interface
-		payload := event.GetPayload()
-		err = dataContext.Add("Payload", payload)
-		if err != nil {
-			return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Failed to add Payload to DataContext: %v", err)
+		for _, ruleID := range dispatchedRuleIDs(result, policy) {
+			result.ActionsExecuted = append(result.ActionsExecuted, re.dispatcher.Plan(rulesByID[ruleID])...)
 		}
+		return result, nil
+	}
 
-		err = dataContext.Add("Payload", payload)
-		if err != nil {
-			return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Failed to add Payload to DataContext: %v", err)
-		}
+	stepStart = time.Now()
+	err = re.consumeCorrelations(ctx, database, event, completed, result)
+	result.Timings.Correlation += time.Since(stepStart)
+	if err != nil {
+		return result, fmt.Errorf("[GRuleProcessor.Evaluate]: Correlation Update Failed: %v", err)
+	}
 
-		// Execute rules
-		gruleEngine := engine.NewGruleEngine()
-		err = gruleEngine.Execute(dataContext, knowledgeBase)
+	stepStart = time.Now()
+	for _, ruleID := range result.HandledRuleIDs {
+		err = re.persistHandledEvent(ctx, database, event, payload, rulesByID[ruleID], result)
 		if err != nil {
-			return false, fmt.Errorf("[GRuleProcessor.Evaluate]: Rule Execution Failed : %v", err)
+			result.Timings.Persistence = time.Since(stepStart)
+			return result, err
 		}
+	}
+	result.Timings.Persistence = time.Since(stepStart)
 
-		if event.ShouldHandle {
-			jsonPayload, err := json.Marshal(payload)
-			if err != nil {
-				return false, fmt.Errorf("Failed to convert payload to JSON: %v", err)
-			}
-
-			err = re.eventStore.SaveEvent(ctx, database.Conn, store.SaveEventParams{
-				TenantID:  event.TenantID,
-				EventType: event.Type,
-				RuleID:    rule.RuleId,
-				EventSha:  event.EventSHA,
-				Column5:   json.RawMessage(jsonPayload),
-			})
-			if err != nil {
-				return false, fmt.Errorf("Failed to save event to store: %v", err)
-			}
-
-			return true, nil
-		}
+	for _, ruleID := range dispatchedRuleIDs(result, policy) {
+		result.ActionsExecuted = append(result.ActionsExecuted,
+			re.dispatcher.Dispatch(ctx, event, payload, rulesByID[ruleID])...)
 	}
 
-	return false, nil
+	return result, nil
 }
 
-/*
-extractPayload extracts the payload from the event.
+// dispatchedRuleIDs returns the fired rules whose actions are dispatched, with the first-match policy only the handling rule.
+func dispatchedRuleIDs(result *models.EvaluationResult, policy MatchPolicy) []string {
+	if policy == MATCH_POLICY_ALL_MATCHING {
+		return result.MatchedRuleIDs
+	}
+	if result.HandledByRuleID == "" {
+		return nil
+	}
+	return []string{result.HandledByRuleID}
+}
 
-If the payload is a nil value, nil is returned.
+// persistHandledEvent saves the event handled by the rule to the event store.
+func (re *GRuleProcessor) persistHandledEvent(ctx context.Context, database store.DBTX, event models.BaseEvent[any], payload any, rule models.Rule, result *models.EvaluationResult) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to convert payload to JSON: %v", err)
+	}
 
-If the payload is a pointer, the underlying value is returned.
+	err = re.eventStore.SaveEvent(ctx, database, store.SaveEventParams{
+		TenantID:  event.TenantID,
+		EventType: event.Type,
+		RuleID:    rule.RuleId,
+		EventSha:  ruleDedupSHA(rule, event.EventSHA),
+		Column5:   json.RawMessage(jsonPayload),
+	})
+	if err != nil {
+		result.ActionsExecuted = append(result.ActionsExecuted, models.ActionResult{
+			RuleID: rule.RuleId, Kind: models.ACTION_KIND_PERSIST, Error: err.Error(),
+		})
+		return fmt.Errorf("Failed to save event to store: %v", err)
+	}
+	result.ActionsExecuted = append(result.ActionsExecuted, models.ActionResult{
+		RuleID: rule.RuleId, Kind: models.ACTION_KIND_PERSIST,
+	})
 
-If the payload is a struct, the struct is returned as an interface.
+	return nil
+}
 
-If the payload is a valid JSON string, it is unmarshaled into a map
-and returned.
+/*
+extractPayload returns the Payload fact of an event.
 
-If the payload is not one of the above, nil is returned.
+JSON payloads without a Go struct, a JSON string, a json.RawMessage or a
+decoded map, are wrapped in a models.DynamicPayload so the rules read them
+with typed accessors such as Payload.GetInt("usage"). Other payloads,
+including JSON that is not an object, are returned as is.
 */
 func extractPayload(payload any) any {
-	v := reflect.ValueOf(payload)
-
-	// If payload is nil, return nil
-	if !v.IsValid() || v.IsZero() {
-		return nil
-	}
-
-	// If payload is a pointer, get the underlying value
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-	}
-
-	// If payload is a struct, return it as an interface
-	if v.Kind() == reflect.Struct {
+	var data []byte
+	switch value := payload.(type) {
+	case string:
+		data = []byte(value)
+	case json.RawMessage:
+		data = value
+	case map[string]any:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return payload
+		}
+		data = encoded
+	default:
 		return payload
 	}
-
-	// If payload is a valid JSON string, unmarshal it into a map
-	if str, ok := payload.(string); ok {
-		var result map[string]interface{}
-		err := json.Unmarshal([]byte(str), &result)
-		if err == nil {
-			return result
-		}
+	dynamic, err := models.NewDynamicPayload(data)
+	if err != nil {
+		return payload
 	}
-
-	return nil
+	return dynamic
 }
@@ -0,0 +1,345 @@
+package rule_processor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+)
+
+func init() {
+	models.GetEventRegistry().RegisterEventType("disk_space", func() models.Evaluable {
+		return &models.BaseEvent[testUsagePayload]{}
+	})
+	models.GetEventRegistry().RegisterEventType("disk_io", func() models.Evaluable {
+		return &models.BaseEvent[testUsagePayload]{}
+	})
+}
+
+func newTestProcessor(t *testing.T, cfg Config, opts ...GRuleProcessorOption) (*GRuleProcessor, *MemoryEventStore) {
+	t.Helper()
+	eventStore := NewMemoryEventStore()
+	opts = append([]GRuleProcessorOption{WithEventStore(eventStore), WithWindowStore(NewMemoryWindowStore()), WithCorrelationStore(NewMemoryCorrelationStore()),
+		WithDBConnector(NoDBConnector)}, opts...)
+	processor, err := NewGRuleProcessor(cfg, opts...)
+	if err != nil {
+		t.Fatalf("NewGRuleProcessor() error = %v", err)
+	}
+	t.Cleanup(processor.Close)
+	return processor, eventStore
+}
+
+func diskEvent(tenantID string, usage int) models.BaseEvent[any] {
+	return models.BaseEvent[any]{
+		TenantID: tenantID,
+		Type:     "disk_space",
+		Payload:  &testUsagePayload{Usage: usage},
+		EventSHA: "instance-1",
+	}
+}
+
+func TestNewGRuleProcessor_ProcessorsOwnTheirRules(t *testing.T) {
+	dir := t.TempDir()
+	pathV1 := filepath.Join(dir, "rules_v1.json")
+	pathV2 := filepath.Join(dir, "rules_v2.json")
+	writeRulesFile(t, pathV1, testRulesV1, time.Now())
+	writeRulesFile(t, pathV2, testRulesV2, time.Now())
+
+	first, _ := newTestProcessor(t, &FrameworkConfig{RuleRepoPath: pathV1})
+	second, _ := newTestProcessor(t, &FrameworkConfig{RuleRepoPath: pathV2})
+
+	for _, tt := range []struct {
+		processor *GRuleProcessor
+		want      string
+	}{{first, "disk_80"}, {second, "disk_90"}} {
+		rules, err := tt.processor.GetEffectiveRules("tenant1")
+		if err != nil {
+			t.Fatalf("GetEffectiveRules() error = %v", err)
+		}
+		if ids := ruleIDs(rules); !reflect.DeepEqual(ids, []string{tt.want}) {
+			t.Errorf("GetEffectiveRules() = %v, want [%s]", ids, tt.want)
+		}
+	}
+
+	if _, err := NewGRuleProcessor(&FrameworkConfig{RuleRepoPath: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Error("NewGRuleProcessor() expected an error for a missing rule file")
+	}
+}
+
+func TestNewGRuleProcessor_UnregisteredEventType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"tenant_default": [
+    {"rule_id": "cpu_90", "event_type": "unregistered_cpu", "condition": "Payload.Load >= 0.9", "action": "Event.ShouldHandle = true"}
+  ]}`, time.Now())
+
+	_, err := NewGRuleProcessor(&FrameworkConfig{RuleRepoPath: path})
+	if err == nil || !strings.Contains(err.Error(), "register the event types before creating the processor") {
+		t.Errorf("NewGRuleProcessor() error = %v, want the event types to be registered first", err)
+	}
+}
+
+// minimalConfig implements Config without any of the optional settings.
+type minimalConfig struct {
+	ruleRepoPath string
+}
+
+func (c minimalConfig) GetDBConfigPath() string           { return "" }
+func (c minimalConfig) GetRuleRepoPath() string           { return c.ruleRepoPath }
+func (c minimalConfig) GetCleanupInterval() time.Duration { return time.Hour }
+func (c minimalConfig) DbConfig() *EventStateStoreConfig  { return &EventStateStoreConfig{} }
+
+func TestNewGRuleProcessor_MinimalConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, testRulesV1, time.Now())
+
+	processor, _ := newTestProcessor(t, minimalConfig{ruleRepoPath: path})
+	if _, ok := processor.ruleRepo.(*JsonRuleRepository); !ok {
+		t.Fatalf("rule repository = %T, want the rule file", processor.ruleRepo)
+	}
+	result, err := processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 85))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if !result.Handled() || result.MatchPolicy != string(MATCH_POLICY_FIRST_MATCH) {
+		t.Errorf("EvaluateWithResult() = %+v, want the event handled with the first-match policy", result)
+	}
+	if got := processor.timezone("tenant1"); got != time.UTC {
+		t.Errorf("timezone() = %v, want UTC", got)
+	}
+}
+
+func TestGRuleProcessor_EvaluateWithResult(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{
+		DEFAULT_TENANT_RULE_ID: {
+			{
+				RuleId:        "disk_80",
+				EventType:     "disk_space",
+				Condition:     "Payload.Usage >= 80 && Event.ShouldHandle == false",
+				Action:        "Event.ShouldHandle = true",
+				Deduplication: true,
+				Priority:      1,
+				Actions:       []models.RuleAction{{Kind: "recording"}},
+			},
+			{
+				RuleId:                  "disk_100",
+				EventType:               "disk_space",
+				Condition:               "Payload.Usage == 100 && Event.ShouldHandle == false",
+				Action:                  "Event.ShouldHandle = true",
+				Deduplication:           true,
+				IncludeRuleIdInDedupKey: true,
+				Priority:                10,
+				Actions:                 []models.RuleAction{{Kind: "recording"}},
+			},
+		},
+	}}
+	handler := &recordingActionHandler{}
+	processor, eventStore := newTestProcessor(t, &FrameworkConfig{},
+		WithRuleRepository(repo), WithActionHandler("recording", handler))
+
+	result, err := processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 100))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if !result.Handled() || result.HandledByRuleID != "disk_100" || !result.ShouldHandle {
+		t.Errorf("result = %+v, want handled by disk_100", result)
+	}
+	if !reflect.DeepEqual(result.MatchedRuleIDs, []string{"disk_100"}) {
+		t.Errorf("MatchedRuleIDs = %v", result.MatchedRuleIDs)
+	}
+	if eventStore.Count() != 1 {
+		t.Errorf("event store holds %d events, want 1", eventStore.Count())
+	}
+	if len(handler.requests) != 1 || handler.requests[0].Rule.RuleId != "disk_100" {
+		t.Errorf("dispatched actions = %+v", handler.requests)
+	}
+
+	// The same event is now a duplicate for disk_100, so disk_80 handles it.
+	result, err = processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 100))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.DedupSkipped, []models.DedupSkip{{RuleID: "disk_100", EventSHA: "disk_100:instance-1"}}) {
+		t.Errorf("DedupSkipped = %+v", result.DedupSkipped)
+	}
+	if result.HandledByRuleID != "disk_80" {
+		t.Errorf("HandledByRuleID = %q, want disk_80", result.HandledByRuleID)
+	}
+
+	// Every rule is now a duplicate.
+	handled, err := processor.Evaluate(context.Background(), diskEvent("tenant1", 100))
+	if err != nil || handled {
+		t.Errorf("Evaluate() = %v, %v, want false, nil", handled, err)
+	}
+	if eventStore.Count() != 2 {
+		t.Errorf("event store holds %d events, want 2", eventStore.Count())
+	}
+}
+
+func TestGRuleProcessor_EvaluateAllMatching(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{
+		DEFAULT_TENANT_RULE_ID: layeredDiskRules(),
+	}}
+	cfg := &FrameworkConfig{TenantMatchPolicies: map[string]MatchPolicy{"tenant_all": MATCH_POLICY_ALL_MATCHING}}
+	processor, eventStore := newTestProcessor(t, cfg, WithRuleRepository(repo))
+
+	result, err := processor.EvaluateWithResult(context.Background(), diskEvent("tenant_all", 97))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if result.MatchPolicy != string(MATCH_POLICY_ALL_MATCHING) {
+		t.Errorf("MatchPolicy = %q", result.MatchPolicy)
+	}
+	if !reflect.DeepEqual(result.HandledRuleIDs, []string{"disk_critical", "disk_warning"}) {
+		t.Errorf("HandledRuleIDs = %v", result.HandledRuleIDs)
+	}
+	if eventStore.Count() != 2 {
+		t.Errorf("event store holds %d events, want 2", eventStore.Count())
+	}
+
+	result, err = processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 97))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.HandledRuleIDs, []string{"disk_critical"}) {
+		t.Errorf("first-match HandledRuleIDs = %v", result.HandledRuleIDs)
+	}
+}
+
+func TestGRuleProcessor_EvaluateFirstMatchStops(t *testing.T) {
+	for _, language := range []string{models.RULE_LANGUAGE_GRL, models.RULE_LANGUAGE_EXPR} {
+		t.Run(language, func(t *testing.T) {
+			// Neither rule is guarded by Event.ShouldHandle == false
+			critical := diskRule("disk_95", "95")
+			critical.Priority = 10
+			warning := diskRule("disk_80", "80")
+			for _, rule := range []*models.Rule{&critical, &warning} {
+				rule.Language = language
+				rule.Actions = []models.RuleAction{{Kind: "recording"}}
+			}
+			repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {warning, critical}}}
+			handler := &recordingActionHandler{}
+			processor, eventStore := newTestProcessor(t, &FrameworkConfig{},
+				WithRuleRepository(repo), WithActionHandler("recording", handler))
+
+			result, err := processor.EvaluateWithResult(context.Background(), diskEvent("tenant1", 97))
+			if err != nil {
+				t.Fatalf("EvaluateWithResult() error = %v", err)
+			}
+			if !reflect.DeepEqual(result.MatchedRuleIDs, []string{"disk_95"}) || result.HandledByRuleID != "disk_95" {
+				t.Errorf("MatchedRuleIDs = %v handled by %q, want [disk_95]", result.MatchedRuleIDs, result.HandledByRuleID)
+			}
+			if len(handler.requests) != 1 || handler.requests[0].Rule.RuleId != "disk_95" {
+				t.Errorf("dispatched actions = %+v, want disk_95 only", handler.requests)
+			}
+			if eventStore.Count() != 1 {
+				t.Errorf("event store holds %d events, want 1", eventStore.Count())
+			}
+		})
+	}
+}
+
+func TestGRuleProcessor_EvaluateDBError(t *testing.T) {
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: testDiskRules()}}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo),
+		WithDBConnector(func(ctx context.Context) (store.DBTX, func(), error) {
+			return nil, nil, fmt.Errorf("connection refused")
+		}))
+
+	if _, err := processor.Evaluate(context.Background(), diskEvent("tenant1", 90)); err == nil {
+		t.Error("Evaluate() expected an error when the database is unavailable")
+	}
+}
+
+func TestGRuleProcessor_DryRun(t *testing.T) {
+	rule := testDiskRules()[0]
+	rule.Deduplication = true
+	rule.Actions = []models.RuleAction{{Kind: "recording"}, {Kind: "pager"}}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	handler := &recordingActionHandler{}
+	connections := 0
+	processor, eventStore := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo), WithActionHandler("recording", handler),
+		WithDBConnector(func(ctx context.Context) (store.DBTX, func(), error) {
+			connections++
+			return nil, func() {}, nil
+		}))
+
+	result, err := processor.DryRun(context.Background(), diskEvent("tenant1", 90), false)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if !result.DryRun || result.HandledByRuleID != "disk_80" {
+		t.Errorf("result = %+v, want a dry run handled by disk_80", result)
+	}
+	wantActions := []models.ActionResult{
+		{RuleID: "disk_80", Kind: models.ACTION_KIND_GRL},
+		{RuleID: "disk_80", Kind: models.ACTION_KIND_PERSIST, Skipped: true},
+		{RuleID: "disk_80", Kind: "recording", Skipped: true},
+		{RuleID: "disk_80", Kind: "pager", Skipped: true, Error: "no handler registered for action kind 'pager'"},
+	}
+	if !reflect.DeepEqual(result.ActionsExecuted, wantActions) {
+		t.Errorf("ActionsExecuted = %+v, want %+v", result.ActionsExecuted, wantActions)
+	}
+	if connections != 0 || eventStore.Count() != 0 || len(handler.requests) != 0 {
+		t.Errorf("dry run had side effects: %d connections, %d events saved, %d actions dispatched",
+			connections, eventStore.Count(), len(handler.requests))
+	}
+
+	// Duplicate checks only read the event store.
+	if _, err := processor.Evaluate(context.Background(), diskEvent("tenant1", 90)); err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	result, err = processor.DryRun(context.Background(), diskEvent("tenant1", 90), true)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if len(result.DedupSkipped) != 1 || result.Handled() {
+		t.Errorf("dry run with duplicate checks = %+v, want disk_80 skipped", result)
+	}
+	if eventStore.Count() != 1 || len(handler.requests) != 1 {
+		t.Errorf("dry run had side effects: %d events saved, %d actions dispatched", eventStore.Count(), len(handler.requests))
+	}
+}
+
+func TestGRuleProcessor_EvaluateDynamicPayload(t *testing.T) {
+	if err := RegisterDynamicEventTypes("dynamic_disk"); err != nil {
+		t.Fatalf("RegisterDynamicEventTypes() error = %v", err)
+	}
+	cfg := &FrameworkConfig{}
+	rule := models.Rule{
+		RuleId:    "dynamic_80",
+		EventType: "dynamic_disk",
+		Condition: `Payload.GetInt("usage") >= 80 && Payload.GetString("host.name") == "db" && Event.ShouldHandle == false`,
+		Action:    "Event.ShouldHandle = true",
+	}
+	if errs := ValidateRule(rule); len(errs) > 0 {
+		t.Fatalf("ValidateRule() = %v", errs)
+	}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	processor, eventStore := newTestProcessor(t, cfg, WithRuleRepository(repo))
+
+	result, err := models.GetEventRegistry().ProcessEventWithResult(context.Background(), processor,
+		[]byte(`{"tenant_id": "tenant1", "type": "dynamic_disk", "event_sha": "db-1", "payload": {"usage": 91, "host": {"name": "db"}}}`))
+	if err != nil {
+		t.Fatalf("ProcessEventWithResult() error = %v", err)
+	}
+	if result.HandledByRuleID != "dynamic_80" {
+		t.Errorf("result = %+v, want handled by dynamic_80", result)
+	}
+	if eventStore.Count() != 1 {
+		t.Errorf("event store holds %d events, want 1", eventStore.Count())
+	}
+
+	// A JSON string payload is exposed through the same accessors.
+	handled, err := processor.Evaluate(context.Background(), models.BaseEvent[any]{
+		TenantID: "tenant1", Type: "dynamic_disk", EventSHA: "db-2", Payload: `{"usage": 95, "host": {"name": "db"}}`,
+	})
+	if err != nil || !handled {
+		t.Errorf("Evaluate() = %v, %v, want a handled JSON string payload", handled, err)
+	}
+}
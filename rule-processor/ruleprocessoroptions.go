@@ -0,0 +1,86 @@
+package rule_processor
+
+import (
+	"context"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5"
+)
+
+// GRuleProcessorOption defines a function signature for setting the dependencies of a GRuleProcessor.
+type GRuleProcessorOption func(*GRuleProcessor)
+
+/*
+DBConnector opens a connection to the event state store for a single
+evaluation.
+
+It returns the connection, a function releasing it and an error if the
+connection could not be established.
+*/
+type DBConnector func(ctx context.Context) (store.DBTX, func(), error)
+
+/*
+inTransaction runs fn in a transaction of the connection, committed when fn
+returns nil and rolled back otherwise. Connections that cannot begin a
+transaction, such as the nil connection of NoDBConnector used with the
+in-memory stores, run fn directly.
+*/
+func inTransaction(ctx context.Context, db store.DBTX, fn func(tx store.DBTX) error) error {
+	beginner, ok := db.(interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+	})
+	if !ok {
+		return fn(db)
+	}
+	return pgx.BeginFunc(ctx, beginner, func(tx pgx.Tx) error {
+		return fn(tx)
+	})
+}
+
+// WithRuleRepository injects the rule repository, the configured rule file is not loaded. Its Generation must change with its rules.
+func WithRuleRepository(repo RuleRepository) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.ruleRepo = repo
+	}
+}
+
+// WithEventStore injects the event store used for deduplication and persistence.
+func WithEventStore(eventStore EventStore) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.eventStore = eventStore
+	}
+}
+
+// WithWindowStore injects the store keeping the sliding windows of aggregation rules.
+func WithWindowStore(windowStore WindowStore) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.windowStore = windowStore
+	}
+}
+
+// WithCorrelationStore injects the store keeping the partial matches of correlation rules.
+func WithCorrelationStore(correlationStore CorrelationStore) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.correlationStore = correlationStore
+	}
+}
+
+// WithDBConnector injects how connections to the event state store are opened.
+func WithDBConnector(connector DBConnector) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.connectDB = connector
+	}
+}
+
+// WithActionHandler registers the handler of an action kind, it takes precedence over handlers built from the config.
+func WithActionHandler(kind string, handler ActionHandler) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.dispatcher.Register(kind, handler)
+	}
+}
+
+// WithEvaluator adds the evaluator of a rule language, it replaces the built-in evaluator of the same language.
+func WithEvaluator(evaluator Evaluator) GRuleProcessorOption {
+	return func(re *GRuleProcessor) {
+		re.evaluators = append(re.evaluators, evaluator)
+	}
+}
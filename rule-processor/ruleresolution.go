@@ -0,0 +1,87 @@
+package rule_processor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+// ErrRuleNotFound is returned when a tenant has no rule with the requested rule_id.
+var ErrRuleNotFound = errors.New("rule not found")
+
+// ErrRuleExists is returned by CreateRule when the tenant already has a rule with the rule_id.
+var ErrRuleExists = errors.New("rule already exists")
+
+// ruleWrite is how a WritableRuleRepository writes a rule: SaveRule upserts, CreateRule creates and UpdateRule updates it.
+type ruleWrite int
+
+const (
+	ruleWriteUpsert ruleWrite = iota
+	ruleWriteCreate
+	ruleWriteUpdate
+)
+
+// check returns ErrRuleExists or ErrRuleNotFound when the write does not apply, exists reports whether the tenant has the rule.
+func (w ruleWrite) check(tenantID, ruleID string, exists bool) error {
+	switch {
+	case w == ruleWriteCreate && exists:
+		return fmt.Errorf("tenant: %s, rule: %s: %w", tenantID, ruleID, ErrRuleExists)
+	case w == ruleWriteUpdate && !exists:
+		return fmt.Errorf("tenant: %s, rule: %s: %w", tenantID, ruleID, ErrRuleNotFound)
+	default:
+		return nil
+	}
+}
+
+/*
+ResolveTenantRules layers the rules of a tenant on top of the default rules.
+
+  - A default rule applies to the tenant unless the tenant declares a rule with
+    the same rule_id.
+  - A tenant rule with the rule_id of a default rule replaces it, in the
+    position of the default rule.
+  - A tenant rule with disabled set removes the rule with its rule_id, the
+    rule itself never applies.
+  - Tenant rules with a new rule_id are added after the default rules.
+
+The input slices are not modified.
+*/
+func ResolveTenantRules(defaults, tenantRules []models.Rule) []models.Rule {
+	overrides := make(map[string]models.Rule, len(tenantRules))
+	for _, rule := range tenantRules {
+		overrides[rule.RuleId] = rule
+	}
+
+	effective := make([]models.Rule, 0, len(defaults)+len(tenantRules))
+	seen := make(map[string]bool, len(defaults)+len(tenantRules))
+	for _, rule := range defaults {
+		if override, ok := overrides[rule.RuleId]; ok {
+			rule = override
+		}
+		seen[rule.RuleId] = true
+		if !rule.Disabled {
+			effective = append(effective, rule)
+		}
+	}
+	for _, rule := range tenantRules {
+		if seen[rule.RuleId] {
+			continue
+		}
+		seen[rule.RuleId] = true
+		if !rule.Disabled {
+			effective = append(effective, rule)
+		}
+	}
+	return effective
+}
+
+// filterRulesByEventType returns the rules of the given event type, and the correlation rules with an event of the type in their sequence.
+func filterRulesByEventType(rules []models.Rule, eventType string) []models.Rule {
+	var filtered []models.Rule
+	for _, rule := range rules {
+		if rule.AppliesTo(eventType) {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,78 @@
+package rule_processor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+func ruleIDs(rules []models.Rule) []string {
+	var ids []string
+	for _, rule := range rules {
+		ids = append(ids, rule.RuleId)
+	}
+	return ids
+}
+
+func TestResolveTenantRules(t *testing.T) {
+	defaults := []models.Rule{
+		{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= 80"},
+		{RuleId: "disk_100", EventType: "disk_space", Condition: "Payload.Usage == 100"},
+		{RuleId: "cpu_90", EventType: "cpu", Condition: "Payload.Usage >= 90"},
+	}
+
+	tests := []struct {
+		name          string
+		tenantRules   []models.Rule
+		wantIDs       []string
+		wantCondition map[string]string
+	}{
+		{
+			name:    "no tenant rules inherits defaults",
+			wantIDs: []string{"disk_80", "disk_100", "cpu_90"},
+		},
+		{
+			name: "override keeps the default position",
+			tenantRules: []models.Rule{
+				{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= 70"},
+			},
+			wantIDs:       []string{"disk_80", "disk_100", "cpu_90"},
+			wantCondition: map[string]string{"disk_80": "Payload.Usage >= 70", "disk_100": "Payload.Usage == 100"},
+		},
+		{
+			name: "disabled removes a default rule",
+			tenantRules: []models.Rule{
+				{RuleId: "disk_100", Disabled: true},
+			},
+			wantIDs: []string{"disk_80", "cpu_90"},
+		},
+		{
+			name: "new rules are appended",
+			tenantRules: []models.Rule{
+				{RuleId: "mem_95", EventType: "memory"},
+				{RuleId: "cpu_90", Disabled: true},
+				{RuleId: "disabled_new", Disabled: true},
+			},
+			wantIDs: []string{"disk_80", "disk_100", "mem_95"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResolveTenantRules(defaults, tt.tenantRules)
+			if ids := ruleIDs(got); !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ResolveTenantRules() ids = %v, want %v", ids, tt.wantIDs)
+			}
+			for _, rule := range got {
+				if want, ok := tt.wantCondition[rule.RuleId]; ok && rule.Condition != want {
+					t.Errorf("rule %s condition = %q, want %q", rule.RuleId, rule.Condition, want)
+				}
+			}
+		})
+	}
+
+	if defaults[0].Condition != "Payload.Usage >= 80" {
+		t.Error("ResolveTenantRules() modified the default rules")
+	}
+}
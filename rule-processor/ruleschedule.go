@@ -0,0 +1,224 @@
+package rule_processor
+
+import (
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMonths and cronWeekdays are the names accepted in the month and day-of-week fields of a cron expression.
+var (
+	cronMonths = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronWeekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+/*
+cronExpression is a parsed cron-like expression of five fields: minute
+(0-59), hour (0-23), day of month (1-31), month (1-12 or jan-dec) and day of
+week (0-7 or sun-sat, 0 and 7 are Sunday). A field is *, a value, a range
+a-b, either of them followed by a step /n, or a comma separated list of
+them.
+
+As in cron, when both the day of month and the day of week are restricted a
+time matches when either of them does.
+*/
+type cronExpression struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek uint64
+	anyDayOfMonth, anyDayOfWeek                     bool
+}
+
+// parseCronExpression parses a cron-like expression.
+func parseCronExpression(expression string) (*cronExpression, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+	cron := &cronExpression{anyDayOfMonth: fields[2] == "*", anyDayOfWeek: fields[4] == "*"}
+	var err error
+	for _, field := range []struct {
+		name     string
+		value    string
+		min, max int
+		names    map[string]int
+		set      *uint64
+	}{
+		{"minute", fields[0], 0, 59, nil, &cron.minutes},
+		{"hour", fields[1], 0, 23, nil, &cron.hours},
+		{"day of month", fields[2], 1, 31, nil, &cron.daysOfMonth},
+		{"month", fields[3], 1, 12, cronMonths, &cron.months},
+		{"day of week", fields[4], 0, 7, cronWeekdays, &cron.daysOfWeek},
+	} {
+		if *field.set, err = parseCronField(field.value, field.min, field.max, field.names); err != nil {
+			return nil, fmt.Errorf("%s: %w", field.name, err)
+		}
+	}
+	if cron.daysOfWeek&(1<<7) != 0 {
+		cron.daysOfWeek |= 1 // 7 is Sunday too
+	}
+	return cron, nil
+}
+
+// parseCronField returns the set of values matched by a field as a bit set.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		base, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+			base = part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case base == "*":
+		case strings.Contains(base, "-"):
+			bounds := strings.SplitN(base, "-", 2)
+			var err error
+			if low, err = parseCronValue(bounds[0], min, max, names); err != nil {
+				return 0, err
+			}
+			if high, err = parseCronValue(bounds[1], min, max, names); err != nil {
+				return 0, err
+			}
+			if max == 7 && high == 0 {
+				high = 7 // Sunday closes a range of days of week, e.g. mon-sun
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range '%s'", base)
+			}
+		default:
+			var err error
+			if low, err = parseCronValue(base, min, max, names); err != nil {
+				return 0, err
+			}
+			if step == 1 {
+				high = low // A single value, a/n runs from a to the maximum
+			}
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+// parseCronValue parses a number or a name of a cron field.
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if number, ok := names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		return 0, fmt.Errorf("invalid value '%s', expected %d-%d", value, min, max)
+	}
+	return number, nil
+}
+
+// matches reports whether the minute of t matches the expression, t is read in its own location.
+func (c *cronExpression) matches(t time.Time) bool {
+	has := func(set uint64, value int) bool { return set&(1<<value) != 0 }
+	if !has(c.minutes, t.Minute()) || !has(c.hours, t.Hour()) || !has(c.months, int(t.Month())) {
+		return false
+	}
+	dayOfMonth, dayOfWeek := has(c.daysOfMonth, t.Day()), has(c.daysOfWeek, int(t.Weekday()))
+	switch {
+	case c.anyDayOfMonth || c.anyDayOfWeek:
+		return dayOfMonth && dayOfWeek
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+// ruleSchedule is the compiled models.RuleSchedule of a rule.
+type ruleSchedule struct {
+	active    []*cronExpression
+	days      map[time.Weekday]bool
+	blackouts []models.BlackoutWindow
+}
+
+/*
+compileRuleSchedule parses the active periods and days of a schedule and
+checks its blackout windows. It returns nil for a rule without schedule.
+*/
+func compileRuleSchedule(schedule *models.RuleSchedule) (*ruleSchedule, error) {
+	if schedule == nil {
+		return nil, nil
+	}
+	compiled := &ruleSchedule{blackouts: schedule.Blackouts}
+	for i, expression := range schedule.Active {
+		cron, err := parseCronExpression(expression)
+		if err != nil {
+			return nil, fmt.Errorf("active[%d]: %w", i, err)
+		}
+		compiled.active = append(compiled.active, cron)
+	}
+	if len(schedule.Days) > 0 {
+		compiled.days = make(map[time.Weekday]bool, len(schedule.Days))
+		for i, day := range schedule.Days {
+			weekday, ok := cronWeekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("days[%d]: unknown day '%s', expected one of sun, mon, tue, wed, thu, fri, sat", i, day)
+			}
+			compiled.days[time.Weekday(weekday)] = true
+		}
+	}
+	for i, blackout := range schedule.Blackouts {
+		if blackout.Start.IsZero() || blackout.End.IsZero() {
+			return nil, fmt.Errorf("blackouts[%d]: start and end are required", i)
+		}
+		if !blackout.End.After(blackout.Start) {
+			return nil, fmt.Errorf("blackouts[%d]: end must be after start", i)
+		}
+	}
+	return compiled, nil
+}
+
+/*
+skipReason returns why the rule is not active at the given time, nil when it
+is. Blackout windows win over the active periods.
+
+Parameters:
+  - ruleID: string - The rule the schedule belongs to.
+  - at: time.Time - The time the event occurred, in the location of the tenant.
+
+Returns:
+  - *models.ScheduleSkip: The reason the rule is skipped, nil if it is active.
+*/
+func (s *ruleSchedule) skipReason(ruleID string, at time.Time) *models.ScheduleSkip {
+	if s == nil {
+		return nil
+	}
+	for _, blackout := range s.blackouts {
+		if !at.Before(blackout.Start) && at.Before(blackout.End) {
+			detail := fmt.Sprintf("%s to %s", blackout.Start.Format(time.RFC3339), blackout.End.Format(time.RFC3339))
+			if blackout.Reason != "" {
+				detail = blackout.Reason + ": " + detail
+			}
+			return &models.ScheduleSkip{RuleID: ruleID, Reason: models.SCHEDULE_SKIP_BLACKOUT, Detail: detail}
+		}
+	}
+
+	active := s.days == nil || s.days[at.Weekday()]
+	if active && len(s.active) > 0 {
+		active = false
+		for _, cron := range s.active {
+			if cron.matches(at) {
+				active = true
+				break
+			}
+		}
+	}
+	if active {
+		return nil
+	}
+	return &models.ScheduleSkip{RuleID: ruleID, Reason: models.SCHEDULE_SKIP_INACTIVE,
+		Detail: fmt.Sprintf("%s %s", at.Format("Mon 15:04"), at.Location())}
+}
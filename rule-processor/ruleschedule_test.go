@@ -0,0 +1,229 @@
+package rule_processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+func TestParseCronExpression(t *testing.T) {
+	// Monday 19 October 2026
+	monday := func(hour, minute int) time.Time { return time.Date(2026, 10, 19, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		expression string
+		at         time.Time
+		want       bool
+	}{
+		{"* * * * *", monday(3, 7), true},
+		{"* 9-16 * * mon-fri", monday(9, 0), true},
+		{"* 9-16 * * mon-fri", monday(16, 59), true},
+		{"* 9-16 * * mon-fri", monday(17, 0), false},
+		{"* 9-16 * * mon-fri", monday(10, 0).AddDate(0, 0, 6), false},
+		{"* * * * mon-sun", monday(10, 0).AddDate(0, 0, 6), true},
+		{"* * * * 7", monday(10, 0).AddDate(0, 0, 6), true},
+		{"*/15 * * * *", monday(10, 30), true},
+		{"*/15 * * * *", monday(10, 31), false},
+		{"5/20 * * * *", monday(10, 45), true},
+		{"5/20 * * * *", monday(10, 0), false},
+		{"0,30 8,20 * * *", monday(20, 30), true},
+		{"* * * OCT *", monday(1, 0), true},
+		{"* * * jan-sep *", monday(1, 0), false},
+		{"* * 1 * mon", monday(1, 0), true},                      // day of month or day of week
+		{"* * 1 * tue", monday(1, 0), false},                     // neither
+		{"* * 19 * *", monday(1, 0), true},                       // unrestricted day of week
+		{"* * 1-10 * *", monday(1, 0), false},                    // unrestricted day of week
+		{"* * * * sat,sun", monday(1, 0).AddDate(0, 0, 5), true}, // Saturday
+	}
+	for _, tt := range tests {
+		cron, err := parseCronExpression(tt.expression)
+		if err != nil {
+			t.Fatalf("parseCronExpression(%q) error = %v", tt.expression, err)
+		}
+		if got := cron.matches(tt.at); got != tt.want {
+			t.Errorf("parseCronExpression(%q).matches(%s) = %v, want %v", tt.expression, tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseCronExpression_Errors(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"60 * * * *", "minute: invalid value '60'"},
+		{"* 24 * * *", "hour: invalid value '24'"},
+		{"* * 0 * *", "day of month: invalid value '0'"},
+		{"* * * foo *", "month: invalid value 'foo'"},
+		{"* * * * 8", "day of week: invalid value '8'"},
+		{"* 17-9 * * *", "hour: invalid range '17-9'"},
+		{"*/0 * * * *", "minute: invalid step in '*/0'"},
+	}
+	for _, tt := range tests {
+		if _, err := parseCronExpression(tt.expression); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseCronExpression(%q) error = %v, want %q", tt.expression, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCompileRuleSchedule_Errors(t *testing.T) {
+	start := time.Date(2026, 10, 24, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule models.RuleSchedule
+		wantErr  string
+	}{
+		{"active period", models.RuleSchedule{Active: []string{"* * * * *", "* 9-17"}}, "active[1]: expected 5 fields"},
+		{"day", models.RuleSchedule{Days: []string{"mon", "monday"}}, "days[1]: unknown day 'monday'"},
+		{"blackout without end", models.RuleSchedule{Blackouts: []models.BlackoutWindow{{Start: start}}}, "blackouts[0]: start and end are required"},
+		{"blackout ending before it starts", models.RuleSchedule{Blackouts: []models.BlackoutWindow{{Start: start, End: start}}}, "blackouts[0]: end must be after start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileRuleSchedule(&tt.schedule); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileRuleSchedule() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if schedule, err := compileRuleSchedule(nil); schedule != nil || err != nil {
+		t.Errorf("compileRuleSchedule(nil) = %v, %v, want nil, nil", schedule, err)
+	}
+}
+
+func TestRuleSchedule_SkipReason(t *testing.T) {
+	maintenance := models.BlackoutWindow{
+		Start:  time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC),
+		End:    time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC),
+		Reason: "maintenance",
+	}
+	schedule, err := compileRuleSchedule(&models.RuleSchedule{
+		Active:    []string{"* 9-16 * * *", "0-14 17 * * *"},
+		Days:      []string{"Mon", "tue"},
+		Blackouts: []models.BlackoutWindow{maintenance},
+	})
+	if err != nil {
+		t.Fatalf("compileRuleSchedule() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		at         time.Time
+		wantReason string
+	}{
+		{"business hours", time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), ""},
+		{"second active period", time.Date(2026, 10, 19, 17, 14, 0, 0, time.UTC), ""},
+		{"after hours", time.Date(2026, 10, 19, 17, 15, 0, 0, time.UTC), models.SCHEDULE_SKIP_INACTIVE},
+		{"other day", time.Date(2026, 10, 21, 10, 0, 0, 0, time.UTC), models.SCHEDULE_SKIP_INACTIVE},
+		{"blackout start", maintenance.Start, models.SCHEDULE_SKIP_BLACKOUT},
+		{"blackout end", maintenance.End, ""},
+		{"blackout in another location", maintenance.Start.Add(time.Hour).In(time.FixedZone("UTC+2", 2*60*60)), models.SCHEDULE_SKIP_BLACKOUT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skip := schedule.skipReason("rule1", tt.at)
+			if tt.wantReason == "" {
+				if skip != nil {
+					t.Errorf("skipReason() = %+v, want nil", skip)
+				}
+				return
+			}
+			if skip == nil || skip.Reason != tt.wantReason || skip.RuleID != "rule1" {
+				t.Errorf("skipReason() = %+v, want reason %s", skip, tt.wantReason)
+			}
+		})
+	}
+
+	if skip := schedule.skipReason("rule1", maintenance.Start); skip == nil || !strings.HasPrefix(skip.Detail, "maintenance: 2026-10-20T10:00:00Z") {
+		t.Errorf("skipReason() = %+v, want the blackout window in the detail", skip)
+	}
+	var unscheduled *ruleSchedule
+	if skip := unscheduled.skipReason("rule1", maintenance.Start); skip != nil {
+		t.Errorf("skipReason() of a rule without schedule = %+v, want nil", skip)
+	}
+}
+
+func TestGRuleProcessor_EvaluateSchedule(t *testing.T) {
+	businessHours := diskRule("disk_80_business_hours", "80")
+	businessHours.Priority = 10
+	businessHours.Schedule = &models.RuleSchedule{Active: []string{"* 9-16 * * mon-fri"}}
+	always := diskRule("disk_80", "80")
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {businessHours, always}}}
+	cfg := &FrameworkConfig{TenantTimezones: map[string]string{"tenant_ny": "America/New_York"}}
+	if err := cfg.ValidateTimezones(); err != nil {
+		t.Fatalf("ValidateTimezones() error = %v", err)
+	}
+	processor, _ := newTestProcessor(t, cfg, WithRuleRepository(repo))
+
+	// 14:00 UTC on Monday 19 October 2026 is 10:00 in New York, 22:00 UTC is 18:00
+	tests := []struct {
+		name        string
+		tenantID    string
+		occurredAt  time.Time
+		wantHandled string
+		wantSkipped bool
+	}{
+		{"business hours in UTC", "tenant1", time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC), "disk_80_business_hours", false},
+		{"business hours in New York", "tenant_ny", time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC), "disk_80_business_hours", false},
+		{"after hours in UTC", "tenant1", time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC), "disk_80", true},
+		{"after hours in New York", "tenant_ny", time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC), "disk_80", true},
+		{"after hours in UTC, business hours in New York", "tenant_ny", time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC), "disk_80_business_hours", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := diskEvent(tt.tenantID, 85)
+			event.OccuredAt = tt.occurredAt
+			result, err := processor.DryRun(context.Background(), event, true)
+			if err != nil {
+				t.Fatalf("DryRun() error = %v", err)
+			}
+			if len(result.HandledRuleIDs) != 1 || result.HandledRuleIDs[0] != tt.wantHandled {
+				t.Errorf("HandledRuleIDs = %v, want [%s]", result.HandledRuleIDs, tt.wantHandled)
+			}
+			if got := len(result.ScheduleSkipped) == 1; got != tt.wantSkipped {
+				t.Fatalf("ScheduleSkipped = %+v, want skipped %v", result.ScheduleSkipped, tt.wantSkipped)
+			}
+			if tt.wantSkipped {
+				skip := result.ScheduleSkipped[0]
+				if skip.RuleID != "disk_80_business_hours" || skip.Reason != models.SCHEDULE_SKIP_INACTIVE {
+					t.Errorf("ScheduleSkipped = %+v, want disk_80_business_hours inactive", result.ScheduleSkipped)
+				}
+			}
+		})
+	}
+}
+
+func TestGRuleProcessor_ProcessEventInBlackout(t *testing.T) {
+	maintenance := time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC)
+	rule := diskRule("disk_80", "80")
+	rule.Schedule = &models.RuleSchedule{Blackouts: []models.BlackoutWindow{
+		{Start: maintenance, End: maintenance.Add(time.Hour), Reason: "maintenance"},
+	}}
+	repo := &JsonRuleRepository{rules: map[string][]models.Rule{DEFAULT_TENANT_RULE_ID: {rule}}}
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+
+	// The schedule is checked at the occured_at of the event, not when it is processed
+	tests := []struct {
+		eventSHA   string
+		occurredAt time.Time
+		want       bool
+	}{
+		{"during", maintenance.Add(30 * time.Minute), false},
+		{"after", maintenance.Add(2 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		rawJSON := fmt.Sprintf(`{"tenant_id": "tenant1", "type": "disk_space", "event_sha": %q, "occured_at": %q, "payload": {"Usage": 85}}`,
+			tt.eventSHA, tt.occurredAt.Format(time.RFC3339))
+		handled, err := models.GetEventRegistry().ProcessEvent(context.Background(), processor, []byte(rawJSON))
+		if err != nil {
+			t.Fatalf("ProcessEvent() error = %v", err)
+		}
+		if handled != tt.want {
+			t.Errorf("ProcessEvent() at %s = %v, want %v", tt.occurredAt.Format(time.RFC3339), handled, tt.want)
+		}
+	}
+}
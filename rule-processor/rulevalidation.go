@@ -1,61 +1,50 @@
 package rule_processor
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/SMART2016/go-rule-engine/examples/events"
-
 	"github.com/SMART2016/go-rule-engine/models"
-	"os"
-	"reflect"
 )
 
-// Map event types to their corresponding payload struct.
-var eventPayloadTypes map[string]reflect.Type = map[string]reflect.Type{
-	"disk_space": reflect.TypeOf(events.DiskUsagePayload{}),
-}
-
-// ValidateRules loads rules from a JSON file and validates their `payload_fields`.
-func validateRules(filePath string) error {
-	// Step 1: Read the file
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read rules file: %w", err)
+/*
+validateRulePayloadFields checks that the event type of a rule, and those of
+the events of its correlation sequence, are registered in the EventRegistry,
+then the `payload_fields` of the rule and the Payload fields its condition
+and action reference against the payload struct registered for its event
+type, and those of a correlation against the payload structs of the events
+of its sequence.
+
+Rules of event types registered without a payload struct, e.g. with
+BaseEvent[any], are not checked, there is nothing to check them against.
+*/
+func validateRulePayloadFields(rule models.Rule) RuleValidationErrors {
+	registry := models.GetEventRegistry()
+	var errs RuleValidationErrors
+	if !registry.IsRegistered(rule.EventType) {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_EVENT_TYPE,
+			Message: unknownEventTypeMessage(rule.EventType)})
 	}
-
-	// Step 2: Unmarshal JSON into RuleConfig
-	var ruleConfig models.RuleConfig
-	if err := json.Unmarshal(data, &ruleConfig); err != nil {
-		return fmt.Errorf("failed to parse rules JSON: %w", err)
-	}
-
-	// Step 3: Validate each rule
-	for tenantID, ruleSet := range ruleConfig {
-		for ruleID, rule := range ruleSet {
-			if err := validateRulePayloadFields(rule); err != nil {
-				return fmt.Errorf("tenant: %s, rule: %s, error: %w", tenantID, ruleID, err)
+	if rule.Correlation != nil {
+		for i, step := range rule.Correlation.Sequence {
+			if step.EventType != "" && !registry.IsRegistered(step.EventType) {
+				errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: correlationStepField(i, "event_type"),
+					Message: unknownEventTypeMessage(step.EventType)})
 			}
 		}
 	}
-
-	fmt.Println("All rules validated successfully.")
-	return nil
-}
-
-// validateRulePayloadFields checks if all `payload_fields` exist in the event's payload struct.
-func validateRulePayloadFields(rule models.Rule) error {
-	// Step 1: Get the expected struct type for this event type
-	payloadType, exists := eventPayloadTypes[rule.EventType]
-	if !exists {
-		return fmt.Errorf("unknown event type: %s", rule.EventType)
+	if len(errs) > 0 {
+		return errs
 	}
 
-	// Step 2: Validate each field in `payload_fields`
-	for _, field := range rule.PayloadFields {
-		if _, found := payloadType.FieldByName(field); !found {
-			return fmt.Errorf("invalid field '%s' in payload_fields for event type '%s'", field, rule.EventType)
-		}
+	correlationErrs := correlationFieldErrors(rule, registry.PayloadType)
+	payloadType, exists := registry.PayloadType(rule.EventType)
+	if !exists {
+		return correlationErrs
 	}
+	return append(payloadFieldErrors(rule, payloadType), correlationErrs...)
+}
 
-	return nil
+// unknownEventTypeMessage explains that the event types must be registered before the rules are loaded.
+func unknownEventTypeMessage(eventType string) string {
+	return fmt.Sprintf("unknown event type '%s', it is not registered in the EventRegistry: "+
+		"register the event types before creating the processor or its rule repository", eventType)
 }
@@ -0,0 +1,268 @@
+package rule_processor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/hyperjumptech/grule-rule-engine/pkg"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	RULE_FIELD_RULE_ID    = "rule_id"
+	RULE_FIELD_EVENT_TYPE = "event_type"
+	RULE_FIELD_CONDITION  = "condition"
+	RULE_FIELD_ACTION     = "action"
+
+	RULE_FIELD_PAYLOAD_FIELDS = "payload_fields"
+	RULE_FIELD_LANGUAGE       = "language"
+	RULE_FIELD_CONDITION_TREE = "condition_tree"
+	RULE_FIELD_SCHEDULE       = "schedule"
+	RULE_FIELD_AGGREGATION    = "aggregation"
+	RULE_FIELD_CORRELATION    = "correlation"
+)
+
+// grlSyntaxError matches the errors reported by grule's GruleErrorReporter.
+var grlSyntaxError = regexp.MustCompile(`^grl error on (\d+):(\d+) (.*)$`)
+
+/*
+RuleValidationError describes why a rule cannot be used.
+
+Field names the rule field at fault, Line and Column (both starting at 1)
+locate a GRL syntax error inside that field and are 0 when unknown.
+*/
+type RuleValidationError struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	RuleID   string `json:"rule_id,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e RuleValidationError) Error() string {
+	var location []string
+	if e.TenantID != "" {
+		location = append(location, "tenant: "+e.TenantID)
+	}
+	if e.RuleID != "" {
+		location = append(location, "rule: "+e.RuleID)
+	}
+	if e.Field != "" {
+		field := e.Field
+		if e.Line > 0 {
+			field = fmt.Sprintf("%s %d:%d", field, e.Line, e.Column)
+		}
+		location = append(location, field)
+	}
+	if len(location) == 0 {
+		return e.Message
+	}
+	return strings.Join(location, ", ") + ": " + e.Message
+}
+
+// RuleValidationErrors is the list of everything wrong with one or more rules.
+type RuleValidationErrors []RuleValidationError
+
+func (e RuleValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// orNil returns the errors as an error, nil when there are none.
+func (e RuleValidationErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// tenantIDs returns the tenants of the errors, sorted and without duplicates.
+func (e RuleValidationErrors) tenantIDs() []string {
+	seen := make(map[string]bool, len(e))
+	var tenantIDs []string
+	for _, err := range e {
+		if !seen[err.TenantID] {
+			seen[err.TenantID] = true
+			tenantIDs = append(tenantIDs, err.TenantID)
+		}
+	}
+	sort.Strings(tenantIDs)
+	return tenantIDs
+}
+
+// withTenant sets the tenant of every error.
+func (e RuleValidationErrors) withTenant(tenantID string) RuleValidationErrors {
+	for i := range e {
+		e[i].TenantID = tenantID
+	}
+	return e
+}
+
+/*
+ValidateRule checks a single rule on its own: rule_id and event_type are
+set, its language is known, its condition tree compiles against the
+payload type of its event type, its schedule parses, its aggregation window
+is valid and only aggregation rules reference the Window fact, its
+correlation declares a sequence and a window, its condition, action and the
+conditions of its sequence compile with the Evaluator of the language (GRL
+by default) and, when the payload types of its event types are known, its
+payload_fields, the Payload fields it references, the fields it aggregates
+and its join_on field exist. Disabled rules only need a rule_id.
+
+The languages known are grl, expr and those of the given evaluators, the
+evaluators added to the processor with WithEvaluator.
+
+Returns every problem found, syntax errors are located in the condition or
+action of the rule. It returns nil if the rule is valid.
+*/
+func ValidateRule(rule models.Rule, evaluators ...Evaluator) RuleValidationErrors {
+	return validateRule(rule, newEvaluatorSet(evaluators...))
+}
+
+// validateRule checks a rule as ValidateRule does, with the evaluators of the set.
+func validateRule(rule models.Rule, evaluators evaluatorSet) RuleValidationErrors {
+	var errs RuleValidationErrors
+	if rule.RuleId == "" {
+		errs = append(errs, RuleValidationError{Field: RULE_FIELD_RULE_ID, Message: "rule_id cannot be empty"})
+	} else if !isGRLIdentifier(rule.RuleId) {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_RULE_ID,
+			Message: "rule_id must start with a letter or underscore and contain only letters, digits and underscores"})
+	}
+	if rule.Disabled || len(errs) > 0 {
+		return errs
+	}
+	if rule.EventType == "" {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_EVENT_TYPE, Message: "event_type cannot be empty"})
+	}
+	// A rule whose condition tree does not compile keeps it, the problems of the tree are reported instead.
+	rule, treeErrs := expandRegisteredConditionTree(rule)
+	errs = append(errs, treeErrs...)
+	if rule.ConditionTree == nil && strings.TrimSpace(rule.Condition) == "" {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_CONDITION, Message: "condition cannot be empty"})
+	}
+	if rule.ConditionTree == nil && strings.TrimSpace(rule.Action) == "" {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_ACTION, Message: "action cannot be empty"})
+	}
+	if _, err := compileRuleSchedule(rule.Schedule); err != nil {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_SCHEDULE, Message: err.Error()})
+	}
+	if _, err := compileRuleAggregation(rule.Aggregation); err != nil {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_AGGREGATION, Message: err.Error()})
+	}
+	if _, err := compileRuleCorrelation(rule.Correlation); err != nil {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_CORRELATION, Message: err.Error()})
+	}
+	if rule.Aggregation != nil && rule.Correlation != nil {
+		errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_CORRELATION, Message: errAggregatedCorrelation.Error()})
+	}
+	if rule.Aggregation == nil {
+		fields := []struct{ name, expression string }{
+			{RULE_FIELD_CONDITION, rule.Condition},
+			{RULE_FIELD_ACTION, rule.Action},
+		}
+		if rule.Correlation != nil {
+			for i, step := range rule.Correlation.Sequence {
+				fields = append(fields, struct{ name, expression string }{correlationStepField(i, RULE_FIELD_CONDITION), step.Condition})
+			}
+		}
+		for _, field := range fields {
+			if windowReference.MatchString(field.expression) {
+				errs = append(errs, RuleValidationError{RuleID: rule.RuleId, Field: field.name,
+					Message: "Window is only available to aggregation rules, set the aggregation of the rule"})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	evaluator, err := evaluators.forRule(rule)
+	if err != nil {
+		return append(errs, RuleValidationError{RuleID: rule.RuleId, Field: RULE_FIELD_LANGUAGE, Message: err.Error()})
+	}
+	languageErrs := append(evaluator.Validate(rule), correlationStepErrors(evaluator, rule)...)
+	if len(languageErrs) > 0 {
+		return append(errs, languageErrs...)
+	}
+	return append(errs, validateRulePayloadFields(rule)...)
+}
+
+// grlValidationErrors converts the error of compiling a rule into RuleValidationErrors.
+func grlValidationErrors(rule models.Rule, err error) RuleValidationErrors {
+	var reporter *pkg.GruleErrorReporter
+	if !errors.As(err, &reporter) {
+		return RuleValidationErrors{{RuleID: rule.RuleId, Message: err.Error()}}
+	}
+
+	errs := make(RuleValidationErrors, 0, len(reporter.Errors))
+	for _, grlErr := range reporter.Errors {
+		validationErr := RuleValidationError{RuleID: rule.RuleId, Message: grlErr.Error()}
+		if match := grlSyntaxError.FindStringSubmatch(grlErr.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			column, _ := strconv.Atoi(match[2])
+			validationErr.Field, validationErr.Line, validationErr.Column = grlPosition(rule, line, column)
+			validationErr.Message = match[3]
+		}
+		errs = append(errs, validationErr)
+	}
+	return errs
+}
+
+/*
+grlPosition maps a position in the GRL generated by ruleToGRL back to the
+rule field it came from.
+
+It mirrors the layout of ruleToGRL: the condition starts on line 4 after
+the Rules.IsActive guard and the action starts on the line following the
+"then" keyword, both indented by 5 tabs. ANTLR columns start at 0.
+*/
+func grlPosition(rule models.Rule, line, column int) (string, int, int) {
+	const indent = len("\t\t\t\t\t")
+	conditionStart := 4
+	conditionLines := strings.Count(rule.Condition, "\n") + 1
+	actionStart := conditionStart + conditionLines + 1
+	actionLines := strings.Count(strings.TrimSpace(rule.Action), "\n") + 1
+
+	fieldPosition := func(start, prefix int) (int, int) {
+		fieldLine := line - start + 1
+		if fieldLine == 1 {
+			column -= prefix
+		}
+		if column < 0 {
+			column = 0
+		}
+		return fieldLine, column + 1
+	}
+
+	switch {
+	case line >= conditionStart && line < conditionStart+conditionLines:
+		guard := len(fmt.Sprintf(`%s.IsActive("%s") && (`, RULES_FACT_NAME, rule.RuleId))
+		fieldLine, fieldColumn := fieldPosition(conditionStart, indent+guard)
+		return RULE_FIELD_CONDITION, fieldLine, fieldColumn
+	case line >= actionStart && line < actionStart+actionLines:
+		fieldLine, fieldColumn := fieldPosition(actionStart, indent)
+		return RULE_FIELD_ACTION, fieldLine, fieldColumn
+	default:
+		return "", 0, 0
+	}
+}
+
+// isGRLIdentifier reports whether the rule_id can be used as a GRL rule name.
+func isGRLIdentifier(name string) bool {
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
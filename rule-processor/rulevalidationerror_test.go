@@ -0,0 +1,138 @@
+package rule_processor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+func TestValidateRule(t *testing.T) {
+	models.GetEventRegistry().RegisterEventType("untyped_cpu", func() models.Evaluable { return &models.BaseEvent[any]{} })
+
+	tests := []struct {
+		name       string
+		rule       models.Rule
+		wantField  string
+		wantLine   int
+		wantColumn int
+	}{
+		{name: "valid", rule: diskRule("disk_80", "80")},
+		{name: "disabled override", rule: models.Rule{RuleId: "disk_80", Disabled: true}},
+		{name: "missing rule_id", rule: models.Rule{EventType: "disk_space"}, wantField: RULE_FIELD_RULE_ID},
+		{name: "rule_id is not a GRL name", rule: diskRule("disk-80", "80"), wantField: RULE_FIELD_RULE_ID},
+		{name: "missing event_type", rule: models.Rule{RuleId: "disk_80", Condition: "true", Action: "Retract(\"disk_80\")"}, wantField: RULE_FIELD_EVENT_TYPE},
+		{name: "missing action", rule: models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "true"}, wantField: RULE_FIELD_ACTION},
+		{
+			name:       "condition syntax error",
+			rule:       models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= ", Action: "Event.ShouldHandle = true"},
+			wantField:  RULE_FIELD_CONDITION,
+			wantLine:   1,
+			wantColumn: 18,
+		},
+		{
+			name:       "multi-line condition syntax error",
+			rule:       models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= 80 &&\n  Payload.Usage <=", Action: "Event.ShouldHandle = true"},
+			wantField:  RULE_FIELD_CONDITION,
+			wantLine:   2,
+			wantColumn: 19,
+		},
+		{
+			name:       "action syntax error",
+			rule:       models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle = = true"},
+			wantField:  RULE_FIELD_ACTION,
+			wantLine:   1,
+			wantColumn: 22,
+		},
+		{
+			name:      "unknown payload field",
+			rule:      models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Used >= 80", Action: "Event.ShouldHandle = true"},
+			wantField: RULE_FIELD_CONDITION,
+		},
+		{
+			name:      "unknown payload_fields entry",
+			rule:      models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle = true", PayloadFields: []string{"Size"}},
+			wantField: RULE_FIELD_PAYLOAD_FIELDS,
+		},
+		{
+			name:      "unknown language",
+			rule:      models.Rule{RuleId: "disk_80", EventType: "disk_space", Language: "cel", Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle = true"},
+			wantField: RULE_FIELD_LANGUAGE,
+		},
+		{
+			name: "valid expr rule",
+			rule: models.Rule{RuleId: "disk_80", EventType: "disk_space", Language: models.RULE_LANGUAGE_EXPR, Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle = true"},
+		},
+		{
+			name:       "expr condition syntax error",
+			rule:       models.Rule{RuleId: "disk_80", EventType: "disk_space", Language: models.RULE_LANGUAGE_EXPR, Condition: "Payload.Usage >= 80 &&\n  Payload.Usage <=", Action: "Event.ShouldHandle = true"},
+			wantField:  RULE_FIELD_CONDITION,
+			wantLine:   2,
+			wantColumn: 18,
+		},
+		{
+			name:       "expr action syntax error",
+			rule:       models.Rule{RuleId: "disk_80", EventType: "disk_space", Language: models.RULE_LANGUAGE_EXPR, Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle == true"},
+			wantField:  RULE_FIELD_ACTION,
+			wantLine:   1,
+			wantColumn: 20,
+		},
+		{
+			name:       "expr unknown payload field",
+			rule:       models.Rule{RuleId: "disk_80", EventType: "disk_space", Language: models.RULE_LANGUAGE_EXPR, Condition: "Payload.Used >= 80", Action: "Event.ShouldHandle = true"},
+			wantField:  RULE_FIELD_CONDITION,
+			wantLine:   1,
+			wantColumn: 9,
+		},
+		{
+			name: "invalid schedule",
+			rule: models.Rule{RuleId: "disk_80", EventType: "disk_space", Condition: "Payload.Usage >= 80", Action: "Event.ShouldHandle = true",
+				Schedule: &models.RuleSchedule{Active: []string{"* 25 * * *"}}},
+			wantField: RULE_FIELD_SCHEDULE,
+		},
+		{
+			name:      "unknown event type",
+			rule:      models.Rule{RuleId: "cpu_90", EventType: "cpu", Condition: "Payload.Load >= 0.9", Action: "Event.ShouldHandle = true"},
+			wantField: RULE_FIELD_EVENT_TYPE,
+		},
+		{
+			name: "payload of an event type without a payload struct",
+			rule: models.Rule{RuleId: "cpu_90", EventType: "untyped_cpu", Condition: "Payload.Load >= 0.9", Action: "Event.ShouldHandle = true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateRule(tt.rule)
+			if tt.wantField == "" {
+				if len(errs) != 0 {
+					t.Fatalf("ValidateRule() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatal("ValidateRule() expected errors")
+			}
+			got := errs[0]
+			if got.Field != tt.wantField || got.Line != tt.wantLine || got.Column != tt.wantColumn {
+				t.Errorf("ValidateRule() = %+v, want field %s at %d:%d", got, tt.wantField, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
+
+func TestValidateTenantRules(t *testing.T) {
+	err := ValidateTenantRules(map[string][]models.Rule{
+		"tenant1": {diskRule("disk_80", "80"), diskRule("disk_80", "90"), diskRule("disk_95", "")},
+	})
+	var errs RuleValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("ValidateTenantRules() = %v", err)
+	}
+	if errs[0].TenantID != "tenant1" || errs[0].Message != "duplicate rule_id" || errs[1].RuleID != "disk_95" {
+		t.Errorf("ValidateTenantRules() = %+v", errs)
+	}
+	if err := ValidateTenantRules(map[string][]models.Rule{"tenant1": {diskRule("disk_80", "80")}}); err != nil {
+		t.Errorf("ValidateTenantRules() of valid rules = %v", err)
+	}
+}
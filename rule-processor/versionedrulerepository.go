@@ -0,0 +1,494 @@
+package rule_processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRuleSetRevisionNotFound is returned when a tenant has no revision with the requested ID.
+	ErrRuleSetRevisionNotFound = errors.New("rule set revision not found")
+	// ErrNoActiveRuleSetRevision is returned when rolling back a tenant without an active revision.
+	ErrNoActiveRuleSetRevision = errors.New("tenant has no active rule set revision")
+	// ErrNoPreviousRuleSetRevision is returned when rolling back a tenant whose active revision is the first it activated.
+	ErrNoPreviousRuleSetRevision = errors.New("tenant has no revision active before the active one")
+)
+
+// activeRuleSet is the cached active revision of a tenant.
+type activeRuleSet struct {
+	revisionID int64
+	rules      []models.Rule
+}
+
+/*
+VersionedRuleRepository is a RevisionedRuleRepository keeping the rule set
+revisions of every tenant in the rule_set_revisions table, and the history
+of their activations in the rule_set_activations table.
+
+Revisions are immutable, a bad rule set is undone by activating an earlier
+revision. The active rule sets are served from an in-memory cache, Refresh
+reloads it and Watch refreshes it periodically so every engine instance
+switches to a newly activated revision.
+*/
+type VersionedRuleRepository struct {
+	active       map[string]activeRuleSet
+	mu           sync.RWMutex
+	ruleSetStore RuleSetStore
+	connectDB    DBConnector
+	hash         [sha256.Size]byte
+	generation   uint64
+	evaluators   []Evaluator
+}
+
+/*
+NewVersionedRuleRepository creates a VersionedRuleRepository and loads the
+active rule sets.
+
+Parameters:
+  - ctx: context.Context - The context of the initial load.
+  - connectDB: DBConnector - Opens the connections used to read and write the revisions.
+  - ruleSetStore: RuleSetStore - The queries on the revision tables, store.New() when nil.
+  - evaluators: ...Evaluator - The evaluators of rule languages other than grl and expr, see ValidateRule.
+
+Returns:
+  - *VersionedRuleRepository: The repository serving the active rule sets.
+  - error: If the active rule sets cannot be read or are invalid.
+*/
+func NewVersionedRuleRepository(ctx context.Context, connectDB DBConnector, ruleSetStore RuleSetStore, evaluators ...Evaluator) (*VersionedRuleRepository, error) {
+	if ruleSetStore == nil {
+		ruleSetStore = store.New()
+	}
+	repo := &VersionedRuleRepository{ruleSetStore: ruleSetStore, connectDB: connectDB, evaluators: evaluators}
+	if _, err := repo.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+/*
+Refresh reloads the active rule set of every tenant from the database.
+
+Revisions are immutable, so the cache is only rebuilt when a tenant
+activated another revision. The rules are decoded and validated before the
+cache is swapped under the repository lock.
+
+Failures are scoped per tenant: a tenant whose active revision is invalid
+keeps its last good revision while the other tenants are refreshed, and the
+returned RuleValidationErrors name the tenants and revisions that were
+rejected. Revisions rejected by a previous refresh are not reported again.
+The initial load fails if any active revision is invalid.
+
+Returns whether the cached rules changed.
+*/
+func (r *VersionedRuleRepository) Refresh(ctx context.Context) (bool, error) {
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return false, fmt.Errorf("[VersionedRuleRepository.Refresh]: failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	rows, err := r.ruleSetStore.ListActiveRuleSets(ctx, db)
+	if err != nil {
+		return false, fmt.Errorf("[VersionedRuleRepository.Refresh]: failed to list the active rule sets: %w", err)
+	}
+	hash := activeRuleSetsHash(rows)
+
+	r.mu.RLock()
+	loaded := r.active != nil
+	unchanged := loaded && hash == r.hash
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	active, rejected := r.decodeActiveRuleSets(rows)
+	if len(rejected) > 0 && !loaded {
+		return false, fmt.Errorf("[VersionedRuleRepository.Refresh]: invalid rules: %w", rejected)
+	}
+	changed := r.swap(active, rejected, hash)
+	if len(rejected) > 0 {
+		return changed, fmt.Errorf("[VersionedRuleRepository.Refresh]: invalid rules, keeping the cached revisions of their tenants: %w", rejected)
+	}
+	return changed, nil
+}
+
+// activeRuleSetsHash identifies the active revision of every tenant.
+func activeRuleSetsHash(rows []*store.ListActiveRuleSetsRow) [sha256.Size]byte {
+	digest := sha256.New()
+	for _, row := range rows {
+		fmt.Fprintf(digest, "%s\x00%d\x00", row.TenantID, row.RevisionID)
+	}
+	var hash [sha256.Size]byte
+	copy(hash[:], digest.Sum(nil))
+	return hash
+}
+
+// decodeActiveRuleSets decodes the active rule sets and validates them per tenant, the tenants with an invalid revision are left out.
+func (r *VersionedRuleRepository) decodeActiveRuleSets(rows []*store.ListActiveRuleSetsRow) (map[string]activeRuleSet, RuleValidationErrors) {
+	var rejected RuleValidationErrors
+	active := make(map[string]activeRuleSet, len(rows))
+	for _, row := range rows {
+		var rules []models.Rule
+		if err := json.Unmarshal(row.Rules, &rules); err != nil {
+			rejected = append(rejected, RuleValidationError{TenantID: row.TenantID,
+				Message: fmt.Sprintf("revision %d: invalid rules: %v", row.RevisionID, err)})
+			continue
+		}
+		err := ValidateTenantRules(map[string][]models.Rule{row.TenantID: rules}, r.evaluators...)
+		var errs RuleValidationErrors
+		if errors.As(err, &errs) {
+			rejected = append(rejected, errs...)
+			continue
+		} else if err != nil {
+			rejected = append(rejected, RuleValidationError{TenantID: row.TenantID, Message: fmt.Sprintf("revision %d: %v", row.RevisionID, err)})
+			continue
+		}
+		active[row.TenantID] = activeRuleSet{revisionID: row.RevisionID, rules: rules}
+	}
+	return active, rejected
+}
+
+/*
+swap replaces the cached active rule sets, the tenants whose revision was
+rejected keep their cached revision. Returns whether the cache changed.
+*/
+func (r *VersionedRuleRepository) swap(active map[string]activeRuleSet, rejected RuleValidationErrors, hash [sha256.Size]byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tenantID := range rejected.tenantIDs() {
+		if cached, ok := r.active[tenantID]; ok {
+			active[tenantID] = cached
+		}
+	}
+	changed := !reflect.DeepEqual(active, r.active)
+	r.active, r.hash = active, hash
+	if changed {
+		r.generation++
+	}
+	return changed
+}
+
+// Generation returns a counter incremented every time the cached active rule sets are replaced.
+func (r *VersionedRuleRepository) Generation() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generation
+}
+
+/*
+Watch refreshes the active rule sets every interval until the context is
+done.
+
+onReload, when not nil, is called after every refresh that changed the
+rules (with a nil error) or failed.
+*/
+func (r *VersionedRuleRepository) Watch(ctx context.Context, interval time.Duration, onReload func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshed, err := r.Refresh(ctx)
+			if err != nil {
+				log.Printf("[VersionedRuleRepository.Watch]: %v", err)
+			}
+			if onReload != nil && (refreshed || err != nil) {
+				onReload(err)
+			}
+		}
+	}
+}
+
+/*
+CreateRevision validates and stores a new revision of the rule set of a
+tenant. The revision is not activated, see ActivateRevision.
+
+Parameters:
+  - ctx: context.Context - A context to manage cancellation and deadlines.
+  - tenantID: string - The tenant owning the rule set.
+  - rules: []models.Rule - The complete rule set of the tenant.
+  - author: string - Who created the revision, required.
+  - comment: string - Why the rules changed.
+
+Returns:
+  - *models.RuleSetRevision: The stored revision.
+  - error: If the rules are invalid or cannot be stored.
+*/
+func (r *VersionedRuleRepository) CreateRevision(ctx context.Context, tenantID string, rules []models.Rule, author, comment string) (*models.RuleSetRevision, error) {
+	if tenantID == "" {
+		return nil, errors.New("[VersionedRuleRepository.CreateRevision]: tenant_id cannot be empty")
+	}
+	if strings.TrimSpace(author) == "" {
+		return nil, errors.New("[VersionedRuleRepository.CreateRevision]: author cannot be empty")
+	}
+	if rules == nil {
+		rules = []models.Rule{}
+	}
+	if err := ValidateTenantRules(map[string][]models.Rule{tenantID: rules}, r.evaluators...); err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.CreateRevision]: %w", err)
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.CreateRevision]: failed to encode the rules: %w", err)
+	}
+
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.CreateRevision]: failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	row, err := r.ruleSetStore.CreateRuleSetRevision(ctx, db, store.CreateRuleSetRevisionParams{
+		TenantID: tenantID,
+		Rules:    encoded,
+		Author:   author,
+		Comment:  comment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.CreateRevision]: failed to store the revision: %w", err)
+	}
+	return r.toRevision(row)
+}
+
+// ListRevisions returns the revisions of a tenant, newest first.
+func (r *VersionedRuleRepository) ListRevisions(ctx context.Context, tenantID string) ([]models.RuleSetRevision, error) {
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.ListRevisions]: failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	rows, err := r.ruleSetStore.ListRuleSetRevisions(ctx, db, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.ListRevisions]: failed to list the revisions: %w", err)
+	}
+	revisions := make([]models.RuleSetRevision, 0, len(rows))
+	for _, row := range rows {
+		revision, err := r.toRevision(row)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+	return revisions, nil
+}
+
+/*
+ActivateRevision makes a revision the active rule set of a tenant and
+refreshes the cache. Other engine instances switch on their next refresh.
+*/
+func (r *VersionedRuleRepository) ActivateRevision(ctx context.Context, tenantID string, revisionID int64, author string) (*models.RuleSetRevision, error) {
+	revision, err := r.activate(ctx, author, func(tx store.DBTX) (*store.RuleSetRevision, error) {
+		row, err := r.ruleSetStore.GetRuleSetRevision(ctx, tx, store.GetRuleSetRevisionParams{TenantID: tenantID, ID: revisionID})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("tenant: %s, revision: %d: %w", tenantID, revisionID, ErrRuleSetRevisionNotFound)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read revision %d: %w", revisionID, err)
+		}
+		return row, nil
+	}, func(tx store.DBTX) error {
+		return r.ruleSetStore.CreateRuleSetActivation(ctx, tx, store.CreateRuleSetActivationParams{
+			TenantID:    tenantID,
+			RevisionID:  revisionID,
+			ActivatedBy: author,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.ActivateRevision]: %w", err)
+	}
+	return revision, nil
+}
+
+/*
+Rollback re-activates the revision that was active before the active
+revision of a tenant and refreshes the cache. The activations it undoes are
+marked as rolled back, so rolling back again keeps going back in the
+activation history.
+
+The active revision and the activation history are read in the transaction
+of the rollback, under the lock of the tenant's active rule set, so
+concurrent rollbacks and activations of the tenant are serialized.
+
+Returns the activated revision, or ErrNoActiveRuleSetRevision and
+ErrNoPreviousRuleSetRevision when there is nothing to roll back to.
+*/
+func (r *VersionedRuleRepository) Rollback(ctx context.Context, tenantID, author string) (*models.RuleSetRevision, error) {
+	var previous *store.RuleSetActivation
+	revision, err := r.activate(ctx, author, func(tx store.DBTX) (*store.RuleSetRevision, error) {
+		current, err := r.ruleSetStore.LockActiveRuleSet(ctx, tx, tenantID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("tenant: %s: %w", tenantID, ErrNoActiveRuleSetRevision)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock the active rule set: %w", err)
+		}
+		activations, err := r.ruleSetStore.ListRuleSetActivations(ctx, tx, tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the activations: %w", err)
+		}
+		// The newest activation of another revision, the ones after it activated the active revision
+		for _, activation := range activations {
+			if activation.RevisionID != current {
+				previous = activation
+				break
+			}
+		}
+		if previous == nil {
+			return nil, fmt.Errorf("tenant: %s, revision: %d: %w", tenantID, current, ErrNoPreviousRuleSetRevision)
+		}
+		row, err := r.ruleSetStore.GetRuleSetRevision(ctx, tx, store.GetRuleSetRevisionParams{TenantID: tenantID, ID: previous.RevisionID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read revision %d: %w", previous.RevisionID, err)
+		}
+		return row, nil
+	}, func(tx store.DBTX) error {
+		return r.ruleSetStore.RollBackRuleSetActivations(ctx, tx, store.RollBackRuleSetActivationsParams{TenantID: tenantID, ID: previous.ID})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[VersionedRuleRepository.Rollback]: %w", err)
+	}
+	return revision, nil
+}
+
+/*
+activate stores a revision as the active rule set of its tenant and
+refreshes the cache. choose reads the revision to activate, record writes
+the activation history: a new activation, or the activations undone by a
+rollback.
+
+Choosing the revision, validating its rules, the activation, its history
+and the reload of the active rule sets share one transaction. It is rolled
+back when the revision is invalid so the database and the cache never
+disagree, the invalid revisions of other tenants keep their cached
+revision as in Refresh.
+*/
+func (r *VersionedRuleRepository) activate(ctx context.Context, author string, choose func(tx store.DBTX) (*store.RuleSetRevision, error),
+	record func(tx store.DBTX) error) (*models.RuleSetRevision, error) {
+	if strings.TrimSpace(author) == "" {
+		return nil, errors.New("author cannot be empty")
+	}
+	db, release, err := r.connectDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	defer release()
+
+	var revision *models.RuleSetRevision
+	var active map[string]activeRuleSet
+	var rejected RuleValidationErrors
+	var hash [sha256.Size]byte
+	err = inTransaction(ctx, db, func(tx store.DBTX) error {
+		row, err := choose(tx)
+		if err != nil {
+			return err
+		}
+		if revision, err = r.toRevision(row); err != nil {
+			return err
+		}
+		if err := ValidateTenantRules(map[string][]models.Rule{row.TenantID: revision.Rules}, r.evaluators...); err != nil {
+			return fmt.Errorf("revision %d: %w", row.ID, err)
+		}
+		if err := r.ruleSetStore.ActivateRuleSetRevision(ctx, tx, store.ActivateRuleSetRevisionParams{
+			TenantID:    row.TenantID,
+			RevisionID:  row.ID,
+			ActivatedBy: author,
+		}); err != nil {
+			return fmt.Errorf("failed to activate revision %d: %w", row.ID, err)
+		}
+		if err := record(tx); err != nil {
+			return fmt.Errorf("failed to record the activation of revision %d: %w", row.ID, err)
+		}
+		rows, err := r.ruleSetStore.ListActiveRuleSets(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to list the active rule sets: %w", err)
+		}
+		hash = activeRuleSetsHash(rows)
+		active, rejected = r.decodeActiveRuleSets(rows)
+		if _, ok := active[row.TenantID]; !ok {
+			return fmt.Errorf("revision %d: invalid rules: %w", row.ID, rejected)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.swap(active, rejected, hash)
+	if len(rejected) > 0 {
+		log.Printf("[VersionedRuleRepository.activate]: invalid rules, keeping the cached revisions of their tenants: %v", rejected)
+	}
+	revision.Active = true
+	return revision, nil
+}
+
+// toRevision decodes a stored revision, marking it active if it is the cached active revision of its tenant.
+func (r *VersionedRuleRepository) toRevision(row *store.RuleSetRevision) (*models.RuleSetRevision, error) {
+	var rules []models.Rule
+	if err := json.Unmarshal(row.Rules, &rules); err != nil {
+		return nil, fmt.Errorf("tenant: %s, revision: %d, invalid rules: %w", row.TenantID, row.ID, err)
+	}
+	r.mu.RLock()
+	active, ok := r.active[row.TenantID]
+	r.mu.RUnlock()
+
+	return &models.RuleSetRevision{
+		ID:        row.ID,
+		TenantID:  row.TenantID,
+		Rules:     rules,
+		Author:    row.Author,
+		Comment:   row.Comment,
+		CreatedAt: row.CreatedAt.Time,
+		Active:    ok && active.revisionID == row.ID,
+	}, nil
+}
+
+/*
+GetRules retrieves the effective rules of a tenant for an event type from
+the active rule sets, the tenant's rules layered on top of the
+DEFAULT_TENANT_RULE_ID rules, see ResolveTenantRules.
+*/
+func (r *VersionedRuleRepository) GetRules(tenantID, eventType string) ([]models.Rule, error) {
+	rules, _, err := r.GetRulesWithRevisions(tenantID, eventType)
+	return rules, err
+}
+
+// GetRulesWithRevisions is GetRules, also returning the active revisions the rules were read from.
+func (r *VersionedRuleRepository) GetRulesWithRevisions(tenantID, eventType string) ([]models.Rule, models.ActiveRevisions, error) {
+	effective, revisions := r.effectiveRules(tenantID)
+	return filterRulesByEventType(effective, eventType), revisions, nil
+}
+
+// GetEffectiveRules returns the rules of the active rule sets that apply to a tenant for every event type.
+func (r *VersionedRuleRepository) GetEffectiveRules(tenantID string) ([]models.Rule, error) {
+	effective, _ := r.effectiveRules(tenantID)
+	return effective, nil
+}
+
+// effectiveRules layers the active rule set of the tenant on the default one, reading both under one lock.
+func (r *VersionedRuleRepository) effectiveRules(tenantID string) ([]models.Rule, models.ActiveRevisions) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defaults := r.active[DEFAULT_TENANT_RULE_ID]
+	revisions := models.ActiveRevisions{DefaultRevisionID: defaults.revisionID}
+	if tenantID == DEFAULT_TENANT_RULE_ID {
+		revisions.TenantRevisionID = defaults.revisionID
+		return ResolveTenantRules(defaults.rules, nil), revisions
+	}
+	tenant := r.active[tenantID]
+	revisions.TenantRevisionID = tenant.revisionID
+	return ResolveTenantRules(defaults.rules, tenant.rules), revisions
+}
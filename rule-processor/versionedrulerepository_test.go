@@ -0,0 +1,412 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// memoryRuleSetStore is an in-memory RuleSetStore behaving like the revision tables.
+type memoryRuleSetStore struct {
+	mu          sync.Mutex
+	revisions   []*store.RuleSetRevision
+	active      map[string]store.ActiveRuleSet
+	activations []*store.RuleSetActivation
+	// queriedIn is the connection of the last call of every method.
+	queriedIn map[string]store.DBTX
+}
+
+func newMemoryRuleSetStore() *memoryRuleSetStore {
+	return &memoryRuleSetStore{active: make(map[string]store.ActiveRuleSet), queriedIn: make(map[string]store.DBTX)}
+}
+
+func (s *memoryRuleSetStore) CreateRuleSetRevision(ctx context.Context, db store.DBTX, arg store.CreateRuleSetRevisionParams) (*store.RuleSetRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row := &store.RuleSetRevision{
+		ID:        int64(len(s.revisions) + 1),
+		TenantID:  arg.TenantID,
+		Rules:     arg.Rules,
+		Author:    arg.Author,
+		Comment:   arg.Comment,
+		CreatedAt: pgtype.Timestamp{Valid: true},
+	}
+	s.revisions = append(s.revisions, row)
+	return row, nil
+}
+
+func (s *memoryRuleSetStore) GetRuleSetRevision(ctx context.Context, db store.DBTX, arg store.GetRuleSetRevisionParams) (*store.RuleSetRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range s.revisions {
+		if row.TenantID == arg.TenantID && row.ID == arg.ID {
+			return row, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (s *memoryRuleSetStore) ListRuleSetRevisions(ctx context.Context, db store.DBTX, tenantID string) ([]*store.RuleSetRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []*store.RuleSetRevision
+	for i := len(s.revisions) - 1; i >= 0; i-- {
+		if s.revisions[i].TenantID == tenantID {
+			rows = append(rows, s.revisions[i])
+		}
+	}
+	return rows, nil
+}
+
+func (s *memoryRuleSetStore) ActivateRuleSetRevision(ctx context.Context, db store.DBTX, arg store.ActivateRuleSetRevisionParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[arg.TenantID] = store.ActiveRuleSet{TenantID: arg.TenantID, RevisionID: arg.RevisionID, ActivatedBy: arg.ActivatedBy}
+	return nil
+}
+
+func (s *memoryRuleSetStore) LockActiveRuleSet(ctx context.Context, db store.DBTX, tenantID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queriedIn["LockActiveRuleSet"] = db
+	active, ok := s.active[tenantID]
+	if !ok {
+		return 0, pgx.ErrNoRows
+	}
+	return active.RevisionID, nil
+}
+
+func (s *memoryRuleSetStore) ListActiveRuleSets(ctx context.Context, db store.DBTX) ([]*store.ListActiveRuleSetsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []*store.ListActiveRuleSetsRow
+	for tenantID, active := range s.active {
+		rows = append(rows, &store.ListActiveRuleSetsRow{
+			TenantID:   tenantID,
+			RevisionID: active.RevisionID,
+			Rules:      s.revisions[active.RevisionID-1].Rules,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].TenantID < rows[j].TenantID })
+	return rows, nil
+}
+
+func (s *memoryRuleSetStore) CreateRuleSetActivation(ctx context.Context, db store.DBTX, arg store.CreateRuleSetActivationParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activations = append(s.activations, &store.RuleSetActivation{
+		ID:          int64(len(s.activations) + 1),
+		TenantID:    arg.TenantID,
+		RevisionID:  arg.RevisionID,
+		ActivatedBy: arg.ActivatedBy,
+		ActivatedAt: pgtype.Timestamp{Valid: true},
+	})
+	return nil
+}
+
+func (s *memoryRuleSetStore) ListRuleSetActivations(ctx context.Context, db store.DBTX, tenantID string) ([]*store.RuleSetActivation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queriedIn["ListRuleSetActivations"] = db
+	var rows []*store.RuleSetActivation
+	for i := len(s.activations) - 1; i >= 0; i-- {
+		if row := s.activations[i]; row.TenantID == tenantID && !row.RolledBackAt.Valid {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (s *memoryRuleSetStore) RollBackRuleSetActivations(ctx context.Context, db store.DBTX, arg store.RollBackRuleSetActivationsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range s.activations {
+		if row.TenantID == arg.TenantID && row.ID > arg.ID && !row.RolledBackAt.Valid {
+			row.RolledBackAt = pgtype.Timestamp{Valid: true}
+		}
+	}
+	return nil
+}
+
+func newTestVersionedRuleRepository(t *testing.T) (*VersionedRuleRepository, *memoryRuleSetStore) {
+	t.Helper()
+	ruleSetStore := newMemoryRuleSetStore()
+	repo, err := NewVersionedRuleRepository(context.Background(), NoDBConnector, ruleSetStore)
+	if err != nil {
+		t.Fatalf("NewVersionedRuleRepository() error = %v", err)
+	}
+	return repo, ruleSetStore
+}
+
+func TestVersionedRuleRepository_ActivateAndRollback(t *testing.T) {
+	ctx := context.Background()
+	repo, ruleSetStore := newTestVersionedRuleRepository(t)
+
+	first, err := repo.CreateRevision(ctx, "tenant1", []models.Rule{diskRule("disk_80", "80")}, "alice", "initial rules")
+	if err != nil {
+		t.Fatalf("CreateRevision() error = %v", err)
+	}
+	if first.Active || first.Author != "alice" || first.Comment != "initial rules" {
+		t.Errorf("CreateRevision() = %+v", first)
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); len(rules) != 0 {
+		t.Errorf("a created revision was used before activation: %v", ruleIDs(rules))
+	}
+
+	if _, err := repo.ActivateRevision(ctx, "tenant1", first.ID, "alice"); err != nil {
+		t.Fatalf("ActivateRevision() error = %v", err)
+	}
+	second, err := repo.CreateRevision(ctx, "tenant1", []models.Rule{diskRule("disk_90", "90")}, "bob", "raise threshold")
+	if err != nil {
+		t.Fatalf("CreateRevision() error = %v", err)
+	}
+	activated, err := repo.ActivateRevision(ctx, "tenant1", second.ID, "bob")
+	if err != nil || !activated.Active {
+		t.Fatalf("ActivateRevision() = %+v, %v", activated, err)
+	}
+	rules, revisions, _ := repo.GetRulesWithRevisions("tenant1", "disk_space")
+	if !reflect.DeepEqual(ruleIDs(rules), []string{"disk_90"}) || revisions.TenantRevisionID != second.ID {
+		t.Errorf("GetRulesWithRevisions() = %v, %+v", ruleIDs(rules), revisions)
+	}
+
+	listed, err := repo.ListRevisions(ctx, "tenant1")
+	if err != nil {
+		t.Fatalf("ListRevisions() error = %v", err)
+	}
+	if len(listed) != 2 || listed[0].ID != second.ID || !listed[0].Active || listed[1].Active {
+		t.Errorf("ListRevisions() = %+v", listed)
+	}
+
+	rolledBack, err := repo.Rollback(ctx, "tenant1", "carol")
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if rolledBack.ID != first.ID || ruleSetStore.active["tenant1"].ActivatedBy != "carol" {
+		t.Errorf("Rollback() = %+v, active = %+v", rolledBack, ruleSetStore.active["tenant1"])
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80"}) {
+		t.Errorf("GetRules() after rollback = %v", ruleIDs(rules))
+	}
+
+	if _, err := repo.Rollback(ctx, "tenant1", "carol"); !errors.Is(err, ErrNoPreviousRuleSetRevision) {
+		t.Errorf("Rollback() of the first revision error = %v", err)
+	}
+	if _, err := repo.Rollback(ctx, "tenant2", "carol"); !errors.Is(err, ErrNoActiveRuleSetRevision) {
+		t.Errorf("Rollback() without active revision error = %v", err)
+	}
+	if _, err := repo.ActivateRevision(ctx, "tenant2", first.ID, "carol"); !errors.Is(err, ErrRuleSetRevisionNotFound) {
+		t.Errorf("ActivateRevision() of another tenant's revision error = %v", err)
+	}
+}
+
+func TestVersionedRuleRepository_RollbackFollowsActivations(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestVersionedRuleRepository(t)
+
+	var revisions []*models.RuleSetRevision
+	for _, threshold := range []string{"80", "90", "95"} {
+		revision, err := repo.CreateRevision(ctx, "tenant1", []models.Rule{diskRule("disk_"+threshold, threshold)}, "alice", "")
+		if err != nil {
+			t.Fatalf("CreateRevision() error = %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	// The second revision is never activated, the first is activated twice
+	for _, revision := range []*models.RuleSetRevision{revisions[0], revisions[2], revisions[0], revisions[0], revisions[2]} {
+		if _, err := repo.ActivateRevision(ctx, "tenant1", revision.ID, "alice"); err != nil {
+			t.Fatalf("ActivateRevision() error = %v", err)
+		}
+	}
+
+	for _, want := range []*models.RuleSetRevision{revisions[0], revisions[2], revisions[0]} {
+		rolledBack, err := repo.Rollback(ctx, "tenant1", "bob")
+		if err != nil {
+			t.Fatalf("Rollback() error = %v", err)
+		}
+		if rolledBack.ID != want.ID {
+			t.Errorf("Rollback() activated revision %d, want %d", rolledBack.ID, want.ID)
+		}
+	}
+	if _, err := repo.Rollback(ctx, "tenant1", "bob"); !errors.Is(err, ErrNoPreviousRuleSetRevision) {
+		t.Errorf("Rollback() past the first activation error = %v", err)
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80"}) {
+		t.Errorf("GetRules() after rollbacks = %v", ruleIDs(rules))
+	}
+}
+
+func TestVersionedRuleRepository_RollbackInOneTransaction(t *testing.T) {
+	ctx := context.Background()
+	ruleSetStore := newMemoryRuleSetStore()
+	db := &transactionalDB{}
+	repo, err := NewVersionedRuleRepository(ctx, db.connect, ruleSetStore)
+	if err != nil {
+		t.Fatalf("NewVersionedRuleRepository() error = %v", err)
+	}
+	for _, threshold := range []string{"80", "90"} {
+		revision, err := repo.CreateRevision(ctx, "tenant1", []models.Rule{diskRule("disk_"+threshold, threshold)}, "alice", "")
+		if err != nil {
+			t.Fatalf("CreateRevision() error = %v", err)
+		}
+		if _, err := repo.ActivateRevision(ctx, "tenant1", revision.ID, "alice"); err != nil {
+			t.Fatalf("ActivateRevision() error = %v", err)
+		}
+	}
+
+	// Another instance rolled back, the cache still holds the second revision
+	ruleSetStore.active["tenant1"] = store.ActiveRuleSet{TenantID: "tenant1", RevisionID: 1}
+	ruleSetStore.activations[1].RolledBackAt = pgtype.Timestamp{Valid: true}
+	if _, err := repo.Rollback(ctx, "tenant1", "bob"); !errors.Is(err, ErrNoPreviousRuleSetRevision) {
+		t.Errorf("Rollback() past the first activation error = %v", err)
+	}
+	if len(ruleSetStore.activations) != 2 {
+		t.Errorf("Rollback() recorded an activation: %d", len(ruleSetStore.activations))
+	}
+	tx := db.txs[len(db.txs)-1]
+	if !tx.rolledBack {
+		t.Error("the failed rollback was not rolled back")
+	}
+	for _, method := range []string{"LockActiveRuleSet", "ListRuleSetActivations"} {
+		if ruleSetStore.queriedIn[method] != tx {
+			t.Errorf("%s was not called in the rollback transaction", method)
+		}
+	}
+
+	ruleSetStore.activations[1].RolledBackAt = pgtype.Timestamp{}
+	ruleSetStore.active["tenant1"] = store.ActiveRuleSet{TenantID: "tenant1", RevisionID: 2}
+	rolledBack, err := repo.Rollback(ctx, "tenant1", "bob")
+	if err != nil || rolledBack.ID != 1 {
+		t.Fatalf("Rollback() = %+v, %v", rolledBack, err)
+	}
+	if tx := db.txs[len(db.txs)-1]; !tx.committed || ruleSetStore.queriedIn["LockActiveRuleSet"] != tx {
+		t.Error("the rollback did not lock and commit in one transaction")
+	}
+}
+
+func TestVersionedRuleRepository_RefreshScopesFailuresPerTenant(t *testing.T) {
+	ctx := context.Background()
+	repo, ruleSetStore := newTestVersionedRuleRepository(t)
+	for _, tenantID := range []string{"tenant1", "tenant2"} {
+		revision, err := repo.CreateRevision(ctx, tenantID, []models.Rule{diskRule("disk_80", "80")}, "alice", "")
+		if err != nil {
+			t.Fatalf("CreateRevision() error = %v", err)
+		}
+		if _, err := repo.ActivateRevision(ctx, tenantID, revision.ID, "alice"); err != nil {
+			t.Fatalf("ActivateRevision() error = %v", err)
+		}
+	}
+
+	// Another instance activated an invalid revision of tenant1 and a valid one of tenant2
+	encoded, _ := json.Marshal([]models.Rule{diskRule("disk_90", "")})
+	invalid, _ := ruleSetStore.CreateRuleSetRevision(ctx, nil, store.CreateRuleSetRevisionParams{TenantID: "tenant1", Rules: encoded, Author: "bob"})
+	encoded, _ = json.Marshal([]models.Rule{diskRule("disk_90", "90")})
+	valid, _ := ruleSetStore.CreateRuleSetRevision(ctx, nil, store.CreateRuleSetRevisionParams{TenantID: "tenant2", Rules: encoded, Author: "bob"})
+	ruleSetStore.active["tenant1"] = store.ActiveRuleSet{TenantID: "tenant1", RevisionID: invalid.ID}
+	ruleSetStore.active["tenant2"] = store.ActiveRuleSet{TenantID: "tenant2", RevisionID: valid.ID}
+
+	changed, err := repo.Refresh(ctx)
+	var errs RuleValidationErrors
+	if !changed || !errors.As(err, &errs) || !reflect.DeepEqual(errs.tenantIDs(), []string{"tenant1"}) {
+		t.Fatalf("Refresh() = %v, %v, want a change and the errors of tenant1", changed, err)
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80"}) {
+		t.Errorf("GetRules(tenant1) = %v, want the last good revision", ruleIDs(rules))
+	}
+	if rules, _ := repo.GetRules("tenant2", "disk_space"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_90"}) {
+		t.Errorf("GetRules(tenant2) = %v, want the refreshed revision", ruleIDs(rules))
+	}
+	if changed, err := repo.Refresh(ctx); changed || err != nil {
+		t.Errorf("Refresh() without changes = %v, %v", changed, err)
+	}
+}
+
+func TestVersionedRuleRepository_ActivateInvalidRevision(t *testing.T) {
+	ctx := context.Background()
+	repo, ruleSetStore := newTestVersionedRuleRepository(t)
+	valid, err := repo.CreateRevision(ctx, "tenant1", []models.Rule{diskRule("disk_80", "80")}, "alice", "")
+	if err != nil {
+		t.Fatalf("CreateRevision() error = %v", err)
+	}
+	if _, err := repo.ActivateRevision(ctx, "tenant1", valid.ID, "alice"); err != nil {
+		t.Fatalf("ActivateRevision() error = %v", err)
+	}
+
+	// Stored without CreateRevision, e.g. by a previous version accepting the rules
+	encoded, _ := json.Marshal([]models.Rule{diskRule("disk_90", "")})
+	invalid, _ := ruleSetStore.CreateRuleSetRevision(ctx, nil, store.CreateRuleSetRevisionParams{TenantID: "tenant1", Rules: encoded, Author: "bob"})
+	if _, err := repo.ActivateRevision(ctx, "tenant1", invalid.ID, "bob"); err == nil {
+		t.Fatal("ActivateRevision() of invalid rules expected an error")
+	}
+	if active := ruleSetStore.active["tenant1"]; active.RevisionID != valid.ID || len(ruleSetStore.activations) != 1 {
+		t.Errorf("active revision = %d with %d activations, want %d with 1", active.RevisionID, len(ruleSetStore.activations), valid.ID)
+	}
+	if rules, _ := repo.GetRules("tenant1", "disk_space"); !reflect.DeepEqual(ruleIDs(rules), []string{"disk_80"}) {
+		t.Errorf("GetRules() = %v, want the valid revision", ruleIDs(rules))
+	}
+}
+
+func TestVersionedRuleRepository_CreateRevisionValidation(t *testing.T) {
+	ctx := context.Background()
+	repo, ruleSetStore := newTestVersionedRuleRepository(t)
+
+	tests := []struct {
+		name     string
+		tenantID string
+		rules    []models.Rule
+		author   string
+	}{
+		{name: "missing author", tenantID: "tenant1", rules: []models.Rule{diskRule("disk_80", "80")}},
+		{name: "missing tenant", rules: []models.Rule{diskRule("disk_80", "80")}, author: "alice"},
+		{name: "invalid condition", tenantID: "tenant1", rules: []models.Rule{diskRule("disk_80", "")}, author: "alice"},
+		{name: "duplicate rule_id", tenantID: "tenant1", rules: []models.Rule{diskRule("disk_80", "80"), diskRule("disk_80", "90")}, author: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := repo.CreateRevision(ctx, tt.tenantID, tt.rules, tt.author, ""); err == nil {
+				t.Error("CreateRevision() expected an error")
+			}
+		})
+	}
+	if len(ruleSetStore.revisions) != 0 {
+		t.Errorf("invalid revisions were stored: %d", len(ruleSetStore.revisions))
+	}
+}
+
+func TestGRuleProcessor_EvaluateReportsActiveRevisions(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestVersionedRuleRepository(t)
+	defaults, err := repo.CreateRevision(ctx, DEFAULT_TENANT_RULE_ID, []models.Rule{diskRule("disk_80", "80")}, "alice", "")
+	if err != nil {
+		t.Fatalf("CreateRevision() error = %v", err)
+	}
+	tenant, err := repo.CreateRevision(ctx, "tenant1", []models.Rule{diskRule("disk_50", "50")}, "alice", "")
+	if err != nil {
+		t.Fatalf("CreateRevision() error = %v", err)
+	}
+	for _, revision := range []*models.RuleSetRevision{defaults, tenant} {
+		if _, err := repo.ActivateRevision(ctx, revision.TenantID, revision.ID, "alice"); err != nil {
+			t.Fatalf("ActivateRevision() error = %v", err)
+		}
+	}
+
+	processor, _ := newTestProcessor(t, &FrameworkConfig{}, WithRuleRepository(repo))
+	result, err := processor.EvaluateWithResult(ctx, diskEvent("tenant1", 60))
+	if err != nil {
+		t.Fatalf("EvaluateWithResult() error = %v", err)
+	}
+	if result.ActiveRevisionID != tenant.ID || result.DefaultRevisionID != defaults.ID {
+		t.Errorf("revisions = %d, %d, want %d, %d", result.ActiveRevisionID, result.DefaultRevisionID, tenant.ID, defaults.ID)
+	}
+	if result.HandledByRuleID != "disk_50" {
+		t.Errorf("HandledByRuleID = %q, want disk_50", result.HandledByRuleID)
+	}
+}
@@ -0,0 +1,272 @@
+package rule_processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// WEBHOOK_SIGNATURE_HEADER carries the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+	WEBHOOK_SIGNATURE_HEADER = "X-Rule-Engine-Signature"
+	// WEBHOOK_TIMESTAMP_HEADER carries the unix timestamp the request was signed at.
+	WEBHOOK_TIMESTAMP_HEADER = "X-Rule-Engine-Timestamp"
+
+	DEFAULT_WEBHOOK_TIMEOUT         = 5 * time.Second
+	DEFAULT_WEBHOOK_INITIAL_BACKOFF = 200 * time.Millisecond
+	DEFAULT_WEBHOOK_MAX_BACKOFF     = 5 * time.Second
+)
+
+// WebhookPayload is the JSON document posted to the webhook endpoints when a rule fires.
+type WebhookPayload struct {
+	TenantID  string    `json:"tenant_id"`
+	RuleID    string    `json:"rule_id"`
+	EventType string    `json:"event_type"`
+	Payload   any       `json:"payload"`
+	EventSHA  string    `json:"event_sha"`
+	FiredAt   time.Time `json:"fired_at"`
+}
+
+// WebhookDelivery is the outcome of delivering a WebhookPayload to one endpoint.
+type WebhookDelivery struct {
+	URL        string        `json:"url"`
+	TenantID   string        `json:"tenant_id"`
+	RuleID     string        `json:"rule_id"`
+	EventSHA   string        `json:"event_sha"`
+	Attempts   int           `json:"attempts"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Delivered  bool          `json:"delivered"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// LogWebhookDeliveryRecorder is the default WebhookDeliveryRecorder, it logs failed deliveries.
+type LogWebhookDeliveryRecorder struct{}
+
+// RecordDelivery logs the delivery if it failed.
+func (LogWebhookDeliveryRecorder) RecordDelivery(ctx context.Context, delivery WebhookDelivery) {
+	if !delivery.Delivered {
+		log.Printf("[WebhookActionHandler]: delivery of rule %s for tenant %s to %s failed after %d attempts: %s",
+			delivery.RuleID, delivery.TenantID, delivery.URL, delivery.Attempts, delivery.Error)
+	}
+}
+
+/*
+WebhookActionHandler is the ActionHandler of the webhook action, it posts a
+signed WebhookPayload to the endpoints of the tenant.
+
+Every request carries the WEBHOOK_TIMESTAMP_HEADER and, when the endpoint has
+a secret, the WEBHOOK_SIGNATURE_HEADER so receivers can verify the sender.
+Network errors, 5xx and 429 responses are retried with an exponential backoff
+and jitter, other responses are final. The outcome of each endpoint is handed
+to the WebhookDeliveryRecorder.
+
+The action accepts the optional param url, posting only to the endpoint of
+the tenant with that URL, signed with its own secret. A url that is not one
+of the tenant's endpoints fails the action, rules cannot post elsewhere.
+*/
+type WebhookActionHandler struct {
+	cfg      *WebhookConfig
+	client   *http.Client
+	recorder WebhookDeliveryRecorder
+	sleep    func(ctx context.Context, d time.Duration) error
+	jitter   func(n int64) int64
+	now      func() time.Time
+}
+
+// NewWebhookActionHandler creates a WebhookActionHandler, a nil recorder logs failed deliveries.
+func NewWebhookActionHandler(cfg *WebhookConfig, recorder WebhookDeliveryRecorder) (*WebhookActionHandler, error) {
+	if cfg == nil {
+		return nil, errors.New("webhook config is required")
+	}
+	if cfg.MaxRetries < 0 {
+		return nil, errors.New("webhook max_retries cannot be negative")
+	}
+	if recorder == nil {
+		recorder = LogWebhookDeliveryRecorder{}
+	}
+
+	timeout := DEFAULT_WEBHOOK_TIMEOUT
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	return &WebhookActionHandler{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: timeout},
+		recorder: recorder,
+		sleep:    sleepContext,
+		jitter:   rand.Int63n,
+		now:      time.Now,
+	}, nil
+}
+
+// Handle posts the fired rule to every endpoint and fails if any delivery failed.
+func (h *WebhookActionHandler) Handle(ctx context.Context, req ActionRequest) error {
+	endpoints := h.cfg.EndpointsFor(req.Event.TenantID)
+	if url, ok := req.Action.Params["url"].(string); ok && url != "" {
+		named, err := namedWebhookEndpoint(endpoints, url)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", req.Event.TenantID, err)
+		}
+		endpoints = []WebhookEndpoint{named}
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no webhook endpoints configured for tenant %s", req.Event.TenantID)
+	}
+
+	body, err := json.Marshal(WebhookPayload{
+		TenantID:  req.Event.TenantID,
+		RuleID:    req.Rule.RuleId,
+		EventType: req.Event.Type,
+		Payload:   req.Payload,
+		EventSHA:  ruleDedupSHA(req.Rule, req.Event.EventSHA),
+		FiredAt:   h.now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	var failed []error
+	for _, endpoint := range endpoints {
+		delivery := h.deliver(ctx, endpoint, body)
+		delivery.TenantID = req.Event.TenantID
+		delivery.RuleID = req.Rule.RuleId
+		delivery.EventSHA = ruleDedupSHA(req.Rule, req.Event.EventSHA)
+		h.recorder.RecordDelivery(ctx, delivery)
+		if !delivery.Delivered {
+			failed = append(failed, fmt.Errorf("webhook %s: %s", endpoint.URL, delivery.Error))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// namedWebhookEndpoint returns the endpoint with the URL named by the url param of the action.
+func namedWebhookEndpoint(endpoints []WebhookEndpoint, url string) (WebhookEndpoint, error) {
+	for _, endpoint := range endpoints {
+		if endpoint.URL == url {
+			return endpoint, nil
+		}
+	}
+	return WebhookEndpoint{}, fmt.Errorf("webhook url %s is not a configured endpoint", url)
+}
+
+// deliver posts the body to the endpoint, retrying retryable failures.
+func (h *WebhookActionHandler) deliver(ctx context.Context, endpoint WebhookEndpoint, body []byte) WebhookDelivery {
+	start := h.now()
+	delivery := WebhookDelivery{URL: endpoint.URL}
+
+	for attempt := 0; attempt <= h.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := h.sleep(ctx, h.backoff(attempt)); err != nil {
+				delivery.Error = err.Error()
+				break
+			}
+		}
+		delivery.Attempts++
+
+		statusCode, retryable, err := h.post(ctx, endpoint, body)
+		delivery.StatusCode = statusCode
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+		if !retryable {
+			break
+		}
+	}
+
+	delivery.Duration = h.now().Sub(start)
+	return delivery
+}
+
+// post sends a single signed request and reports whether a failure can be retried.
+func (h *WebhookActionHandler) post(ctx context.Context, endpoint WebhookEndpoint, body []byte) (int, bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	timestamp := strconv.FormatInt(h.now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+	if endpoint.Secret != "" {
+		request.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhookPayload(endpoint.Secret, timestamp, body))
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		// The caller's context ending is final, anything else is a network error worth retrying.
+		return 0, ctx.Err() == nil, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response.StatusCode, false, nil
+	}
+	retryable := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return response.StatusCode, retryable, fmt.Errorf("unexpected status %d", response.StatusCode)
+}
+
+// backoff returns the wait before the given retry: exponential, capped, with equal jitter.
+func (h *WebhookActionHandler) backoff(attempt int) time.Duration {
+	initial := DEFAULT_WEBHOOK_INITIAL_BACKOFF
+	if h.cfg.InitialBackoffMillis > 0 {
+		initial = time.Duration(h.cfg.InitialBackoffMillis) * time.Millisecond
+	}
+	maximum := DEFAULT_WEBHOOK_MAX_BACKOFF
+	if h.cfg.MaxBackoffMillis > 0 {
+		maximum = time.Duration(h.cfg.MaxBackoffMillis) * time.Millisecond
+	}
+
+	wait := initial
+	for i := 1; i < attempt && wait < maximum; i++ {
+		wait *= 2
+	}
+	if wait > maximum {
+		wait = maximum
+	}
+	half := wait / 2
+	return half + time.Duration(h.jitter(int64(half)+1))
+}
+
+/*
+SignWebhookPayload returns the signature of a webhook request.
+
+The signature is the hex encoded HMAC-SHA256, keyed with the endpoint's
+secret, of the timestamp header value, a dot and the raw request body.
+Receivers recompute it to verify the request and use the timestamp to
+reject replays.
+*/
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sleepContext waits for the duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,202 @@
+package rule_processor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type recordingDeliveryRecorder struct {
+	mu         sync.Mutex
+	deliveries []WebhookDelivery
+}
+
+func (r *recordingDeliveryRecorder) RecordDelivery(ctx context.Context, delivery WebhookDelivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, delivery)
+}
+
+// newTestWebhookHandler creates a handler that records its backoffs instead of sleeping.
+func newTestWebhookHandler(t *testing.T, cfg *WebhookConfig) (*WebhookActionHandler, *recordingDeliveryRecorder, *[]time.Duration) {
+	t.Helper()
+	recorder := &recordingDeliveryRecorder{}
+	handler, err := NewWebhookActionHandler(cfg, recorder)
+	if err != nil {
+		t.Fatalf("NewWebhookActionHandler() error = %v", err)
+	}
+	var waits []time.Duration
+	handler.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	handler.jitter = func(n int64) int64 { return 0 }
+	return handler, recorder, &waits
+}
+
+func webhookRequest(tenantID string) ActionRequest {
+	return ActionRequest{
+		Event:   models.BaseEvent[any]{TenantID: tenantID, Type: "disk_space", EventSHA: "abc"},
+		Payload: testUsagePayload{Usage: 91},
+		Rule:    models.Rule{RuleId: "disk_80", IncludeRuleIdInDedupKey: true},
+		Action:  models.RuleAction{Kind: models.ACTION_KIND_WEBHOOK},
+	}
+}
+
+func TestWebhookActionHandler_SignedDelivery(t *testing.T) {
+	var received WebhookPayload
+	var signature, timestamp string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(WEBHOOK_SIGNATURE_HEADER)
+		timestamp = r.Header.Get(WEBHOOK_TIMESTAMP_HEADER)
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler, recorder, _ := newTestWebhookHandler(t, &WebhookConfig{
+		Endpoints: map[string][]WebhookEndpoint{
+			DEFAULT_TENANT_RULE_ID: {{URL: server.URL, Secret: "s3cret"}},
+		},
+	})
+
+	if err := handler.Handle(context.Background(), webhookRequest("tenant1")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	if received.TenantID != "tenant1" || received.RuleID != "disk_80" || received.EventType != "disk_space" {
+		t.Errorf("received payload = %+v", received)
+	}
+	if received.EventSHA != "disk_80:abc" {
+		t.Errorf("EventSHA = %q, want %q", received.EventSHA, "disk_80:abc")
+	}
+	if usage := received.Payload.(map[string]any)["Usage"]; usage != float64(91) {
+		t.Errorf("payload usage = %v, want 91", usage)
+	}
+	if want := SignWebhookPayload("s3cret", timestamp, body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+	if len(recorder.deliveries) != 1 || !recorder.deliveries[0].Delivered || recorder.deliveries[0].Attempts != 1 {
+		t.Errorf("deliveries = %+v", recorder.deliveries)
+	}
+}
+
+func TestWebhookActionHandler_NamedEndpoint(t *testing.T) {
+	var calls sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls.Store(r.URL.Path, SignWebhookPayload("secret"+r.URL.Path, r.Header.Get(WEBHOOK_TIMESTAMP_HEADER), body) == r.Header.Get(WEBHOOK_SIGNATURE_HEADER))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler, _, _ := newTestWebhookHandler(t, &WebhookConfig{
+		Endpoints: map[string][]WebhookEndpoint{"tenant1": {
+			{URL: server.URL + "/a", Secret: "secret/a"},
+			{URL: server.URL + "/b", Secret: "secret/b"},
+		}},
+	})
+
+	// The url param selects one endpoint of the tenant, signed with its own secret
+	req := webhookRequest("tenant1")
+	req.Action.Params = map[string]any{"url": server.URL + "/b"}
+	if err := handler.Handle(context.Background(), req); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if _, ok := calls.Load("/a"); ok {
+		t.Error("posted to /a, want only the named endpoint")
+	}
+	if signed, ok := calls.Load("/b"); !ok || !signed.(bool) {
+		t.Errorf("delivery to /b = %v, %v, want it signed with its secret", signed, ok)
+	}
+
+	// Any other URL is refused, it would receive a payload signed with a tenant's secret
+	req.Action.Params = map[string]any{"url": server.URL + "/elsewhere"}
+	if err := handler.Handle(context.Background(), req); err == nil {
+		t.Error("Handle() expected an error for a url that is not an endpoint of the tenant")
+	}
+	if _, ok := calls.Load("/elsewhere"); ok {
+		t.Error("posted to an unconfigured url")
+	}
+}
+
+func TestWebhookActionHandler_RetriesWithBackoff(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	handler, recorder, waits := newTestWebhookHandler(t, &WebhookConfig{
+		Endpoints:            map[string][]WebhookEndpoint{"tenant1": {{URL: server.URL}}},
+		MaxRetries:           3,
+		InitialBackoffMillis: 100,
+		MaxBackoffMillis:     150,
+	})
+
+	if err := handler.Handle(context.Background(), webhookRequest("tenant1")); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("server called %d times, want 3", calls)
+	}
+	// Zero jitter leaves half of the capped exponential backoff.
+	if want := []time.Duration{50 * time.Millisecond, 75 * time.Millisecond}; len(*waits) != 2 || (*waits)[0] != want[0] || (*waits)[1] != want[1] {
+		t.Errorf("backoffs = %v, want %v", *waits, want)
+	}
+	if delivery := recorder.deliveries[0]; !delivery.Delivered || delivery.Attempts != 3 || delivery.StatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
+
+func TestWebhookActionHandler_Failures(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int
+	}{
+		{name: "retries exhausted", status: http.StatusInternalServerError, wantAttempts: 3},
+		{name: "client error is final", status: http.StatusBadRequest, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			handler, recorder, _ := newTestWebhookHandler(t, &WebhookConfig{
+				Endpoints:  map[string][]WebhookEndpoint{"tenant1": {{URL: server.URL}}},
+				MaxRetries: 2,
+			})
+
+			if err := handler.Handle(context.Background(), webhookRequest("tenant1")); err == nil {
+				t.Error("Handle() expected an error")
+			}
+			delivery := recorder.deliveries[0]
+			if delivery.Delivered || delivery.Attempts != tt.wantAttempts || delivery.StatusCode != tt.status || delivery.Error == "" {
+				t.Errorf("delivery = %+v", delivery)
+			}
+		})
+	}
+
+	handler, _, _ := newTestWebhookHandler(t, &WebhookConfig{})
+	if err := handler.Handle(context.Background(), webhookRequest("tenant1")); err == nil {
+		t.Error("Handle() expected an error without endpoints")
+	}
+}
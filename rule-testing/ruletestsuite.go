@@ -0,0 +1,409 @@
+/*
+Package rule_testing runs declarative regression tests of rule files.
+
+A test suite is a JSON file listing test cases, each giving an event, the
+state of the event store before the event arrives and what the rules are
+expected to do with it:
+
+	{
+	  "rules": "../configs/rules.json",
+	  "cases": [
+	    {
+	      "name": "disk at 85% alerts once",
+	      "tenant_id": "tenant_12",
+	      "event": {"type": "disk_space", "event_sha": "abcd", "payload": {"usage_percentage": 85}},
+	      "prior_state": {"processed_events": [{"rule_id": "disk_space_100_percent_alert"}]},
+	      "expect": {"fired_rule_ids": ["disk_space_80_percent_alert"], "should_handle": true}
+	    }
+	  ]
+	}
+
+The rules path is relative to the suite file. Cases are evaluated as dry
+runs against an in-memory event store, no database is needed and no action
+is dispatched. Only the expectations a case sets are checked.
+
+Suites run from go test with RunSuiteFile and from the command line with
+rulectl test.
+*/
+package rule_testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/SMART2016/go-rule-engine/models"
+	ruleprocessor "github.com/SMART2016/go-rule-engine/rule-processor"
+	"github.com/SMART2016/go-rule-engine/store"
+	"github.com/jackc/pgx/v5/pgtype"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// DEFAULT_TEST_EVENT_SHA is the EventSHA of test events without one, so deduplication can be tested.
+	DEFAULT_TEST_EVENT_SHA = "rule-test-event"
+)
+
+// Suite is a rule test file.
+type Suite struct {
+	Rules        string                    `json:"rules"`                   // Rule file, relative to the suite file
+	PayloadTypes string                    `json:"payload_types,omitempty"` // Optional payload type file, relative to the suite file
+	MatchPolicy  ruleprocessor.MatchPolicy `json:"match_policy,omitempty"`  // Match policy of every case, first-match by default
+	Timezone     string                    `json:"timezone,omitempty"`      // IANA timezone rule schedules are read in, UTC by default
+	Cases        []Case                    `json:"cases"`
+
+	dir string
+}
+
+// Case is a single event evaluated against the rules.
+type Case struct {
+	Name        string                    `json:"name"`
+	TenantID    string                    `json:"tenant_id,omitempty"`    // Overrides the tenant_id of the event
+	MatchPolicy ruleprocessor.MatchPolicy `json:"match_policy,omitempty"` // Overrides the match policy of the suite
+	Event       json.RawMessage           `json:"event"`                  // Event in the format consumed by EventRegistry.ProcessEvent, of a registered event type
+	PriorState  PriorState                `json:"prior_state,omitempty"`
+	Expect      Expectation               `json:"expect"`
+}
+
+// PriorState is the content of the event store, of the windows of aggregation rules and of the partial matches of correlation rules when the event arrives.
+type PriorState struct {
+	ProcessedEvents    []ProcessedEvent   `json:"processed_events,omitempty"`
+	WindowSamples      []WindowSample     `json:"window_samples,omitempty"`
+	CorrelationMatches []CorrelationMatch `json:"correlation_matches,omitempty"`
+}
+
+// ProcessedEvent is an event already handled by a rule, its EventSHA defaults to the one of the case's event.
+type ProcessedEvent struct {
+	RuleID   string `json:"rule_id"`
+	EventSHA string `json:"event_sha,omitempty"`
+}
+
+/*
+WindowSample is an event already recorded in the window of an aggregation
+rule, Key is the value of its group_by field. It occurred when the case's
+event did unless OccurredAt is set, samples are listed oldest first.
+*/
+type WindowSample struct {
+	RuleID     string    `json:"rule_id"`
+	Key        string    `json:"key,omitempty"`
+	Value      float64   `json:"value,omitempty"`
+	OccurredAt time.Time `json:"occurred_at,omitempty"`
+}
+
+/*
+CorrelationMatch is a partial match of the sequence of a correlation rule,
+Key is the value of its join_on field and Step the number of events of the
+sequence matched, the whole sequence unless set. It started when the case's
+event occurred unless StartedAt is set.
+*/
+type CorrelationMatch struct {
+	RuleID    string    `json:"rule_id"`
+	Key       string    `json:"key,omitempty"`
+	Step      int       `json:"step,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+// Expectation is the expected outcome of a case, unset fields are not checked.
+type Expectation struct {
+	FiredRuleIDs           *[]string `json:"fired_rule_ids,omitempty"`
+	HandledRuleIDs         *[]string `json:"handled_rule_ids,omitempty"`
+	DedupSkippedRuleIDs    *[]string `json:"dedup_skipped_rule_ids,omitempty"`
+	ScheduleSkippedRuleIDs *[]string `json:"schedule_skipped_rule_ids,omitempty"`
+	ShouldHandle           *bool     `json:"should_handle,omitempty"`
+}
+
+// CaseResult is the outcome of a case, Diffs lists every unmet expectation.
+type CaseResult struct {
+	Name   string   `json:"name"`
+	Passed bool     `json:"passed"`
+	Diffs  []string `json:"diffs,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Report is the outcome of a suite.
+type Report struct {
+	Cases  []CaseResult `json:"cases"`
+	Passed int          `json:"passed"`
+	Failed int          `json:"failed"`
+}
+
+/*
+LoadSuite reads a rule test file.
+
+Parameters:
+  - path: string - The suite file, the rules and payload type paths in it are relative to its directory.
+
+Returns:
+  - *Suite: The test suite.
+  - error: If the file cannot be read, is not a suite or has no cases.
+*/
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[rule_testing.LoadSuite]: failed to read %s: %w", path, err)
+	}
+	var suite Suite
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&suite); err != nil {
+		return nil, fmt.Errorf("[rule_testing.LoadSuite]: failed to parse %s: %w", path, err)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("[rule_testing.LoadSuite]: %s has no cases", path)
+	}
+	suite.dir = filepath.Dir(path)
+	return &suite, nil
+}
+
+// path resolves a path of the suite relative to the suite file.
+// RulesPath returns the path of the rule file of the suite, empty if it has none.
+func (s *Suite) RulesPath() string {
+	return s.path(s.Rules)
+}
+
+func (s *Suite) path(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.dir, path)
+}
+
+/*
+Run evaluates every case of the suite against the rule file.
+
+Parameters:
+  - ctx: context.Context - A context to manage cancellation and deadlines.
+  - rulesPath: string - Rule file to test instead of the one of the suite, ignored when empty.
+
+Returns:
+  - *Report: The outcome of every case.
+  - error: If the rule file or payload types cannot be loaded, failing cases are reported in the Report.
+*/
+func (s *Suite) Run(ctx context.Context, rulesPath string) (*Report, error) {
+	if rulesPath == "" {
+		rulesPath = s.RulesPath()
+	}
+	if rulesPath == "" {
+		return nil, fmt.Errorf("[rule_testing.Suite.Run]: no rule file to test")
+	}
+	repo, err := ruleprocessor.NewJsonRuleRepository(rulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("[rule_testing.Suite.Run]: %w", err)
+	}
+	payloadTypes, err := ruleprocessor.LoadPayloadTypes(s.path(s.PayloadTypes))
+	if err != nil {
+		return nil, fmt.Errorf("[rule_testing.Suite.Run]: %w", err)
+	}
+
+	report := &Report{}
+	for i, testCase := range s.Cases {
+		if testCase.Name == "" {
+			testCase.Name = fmt.Sprintf("case %d", i+1)
+		}
+		result := s.runCase(ctx, repo, payloadTypes, testCase)
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, result)
+	}
+	return report, nil
+}
+
+// runCase evaluates a case with a processor of its own, so cases do not share event store state.
+func (s *Suite) runCase(ctx context.Context, repo *ruleprocessor.JsonRuleRepository, payloadTypes map[string]reflect.Type, testCase Case) CaseResult {
+	result := CaseResult{Name: testCase.Name}
+	fail := func(err error) CaseResult {
+		result.Error = err.Error()
+		return result
+	}
+
+	event, err := ruleprocessor.DecodeEvent(testCase.Event, payloadTypes)
+	if err != nil {
+		return fail(err)
+	}
+	if testCase.TenantID != "" {
+		event.TenantID = testCase.TenantID
+	}
+	if event.EventSHA == "" {
+		event.EventSHA = DEFAULT_TEST_EVENT_SHA
+	}
+
+	eventStore := ruleprocessor.NewMemoryEventStore()
+	rules, err := repo.GetRules(event.TenantID, event.Type)
+	if err != nil {
+		return fail(err)
+	}
+	for _, processed := range testCase.PriorState.ProcessedEvents {
+		rule, found := findRule(rules, processed.RuleID)
+		if !found {
+			return fail(fmt.Errorf("prior state: rule %s does not apply to tenant %s and event type %s", processed.RuleID, event.TenantID, event.Type))
+		}
+		eventSHA := processed.EventSHA
+		if eventSHA == "" {
+			eventSHA = event.EventSHA
+		}
+		eventStore.MarkProcessed(event.TenantID, event.Type, rule, eventSHA)
+	}
+	windowStore := ruleprocessor.NewMemoryWindowStore()
+	for _, sample := range testCase.PriorState.WindowSamples {
+		if _, found := findRule(rules, sample.RuleID); !found {
+			return fail(fmt.Errorf("prior state: rule %s does not apply to tenant %s and event type %s", sample.RuleID, event.TenantID, event.Type))
+		}
+		occurredAt := sample.OccurredAt
+		if occurredAt.IsZero() {
+			occurredAt = event.OccuredAt
+		}
+		if occurredAt.IsZero() {
+			occurredAt = time.Now()
+		}
+		if err := windowStore.AddWindowSample(ctx, nil, store.AddWindowSampleParams{
+			TenantID: event.TenantID, EventType: event.Type, RuleID: sample.RuleID, GroupKey: sample.Key,
+			Value: sample.Value, OccurredAt: pgtype.Timestamp{Time: occurredAt.UTC(), Valid: true},
+		}); err != nil {
+			return fail(err)
+		}
+	}
+
+	correlationStore := ruleprocessor.NewMemoryCorrelationStore()
+	for _, match := range testCase.PriorState.CorrelationMatches {
+		rule, found := findRule(rules, match.RuleID)
+		if !found || rule.Correlation == nil {
+			return fail(fmt.Errorf("prior state: correlation rule %s does not apply to tenant %s and event type %s", match.RuleID, event.TenantID, event.Type))
+		}
+		step := match.Step
+		if step == 0 {
+			step = len(rule.Correlation.Sequence)
+		}
+		startedAt := match.StartedAt
+		if startedAt.IsZero() {
+			startedAt = event.OccuredAt
+		}
+		if startedAt.IsZero() {
+			startedAt = time.Now()
+		}
+		if err := correlationStore.UpsertCorrelationMatch(ctx, nil, store.UpsertCorrelationMatchParams{
+			TenantID: event.TenantID, RuleID: match.RuleID, JoinKey: match.Key,
+			Step: int32(step), StartedAt: pgtype.Timestamp{Time: startedAt.UTC(), Valid: true},
+		}); err != nil {
+			return fail(err)
+		}
+	}
+
+	policy := testCase.MatchPolicy
+	if policy == "" {
+		policy = s.MatchPolicy
+	}
+	cfg := &ruleprocessor.FrameworkConfig{DefaultMatchPolicy: policy, DefaultTimezone: s.Timezone}
+	if err := cfg.ValidateMatchPolicies(); err != nil {
+		return fail(err)
+	}
+	if err := cfg.ValidateTimezones(); err != nil {
+		return fail(err)
+	}
+	processor, err := ruleprocessor.NewGRuleProcessor(cfg,
+		ruleprocessor.WithRuleRepository(repo),
+		ruleprocessor.WithEventStore(eventStore),
+		ruleprocessor.WithWindowStore(windowStore),
+		ruleprocessor.WithCorrelationStore(correlationStore),
+		ruleprocessor.WithDBConnector(ruleprocessor.NoDBConnector))
+	if err != nil {
+		return fail(err)
+	}
+	defer processor.Close()
+
+	evaluation, err := processor.DryRun(ctx, event, true)
+	if err != nil {
+		return fail(err)
+	}
+	result.Diffs = testCase.Expect.diff(evaluation)
+	result.Passed = len(result.Diffs) == 0
+	return result
+}
+
+// diff describes every expectation the evaluation does not meet.
+func (e Expectation) diff(evaluation *models.EvaluationResult) []string {
+	var diffs []string
+	compare := func(name string, want *[]string, got []string) {
+		if want != nil && !equalIDs(*want, got) {
+			diffs = append(diffs, fmt.Sprintf("%s: want %s, got %s", name, formatIDs(*want), formatIDs(got)))
+		}
+	}
+	compare("fired_rule_ids", e.FiredRuleIDs, evaluation.MatchedRuleIDs)
+	compare("handled_rule_ids", e.HandledRuleIDs, evaluation.HandledRuleIDs)
+	skipped := make([]string, len(evaluation.DedupSkipped))
+	for i, skip := range evaluation.DedupSkipped {
+		skipped[i] = skip.RuleID
+	}
+	compare("dedup_skipped_rule_ids", e.DedupSkippedRuleIDs, skipped)
+	scheduleSkipped := make([]string, len(evaluation.ScheduleSkipped))
+	for i, skip := range evaluation.ScheduleSkipped {
+		scheduleSkipped[i] = skip.RuleID
+	}
+	compare("schedule_skipped_rule_ids", e.ScheduleSkippedRuleIDs, scheduleSkipped)
+	if e.ShouldHandle != nil && *e.ShouldHandle != evaluation.ShouldHandle {
+		diffs = append(diffs, fmt.Sprintf("should_handle: want %t, got %t", *e.ShouldHandle, evaluation.ShouldHandle))
+	}
+	return diffs
+}
+
+func equalIDs(want, got []string) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatIDs(ids []string) string {
+	return "[" + strings.Join(ids, ", ") + "]"
+}
+
+func findRule(rules []models.Rule, ruleID string) (models.Rule, bool) {
+	for _, rule := range rules {
+		if rule.RuleId == ruleID {
+			return rule, true
+		}
+	}
+	return models.Rule{}, false
+}
+
+/*
+RunSuiteFile runs a rule test file from go test, every case is a subtest
+failing with its diffs:
+
+	func TestRules(t *testing.T) {
+		rule_testing.RunSuiteFile(t, "testdata/rules_test.json")
+	}
+*/
+func RunSuiteFile(t *testing.T, path string) {
+	t.Helper()
+	suite, err := LoadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := suite.Run(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range report.Cases {
+		t.Run(result.Name, func(t *testing.T) {
+			if result.Error != "" {
+				t.Fatal(result.Error)
+			}
+			for _, diff := range result.Diffs {
+				t.Error(diff)
+			}
+		})
+	}
+}
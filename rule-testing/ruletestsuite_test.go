@@ -0,0 +1,234 @@
+package rule_testing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SMART2016/go-rule-engine/models"
+)
+
+type diskUsagePayload struct {
+	Usage      int    `json:"usage_percentage"`
+	InstanceID string `json:"instance_id"`
+}
+
+func init() {
+	models.GetEventRegistry().RegisterEventType("disk_space", func() models.Evaluable {
+		return &models.BaseEvent[diskUsagePayload]{}
+	})
+}
+
+const testRules = `{
+  "tenant_default": [
+    {"rule_id": "disk_80", "event_type": "disk_space", "condition": "Payload.Usage >= 80 && Event.ShouldHandle == false", "action": "Event.ShouldHandle = true", "priority": 1, "deduplication": true},
+    {"rule_id": "disk_95", "event_type": "disk_space", "condition": "Payload.Usage >= 95 && Event.ShouldHandle == false", "action": "Event.ShouldHandle = true", "priority": 10, "deduplication": true, "include_rule_id_in_dedup_key": true}
+  ]
+}`
+
+const testSuite = `{
+  "rules": "rules.json",
+  "cases": [
+    {
+      "name": "below every threshold",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "payload": {"usage_percentage": 50, "instance_id": "i-1"}},
+      "expect": {"fired_rule_ids": [], "should_handle": false}
+    },
+    {
+      "name": "the highest priority rule wins",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "event_sha": "i-1", "payload": {"usage_percentage": 97, "instance_id": "i-1"}},
+      "expect": {"fired_rule_ids": ["disk_95"], "handled_rule_ids": ["disk_95"], "should_handle": true}
+    },
+    {
+      "name": "an already processed event is skipped",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "event_sha": "i-1", "payload": {"usage_percentage": 97, "instance_id": "i-1"}},
+      "prior_state": {"processed_events": [{"rule_id": "disk_95"}]},
+      "expect": {"fired_rule_ids": ["disk_80"], "dedup_skipped_rule_ids": ["disk_95"]}
+    },
+    {
+      "name": "all-matching fires every rule",
+      "tenant_id": "tenant1",
+      "match_policy": "all-matching",
+      "event": {"type": "disk_space", "payload": {"usage_percentage": 97, "instance_id": "i-1"}},
+      "expect": {"handled_rule_ids": ["disk_95", "disk_80"]}
+    }
+  ]
+}`
+
+func writeSuite(t *testing.T, suite string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rules.json"), []byte(testRules), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	path := filepath.Join(dir, "rules_test.json")
+	if err := os.WriteFile(path, []byte(suite), 0o600); err != nil {
+		t.Fatalf("failed to write suite: %v", err)
+	}
+	return path
+}
+
+func TestRunSuiteFile(t *testing.T) {
+	RunSuiteFile(t, writeSuite(t, testSuite))
+}
+
+func TestSuite_RunReportsDiffs(t *testing.T) {
+	failing := strings.Replace(testSuite, `"fired_rule_ids": ["disk_95"]`, `"fired_rule_ids": ["disk_80"]`, 1)
+	failing = strings.Replace(failing, `"prior_state": {"processed_events": [{"rule_id": "disk_95"}]}`,
+		`"prior_state": {"processed_events": [{"rule_id": "cpu_90"}]}`, 1)
+	suite, err := LoadSuite(writeSuite(t, failing))
+	if err != nil {
+		t.Fatalf("LoadSuite() error = %v", err)
+	}
+
+	report, err := suite.Run(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Passed != 2 || report.Failed != 2 {
+		t.Fatalf("report = %+v, want 2 passed and 2 failed", report)
+	}
+	if want := []string{"fired_rule_ids: want [disk_80], got [disk_95]"}; !reflect.DeepEqual(report.Cases[1].Diffs, want) {
+		t.Errorf("diffs = %v, want %v", report.Cases[1].Diffs, want)
+	}
+	if !strings.Contains(report.Cases[2].Error, "rule cpu_90 does not apply") {
+		t.Errorf("error = %q, want an unknown prior state rule", report.Cases[2].Error)
+	}
+}
+
+func TestLoadSuite_Errors(t *testing.T) {
+	if _, err := LoadSuite(writeSuite(t, `{"rules": "rules.json", "cases": []}`)); err == nil {
+		t.Error("LoadSuite() expected an error for a suite without cases")
+	}
+	if _, err := LoadSuite(writeSuite(t, `{"rules": "rules.json", "tests": []}`)); err == nil {
+		t.Error("LoadSuite() expected an error for an unknown field")
+	}
+}
+
+func TestRunSuiteFile_Schedules(t *testing.T) {
+	dir := t.TempDir()
+	rules := `{"tenant_default": [
+  {"rule_id": "disk_80", "event_type": "disk_space", "condition": "Payload.Usage >= 80", "action": "Event.ShouldHandle = true",
+   "schedule": {"active": ["* 9-16 * * mon-fri"]}}
+]}`
+	suite := `{
+  "rules": "rules.json",
+  "timezone": "America/New_York",
+  "cases": [
+    {
+      "name": "business hours in New York",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "occured_at": "2026-10-19T14:00:00Z", "payload": {"usage_percentage": 85}},
+      "expect": {"handled_rule_ids": ["disk_80"], "schedule_skipped_rule_ids": []}
+    },
+    {
+      "name": "after hours in New York",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "occured_at": "2026-10-19T22:00:00Z", "payload": {"usage_percentage": 85}},
+      "expect": {"handled_rule_ids": [], "schedule_skipped_rule_ids": ["disk_80"]}
+    }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "rules.json"), []byte(rules), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	path := filepath.Join(dir, "rules_test.json")
+	if err := os.WriteFile(path, []byte(suite), 0o600); err != nil {
+		t.Fatalf("failed to write suite: %v", err)
+	}
+	RunSuiteFile(t, path)
+}
+
+func TestRunSuiteFile_WindowSamples(t *testing.T) {
+	dir := t.TempDir()
+	rules := `{"tenant_default": [
+  {"rule_id": "disk_sustained", "event_type": "disk_space", "condition": "Window.CountAtLeast(80) >= 3", "action": "Event.ShouldHandle = true",
+   "aggregation": {"group_by": "instance_id", "field": "usage_percentage", "size": 5}}
+]}`
+	suite := `{
+  "rules": "rules.json",
+  "cases": [
+    {
+      "name": "a single sample does not alert",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "payload": {"usage_percentage": 85, "instance_id": "i-1"}},
+      "expect": {"handled_rule_ids": []}
+    },
+    {
+      "name": "3 of the last 5 samples alert",
+      "tenant_id": "tenant1",
+      "event": {"type": "disk_space", "payload": {"usage_percentage": 85, "instance_id": "i-1"}},
+      "prior_state": {"window_samples": [
+        {"rule_id": "disk_sustained", "key": "i-1", "value": 90},
+        {"rule_id": "disk_sustained", "key": "i-2", "value": 90},
+        {"rule_id": "disk_sustained", "key": "i-1", "value": 50},
+        {"rule_id": "disk_sustained", "key": "i-1", "value": 80}
+      ]},
+      "expect": {"handled_rule_ids": ["disk_sustained"]}
+    }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "rules.json"), []byte(rules), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	path := filepath.Join(dir, "rules_test.json")
+	if err := os.WriteFile(path, []byte(suite), 0o600); err != nil {
+		t.Fatalf("failed to write suite: %v", err)
+	}
+	RunSuiteFile(t, path)
+}
+
+func TestRunSuiteFile_CorrelationMatches(t *testing.T) {
+	models.GetEventRegistry().RegisterDynamicEventType("service_outage")
+	dir := t.TempDir()
+	rules := `{"tenant_default": [
+  {"rule_id": "disk_then_outage", "event_type": "service_outage", "condition": "true", "action": "Event.ShouldHandle = true",
+   "correlation": {"join_on": "instance_id", "within": "10m", "sequence": [{"event_type": "disk_space", "condition": "Payload.Usage > 90"}]}}
+]}`
+	suite := `{
+  "rules": "rules.json",
+  "cases": [
+    {
+      "name": "an outage alone does not alert",
+      "tenant_id": "tenant1",
+      "event": {"type": "service_outage", "occured_at": "2026-10-19T14:00:00Z", "payload": {"instance_id": "i-1"}},
+      "expect": {"handled_rule_ids": []}
+    },
+    {
+      "name": "an outage after a full disk alerts",
+      "tenant_id": "tenant1",
+      "event": {"type": "service_outage", "occured_at": "2026-10-19T14:00:00Z", "payload": {"instance_id": "i-1"}},
+      "prior_state": {"correlation_matches": [{"rule_id": "disk_then_outage", "key": "i-1", "started_at": "2026-10-19T13:55:00Z"}]},
+      "expect": {"handled_rule_ids": ["disk_then_outage"]}
+    },
+    {
+      "name": "a full disk of another instance does not alert",
+      "tenant_id": "tenant1",
+      "event": {"type": "service_outage", "occured_at": "2026-10-19T14:00:00Z", "payload": {"instance_id": "i-1"}},
+      "prior_state": {"correlation_matches": [{"rule_id": "disk_then_outage", "key": "i-2"}]},
+      "expect": {"handled_rule_ids": []}
+    },
+    {
+      "name": "an expired full disk does not alert",
+      "tenant_id": "tenant1",
+      "event": {"type": "service_outage", "occured_at": "2026-10-19T14:00:00Z", "payload": {"instance_id": "i-1"}},
+      "prior_state": {"correlation_matches": [{"rule_id": "disk_then_outage", "key": "i-1", "started_at": "2026-10-19T13:45:00Z"}]},
+      "expect": {"handled_rule_ids": []}
+    }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "rules.json"), []byte(rules), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	path := filepath.Join(dir, "rules_test.json")
+	if err := os.WriteFile(path, []byte(suite), 0o600); err != nil {
+		t.Fatalf("failed to write suite: %v", err)
+	}
+	RunSuiteFile(t, path)
+}
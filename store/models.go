@@ -8,6 +8,21 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ActiveRuleSet struct {
+	TenantID    string
+	RevisionID  int64
+	ActivatedBy string
+	ActivatedAt pgtype.Timestamp
+}
+
+type CorrelationMatch struct {
+	TenantID  string
+	RuleID    string
+	JoinKey   string
+	Step      int32
+	StartedAt pgtype.Timestamp
+}
+
 type ProcessedEvent struct {
 	ID                          int64
 	TenantID                    string
@@ -18,3 +33,39 @@ type ProcessedEvent struct {
 	OccurredAt                  pgtype.Timestamp
 	ActualEventPersistentceTime pgtype.Timestamp
 }
+
+type Rule struct {
+	TenantID   string
+	RuleID     string
+	EventType  string
+	Definition []byte
+	UpdatedAt  pgtype.Timestamp
+}
+
+type RuleSetActivation struct {
+	ID           int64
+	TenantID     string
+	RevisionID   int64
+	ActivatedBy  string
+	ActivatedAt  pgtype.Timestamp
+	RolledBackAt pgtype.Timestamp
+}
+
+type RuleSetRevision struct {
+	ID        int64
+	TenantID  string
+	Rules     []byte
+	Author    string
+	Comment   string
+	CreatedAt pgtype.Timestamp
+}
+
+type WindowSample struct {
+	ID         int64
+	TenantID   string
+	EventType  string
+	RuleID     string
+	GroupKey   string
+	Value      float64
+	OccurredAt pgtype.Timestamp
+}
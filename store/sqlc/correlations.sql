@@ -0,0 +1,40 @@
+-- name: UpsertCorrelationMatch :exec
+INSERT INTO correlation_matches (tenant_id, rule_id, join_key, step, started_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (tenant_id, rule_id, join_key, step)
+    DO UPDATE SET started_at = GREATEST(correlation_matches.started_at, EXCLUDED.started_at);
+
+-- name: ListCorrelationMatches :many
+SELECT tenant_id, rule_id, join_key, step, started_at
+FROM correlation_matches
+WHERE tenant_id = $1
+  AND rule_id = $2
+  AND join_key = $3
+  AND started_at >= $4
+ORDER BY step;
+
+-- name: ExpireCorrelationMatches :exec
+DELETE FROM correlation_matches
+WHERE tenant_id = $1
+  AND rule_id = $2
+  AND join_key = $3
+  AND started_at < $4;
+
+-- name: DeleteCorrelationMatches :exec
+DELETE FROM correlation_matches
+WHERE tenant_id = $1
+  AND rule_id = $2
+  AND join_key = $3;
+
+-- name: ClaimCorrelationMatch :execrows
+-- Removes the completed match of a join key, at most one of concurrent events completing the sequence claims it.
+DELETE FROM correlation_matches
+WHERE tenant_id = $1
+  AND rule_id = $2
+  AND join_key = $3
+  AND step = $4
+  AND started_at >= $5;
+
+-- name: LockCorrelation :exec
+-- Serializes the updates of the partial matches of a join key until the end of the transaction.
+SELECT pg_advisory_xact_lock(hashtextextended(@tenant_id::text || '/' || @rule_id::text || '/' || @join_key::text, 0));
@@ -0,0 +1,34 @@
+-- name: ListRules :many
+SELECT tenant_id, rule_id, event_type, definition, updated_at
+FROM rules
+ORDER BY tenant_id, rule_id, event_type;
+
+-- name: UpsertRule :exec
+INSERT INTO rules (tenant_id, rule_id, event_type, definition, updated_at)
+VALUES ($1, $2, $3, $4, NOW())
+    ON CONFLICT (tenant_id, rule_id, event_type) DO UPDATE
+    SET definition = EXCLUDED.definition,
+        updated_at = NOW();
+
+-- name: DeleteRule :exec
+DELETE FROM rules
+WHERE tenant_id = $1
+  AND rule_id = $2
+  AND event_type = $3;
+
+-- name: DeleteRuleByID :execrows
+-- Removes a rule_id of a tenant under every event type it is stored under.
+DELETE FROM rules
+WHERE tenant_id = $1
+  AND rule_id = $2;
+
+-- name: LockRule :exec
+-- Serializes the writes of a rule_id of a tenant until the end of the transaction.
+SELECT pg_advisory_xact_lock(hashtextextended(@tenant_id::text || '/' || @rule_id::text, 0));
+
+-- name: ListRuleEventTypes :many
+SELECT event_type
+FROM rules
+WHERE tenant_id = $1
+  AND rule_id = $2
+ORDER BY event_type;
@@ -0,0 +1,55 @@
+-- name: CreateRuleSetRevision :one
+INSERT INTO rule_set_revisions (tenant_id, rules, author, comment, created_at)
+VALUES ($1, $2, $3, $4, NOW())
+    RETURNING id, tenant_id, rules, author, comment, created_at;
+
+-- name: GetRuleSetRevision :one
+SELECT id, tenant_id, rules, author, comment, created_at
+FROM rule_set_revisions
+WHERE tenant_id = $1
+  AND id = $2;
+
+-- name: ListRuleSetRevisions :many
+SELECT id, tenant_id, rules, author, comment, created_at
+FROM rule_set_revisions
+WHERE tenant_id = $1
+ORDER BY id DESC;
+
+-- name: ActivateRuleSetRevision :exec
+INSERT INTO active_rule_sets (tenant_id, revision_id, activated_by, activated_at)
+VALUES ($1, $2, $3, NOW())
+    ON CONFLICT (tenant_id) DO UPDATE
+    SET revision_id = EXCLUDED.revision_id,
+        activated_by = EXCLUDED.activated_by,
+        activated_at = NOW();
+
+-- name: CreateRuleSetActivation :exec
+INSERT INTO rule_set_activations (tenant_id, revision_id, activated_by, activated_at)
+VALUES ($1, $2, $3, NOW());
+
+-- name: ListRuleSetActivations :many
+SELECT id, tenant_id, revision_id, activated_by, activated_at, rolled_back_at
+FROM rule_set_activations
+WHERE tenant_id = $1
+  AND rolled_back_at IS NULL
+ORDER BY id DESC;
+
+-- name: LockActiveRuleSet :one
+-- Locks the active rule set of a tenant until the end of the transaction and returns its revision.
+SELECT revision_id
+FROM active_rule_sets
+WHERE tenant_id = $1
+    FOR UPDATE;
+
+-- name: RollBackRuleSetActivations :exec
+UPDATE rule_set_activations
+SET rolled_back_at = NOW()
+WHERE tenant_id = $1
+  AND id > $2
+  AND rolled_back_at IS NULL;
+
+-- name: ListActiveRuleSets :many
+SELECT active_rule_sets.tenant_id, active_rule_sets.revision_id, rule_set_revisions.rules
+FROM active_rule_sets
+         JOIN rule_set_revisions ON rule_set_revisions.id = active_rule_sets.revision_id
+ORDER BY active_rule_sets.tenant_id;
@@ -26,6 +26,75 @@ ALTER TABLE processed_events SET (
     );
 
 
+-- Rules of every tenant, shared by all engine instances.
+-- definition holds the JSON encoded rule, rule_id and event_type are kept in sync with it.
+CREATE TABLE IF NOT EXISTS rules (
+                                     tenant_id VARCHAR(255) NOT NULL,
+                                     rule_id VARCHAR(255) NOT NULL,
+                                     event_type VARCHAR(255) NOT NULL,
+                                     definition jsonb NOT NULL,
+                                     updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                     PRIMARY KEY (tenant_id, rule_id, event_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rules_updated_at ON rules (updated_at DESC);
+
+-- Immutable revisions of the rule set of each tenant.
+CREATE TABLE IF NOT EXISTS rule_set_revisions (
+                                                  id BIGSERIAL PRIMARY KEY,
+                                                  tenant_id VARCHAR(255) NOT NULL,
+                                                  rules jsonb NOT NULL,
+                                                  author VARCHAR(255) NOT NULL,
+                                                  comment TEXT NOT NULL DEFAULT '',
+                                                  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rule_set_revisions_tenant ON rule_set_revisions (tenant_id, id DESC);
+
+-- The revision of the rule set in use for each tenant.
+CREATE TABLE IF NOT EXISTS active_rule_sets (
+                                                tenant_id VARCHAR(255) PRIMARY KEY,
+                                                revision_id BIGINT NOT NULL REFERENCES rule_set_revisions (id),
+                                                activated_by VARCHAR(255) NOT NULL,
+                                                activated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Every activation of a revision, rolled_back_at is set once a rollback undid it.
+CREATE TABLE IF NOT EXISTS rule_set_activations (
+                                                    id BIGSERIAL PRIMARY KEY,
+                                                    tenant_id VARCHAR(255) NOT NULL,
+                                                    revision_id BIGINT NOT NULL REFERENCES rule_set_revisions (id),
+                                                    activated_by VARCHAR(255) NOT NULL,
+                                                    activated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                                    rolled_back_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rule_set_activations_tenant ON rule_set_activations (tenant_id, id DESC);
+
+-- Samples of the sliding windows of aggregation rules, one row per event, rule and group.
+CREATE TABLE IF NOT EXISTS window_samples (
+                                              id BIGSERIAL PRIMARY KEY,
+                                              tenant_id VARCHAR(255) NOT NULL,
+                                              event_type VARCHAR(255) NOT NULL,
+                                              rule_id VARCHAR(255) NOT NULL,
+                                              group_key VARCHAR(255) NOT NULL,
+                                              value DOUBLE PRECISION NOT NULL DEFAULT 0,
+                                              occurred_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_window_samples_group ON window_samples (tenant_id, event_type, rule_id, group_key, occurred_at DESC);
+
+-- Partial matches of the sequences of correlation rules, step is the number of events of the sequence matched.
+-- started_at is the time the first event of the sequence occurred, the latest one when several partial matches reach a step.
+CREATE TABLE IF NOT EXISTS correlation_matches (
+                                                   tenant_id VARCHAR(255) NOT NULL,
+                                                   rule_id VARCHAR(255) NOT NULL,
+                                                   join_key VARCHAR(255) NOT NULL,
+                                                   step INTEGER NOT NULL,
+                                                   started_at TIMESTAMP NOT NULL,
+                                                   PRIMARY KEY (tenant_id, rule_id, join_key, step)
+);
+
 --CREATE EXTENSION IF NOT EXISTS pg_cron;
 
 commit ;
@@ -0,0 +1,29 @@
+-- name: AddWindowSample :exec
+INSERT INTO window_samples (tenant_id, event_type, rule_id, group_key, value, occurred_at)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ListWindowSamples :many
+SELECT id, tenant_id, event_type, rule_id, group_key, value, occurred_at
+FROM window_samples
+WHERE tenant_id = $1
+  AND event_type = $2
+  AND rule_id = $3
+  AND group_key = $4
+  AND occurred_at >= $5
+ORDER BY occurred_at DESC, id DESC
+    LIMIT $6;
+
+-- name: TrimWindowSamples :exec
+DELETE FROM window_samples
+WHERE tenant_id = $1
+  AND event_type = $2
+  AND rule_id = $3
+  AND group_key = $4
+  AND (occurred_at < $5 OR id NOT IN (
+      SELECT id FROM window_samples
+      WHERE tenant_id = $1
+        AND event_type = $2
+        AND rule_id = $3
+        AND group_key = $4
+      ORDER BY occurred_at DESC, id DESC
+          LIMIT $6));